@@ -39,6 +39,7 @@ import (
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/metrics"
+	lru "github.com/hashicorp/golang-lru"
 	"github.com/holisticode/swarm/chunk"
 	"github.com/holisticode/swarm/contracts/ens"
 	"github.com/holisticode/swarm/log"
@@ -74,6 +75,7 @@ var (
 	apiAppendFileCount     = metrics.NewRegisteredCounter("api/appendfile/count", nil)
 	apiAppendFileFail      = metrics.NewRegisteredCounter("api/appendfile/fail", nil)
 	apiGetInvalid          = metrics.NewRegisteredCounter("api/get/invalid", nil)
+	apiResolveCacheHit     = metrics.NewRegisteredCounter("api/resolve/cache/hit", nil)
 )
 
 // ResolverFunc is function which takes a domain in the form of a string and resolves it to a content hash
@@ -87,6 +89,81 @@ type Resolver interface {
 	Resolve(string) (common.Hash, error)
 }
 
+// FallbackResolver tries its Resolvers in order and returns the
+// resolution from the first one which does not return an error.
+type FallbackResolver []Resolver
+
+// NewFallbackResolver creates a FallbackResolver from the provided resolvers.
+func NewFallbackResolver(resolvers ...Resolver) FallbackResolver {
+	return FallbackResolver(resolvers)
+}
+
+// Resolve resolves the domain with each Resolver in sequence until one succeeds.
+// If all of them fail, the error of the last one is returned.
+func (f FallbackResolver) Resolve(domain string) (h common.Hash, err error) {
+	if len(f) == 0 {
+		return h, errors.New("no resolver configured")
+	}
+	for _, r := range f {
+		h, err = r.Resolve(domain)
+		if err == nil {
+			return h, nil
+		}
+	}
+	return h, err
+}
+
+// CachingResolver caches the resolutions of its Resolver for a period of time,
+// so that repeated lookups of the same name do not hit the resolver backend.
+// Failed resolutions are not cached.
+type CachingResolver struct {
+	resolver Resolver
+	ttl      time.Duration
+	cache    *lru.Cache
+}
+
+// cachedResolution is a resolved hash with the time until it can be used
+type cachedResolution struct {
+	hash    common.Hash
+	expires time.Time
+}
+
+// NewCachingResolver creates a CachingResolver in front of the provided resolver
+// which keeps the resolutions of at most size names for ttl.
+func NewCachingResolver(r Resolver, size int, ttl time.Duration) (*CachingResolver, error) {
+	cache, err := lru.New(size)
+	if err != nil {
+		return nil, err
+	}
+	return &CachingResolver{
+		resolver: r,
+		ttl:      ttl,
+		cache:    cache,
+	}, nil
+}
+
+// Resolve returns the cached resolution of the domain if it has not expired,
+// otherwise it resolves the domain with the Resolver and caches the result.
+func (c *CachingResolver) Resolve(domain string) (common.Hash, error) {
+	if v, ok := c.cache.Get(domain); ok {
+		r := v.(cachedResolution)
+		if time.Now().Before(r.expires) {
+			apiResolveCacheHit.Inc(1)
+			return r.hash, nil
+		}
+		c.cache.Remove(domain)
+	}
+	h, err := c.resolver.Resolve(domain)
+	if err != nil {
+		return h, err
+	}
+	c.cache.Add(domain, cachedResolution{
+		hash:    h,
+		expires: time.Now().Add(c.ttl),
+	})
+	return h, nil
+}
+
 // ResolveValidator is used to validate the contained Resolver
 type ResolveValidator interface {
 	Resolver
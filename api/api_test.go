@@ -28,6 +28,7 @@ import (
 	"os"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
@@ -347,6 +348,20 @@ func TestRNSResolve(t *testing.T) {
 			content:     resolvedContent,
 			expectedErr: rns.ErrNoContent,
 		},
+		{
+			desc:        "failover to the next RNS endpoint",
+			rns:         NewFallbackResolver(doesntResolve, doesResolve),
+			addr:        rnsAddr,
+			content:     resolvedContent,
+			expectedErr: nil,
+		},
+		{
+			desc:        "all RNS endpoints fail",
+			rns:         NewFallbackResolver(doesntResolve, doesntResolve),
+			addr:        rnsAddr,
+			content:     resolvedContent,
+			expectedErr: rns.ErrNoContent,
+		},
 	}
 
 	for _, x := range tests {
@@ -497,6 +512,56 @@ func TestMultiResolver(t *testing.T) {
 	}
 }
 
+// TestCachingResolver checks that resolutions are served from the cache within
+// the TTL, and that expired and failed resolutions are resolved again.
+func TestCachingResolver(t *testing.T) {
+	hash := common.HexToHash("0x2222222222222222222222222222222222222222222222222222222222222222")
+	var calls int
+	fail := false
+	backend := ResolverFunc(func(domain string) (common.Hash, error) {
+		calls++
+		if fail {
+			return common.Hash{}, errors.New("resolve failure")
+		}
+		return hash, nil
+	})
+
+	ttl := 100 * time.Millisecond
+	r, err := NewCachingResolver(backend, 10, ttl)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		h, err := r.Resolve("swarm.eth")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if h != hash {
+			t.Fatalf("expected %x, got %x", hash, h)
+		}
+	}
+	if calls != 1 {
+		t.Fatalf("expected 1 backend call within ttl, got %d", calls)
+	}
+
+	time.Sleep(ttl)
+	fail = true
+	if _, err := r.Resolve("swarm.eth"); err == nil {
+		t.Fatal("expected the expired resolution to be resolved again")
+	}
+	if _, err := r.Resolve("swarm.eth"); err == nil {
+		t.Fatal("expected the failed resolution not to be cached")
+	}
+	if calls != 3 {
+		t.Fatalf("expected 3 backend calls, got %d", calls)
+	}
+
+	if _, err := NewCachingResolver(backend, 0, ttl); err == nil {
+		t.Fatal("expected error for zero cache size")
+	}
+}
+
 func TestDecryptOriginForbidden(t *testing.T) {
 	ctx := context.TODO()
 	ctx = sctx.SetHost(ctx, "swarm-gateways.net")
@@ -18,9 +18,14 @@ package api
 
 import (
 	"crypto/ecdsa"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
+	"strconv"
+	"time"
+	"unicode"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
@@ -29,9 +34,11 @@ import (
 	"github.com/ethereum/go-ethereum/p2p/enode"
 	"github.com/holisticode/swarm/contracts/ens"
 	"github.com/holisticode/swarm/network"
+	"github.com/holisticode/swarm/network/timeouts"
 	"github.com/holisticode/swarm/pss"
 	"github.com/holisticode/swarm/storage"
 	"github.com/holisticode/swarm/swap"
+	"github.com/naoina/toml"
 )
 
 const (
@@ -39,6 +46,13 @@ const (
 	DefaultHTTPPort       = "8500"
 )
 
+const (
+	// DefaultResolverCacheSize is the default number of names whose ENS/RNS resolutions are cached
+	DefaultResolverCacheSize = 1000
+	// DefaultResolverCacheTTL is the default period for which ENS/RNS resolutions are cached
+	DefaultResolverCacheTTL = time.Minute
+)
+
 // separate bzz directories
 // allow several bzz nodes running in parallel
 type Config struct {
@@ -51,6 +65,13 @@ type Config struct {
 	CacheCapacity uint
 	BaseKey       []byte
 
+	// ChunkDataPaths are the paths, e.g. on different disks, chunk data is sharded across
+	// by address prefix. Indexes stay in ChunkDbPath. If empty, chunk data is kept there too.
+	ChunkDataPaths []string
+
+	// NetStore
+	FetchersCapacity int // maximum number of fetchers for chunks being retrieved
+
 	// Swap configs
 	SwapBackendURL          string         // Ethereum API endpoint
 	SwapEnabled             bool           // whether SWAP incentives are enabled
@@ -68,7 +89,8 @@ type Config struct {
 	Pss                *pss.Params
 	EnsRoot            common.Address
 	EnsAPIs            []string
-	RnsAPI             string
+	RnsAPI             string // deprecated, use RnsAPIs
+	RnsAPIs            []string
 	Path               string
 	ListenAddr         string
 	Port               string
@@ -86,12 +108,26 @@ type Config struct {
 	BzzAccount         string
 	GlobalStoreAPI     string
 	privateKey         *ecdsa.PrivateKey
+
+	// DisabledStreamProviders are the names of the stream providers
+	// which are not started, like SYNC for pull syncing
+	DisabledStreamProviders []string
+
+	// DeliveryAckTimeout is the time to wait for peers to acknowledge
+	// synced chunks before delivering them again
+	DeliveryAckTimeout time.Duration
+
+	// ENS/RNS resolutions are cached for ResolverCacheTTL, for at most
+	// ResolverCacheSize names. A zero ResolverCacheTTL disables the cache.
+	ResolverCacheSize int
+	ResolverCacheTTL  time.Duration
 }
 
 //NewConfig creates a default config with all parameters to set to defaults
 func NewConfig() *Config {
 	return &Config{
 		FileStoreParams:         storage.NewFileStoreParams(),
+		FetchersCapacity:        storage.DefaultFetchersCapacity,
 		SwapBackendURL:          "",
 		SwapEnabled:             false,
 		SwapSkipDeposit:         false,
@@ -105,6 +141,7 @@ func NewConfig() *Config {
 		EnsRoot:                 ens.Address,
 		EnsAPIs:                 nil,
 		RnsAPI:                  "",
+		RnsAPIs:                 nil,
 		Path:                    node.DefaultDataDir(),
 		ListenAddr:              DefaultHTTPListenAddr,
 		Port:                    DefaultHTTPPort,
@@ -112,12 +149,59 @@ func NewConfig() *Config {
 		SyncEnabled:             true,
 		PushSyncEnabled:         true,
 		EnablePinning:           false,
+		ResolverCacheSize:       DefaultResolverCacheSize,
+		ResolverCacheTTL:        DefaultResolverCacheTTL,
+		DeliveryAckTimeout:      timeouts.DeliveryAckTimeout,
+	}
+}
+
+// TOMLSettings ensure that TOML keys use the same names as Go struct fields
+// and that unknown keys are reported instead of being silently ignored.
+// They are used to load and dump the configuration of the swarm node.
+var TOMLSettings = toml.Config{
+	NormFieldName: func(rt reflect.Type, key string) string {
+		return key
+	},
+	FieldToKey: func(rt reflect.Type, field string) string {
+		return field
+	},
+	MissingField: func(rt reflect.Type, field string) error {
+		link := ""
+		if unicode.IsUpper(rune(rt.Name()[0])) && rt.PkgPath() != "main" {
+			link = ", check github.com/holisticode/swarm/api/config.go for available fields"
+		}
+		return fmt.Errorf("field '%s' is not defined in %s%s", field, rt.String(), link)
+	},
+}
+
+// LoadConfig reads the TOML file at path and overlays it onto the defaults
+// returned by NewConfig. Entries not present in the file keep their default value.
+// The private key and the Enode are not loaded and are set later by Init.
+func LoadConfig(path string) (*Config, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	c := NewConfig()
+	err = TOMLSettings.NewDecoder(f).Decode(c)
+	if err != nil {
+		// Add file name to errors that have a line number.
+		if _, ok := err.(*toml.LineError); ok {
+			err = errors.New(path + ", " + err.Error())
+		}
+		return nil, err
 	}
+	return c, nil
 }
 
 //some config params need to be initialized after the complete
 //config building phase is completed (e.g. due to overriding flags)
 func (c *Config) Init(prvKey *ecdsa.PrivateKey, nodeKey *ecdsa.PrivateKey) error {
+	if err := c.Validate(); err != nil {
+		return err
+	}
 
 	// create swarm dir and record key
 	err := c.createAndSetPath(c.Path, prvKey)
@@ -143,10 +227,42 @@ func (c *Config) Init(prvKey *ecdsa.PrivateKey, nodeKey *ecdsa.PrivateKey) error
 	c.ChunkDbPath = filepath.Join(c.Path, "chunks")
 	c.BaseKey = common.FromHex(c.BzzKey)
 
+	// preserve backward compatibility with the single RnsAPI endpoint
+	if c.RnsAPI != "" && !containsString(c.RnsAPIs, c.RnsAPI) {
+		c.RnsAPIs = append([]string{c.RnsAPI}, c.RnsAPIs...)
+	}
+
 	c.Pss = c.Pss.WithPrivateKey(c.privateKey)
 	return nil
 }
 
+// Validate checks the invariants between interdependent config fields
+// and returns an error naming the offending field if any of them is violated.
+func (c *Config) Validate() error {
+	if c.SwapEnabled && c.SwapPaymentThreshold >= c.SwapDisconnectThreshold {
+		return fmt.Errorf("invalid config: SwapPaymentThreshold (%d) must be less than SwapDisconnectThreshold (%d)", c.SwapPaymentThreshold, c.SwapDisconnectThreshold)
+	}
+	// an empty port is allowed, the OS will allocate one when the HTTP proxy starts
+	if c.Port != "" {
+		if _, err := strconv.ParseUint(c.Port, 10, 16); err != nil {
+			return fmt.Errorf("invalid config: Port %q is not a valid port number", c.Port)
+		}
+	}
+	if c.LightNodeEnabled && c.BootnodeMode {
+		return fmt.Errorf("invalid config: LightNodeEnabled and BootnodeMode cannot both be set")
+	}
+	if c.NetworkID == 0 {
+		return fmt.Errorf("invalid config: NetworkID must not be 0")
+	}
+	if c.ResolverCacheTTL > 0 && c.ResolverCacheSize <= 0 {
+		return fmt.Errorf("invalid config: ResolverCacheSize (%d) must be positive when ResolverCacheTTL is set", c.ResolverCacheSize)
+	}
+	if c.DeliveryAckTimeout <= 0 {
+		return fmt.Errorf("invalid config: DeliveryAckTimeout (%s) must be positive", c.DeliveryAckTimeout)
+	}
+	return nil
+}
+
 func (c *Config) ShiftPrivateKey() (privKey *ecdsa.PrivateKey) {
 	if c.privateKey != nil {
 		privKey = c.privateKey
@@ -176,3 +292,12 @@ func (c *Config) createAndSetPath(datadirPath string, prvKey *ecdsa.PrivateKey)
 	c.Path = bzzdirPath
 	return nil
 }
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
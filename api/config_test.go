@@ -17,6 +17,9 @@
 package api
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
 
@@ -63,3 +66,153 @@ func TestConfig(t *testing.T) {
 		t.Fatal("Failed to correctly initialize StoreParams")
 	}
 }
+
+func TestConfigValidate(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		mutate  func(c *Config)
+		wantErr bool
+	}{
+		{
+			name:   "default",
+			mutate: func(c *Config) {},
+		},
+		{
+			name:   "empty port",
+			mutate: func(c *Config) { c.Port = "" },
+		},
+		{
+			name: "swap thresholds",
+			mutate: func(c *Config) {
+				c.SwapEnabled = true
+				c.SwapPaymentThreshold = c.SwapDisconnectThreshold
+			},
+			wantErr: true,
+		},
+		{
+			name:    "non numeric port",
+			mutate:  func(c *Config) { c.Port = "http" },
+			wantErr: true,
+		},
+		{
+			name:    "port out of range",
+			mutate:  func(c *Config) { c.Port = "65536" },
+			wantErr: true,
+		},
+		{
+			name: "light node and bootnode",
+			mutate: func(c *Config) {
+				c.LightNodeEnabled = true
+				c.BootnodeMode = true
+			},
+			wantErr: true,
+		},
+		{
+			name:    "zero network id",
+			mutate:  func(c *Config) { c.NetworkID = 0 },
+			wantErr: true,
+		},
+		{
+			name: "resolver cache disabled",
+			mutate: func(c *Config) {
+				c.ResolverCacheTTL = 0
+				c.ResolverCacheSize = 0
+			},
+		},
+		{
+			name:    "zero resolver cache size",
+			mutate:  func(c *Config) { c.ResolverCacheSize = 0 },
+			wantErr: true,
+		},
+		{
+			name:    "zero delivery ack timeout",
+			mutate:  func(c *Config) { c.DeliveryAckTimeout = 0 },
+			wantErr: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := NewConfig()
+			tc.mutate(c)
+			err := c.Validate()
+			if tc.wantErr && err == nil {
+				t.Fatal("expected error, got nil")
+			}
+			if !tc.wantErr && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "swarm-config-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "config.toml")
+	data := `
+NetworkID = 42
+Port = "8588"
+EnsAPIs = ["http://localhost:8545"]
+`
+	if err := ioutil.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.NetworkID != 42 {
+		t.Fatalf("expected NetworkID 42, got %d", c.NetworkID)
+	}
+	if c.Port != "8588" {
+		t.Fatalf("expected Port 8588, got %s", c.Port)
+	}
+	if len(c.EnsAPIs) != 1 || c.EnsAPIs[0] != "http://localhost:8545" {
+		t.Fatalf("unexpected EnsAPIs %v", c.EnsAPIs)
+	}
+	// values not present in the file keep their defaults
+	if c.ListenAddr != DefaultHTTPListenAddr {
+		t.Fatalf("expected default ListenAddr %s, got %s", DefaultHTTPListenAddr, c.ListenAddr)
+	}
+	if c.Enode != nil {
+		t.Fatal("expected Enode not to be set")
+	}
+
+	if err := ioutil.WriteFile(path, []byte("NetworkId = 42\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadConfig(path); err == nil {
+		t.Fatal("expected error for unknown key")
+	}
+}
+
+func TestConfigRnsAPIBackwardCompatibility(t *testing.T) {
+	prvkey, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	nodekey, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "swarm-config-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	c := NewConfig()
+	c.Path = dir
+	c.RnsAPI = "http://rns.one"
+	c.RnsAPIs = []string{"http://rns.two"}
+	if err := c.Init(prvkey, nodekey); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(c.RnsAPIs, []string{"http://rns.one", "http://rns.two"}) {
+		t.Fatalf("unexpected RnsAPIs %v", c.RnsAPIs)
+	}
+}
@@ -19,6 +19,7 @@ package api
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"strings"
 	"time"
@@ -34,6 +35,9 @@ import (
 
 const InspectorIsPullSyncingTolerance = 15 * time.Second
 
+// InspectorResyncBinTimeout is the max time ResyncBin waits for the bin to be synced again
+const InspectorResyncBinTimeout = 5 * time.Minute
+
 type Inspector struct {
 	api      *API
 	hive     *network.Hive
@@ -56,6 +60,95 @@ func (i *Inspector) KademliaInfo() network.KademliaInfo {
 	return i.hive.KademliaInfo()
 }
 
+// BinStat holds the number of connected peers and known addresses in a proximity bin
+type BinStat struct {
+	Bin       int `json:"bin"`
+	Connected int `json:"connected"`
+	Known     int `json:"known"`
+}
+
+// BinStats holds the per bin peer counts of the kademlia table and its depth
+type BinStats struct {
+	Depth int       `json:"depth"`
+	Bins  []BinStat `json:"bins"`
+}
+
+// BinStats returns the number of connected peers and known addresses
+// for each proximity bin, together with the current depth, as JSON
+func (i *Inspector) BinStats() (string, error) {
+	maxBin := i.hive.MaxProxDisplay
+	stats := BinStats{
+		Depth: i.hive.NeighbourhoodDepth(),
+		Bins:  make([]BinStat, maxBin),
+	}
+	for po := range stats.Bins {
+		stats.Bins[po].Bin = po
+	}
+	// bins deeper than the displayed rows are accounted in the last one
+	bin := func(po int) int {
+		if po >= maxBin {
+			return maxBin - 1
+		}
+		return po
+	}
+	i.hive.EachConn(nil, 255, func(_ *network.Peer, po int) bool {
+		stats.Bins[bin(po)].Connected++
+		return true
+	})
+	i.hive.EachAddr(nil, 255, func(_ *network.BzzAddr, po int) bool {
+		stats.Bins[bin(po)].Known++
+		return true
+	})
+	v, err := json.Marshal(stats)
+	if err != nil {
+		return "", err
+	}
+	return string(v), nil
+}
+
+// CapabilityHealth returns the health of the connections for each
+// registered capability index, keyed by the capability index name
+func (i *Inspector) CapabilityHealth() (map[string]bool, error) {
+	health := make(map[string]bool)
+	for _, capKey := range i.hive.CapabilityKeys() {
+		healthy, err := i.hive.Kademlia.CapabilityHealth(capKey)
+		if err != nil {
+			return nil, err
+		}
+		health[capKey] = healthy
+	}
+	return health, nil
+}
+
+// FetcherInfo describes a chunk the node is currently trying to fetch
+type FetcherInfo struct {
+	Ref               string        `json:"ref"`
+	CreatedBy         string        `json:"createdBy"`
+	CreatedAt         time.Time     `json:"createdAt"`
+	Age               time.Duration `json:"age"`
+	RequestedBySyncer bool          `json:"requestedBySyncer"`
+}
+
+// ActiveFetchers returns the in-flight fetchers of the NetStore as JSON
+func (i *Inspector) ActiveFetchers() (string, error) {
+	fetchers := []FetcherInfo{}
+	i.netStore.EachFetcher(func(ref string, f *storage.Fetcher) bool {
+		fetchers = append(fetchers, FetcherInfo{
+			Ref:               ref,
+			CreatedBy:         f.CreatedBy,
+			CreatedAt:         f.CreatedAt,
+			Age:               time.Since(f.CreatedAt),
+			RequestedBySyncer: f.RequestedBySyncer,
+		})
+		return true
+	})
+	v, err := json.Marshal(fetchers)
+	if err != nil {
+		return "", err
+	}
+	return string(v), nil
+}
+
 func (i *Inspector) IsPushSynced(tagname string) bool {
 	tags := i.api.Tags.All()
 
@@ -70,6 +163,24 @@ func (i *Inspector) IsPushSynced(tagname string) bool {
 	return false
 }
 
+// PushSyncProgress returns the total number of chunks of the tag with the given name,
+// the number of chunks already push synced and whether push syncing is done.
+// If the total is not known yet, as for streaming uploads, total is -1.
+func (i *Inspector) PushSyncProgress(tagname string) (total, synced int, done bool, err error) {
+	for _, t := range i.api.Tags.All() {
+		if t.Name != tagname {
+			continue
+		}
+		if t.TotalCounter() == 0 {
+			return -1, int(t.Get(chunk.StateSynced)), false, nil
+		}
+		// the error only signals that the counts are not final yet
+		n, _, _ := t.Status(chunk.StateSynced)
+		return int(t.TotalCounter()), int(n), t.Done(chunk.StateSynced), nil
+	}
+	return 0, 0, false, fmt.Errorf("tag %q not found", tagname)
+}
+
 func (i *Inspector) IsPullSyncing() bool {
 	t := i.stream.LastReceivedChunkTime()
 
@@ -96,20 +207,66 @@ func (i *Inspector) DeliveriesPerPeer() map[string]int64 {
 	return res
 }
 
+// DeliveryLatencyPerPeer returns the 95th percentile of the recent latencies,
+// in milliseconds, between sending a retrieve request and receiving the chunk
+// delivery, for every connected peer that has delivered chunks
+func (i *Inspector) DeliveryLatencyPerPeer() map[string]float64 {
+	res := map[string]float64{}
+
+	// iterate connection in kademlia
+	i.hive.Kademlia.EachConn(nil, 255, func(p *network.Peer, po int) bool {
+		peermetric := fmt.Sprintf("network/retrieve/chunk/delivery/latency/%x", p.Over()[:16])
+
+		// do not register timers for peers that did not deliver any chunks
+		if t, ok := metrics.DefaultRegistry.Get(peermetric).(metrics.Timer); ok && t.Count() > 0 {
+			res[fmt.Sprintf("%x", p.Over()[:16])] = t.Percentile(0.95) / float64(time.Millisecond)
+		}
+
+		return true
+	})
+
+	return res
+}
+
+// Metrics returns the current values of the requested counters and gauges
+// from the default metrics registry. Meters, histograms and timers report their count.
+// Metrics which are not registered are omitted from the result.
+func (i *Inspector) Metrics(names []string) map[string]float64 {
+	res := make(map[string]float64)
+	for _, name := range names {
+		switch m := metrics.DefaultRegistry.Get(name).(type) {
+		case metrics.Counter:
+			res[name] = float64(m.Count())
+		case metrics.Gauge:
+			res[name] = float64(m.Value())
+		case metrics.GaugeFloat64:
+			res[name] = m.Value()
+		case metrics.Meter:
+			res[name] = float64(m.Count())
+		case metrics.Histogram:
+			res[name] = float64(m.Count())
+		case metrics.Timer:
+			res[name] = float64(m.Count())
+		}
+	}
+	return res
+}
+
 // Has checks whether each chunk address is present in the underlying datastore,
 // the bool in the returned structs indicates if the underlying datastore has
 // the chunk stored with the given address (true), or not (false)
 func (i *Inspector) Has(chunkAddresses []storage.Address) string {
-	hostChunks := []string{}
-	for _, addr := range chunkAddresses {
-		has, err := i.netStore.Has(context.Background(), addr)
-		if err != nil {
-			log.Error(err.Error())
-		}
-		if has {
-			hostChunks = append(hostChunks, "1")
+	has, err := i.netStore.HasMulti(context.Background(), chunkAddresses...)
+	if err != nil {
+		log.Error(err.Error())
+	}
+
+	hostChunks := make([]string, len(chunkAddresses))
+	for j := range chunkAddresses {
+		if j < len(has) && has[j] {
+			hostChunks[j] = "1"
 		} else {
-			hostChunks = append(hostChunks, "0")
+			hostChunks[j] = "0"
 		}
 	}
 
@@ -131,3 +288,28 @@ func (i *Inspector) PeerStreams() (string, error) {
 func (i *Inspector) StorageIndices() (map[string]int, error) {
 	return i.ls.DebugIndices()
 }
+
+// RunGC removes chunks from the local store, in the same order as the garbage
+// collection triggered by the store capacity, until no more than targetCapacity
+// chunks are left in the garbage collection index. It returns the number of
+// removed chunks.
+func (i *Inspector) RunGC(targetCapacity uint64) (freed int, err error) {
+	if i.ls == nil {
+		return 0, errors.New("local store not available")
+	}
+	collected, err := i.ls.CollectGarbage(targetCapacity)
+	return int(collected), err
+}
+
+// ResyncBin requests the sync stream of the proximity order bin again from the start from all
+// peers it is synced from, to fetch the chunks of the bin that are missing from the local store,
+// without restarting the node. Chunks that are already stored are not fetched again, so it can
+// be called on a node that is in sync. It returns the number of recovered chunks.
+func (i *Inspector) ResyncBin(bin uint8) (recovered int, err error) {
+	if i.stream == nil {
+		return 0, errors.New("stream registry not available")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), InspectorResyncBinTimeout)
+	defer cancel()
+	return i.stream.ResyncBin(ctx, bin)
+}
@@ -1,18 +1,27 @@
 package api
 
 import (
+	"context"
 	"crypto/rand"
+	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/holisticode/swarm/chunk"
 	"github.com/holisticode/swarm/network"
 	"github.com/holisticode/swarm/network/stream"
 	"github.com/holisticode/swarm/storage"
 	"github.com/holisticode/swarm/storage/localstore"
 
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/enode"
 	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/holisticode/swarm/p2p/protocols"
 	"github.com/holisticode/swarm/state"
 )
 
@@ -107,3 +116,412 @@ func TestInspectorStorageIndices(t *testing.T) {
 		t.Fatalf("expected gcSize to be %d but got %d", 0, indiceInfo["gcSize"])
 	}
 }
+
+// TestInspectorRunGC validates that garbage collection can be run over RPC
+// and that it reports the number of removed chunks
+func TestInspectorRunGC(t *testing.T) {
+	dir, err := ioutil.TempDir("", "swarm-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	baseKey := make([]byte, 32)
+	_, err = rand.Read(baseKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	localStore, err := localstore.New(dir, baseKey, &localstore.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer localStore.Close()
+
+	chunkCount := 10
+	for j := 0; j < chunkCount; j++ {
+		ch := storage.GenerateRandomChunk(chunk.DefaultSize)
+		if _, err := localStore.Put(context.Background(), chunk.ModePutUpload, ch); err != nil {
+			t.Fatal(err)
+		}
+		if err := localStore.Set(context.Background(), chunk.ModeSetSyncPull, ch.Address()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	i := NewInspector(nil, nil, nil, nil, localStore)
+
+	server := rpc.NewServer()
+	if err := server.RegisterName("inspector", i); err != nil {
+		t.Fatal(err)
+	}
+
+	client := rpc.DialInProc(server)
+
+	var freed int
+	if err := client.Call(&freed, "inspector_runGC", 4); err != nil {
+		t.Fatal(err)
+	}
+	if freed != chunkCount-4 {
+		t.Fatalf("expected %d freed chunks but got %d", chunkCount-4, freed)
+	}
+
+	var indiceInfo map[string]int
+	if err := client.Call(&indiceInfo, "inspector_storageIndices"); err != nil {
+		t.Fatal(err)
+	}
+	if indiceInfo["gcSize"] != 4 {
+		t.Fatalf("expected gcSize to be %d but got %d", 4, indiceInfo["gcSize"])
+	}
+}
+
+// TestInspectorBinStats validates that the per bin peer counts
+// reflect the addresses known by kademlia
+func TestInspectorBinStats(t *testing.T) {
+	baseKey := make([]byte, 32)
+	_, err := rand.Read(baseKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	kad := network.NewKademlia(baseKey, network.NewKadParams())
+	hive := network.NewHive(network.NewHiveParams(), kad, state.NewInmemoryStore())
+
+	expected := make([]int, kad.MaxProxDisplay)
+	var addrs []*network.BzzAddr
+	for j := 0; j < 20; j++ {
+		addr := network.RandomBzzAddr()
+		po := chunk.Proximity(baseKey, addr.Over())
+		if po >= kad.MaxProxDisplay {
+			po = kad.MaxProxDisplay - 1
+		}
+		expected[po]++
+		addrs = append(addrs, addr)
+	}
+	if err := kad.Register(addrs...); err != nil {
+		t.Fatal(err)
+	}
+
+	i := NewInspector(nil, hive, nil, nil, nil)
+
+	server := rpc.NewServer()
+	if err := server.RegisterName("inspector", i); err != nil {
+		t.Fatal(err)
+	}
+
+	client := rpc.DialInProc(server)
+
+	var res string
+	err = client.Call(&res, "inspector_binStats")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var stats BinStats
+	if err := json.Unmarshal([]byte(res), &stats); err != nil {
+		t.Fatal(err)
+	}
+	if len(stats.Bins) != kad.MaxProxDisplay {
+		t.Fatalf("expected %d bins, got %d", kad.MaxProxDisplay, len(stats.Bins))
+	}
+	for po, b := range stats.Bins {
+		if b.Bin != po {
+			t.Fatalf("expected bin %d, got %d", po, b.Bin)
+		}
+		if b.Connected != 0 {
+			t.Fatalf("bin %d: expected no connected peers, got %d", po, b.Connected)
+		}
+		if b.Known != expected[po] {
+			t.Fatalf("bin %d: expected %d known addresses, got %d", po, expected[po], b.Known)
+		}
+	}
+}
+
+// TestInspectorCapabilityHealth validates that the health is reported
+// for every capability index and depends on connected peers only
+func TestInspectorCapabilityHealth(t *testing.T) {
+	baseKey := make([]byte, 32)
+	_, err := rand.Read(baseKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	kad := network.NewKademlia(baseKey, network.NewKadParams())
+	hive := network.NewHive(network.NewHiveParams(), kad, state.NewInmemoryStore())
+
+	if err := kad.Register(network.RandomBzzAddr()); err != nil {
+		t.Fatal(err)
+	}
+
+	i := NewInspector(nil, hive, nil, nil, nil)
+
+	server := rpc.NewServer()
+	if err := server.RegisterName("inspector", i); err != nil {
+		t.Fatal(err)
+	}
+
+	client := rpc.DialInProc(server)
+
+	var health map[string]bool
+	err = client.Call(&health, "inspector_capabilityHealth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := kad.CapabilityKeys()
+	if len(health) != len(keys) {
+		t.Fatalf("expected health for %d capability indices, got %v", len(keys), health)
+	}
+	for _, capKey := range keys {
+		healthy, ok := health[capKey]
+		if !ok {
+			t.Fatalf("missing health for capability index %s", capKey)
+		}
+		if healthy {
+			t.Fatalf("expected capability index %s without connections to be unhealthy", capKey)
+		}
+	}
+}
+
+// TestInspectorActiveFetchers validates that in-flight fetchers are reported
+func TestInspectorActiveFetchers(t *testing.T) {
+	dir, err := ioutil.TempDir("", "swarm-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	baseKey := make([]byte, 32)
+	_, err = rand.Read(baseKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	baseAddress := network.NewBzzAddr(baseKey, baseKey)
+	localStore, err := localstore.New(dir, baseKey, &localstore.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer localStore.Close()
+	netStore := storage.NewNetStore(localStore, baseAddress)
+
+	ref := storage.GenerateRandomChunk(chunk.DefaultSize).Address()
+	_, _, ok := netStore.GetOrCreateFetcher(context.Background(), ref, "request")
+	if !ok {
+		t.Fatal("expected fetcher to be created")
+	}
+
+	i := NewInspector(nil, nil, netStore, nil, localStore)
+
+	server := rpc.NewServer()
+	if err := server.RegisterName("inspector", i); err != nil {
+		t.Fatal(err)
+	}
+
+	client := rpc.DialInProc(server)
+
+	var res string
+	err = client.Call(&res, "inspector_activeFetchers")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var fetchers []FetcherInfo
+	if err := json.Unmarshal([]byte(res), &fetchers); err != nil {
+		t.Fatal(err)
+	}
+	if len(fetchers) != 1 {
+		t.Fatalf("expected 1 fetcher, got %d", len(fetchers))
+	}
+	if fetchers[0].Ref != ref.String() {
+		t.Fatalf("expected ref %s, got %s", ref, fetchers[0].Ref)
+	}
+	if fetchers[0].CreatedBy != "request" {
+		t.Fatalf("expected fetcher to be created by request, got %q", fetchers[0].CreatedBy)
+	}
+	if fetchers[0].RequestedBySyncer {
+		t.Fatal("expected fetcher not to be requested by syncer")
+	}
+}
+
+// TestInspectorMetrics validates that the requested metrics are reported
+func TestInspectorMetrics(t *testing.T) {
+	// register the metrics explicitly, as metrics collection is not enabled in tests
+	counter := new(metrics.StandardCounter)
+	counter.Inc(3)
+	gauge := new(metrics.StandardGauge)
+	gauge.Update(7)
+	metrics.DefaultRegistry.Register("inspector/test/counter", counter)
+	metrics.DefaultRegistry.Register("inspector/test/gauge", gauge)
+	defer metrics.DefaultRegistry.Unregister("inspector/test/counter")
+	defer metrics.DefaultRegistry.Unregister("inspector/test/gauge")
+
+	i := NewInspector(nil, nil, nil, nil, nil)
+
+	server := rpc.NewServer()
+	if err := server.RegisterName("inspector", i); err != nil {
+		t.Fatal(err)
+	}
+
+	client := rpc.DialInProc(server)
+
+	var res map[string]float64
+	err := client.Call(&res, "inspector_metrics", []string{"inspector/test/counter", "inspector/test/gauge", "inspector/test/missing"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 2 {
+		t.Fatalf("expected 2 metrics, got %v", res)
+	}
+	if res["inspector/test/counter"] != 3 {
+		t.Fatalf("expected counter to be 3, got %v", res["inspector/test/counter"])
+	}
+	if res["inspector/test/gauge"] != 7 {
+		t.Fatalf("expected gauge to be 7, got %v", res["inspector/test/gauge"])
+	}
+}
+
+// TestInspectorPushSyncProgress validates the reported push sync progress of a tag
+func TestInspectorPushSyncProgress(t *testing.T) {
+	tags := chunk.NewTags()
+	i := NewInspector(&API{Tags: tags}, nil, nil, nil, nil)
+
+	if _, _, _, err := i.PushSyncProgress("missing"); err == nil {
+		t.Fatal("expected error for missing tag")
+	}
+
+	// total is not known yet for streaming uploads
+	stream, err := tags.Create("stream", 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream.IncN(chunk.StateSynced, 2)
+	total, synced, done, err := i.PushSyncProgress("stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != -1 || synced != 2 || done {
+		t.Fatalf("got total %v synced %v done %v, want -1 2 false", total, synced, done)
+	}
+
+	tag, err := tags.Create("upload", 4, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tag.IncN(chunk.StateStored, 4)
+	tag.IncN(chunk.StateSynced, 3)
+	total, synced, done, err = i.PushSyncProgress("upload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 4 || synced != 3 || done {
+		t.Fatalf("got total %v synced %v done %v, want 4 3 false", total, synced, done)
+	}
+
+	tag.Inc(chunk.StateSynced)
+	total, synced, done, err = i.PushSyncProgress("upload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 4 || synced != 4 || !done {
+		t.Fatalf("got total %v synced %v done %v, want 4 4 true", total, synced, done)
+	}
+}
+
+// TestInspectorHas validates that the RPC has function reports
+// the presence of each requested chunk in order
+func TestInspectorHas(t *testing.T) {
+	dir, err := ioutil.TempDir("", "swarm-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	baseKey := make([]byte, 32)
+	_, err = rand.Read(baseKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	localStore, err := localstore.New(dir, baseKey, &localstore.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer localStore.Close()
+	netStore := storage.NewNetStore(localStore, network.NewBzzAddr(baseKey, baseKey))
+
+	stored := storage.GenerateRandomChunk(chunk.DefaultSize)
+	if _, err := netStore.Put(context.Background(), chunk.ModePutUpload, stored); err != nil {
+		t.Fatal(err)
+	}
+	missing := storage.GenerateRandomChunk(chunk.DefaultSize)
+
+	i := NewInspector(nil, nil, netStore, nil, localStore)
+
+	server := rpc.NewServer()
+	if err := server.RegisterName("inspector", i); err != nil {
+		t.Fatal(err)
+	}
+
+	client := rpc.DialInProc(server)
+
+	var res string
+	err = client.Call(&res, "inspector_has", []storage.Address{missing.Address(), stored.Address(), missing.Address()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res != "010" {
+		t.Fatalf("expected %q, got %q", "010", res)
+	}
+}
+
+// TestInspectorDeliveryLatencyPerPeer validates that delivery latencies are
+// reported only for connected peers that delivered chunks
+func TestInspectorDeliveryLatencyPerPeer(t *testing.T) {
+	baseKey := make([]byte, 32)
+	_, err := rand.Read(baseKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	kad := network.NewKademlia(baseKey, network.NewKadParams())
+	hive := network.NewHive(network.NewHiveParams(), kad, state.NewInmemoryStore())
+
+	newPeer := func() *network.Peer {
+		addr := network.RandomBzzAddr()
+		p := p2p.NewPeer(enode.ID{}, "test", []p2p.Cap{})
+		bp := &network.BzzPeer{
+			Peer:    protocols.NewPeer(p, &p2p.MsgPipeRW{}, &protocols.Spec{}),
+			BzzAddr: addr,
+		}
+		return network.NewPeer(bp, kad)
+	}
+	slow := newPeer()
+	silent := newPeer()
+	kad.On(slow)
+	kad.On(silent)
+
+	// register the timer explicitly, as metrics collection is not enabled in tests
+	name := fmt.Sprintf("network/retrieve/chunk/delivery/latency/%x", slow.Over()[:16])
+	metrics.DefaultRegistry.Register(name, testTimer{count: 2, p95: float64(20 * time.Millisecond)})
+	defer metrics.DefaultRegistry.Unregister(name)
+
+	i := NewInspector(nil, hive, nil, nil, nil)
+
+	res := i.DeliveryLatencyPerPeer()
+	if len(res) != 1 {
+		t.Fatalf("expected latency for 1 peer, got %v", res)
+	}
+	if got := res[fmt.Sprintf("%x", slow.Over()[:16])]; got != 20 {
+		t.Fatalf("expected latency 20ms, got %v", got)
+	}
+}
+
+// testTimer is a metrics.Timer reporting the given count and 95th percentile
+type testTimer struct {
+	metrics.NilTimer
+	count int64
+	p95   float64
+}
+
+func (t testTimer) Count() int64 { return t.count }
+
+func (t testTimer) Percentile(p float64) float64 { return t.p95 }
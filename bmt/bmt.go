@@ -20,6 +20,7 @@ package bmt
 import (
 	"context"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"hash"
 	"strings"
@@ -45,12 +46,14 @@ The size of the underlying segments is fixed to the size of the base hash (calle
 of the BMT hash), Using Keccak256 SHA3 hash is 32 bytes, the EVM word size to optimize for on-chain BMT verification
 as well as the hash size optimal for inclusion proofs in the merkle tree of the swarm hash.
 
-Two implementations are provided:
+Three implementations are provided:
 
 * RefHasher is optimized for code simplicity and meant as a reference implementation
   that is simple to understand
 * Hasher is optimized for speed taking advantage of concurrency with minimalistic
   control structure to coordinate the concurrent routines
+* HasherSync computes the same hash synchronously without allocations,
+  which is faster than Hasher for hashing many small chunks
 
   BMT Hasher implements the following interfaces
 	* standard golang hash.Hash - synchronous, reusable
@@ -67,6 +70,14 @@ const (
 
 var (
 	ZeroSpan = make([]byte, 8)
+
+	// ErrConcurrentUse is the panic value when Write or Sum is called
+	// on a Hasher while another Write or Sum call is running
+	ErrConcurrentUse = errors.New("bmt: concurrent use of Hasher")
+
+	// ErrPoolClosed is returned by Write and recorded by Sum, SetSpan and SetSpanBytes
+	// when a Hasher can not reserve a tree from a closed TreePool, see Hasher.Err
+	ErrPoolClosed = errors.New("bmt: tree pool closed")
 )
 
 // BaseHasherFunc is a hash.Hash constructor function used for the base hash of the BMT.
@@ -78,7 +89,8 @@ type BaseHasherFunc func() hash.Hash
 // - reuses a pool of trees for amortised memory allocation and resource control
 // - supports order-agnostic concurrent segment writes and section (double segment) writes
 //   as well as sequential read and write
-// - the same hasher instance must not be called concurrently on more than one chunk
+// - the same hasher instance must not be called concurrently on more than one chunk,
+//   overlapping Write or Sum calls panic with ErrConcurrentUse
 // - the same hasher instance is synchronously reuseable
 // - Sum gives back the tree to the pool and guaranteed to leave
 //   the tree and itself in a state reusable for hashing a new chunk
@@ -91,6 +103,9 @@ type Hasher struct {
 	cursor  int        // cursor to write to on next Write() call
 	errFunc func(error)
 	ctx     context.Context
+	busy    int32 // set while Write or Sum is running, to detect concurrent use
+
+	err error // error reserving a tree recorded since the last Reset, see Err
 }
 
 // New creates a reusable BMT Hasher that
@@ -115,6 +130,8 @@ type TreePool struct {
 	Size         int            // the total length of the data (count * size)
 	count        int            // current count of (ever) allocated resources
 	zerohashes   [][]byte       // lookup table for predictable padding subtrees for all levels
+	closed       bool           // set by Close, protected by lock
+	quit         chan struct{}  // closed by Close to unblock reserve calls waiting for a tree
 }
 
 // NewTreePool creates a tree pool with hasher, segment size, segment count and capacity
@@ -140,6 +157,7 @@ func NewTreePool(hasher BaseHasherFunc, segmentCount, capacity int) *TreePool {
 		Size:         segmentCount * segmentSize,
 		Depth:        depth,
 		zerohashes:   zerohashes,
+		quit:         make(chan struct{}),
 	}
 }
 
@@ -153,23 +171,59 @@ func (p *TreePool) Drain(n int) {
 	}
 }
 
+// Close closes the pool and waits until all the trees reserved from it are released.
+// Once the pool is closed, reserving a tree fails with ErrPoolClosed.
+// It returns the context error if the context is done before all trees are released,
+// in which case Close can be called again to keep waiting.
+func (p *TreePool) Close(ctx context.Context) error {
+	p.lock.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.quit)
+	}
+	count := p.count
+	p.lock.Unlock()
+
+	for i := 0; i < count; i++ {
+		select {
+		case <-p.c:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		p.lock.Lock()
+		p.count--
+		p.lock.Unlock()
+	}
+	return nil
+}
+
 // Reserve is blocking until it returns an available tree
 // it reuses free trees or creates a new one if size is not reached
-// TODO: should use a context here
-func (p *TreePool) reserve() *tree {
+// it returns ErrPoolClosed if the pool is closed
+func (p *TreePool) reserve() (*tree, error) {
 	p.lock.Lock()
-	defer p.lock.Unlock()
-	var t *tree
-	if p.count == p.Capacity {
-		return <-p.c
+	if p.closed {
+		p.lock.Unlock()
+		return nil, ErrPoolClosed
 	}
 	select {
-	case t = <-p.c:
+	case t := <-p.c:
+		p.lock.Unlock()
+		return t, nil
 	default:
-		t = newTree(p.SegmentSize, p.Depth, p.hasher)
+	}
+	if p.count < p.Capacity {
 		p.count++
+		p.lock.Unlock()
+		return newTree(p.SegmentSize, p.Depth, p.hasher), nil
+	}
+	p.lock.Unlock()
+	select {
+	case t := <-p.c:
+		return t, nil
+	case <-p.quit:
+		return nil, ErrPoolClosed
 	}
-	return t
 }
 
 // release gives back a tree to the pool.
@@ -302,18 +356,38 @@ func (h *Hasher) SectionSize() int {
 }
 
 // SetSpan implements file.SectionWriter
+// If no tree can be reserved from the pool, the error is recorded, see Err
 func (h *Hasher) SetSpan(length int) {
-	span := LengthToSpan(length)
-	h.getTree().span = span
+	t, err := h.getTree()
+	if err != nil {
+		h.err = err
+		return
+	}
+	t.span = LengthToSpan(length)
 }
 
 // SetSpanBytes implements storage.SwarmHash
+// If no tree can be reserved from the pool, the error is recorded, see Err
 func (h *Hasher) SetSpanBytes(b []byte) {
-	t := h.getTree()
+	t, err := h.getTree()
+	if err != nil {
+		h.err = err
+		return
+	}
 	t.span = make([]byte, 8)
 	copy(t.span, b)
 }
 
+// SumWithSpan returns the BMT root hash of the data b using the given span
+// instead of one derived from the data length, as needed for intermediate chunks.
+// It resets the hasher before writing b. Implements storage.SwarmHash
+func (h *Hasher) SumWithSpan(b, span []byte) []byte {
+	h.Reset()
+	h.SetSpanBytes(span)
+	h.Write(b)
+	return h.Sum(nil)
+}
+
 // Branches implements file.SectionWriter
 func (h *Hasher) Branches() int {
 	return h.pool.SegmentCount
@@ -331,9 +405,16 @@ func (h *Hasher) BlockSize() int {
 
 // Sum returns the BMT root hash of the buffer
 // using Sum presupposes sequential synchronous writes (io.Writer interface)
+// If no tree can be reserved from the pool, b is returned and the error is recorded, see Err
 // Implements hash.Hash in file.SectionWriter
 func (h *Hasher) Sum(b []byte) (s []byte) {
-	t := h.getTree()
+	h.enter()
+	defer h.leave()
+	t, err := h.getTree()
+	if err != nil {
+		h.err = err
+		return b
+	}
 	h.mtx.Lock()
 	if h.size == 0 && t.offset == 0 {
 		h.mtx.Unlock()
@@ -357,16 +438,22 @@ func (h *Hasher) Sum(b []byte) (s []byte) {
 
 // Write calls sequentially add to the buffer to be hashed,
 // with every full segment calls WriteSection in a go routine
+// It returns ErrPoolClosed if no tree can be reserved from the pool
 // Implements hash.Hash and file.SectionWriter
 func (h *Hasher) Write(b []byte) (int, error) {
+	h.enter()
+	defer h.leave()
 	l := len(b)
 	if l == 0 || l > h.pool.Size {
 		return 0, nil
 	}
+	t, err := h.getTree()
+	if err != nil {
+		return 0, err
+	}
 	h.mtx.Lock()
 	h.size += len(b)
 	h.mtx.Unlock()
-	t := h.getTree()
 	secsize := 2 * h.pool.SegmentSize
 	// calculate length of missing bit to complete current open section
 	smax := secsize - t.offset
@@ -410,9 +497,31 @@ func (h *Hasher) Write(b []byte) (int, error) {
 func (h *Hasher) Reset() {
 	h.cursor = 0
 	h.size = 0
+	h.err = nil
 	h.releaseTree()
 }
 
+// Err returns the error recorded by Sum, SetSpan or SetSpanBytes since the last Reset,
+// ErrPoolClosed if no tree could be reserved from a closed pool. The result of Sum is
+// only valid if Err returns nil.
+func (h *Hasher) Err() error {
+	return h.err
+}
+
+// enter marks the Hasher as being used by a Write or Sum call
+// it panics if another call is still running, as the Hasher
+// must not be used concurrently on more than one chunk
+func (h *Hasher) enter() {
+	if !atomic.CompareAndSwapInt32(&h.busy, 0, 1) {
+		panic(ErrConcurrentUse)
+	}
+}
+
+// leave marks the end of a Write or Sum call
+func (h *Hasher) leave() {
+	atomic.StoreInt32(&h.busy, 0)
+}
+
 // releaseTree gives back the Tree to the pool whereby it unlocks
 // it resets tree, segment and index
 func (h *Hasher) releaseTree() {
@@ -451,7 +560,12 @@ func (h *Hasher) writeSection(i int, section []byte, double bool, final bool) {
 	var isLeft bool
 	var hasher hash.Hash
 	var level int
-	t := h.getTree()
+	t, err := h.getTree()
+	if err != nil {
+		// the tree is reserved by the Write or Sum call writing the section,
+		// which fails with the same error
+		return
+	}
 	if double {
 		level++
 		n = t.leaves[i]
@@ -484,7 +598,7 @@ func (h *Hasher) writeNode(n *node, bh hash.Hash, isLeft bool, s []byte) {
 	for {
 		// at the root of the bmt just write the result to the result channel
 		if n == nil {
-			h.getTree().result <- s
+			h.bmt.result <- s
 			return
 		}
 		// otherwise assign child hash to left or right segment
@@ -517,7 +631,7 @@ func (h *Hasher) writeFinalNode(level int, n *node, bh hash.Hash, isLeft bool, s
 		// at the root of the bmt just write the result to the result channel
 		if n == nil {
 			if s != nil {
-				h.getTree().result <- s
+				h.bmt.result <- s
 			}
 			return
 		}
@@ -567,13 +681,17 @@ func (h *Hasher) writeFinalNode(level int, n *node, bh hash.Hash, isLeft bool, s
 }
 
 // getTree obtains a BMT resource by reserving one from the pool and assigns it to the bmt field
-func (h *Hasher) getTree() *tree {
+// it returns ErrPoolClosed if the pool is closed
+func (h *Hasher) getTree() (*tree, error) {
 	if h.bmt != nil {
-		return h.bmt
+		return h.bmt, nil
+	}
+	t, err := h.pool.reserve()
+	if err != nil {
+		return nil, err
 	}
-	t := h.pool.reserve()
 	h.bmt = t
-	return t
+	return t, nil
 }
 
 // atomic bool toggle implementing a concurrent reusable 2-state object
@@ -633,8 +751,14 @@ func (h *Hasher) GetZeroHash() []byte {
 }
 
 // GetTree gets the underlying tree in use by the Hasher
+// If no tree can be reserved from the pool, it returns nil and the error is recorded, see Err
 func (h *Hasher) GetTree() *tree {
-	return h.getTree()
+	t, err := h.getTree()
+	if err != nil {
+		h.err = err
+		return nil
+	}
+	return t
 }
 
 // GetTree releases the underlying tree in use by the Hasher
@@ -26,6 +26,9 @@
 package bmt
 
 import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
 	"hash"
 )
 
@@ -82,3 +85,161 @@ func (rh *RefHasher) hash(data []byte, length int) []byte {
 	rh.hasher.Write(section)
 	return rh.hasher.Sum(nil)
 }
+
+// HasherRef wraps a RefHasher into a hasher with the same interface and results as Hasher,
+// so that the reference implementation can be used in place of Hasher to verify it.
+// - implements the hash.Hash interface and SetSpanBytes and SumWithSpan of storage.SwarmHash
+// - the same hasher instance must not be used concurrently
+type HasherRef struct {
+	ref     *RefHasher
+	hasher  hash.Hash // base hasher for the span
+	maxSize int       // maximum data size, segment count * segment size
+	data    []byte    // data written since last Reset
+	span    []byte    // span set by SetSpan or SetSpanBytes, nil if not set
+}
+
+// NewRef creates a hasher using a RefHasher for count segments of the base hasher
+func NewRef(hasher BaseHasherFunc, count int) *HasherRef {
+	h := hasher()
+	return &HasherRef{
+		ref:     NewRefHasher(hasher, count),
+		hasher:  h,
+		maxSize: count * h.Size(),
+	}
+}
+
+// Size implements hash.Hash
+func (h *HasherRef) Size() int {
+	return h.hasher.Size()
+}
+
+// BlockSize implements hash.Hash
+func (h *HasherRef) BlockSize() int {
+	return 2 * h.hasher.Size()
+}
+
+// SetSpan sets the span of the data from its length
+func (h *HasherRef) SetSpan(length int) {
+	h.span = LengthToSpan(length)
+}
+
+// SetSpanBytes implements storage.SwarmHash
+func (h *HasherRef) SetSpanBytes(b []byte) {
+	h.span = make([]byte, 8)
+	copy(h.span, b)
+}
+
+// Write appends b to the data to be hashed. As with Hasher, data beyond
+// the maximum size of the BMT is not written.
+// Implements hash.Hash
+func (h *HasherRef) Write(b []byte) (int, error) {
+	l := len(b)
+	if l == 0 || l > h.maxSize {
+		return 0, nil
+	}
+	if free := h.maxSize - len(h.data); l > free {
+		l = free
+	}
+	h.data = append(h.data, b[:l]...)
+	return l, nil
+}
+
+// Reset implements hash.Hash
+func (h *HasherRef) Reset() {
+	h.data = h.data[:0]
+	h.span = nil
+}
+
+// Sum appends the BMT root hash of the data written to b.
+// As with Hasher, the hash of empty data is the root of the zero padded tree without the span.
+// Implements hash.Hash
+func (h *HasherRef) Sum(b []byte) []byte {
+	root := h.ref.Hash(h.data)
+	if len(h.data) == 0 {
+		return append(b, root...)
+	}
+	span := h.span
+	if span == nil {
+		span = make([]byte, 8)
+		binary.LittleEndian.PutUint64(span, uint64(len(h.data)))
+	}
+	h.hasher.Reset()
+	h.hasher.Write(span)
+	h.hasher.Write(root)
+	return h.hasher.Sum(b)
+}
+
+// SumWithSpan returns the BMT root hash of the data b using the given span
+// instead of one derived from the data length, as needed for intermediate chunks.
+// It resets the hasher before writing b. Implements storage.SwarmHash
+func (h *HasherRef) SumWithSpan(b, span []byte) []byte {
+	h.Reset()
+	h.SetSpanBytes(span)
+	h.Write(b)
+	return h.Sum(nil)
+}
+
+// Proof returns the segment with index i of the data and its inclusion proof, that is the
+// sibling hashes on the path from the segment to the root of the BMT, starting with the
+// sibling segment. The data is zero padded as in Hash. The root can be recomputed from
+// the segment and the proof with ProofRoot.
+func (rh *RefHasher) Proof(data []byte, i int) (segment []byte, proof [][]byte, err error) {
+	segmentSize := rh.sectionLength / 2
+	count := rh.maxDataLength / segmentSize
+	if i < 0 || i >= count {
+		return nil, nil, fmt.Errorf("segment index %d out of range [0, %d)", i, count)
+	}
+	d := make([]byte, rh.maxDataLength)
+	copy(d, data)
+
+	segment = d[i*segmentSize : (i+1)*segmentSize]
+	sibling := i ^ 1
+	proof = append(proof, d[sibling*segmentSize:(sibling+1)*segmentSize])
+
+	// hashes of the sections on the level above the segments
+	level := make([][]byte, count/2)
+	for j := range level {
+		level[j] = rh.hash(d[j*rh.sectionLength:(j+1)*rh.sectionLength], rh.sectionLength)
+	}
+	for i /= 2; len(level) > 1; i /= 2 {
+		proof = append(proof, level[i^1])
+		next := make([][]byte, len(level)/2)
+		for j := range next {
+			rh.hasher.Reset()
+			rh.hasher.Write(level[2*j])
+			rh.hasher.Write(level[2*j+1])
+			next[j] = rh.hasher.Sum(nil)
+		}
+		level = next
+	}
+	return segment, proof, nil
+}
+
+// ProofRoot returns the BMT root computed from the segment with index i
+// and its inclusion proof as returned by RefHasher.Proof
+func ProofRoot(hasher BaseHasherFunc, segment []byte, i int, proof [][]byte) []byte {
+	h := hasher()
+	node := segment
+	for _, sibling := range proof {
+		h.Reset()
+		if i%2 == 0 {
+			h.Write(node)
+			h.Write(sibling)
+		} else {
+			h.Write(sibling)
+			h.Write(node)
+		}
+		node = h.Sum(nil)
+		i /= 2
+	}
+	return node
+}
+
+// VerifyProof checks that the segment with index i is included in the data
+// with the given BMT hash and span, using the inclusion proof of the segment
+func VerifyProof(hasher BaseHasherFunc, hash, span, segment []byte, i int, proof [][]byte) bool {
+	h := hasher()
+	h.Write(span)
+	h.Write(ProofRoot(hasher, segment, i, proof))
+	return bytes.Equal(h.Sum(nil), hash)
+}
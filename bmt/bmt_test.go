@@ -18,6 +18,7 @@ package bmt
 
 import (
 	"bytes"
+	"context"
 	"encoding/binary"
 	"fmt"
 	"math/rand"
@@ -169,6 +170,114 @@ func TestSyncHasherCorrectness(t *testing.T) {
 	}
 }
 
+// TestHasherSyncCorrectness tests that HasherSync gives the same hash as Hasher
+// for all data lengths, with and without a span set, also when it is reused
+func TestHasherSyncCorrectness(t *testing.T) {
+	data := testutil.RandomBytes(1, bmttestutil.BufferSize)
+	hasher := sha3.NewLegacyKeccak256
+	size := hasher().Size()
+
+	for _, count := range bmttestutil.Counts {
+		t.Run(fmt.Sprintf("segments_%v", count), func(t *testing.T) {
+			pool := NewTreePool(hasher, count, 1)
+			defer pool.Drain(0)
+			bmt := New(pool)
+			sbmt := NewSync(pool)
+			max := count * size
+			for n := 0; n <= max; n += 1 + rand.Intn(5) {
+				exp := syncHash(bmt, n, data[:n])
+				sbmt.Reset()
+				sbmt.Write(data[:n])
+				if got := sbmt.Sum(nil); !bytes.Equal(got, exp) {
+					t.Fatalf("length %v: expected %x, got %x", n, exp, got)
+				}
+
+				span := LengthToSpan(n * count)
+				exp = bmt.SumWithSpan(data[:n], span)
+				if got := sbmt.SumWithSpan(data[:n], span); !bytes.Equal(got, exp) {
+					t.Fatalf("length %v with span: expected %x, got %x", n, exp, got)
+				}
+			}
+		})
+	}
+}
+
+// TestHasherRefCorrectness checks that HasherRef gives the same hashes as Hasher
+// for random data lengths and spans over all segment counts
+func TestHasherRefCorrectness(t *testing.T) {
+	data := testutil.RandomBytes(1, bmttestutil.BufferSize)
+	hasher := sha3.NewLegacyKeccak256
+	size := hasher().Size()
+
+	for _, count := range bmttestutil.Counts {
+		t.Run(fmt.Sprintf("segments_%v", count), func(t *testing.T) {
+			pool := NewTreePool(hasher, count, PoolSize)
+			defer pool.Drain(0)
+			bmt := New(pool)
+			rbmt := NewRef(hasher, count)
+			max := count * size
+			for n := 0; n <= max; n += 1 + rand.Intn(5) {
+				exp := syncHash(bmt, n, data[:n])
+				rbmt.Reset()
+				rbmt.SetSpan(n)
+				rbmt.Write(data[:n])
+				if got := rbmt.Sum(nil); !bytes.Equal(got, exp) {
+					t.Fatalf("length %v: expected %x, got %x", n, exp, got)
+				}
+
+				span := LengthToSpan(n * count)
+				exp = bmt.SumWithSpan(data[:n], span)
+				if got := rbmt.SumWithSpan(data[:n], span); !bytes.Equal(got, exp) {
+					t.Fatalf("length %v with span: expected %x, got %x", n, exp, got)
+				}
+			}
+		})
+	}
+}
+
+// TestProof checks that the inclusion proofs of all segments verify against the
+// hash of Hasher for random data lengths over all segment counts, and that the
+// proof of a modified segment does not
+func TestProof(t *testing.T) {
+	data := testutil.RandomBytes(1, bmttestutil.BufferSize)
+	hasher := sha3.NewLegacyKeccak256
+	size := hasher().Size()
+
+	for _, count := range bmttestutil.Counts {
+		t.Run(fmt.Sprintf("segments_%v", count), func(t *testing.T) {
+			pool := NewTreePool(hasher, count, PoolSize)
+			defer pool.Drain(0)
+			bmt := New(pool)
+			rbmt := NewRefHasher(hasher, count)
+			max := count * size
+			for n := 1; n <= max; n += 1 + rand.Intn(max/4+1) {
+				span := LengthToSpan(n)
+				hash := bmt.SumWithSpan(data[:n], span)
+				for i := 0; i < count; i++ {
+					segment, proof, err := rbmt.Proof(data[:n], i)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if !VerifyProof(hasher, hash, span, segment, i, proof) {
+						t.Fatalf("length %v: proof of segment %v does not verify", n, i)
+					}
+					modified := append([]byte{}, segment...)
+					modified[0]++
+					if VerifyProof(hasher, hash, span, modified, i, proof) {
+						t.Fatalf("length %v: proof of modified segment %v verifies", n, i)
+					}
+				}
+			}
+			// the segment count is rounded up to a power of 2
+			for _, i := range []int{-1, rbmt.maxDataLength / size} {
+				if _, _, err := rbmt.Proof(data, i); err == nil {
+					t.Fatalf("expected error for segment index %v", i)
+				}
+			}
+		})
+	}
+}
+
 // Tests that the BMT hasher can be synchronously reused with poolsizes 1 and PoolSize
 func TestHasherReuse(t *testing.T) {
 	t.Run(fmt.Sprintf("poolsize_%d", 1), func(t *testing.T) {
@@ -337,6 +446,9 @@ func BenchmarkBMT(t *testing.B) {
 		t.Run(fmt.Sprintf("%v_size_%v", "BMT", size), func(t *testing.B) {
 			benchmarkBMT(t, size)
 		})
+		t.Run(fmt.Sprintf("%v_size_%v", "BMTSync", size), func(t *testing.B) {
+			benchmarkBMTSync(t, size)
+		})
 	}
 }
 
@@ -410,6 +522,24 @@ func benchmarkBMT(t *testing.B, n int) {
 	bmttestutil.BenchmarkBMTResult = r
 }
 
+// benchmarks synchronous BMT HasherSync
+func benchmarkBMTSync(t *testing.B, n int) {
+	data := testutil.RandomBytes(1, n)
+	hasher := sha3.NewLegacyKeccak256
+	pool := NewTreePool(hasher, bmttestutil.SegmentCount, PoolSize)
+	bmt := NewSync(pool)
+	r := make([]byte, 0, bmt.Size())
+
+	t.ReportAllocs()
+	t.ResetTimer()
+	for i := 0; i < t.N; i++ {
+		bmt.Reset()
+		bmt.Write(data)
+		r = bmt.Sum(r[:0])
+	}
+	bmttestutil.BenchmarkBMTResult = r
+}
+
 // benchmarks 100 concurrent bmt hashes with pool capacity
 func benchmarkPool(t *testing.B, poolsize, n int) {
 	data := testutil.RandomBytes(1, n)
@@ -473,3 +603,98 @@ func TestUseSyncAsOrdinaryHasher(t *testing.T) {
 		t.Fatalf("normalhash; expected %x, got %x", refRes, res)
 	}
 }
+
+// TestSumWithSpan verifies that SumWithSpan hashes the data with the given span
+// rather than one derived from the data length
+func TestSumWithSpan(t *testing.T) {
+	hasher := sha3.NewLegacyKeccak256
+	pool := NewTreePool(hasher, bmttestutil.SegmentCount, PoolSize)
+	bmt := New(pool)
+	data := []byte("foo")
+	span := LengthToSpan(4096 * 128)
+	// write some data first to check that SumWithSpan resets the hasher
+	bmt.Write([]byte("bar"))
+	res := bmt.SumWithSpan(data, span)
+	refh := NewRefHasher(hasher, 128)
+	resh := refh.Hash(data)
+	hsub := hasher()
+	hsub.Write(span)
+	hsub.Write(resh)
+	refRes := hsub.Sum(nil)
+	if !bytes.Equal(res, refRes) {
+		t.Fatalf("expected %x, got %x", refRes, res)
+	}
+}
+
+// TestHasherConcurrentUse verifies that Write and Sum panic
+// if they are called while another call is running
+func TestHasherConcurrentUse(t *testing.T) {
+	pool := NewTreePool(sha3.NewLegacyKeccak256, bmttestutil.SegmentCount, PoolSize)
+	defer pool.Drain(0)
+
+	for name, f := range map[string]func(h *Hasher){
+		"write": func(h *Hasher) { h.Write([]byte("foo")) },
+		"sum":   func(h *Hasher) { h.Sum(nil) },
+	} {
+		t.Run(name, func(t *testing.T) {
+			h := New(pool)
+			// simulate a call running in another goroutine
+			h.enter()
+			func() {
+				defer func() {
+					if r := recover(); r != ErrConcurrentUse {
+						t.Fatalf("got panic %v, want %v", r, ErrConcurrentUse)
+					}
+				}()
+				f(h)
+			}()
+			h.leave()
+
+			// the hasher is usable once the other call is finished
+			f(h)
+		})
+	}
+}
+
+// TestTreePoolClose verifies that Close waits for the reserved trees to be released
+// and that no trees can be reserved from a closed pool
+func TestTreePoolClose(t *testing.T) {
+	pool := NewTreePool(sha3.NewLegacyKeccak256, bmttestutil.SegmentCount, PoolSize)
+
+	h := New(pool)
+	h.Write([]byte("foo"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := pool.Close(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("got error %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	closed := New(pool)
+	if _, err := closed.Write([]byte("bar")); err != ErrPoolClosed {
+		t.Fatalf("got write error %v, want %v", err, ErrPoolClosed)
+	}
+	closed.SetSpan(3)
+	if err := closed.Err(); err != ErrPoolClosed {
+		t.Fatalf("got set span error %v, want %v", err, ErrPoolClosed)
+	}
+	closed.Reset()
+	if err := closed.Err(); err != nil {
+		t.Fatalf("got error %v after reset", err)
+	}
+	if s := closed.Sum(nil); s != nil {
+		t.Fatalf("got sum %x from a closed pool", s)
+	}
+	if err := closed.Err(); err != ErrPoolClosed {
+		t.Fatalf("got sum error %v, want %v", err, ErrPoolClosed)
+	}
+
+	// releases the tree reserved by the hasher
+	h.Sum(nil)
+
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := pool.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -65,6 +65,12 @@ type Tag struct {
 	ctx      context.Context  // tracing context
 	span     opentracing.Span // tracing root span
 	spanOnce sync.Once        // make sure we close root span only once
+
+	resuming int32 // set to 1 by Resume, accessed atomically
+
+	subsMu     sync.Mutex                // protects subs
+	subs       map[State][]chan struct{} // channels to close when the tag is complete wrt a state
+	subsActive int32                     // number of subscriptions, to skip notifying without subscriptions
 }
 
 // NewTag creates a new tag, and returns it
@@ -111,6 +117,7 @@ func (t *Tag) IncN(state State, n int) {
 		v = &t.Synced
 	}
 	atomic.AddInt64(v, int64(n))
+	t.notify()
 }
 
 // Inc increments the count for a state
@@ -145,19 +152,79 @@ func (t *Tag) TotalCounter() int64 {
 // wrt the state given as argument
 // it returns an error if the context is done
 func (t *Tag) WaitTillDone(ctx context.Context, s State) error {
-	if t.Done(s) {
+	c := t.Subscribe(s)
+	select {
+	case <-c:
 		return nil
+	case <-ctx.Done():
+		t.unsubscribe(s, c)
+		return ctx.Err()
+	}
+}
+
+// Subscribe returns a channel that is closed once the tag is complete
+// wrt the state given as argument, as reported by Done
+func (t *Tag) Subscribe(s State) <-chan struct{} {
+	c := make(chan struct{})
+
+	t.subsMu.Lock()
+	defer t.subsMu.Unlock()
+
+	// count the subscription before checking Done, so that an
+	// increment either finds it in notify or is seen by Done
+	atomic.AddInt32(&t.subsActive, 1)
+	if t.Done(s) {
+		atomic.AddInt32(&t.subsActive, -1)
+		close(c)
+		return c
+	}
+	if t.subs == nil {
+		t.subs = make(map[State][]chan struct{})
+	}
+	t.subs[s] = append(t.subs[s], c)
+	return c
+}
+
+// unsubscribe removes the subscription channel c returned by Subscribe,
+// if it was not closed yet
+func (t *Tag) unsubscribe(s State, c <-chan struct{}) {
+	t.subsMu.Lock()
+	defer t.subsMu.Unlock()
+
+	chans := t.subs[s]
+	for i := range chans {
+		if chans[i] != c {
+			continue
+		}
+		if len(chans) == 1 {
+			delete(t.subs, s)
+		} else {
+			t.subs[s] = append(chans[:i], chans[i+1:]...)
+		}
+		atomic.AddInt32(&t.subsActive, -1)
+		return
 	}
-	ticker := time.NewTicker(100 * time.Millisecond)
-	for {
-		select {
-		case <-ticker.C:
-			if t.Done(s) {
-				return nil
-			}
-		case <-ctx.Done():
-			return ctx.Err()
+}
+
+// notify closes the channels of subscriptions
+// for states wrt which the tag is complete
+func (t *Tag) notify() {
+	if atomic.LoadInt32(&t.subsActive) == 0 {
+		return
+	}
+
+	t.subsMu.Lock()
+	defer t.subsMu.Unlock()
+
+	for s, chans := range t.subs {
+		if !t.Done(s) {
+			continue
+		}
+		for _, c := range chans {
+			close(c)
 		}
+		delete(t.subs, s)
+		atomic.AddInt32(&t.subsActive, -int32(len(chans)))
 	}
 }
 
@@ -173,9 +240,26 @@ func (t *Tag) DoneSplit(address Address) int64 {
 	total := atomic.LoadInt64(&t.Split)
 	atomic.StoreInt64(&t.Total, total)
 	t.Address = address
+	t.notify()
 	return total
 }
 
+// Resume prepares the tag for uploading the same content again after an
+// interrupted upload. The split, stored and seen counts are reset, as they are
+// recounted by the new upload, while push sync progress is kept. Uploads with
+// a resumed tag skip chunks which are already in the local store.
+func (t *Tag) Resume() {
+	atomic.StoreInt64(&t.Split, 0)
+	atomic.StoreInt64(&t.Stored, 0)
+	atomic.StoreInt64(&t.Seen, 0)
+	atomic.StoreInt32(&t.resuming, 1)
+}
+
+// Resuming returns true if Resume has been called on the tag
+func (t *Tag) Resuming() bool {
+	return atomic.LoadInt32(&t.resuming) == 1
+}
+
 // Status returns the value of state and the total count
 func (t *Tag) Status(state State) (int64, int64, error) {
 	count, seen, total := t.Get(state), atomic.LoadInt64(&t.Seen), atomic.LoadInt64(&t.Total)
@@ -18,7 +18,9 @@ package chunk
 
 import (
 	"bytes"
+	"context"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -57,6 +59,38 @@ func TestTagSingleIncrements(t *testing.T) {
 	}
 }
 
+// TestTagResume tests that Resume resets the counts recounted by a new
+// upload and keeps the push sync progress
+func TestTagResume(t *testing.T) {
+	tg := &Tag{Total: 10}
+	for _, s := range allStates {
+		tg.IncN(s, 5)
+	}
+	if tg.Resuming() {
+		t.Fatal("expected tag not to be resuming")
+	}
+
+	tg.Resume()
+
+	if !tg.Resuming() {
+		t.Fatal("expected tag to be resuming")
+	}
+	for s, want := range map[State]int64{
+		StateSplit:  0,
+		StateStored: 0,
+		StateSeen:   0,
+		StateSent:   5,
+		StateSynced: 5,
+	} {
+		if got := tg.Get(s); got != want {
+			t.Errorf("state %v: got %v, want %v", s, got, want)
+		}
+	}
+	if tg.TotalCounter() != 10 {
+		t.Errorf("got total %v, want 10", tg.TotalCounter())
+	}
+}
+
 // TestTagStatus is a unit test to cover Tag.Status method functionality
 func TestTagStatus(t *testing.T) {
 	tg := &Tag{Total: 10}
@@ -92,6 +126,122 @@ func TestTagStatus(t *testing.T) {
 	}
 }
 
+// TestTagSubscribe tests that the subscription channel is closed
+// once the tag is complete wrt the subscribed state
+func TestTagSubscribe(t *testing.T) {
+	isClosed := func(c <-chan struct{}) bool {
+		select {
+		case <-c:
+			return true
+		default:
+			return false
+		}
+	}
+
+	t.Run("known total", func(t *testing.T) {
+		tg := &Tag{Total: 3}
+		stored := tg.Subscribe(StateStored)
+		synced := tg.Subscribe(StateSynced)
+
+		tg.IncN(StateStored, 3)
+		if !isClosed(stored) {
+			t.Fatal("stored subscription not closed")
+		}
+		tg.IncN(StateSynced, 2)
+		if isClosed(synced) {
+			t.Fatal("synced subscription closed before all chunks are synced")
+		}
+		tg.Inc(StateSynced)
+		if !isClosed(synced) {
+			t.Fatal("synced subscription not closed")
+		}
+
+		// subscribing to a completed state returns a closed channel
+		if !isClosed(tg.Subscribe(StateSynced)) {
+			t.Fatal("subscription to completed state not closed")
+		}
+	})
+
+	t.Run("unknown total", func(t *testing.T) {
+		tg := &Tag{}
+		synced := tg.Subscribe(StateSynced)
+
+		tg.IncN(StateSplit, 2)
+		tg.IncN(StateStored, 2)
+		tg.IncN(StateSynced, 2)
+		if isClosed(synced) {
+			t.Fatal("synced subscription closed before the total is known")
+		}
+		tg.DoneSplit(nil)
+		if !isClosed(synced) {
+			t.Fatal("synced subscription not closed")
+		}
+	})
+
+	t.Run("concurrent increments", func(t *testing.T) {
+		tg := &Tag{Total: 1000}
+		synced := tg.Subscribe(StateSynced)
+
+		var wg sync.WaitGroup
+		for i := 0; i < 1000; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				tg.Inc(StateStored)
+				tg.Inc(StateSynced)
+			}()
+		}
+		select {
+		case <-synced:
+		case <-time.After(5 * time.Second):
+			t.Fatal("synced subscription not closed")
+		}
+		wg.Wait()
+	})
+
+	t.Run("concurrent subscribe", func(t *testing.T) {
+		for i := 0; i < 1000; i++ {
+			tg := &Tag{Total: 1}
+			subscribed := make(chan (<-chan struct{}))
+			go func() {
+				subscribed <- tg.Subscribe(StateStored)
+			}()
+			tg.Inc(StateStored)
+			select {
+			case <-<-subscribed:
+			case <-time.After(5 * time.Second):
+				t.Fatal("stored subscription not closed")
+			}
+		}
+	})
+
+	t.Run("wait cancelled", func(t *testing.T) {
+		tg := &Tag{Total: 1}
+		other := tg.Subscribe(StateStored)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if err := tg.WaitTillDone(ctx, StateStored); err != context.Canceled {
+			t.Fatalf("got error %v, want %v", err, context.Canceled)
+		}
+		// only the subscription of the cancelled wait is removed
+		if n := len(tg.subs[StateStored]); n != 1 {
+			t.Fatalf("got %d subscriptions, want 1", n)
+		}
+		if n := atomic.LoadInt32(&tg.subsActive); n != 1 {
+			t.Fatalf("got %d active subscriptions, want 1", n)
+		}
+
+		tg.Inc(StateStored)
+		if !isClosed(other) {
+			t.Fatal("stored subscription not closed")
+		}
+		if n := atomic.LoadInt32(&tg.subsActive); n != 0 {
+			t.Fatalf("got %d active subscriptions, want 0", n)
+		}
+	})
+}
+
 // tests ETA is precise
 func TestTagETA(t *testing.T) {
 	now := time.Now()
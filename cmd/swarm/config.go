@@ -22,9 +22,7 @@ import (
 	"fmt"
 	"io"
 	"os"
-	"reflect"
 	"strings"
-	"unicode"
 
 	"github.com/ethereum/go-ethereum/common"
 	cli "gopkg.in/urfave/cli.v1"
@@ -85,6 +83,7 @@ const (
 	SwarmEnvStorePath               = "SWARM_STORE_PATH"
 	SwarmEnvStoreCapacity           = "SWARM_STORE_CAPACITY"
 	SwarmEnvStoreCacheCapacity      = "SWARM_STORE_CACHE_CAPACITY"
+	SwarmEnvStoreDataPaths          = "SWARM_STORE_DATA_PATHS"
 	SwarmEnvBootnodeMode            = "SWARM_BOOTNODE_MODE"
 	SwarmEnvNATInterface            = "SWARM_NAT_INTERFACE"
 	SwarmAccessPassword             = "SWARM_ACCESS_PASSWORD"
@@ -93,23 +92,6 @@ const (
 	GethEnvDataDir                  = "GETH_DATADIR"
 )
 
-// These settings ensure that TOML keys use the same names as Go struct fields.
-var tomlSettings = toml.Config{
-	NormFieldName: func(rt reflect.Type, key string) string {
-		return key
-	},
-	FieldToKey: func(rt reflect.Type, field string) string {
-		return field
-	},
-	MissingField: func(rt reflect.Type, field string) error {
-		link := ""
-		if unicode.IsUpper(rune(rt.Name()[0])) && rt.PkgPath() != "main" {
-			link = ", check github.com/holisticode/swarm/api/config.go for available fields"
-		}
-		return fmt.Errorf("field '%s' is not defined in %s%s", field, rt.String(), link)
-	},
-}
-
 //before booting the swarm node, build the configuration
 func buildConfig(ctx *cli.Context) (config *bzzapi.Config, err error) {
 	//start by creating a default config
@@ -166,7 +148,7 @@ func configFileOverride(config *bzzapi.Config, ctx *cli.Context) (*bzzapi.Config
 		//decode the TOML file into a Config struct
 		//note that we are decoding into the existing defaultConfig;
 		//if an entry is not present in the file, the default entry is kept
-		err = tomlSettings.NewDecoder(f).Decode(&config)
+		err = bzzapi.TOMLSettings.NewDecoder(f).Decode(&config)
 		// Add file name to errors that have a line number.
 		if _, ok := err.(*toml.LineError); ok {
 			err = errors.New(filepath + ", " + err.Error())
@@ -246,8 +228,14 @@ func flagsOverride(currentConfig *bzzapi.Config, ctx *cli.Context) *bzzapi.Confi
 		}
 		currentConfig.EnsAPIs = ensAPIs
 	}
-	if rns := ctx.GlobalString(RnsAPIFlag.Name); rns != "" {
-		currentConfig.RnsAPI = rns
+	if ctx.GlobalIsSet(RnsAPIFlag.Name) {
+		rnsAPIs := ctx.GlobalStringSlice(RnsAPIFlag.Name)
+		// preserve backward compatibility to disable RNS with --rns-api=""
+		if len(rnsAPIs) == 1 && rnsAPIs[0] == "" {
+			rnsAPIs = nil
+		}
+		currentConfig.RnsAPI = ""
+		currentConfig.RnsAPIs = rnsAPIs
 	}
 	if cors := ctx.GlobalString(CorsStringFlag.Name); cors != "" {
 		currentConfig.Cors = cors
@@ -255,6 +243,13 @@ func flagsOverride(currentConfig *bzzapi.Config, ctx *cli.Context) *bzzapi.Confi
 	if storePath := ctx.GlobalString(SwarmStorePath.Name); storePath != "" {
 		currentConfig.ChunkDbPath = storePath
 	}
+	if ctx.GlobalIsSet(SwarmStoreDataPaths.Name) {
+		dataPaths := ctx.GlobalStringSlice(SwarmStoreDataPaths.Name)
+		for i := range dataPaths {
+			dataPaths[i] = expandPath(dataPaths[i])
+		}
+		currentConfig.ChunkDataPaths = dataPaths
+	}
 	if storeCapacity := ctx.GlobalUint64(SwarmStoreCapacity.Name); storeCapacity != 0 {
 		currentConfig.DbCapacity = storeCapacity
 	}
@@ -284,7 +279,7 @@ func dumpConfig(ctx *cli.Context) error {
 		utils.Fatalf(fmt.Sprintf("Uh oh - dumpconfig triggered an error %v", err))
 	}
 	comment := ""
-	out, err := tomlSettings.Marshal(&cfg)
+	out, err := bzzapi.TOMLSettings.Marshal(&cfg)
 	if err != nil {
 		return err
 	}
@@ -328,7 +323,7 @@ func validateEnsAPIs(s string) (err error) {
 
 //print a Config as string
 func printConfig(config *bzzapi.Config) string {
-	out, err := tomlSettings.Marshal(&config)
+	out, err := bzzapi.TOMLSettings.Marshal(&config)
 	if err != nil {
 		return fmt.Sprintf("Something is not right with the configuration: %v", err)
 	}
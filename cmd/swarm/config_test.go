@@ -42,7 +42,7 @@ import (
 func TestConfigDump(t *testing.T) {
 	swarm := runSwarm(t, "--verbosity", fmt.Sprintf("%d", *testutil.Loglevel), "dumpconfig")
 	defaultConf := api.NewConfig()
-	out, err := tomlSettings.Marshal(&defaultConf)
+	out, err := api.TOMLSettings.Marshal(&defaultConf)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -321,7 +321,7 @@ func TestConfigFileOverrides(t *testing.T) {
 	defaultConf.HiveParams.KeepAliveInterval = 6000000000
 	//defaultConf.SyncParams.KeyBufferSize = 512
 	//create a TOML string
-	out, err := tomlSettings.Marshal(&defaultConf)
+	out, err := api.TOMLSettings.Marshal(&defaultConf)
 	if err != nil {
 		t.Fatalf("Error creating TOML file in TestFileOverride: %v", err)
 	}
@@ -521,7 +521,7 @@ func TestConfigCmdLineOverridesFile(t *testing.T) {
 	defaultConf.HiveParams.KeepAliveInterval = 6000000000
 	//defaultConf.SyncParams.KeyBufferSize = 512
 	//create a TOML file
-	out, err := tomlSettings.Marshal(&defaultConf)
+	out, err := api.TOMLSettings.Marshal(&defaultConf)
 	if err != nil {
 		t.Fatalf("Error creating TOML file in TestFileOverride: %v", err)
 	}
@@ -119,9 +119,9 @@ var (
 		Usage:  "ENS API endpoint for a TLD and with contract address, can be repeated, format [tld:][contract-addr@]url",
 		EnvVar: SwarmEnvENSAPI,
 	}
-	RnsAPIFlag = cli.StringFlag{
+	RnsAPIFlag = cli.StringSliceFlag{
 		Name:   "rns-api",
-		Usage:  "RNS API endpoint for RKS domains contract address, format [contract-addr@]url",
+		Usage:  "RNS API endpoint for RKS domains contract address, can be repeated, format [contract-addr@]url",
 		EnvVar: SwarmEnvRNSAPI,
 	}
 	SwarmApiFlag = cli.StringFlag{
@@ -180,6 +180,11 @@ var (
 		Usage:  "Path to leveldb chunk DB (default <$GETH_ENV_DIR>/swarm/bzz-<$BZZ_KEY>/chunks)",
 		EnvVar: SwarmEnvStorePath,
 	}
+	SwarmStoreDataPaths = cli.StringSliceFlag{
+		Name:   "store.data-paths",
+		Usage:  "Paths of the databases chunk data is sharded across, e.g. on multiple disks, while indexes stay in store.path (default store.path)",
+		EnvVar: SwarmEnvStoreDataPaths,
+	}
 	SwarmStoreCapacity = cli.Uint64Flag{
 		Name:   "store.size",
 		Usage:  "Number of chunks (5M is roughly 20-25GB) (default 5000000)",
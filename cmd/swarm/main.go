@@ -211,6 +211,7 @@ func init() {
 		SwarmDisableAutoConnectFlag,
 		// storage flags
 		SwarmStorePath,
+		SwarmStoreDataPaths,
 		SwarmStoreCapacity,
 		SwarmStoreCacheCapacity,
 		SwarmGlobalStoreAPIFlag,
@@ -254,6 +255,14 @@ func init() {
 			EnableExport:  ctx.GlobalBool(flags.MetricsEnableInfluxDBExportFlag.Name),
 			DataDirectory: ctx.GlobalString(utils.DataDirFlag.Name),
 			InfluxDBTags:  ctx.GlobalString(flags.MetricsInfluxDBTagsFlag.Name),
+
+			DiskUsageInterval: ctx.GlobalDuration(flags.MetricsDiskUsageIntervalFlag.Name),
+
+			StatsDAddr:   ctx.GlobalString(flags.MetricsStatsDAddrFlag.Name),
+			StatsDPrefix: ctx.GlobalString(flags.MetricsStatsDPrefixFlag.Name),
+
+			PrometheusPushURL:      ctx.GlobalString(flags.MetricsPrometheusPushURLFlag.Name),
+			PrometheusPushInterval: ctx.GlobalDuration(flags.MetricsPrometheusPushIntervalFlag.Name),
 		})
 		tracing.Setup(tracing.Options{
 			Enabled:  ctx.GlobalBool(flags.TracingEnabledFlag.Name),
@@ -101,6 +101,10 @@ func (sw *AsyncHasher) WriteIndexed(i int, section []byte) {
 	sw.mtx.Lock()
 	defer sw.mtx.Unlock()
 	t := sw.GetTree()
+	if t == nil {
+		sw.raiseError(sw.Err().Error())
+		return
+	}
 	// cursor keeps track of the rightmost.GetSection() written so far
 	// if index is lower than cursor then just write non-final section as is
 	if i < sw.Hasher.GetCursor() {
@@ -146,6 +150,11 @@ func (sw *AsyncHasher) WriteIndexed(i int, section []byte) {
 func (sw *AsyncHasher) SumIndexed(b []byte, length int) (s []byte) {
 	sw.mtx.Lock()
 	t := sw.GetTree()
+	if t == nil {
+		sw.mtx.Unlock()
+		sw.raiseError(sw.Err().Error())
+		return b
+	}
 	if length == 0 {
 		sw.ReleaseTree()
 		sw.mtx.Unlock()
@@ -21,6 +21,7 @@ import (
 	"context"
 	"fmt"
 	"math/rand"
+	"sync"
 	"testing"
 
 	"github.com/holisticode/swarm/bmt"
@@ -98,6 +99,55 @@ func TestAsyncCorrectness(t *testing.T) {
 	}
 }
 
+// TestAsyncHasherConcurrentWrites checks that writing sections concurrently from multiple
+// goroutines in random order results in the same root as the synchronous Hasher
+func TestAsyncHasherConcurrentWrites(t *testing.T) {
+	hasher := sha3.NewLegacyKeccak256
+	pool := bmt.NewTreePool(hasher, bmttestutil.SegmentCount, bmt.PoolSize)
+	defer pool.Drain(0)
+	data := testutil.RandomBytes(1, pool.Size)
+
+	for _, double := range []bool{false, true} {
+		t.Run(fmt.Sprintf("double_%v", double), func(t *testing.T) {
+			for i := 0; i < 50; i++ {
+				n := 1 + rand.Intn(len(data))
+				d := data[:n]
+
+				sbmt := bmt.New(pool)
+				sbmt.SetSpan(n)
+				sbmt.Write(d)
+				exp := sbmt.Sum(nil)
+
+				ctx, cancel := context.WithCancel(context.Background())
+				sw := NewAsyncHasher(ctx, bmt.New(pool), double, nil)
+				sw.Reset()
+				sw.SetSpan(n)
+				idxs, segments := splitAndShuffle(sw.SectionSize(), d)
+
+				var wg sync.WaitGroup
+				for _, idx := range idxs {
+					wg.Add(1)
+					go func(idx int) {
+						defer wg.Done()
+						sw.WriteIndexed(idx, segments[idx])
+					}(idx)
+				}
+				c := make(chan []byte, 1)
+				go func() {
+					c <- sw.SumIndexed(nil, n)
+				}()
+				wg.Wait()
+
+				got := <-c
+				cancel()
+				if !bytes.Equal(got, exp) {
+					t.Fatalf("wrong async hash for datalength %v: expected %x, got %x", n, exp, got)
+				}
+			}
+		})
+	}
+}
+
 func BenchmarkBMTAsync(t *testing.B) {
 	whs := []whenHash{first, last, random}
 	for size := 4096; size >= 128; size /= 2 {
@@ -17,6 +17,8 @@
 package flags
 
 import (
+	"time"
+
 	"github.com/ethereum/go-ethereum/cmd/utils"
 	"gopkg.in/urfave/cli.v1"
 )
@@ -30,6 +32,11 @@ var Metrics = []cli.Flag{
 	MetricsInfluxDBUsernameFlag,
 	MetricsInfluxDBPasswordFlag,
 	MetricsInfluxDBTagsFlag,
+	MetricsDiskUsageIntervalFlag,
+	MetricsStatsDAddrFlag,
+	MetricsStatsDPrefixFlag,
+	MetricsPrometheusPushURLFlag,
+	MetricsPrometheusPushIntervalFlag,
 }
 
 var (
@@ -66,4 +73,29 @@ var (
 		Usage: "Comma-separated InfluxDB tags (key/values) attached to all measurements",
 		Value: "host=localhost",
 	}
+	MetricsDiskUsageIntervalFlag = cli.DurationFlag{
+		Name:  "metrics.diskusage.interval",
+		Usage: "Interval between data directory disk usage samples (0 disables sampling)",
+		Value: 4 * time.Second,
+	}
+	MetricsStatsDAddrFlag = cli.StringFlag{
+		Name:  "metrics.statsd.addr",
+		Usage: "Metrics StatsD endpoint (host:port), metrics are exported only if set together with --metrics.influxdb.export",
+		Value: "",
+	}
+	MetricsStatsDPrefixFlag = cli.StringFlag{
+		Name:  "metrics.statsd.prefix",
+		Usage: "Prefix prepended to all metric names sent to StatsD",
+		Value: "swarm.",
+	}
+	MetricsPrometheusPushURLFlag = cli.StringFlag{
+		Name:  "metrics.prometheus.push.url",
+		Usage: "Metrics Prometheus push-gateway URL, metrics are pushed only if set",
+		Value: "",
+	}
+	MetricsPrometheusPushIntervalFlag = cli.DurationFlag{
+		Name:  "metrics.prometheus.push.interval",
+		Usage: "Interval between pushes to the Prometheus push-gateway",
+		Value: 10 * time.Second,
+	}
 )
@@ -27,8 +27,14 @@ import (
 	"github.com/ethereum/go-ethereum/metrics/prometheus"
 	"github.com/holisticode/swarm/log"
 	"github.com/holisticode/swarm/metrics/influxdb"
+	swarmprometheus "github.com/holisticode/swarm/metrics/prometheus"
+	"github.com/holisticode/swarm/metrics/statsd"
 )
 
+// DefaultPrometheusPushInterval is the interval at which metrics are pushed
+// to the Prometheus push-gateway if no interval is provided
+const DefaultPrometheusPushInterval = 10 * time.Second
+
 type Options struct {
 	Endoint       string
 	Database      string
@@ -37,6 +43,14 @@ type Options struct {
 	EnableExport  bool
 	DataDirectory string
 	InfluxDBTags  string
+
+	DiskUsageInterval time.Duration // interval between data directory disk usage samples, disabled if 0
+
+	StatsDAddr   string // StatsD endpoint address (host:port), export is disabled if empty
+	StatsDPrefix string // prefix prepended to all metric names sent to StatsD
+
+	PrometheusPushURL      string        // Prometheus push-gateway URL, push is disabled if empty
+	PrometheusPushInterval time.Duration // interval between pushes to the Prometheus push-gateway
 }
 
 func init() {
@@ -51,7 +65,10 @@ func Setup(o Options) {
 		go metrics.CollectProcessMetrics(4 * time.Second)
 
 		// Start collecting disk metrics
-		go datadirDiskUsage(o.DataDirectory, 4*time.Second)
+		// walking a large data directory is expensive, so it can be sampled less often or disabled
+		if o.DiskUsageInterval > 0 {
+			go datadirDiskUsage(o.DataDirectory, o.DiskUsageInterval)
+		}
 
 		go captureRuntimeMemStats(metrics.DefaultRegistry, 4*time.Second)
 
@@ -61,6 +78,19 @@ func Setup(o Options) {
 			log.Info("Enabling swarm metrics export to InfluxDB")
 			go influxdb.InfluxDBWithTags(metrics.DefaultRegistry, 10*time.Second, o.Endoint, o.Database, o.Username, o.Password, "swarm.", tagsMap)
 			go influxdb.InfluxDBWithTags(metrics.AccountingRegistry, 10*time.Second, o.Endoint, o.Database, o.Username, o.Password, "accounting.", tagsMap)
+			if o.StatsDAddr != "" {
+				log.Info("Enabling swarm metrics export to StatsD", "addr", o.StatsDAddr)
+				go statsd.StatsD(metrics.DefaultRegistry, 10*time.Second, o.StatsDAddr, o.StatsDPrefix)
+			}
+		}
+
+		if o.PrometheusPushURL != "" {
+			interval := o.PrometheusPushInterval
+			if interval <= 0 {
+				interval = DefaultPrometheusPushInterval
+			}
+			log.Info("Enabling swarm metrics push to Prometheus push-gateway", "url", o.PrometheusPushURL, "interval", interval)
+			go swarmprometheus.Push(metrics.DefaultRegistry, interval, o.PrometheusPushURL, "swarm", "swarm_")
 		}
 		http.Handle("/debug/metrics/prometheus/accounting", prometheus.Handler(metrics.AccountingRegistry))
 	}
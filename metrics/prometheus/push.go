@@ -0,0 +1,158 @@
+// Copyright 2019 The Swarm authors
+// This file is part of the swarm library.
+//
+// The swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package prometheus
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	uurl "net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+)
+
+// pusher pushes the metrics of a registry to a Prometheus push-gateway
+type pusher struct {
+	reg      metrics.Registry
+	interval time.Duration
+
+	url       string
+	namespace string
+
+	client *http.Client
+}
+
+// Push starts a Prometheus push-gateway reporter which will push the metrics from the given
+// metrics.Registry at each d interval, grouped under the given job name.
+func Push(r metrics.Registry, d time.Duration, url, job, namespace string) {
+	p, err := newPusher(r, d, url, job, namespace)
+	if err != nil {
+		log.Warn("Unable to parse Prometheus push-gateway", "url", url, "err", err)
+		return
+	}
+	p.run()
+}
+
+func newPusher(r metrics.Registry, d time.Duration, url, job, namespace string) (*pusher, error) {
+	u, err := uurl.Parse(url)
+	if err != nil {
+		return nil, err
+	}
+	// the job is escaped in the raw path, so that it may contain slashes
+	u.RawPath = strings.TrimSuffix(u.EscapedPath(), "/") + "/metrics/job/" + uurl.PathEscape(job)
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/metrics/job/" + job
+	return &pusher{
+		reg:       r,
+		interval:  d,
+		url:       u.String(),
+		namespace: namespace,
+		client:    &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+func (p *pusher) run() {
+	for range time.Tick(p.interval) {
+		if err := p.send(); err != nil {
+			log.Warn("Unable to push to Prometheus push-gateway", "err", err)
+		}
+	}
+}
+
+func (p *pusher) send() error {
+	req, err := http.NewRequest(http.MethodPut, p.url, bytes.NewReader(p.collect()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; version=0.0.4")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// collect renders the metrics of the registry in the Prometheus text exposition format
+func (p *pusher) collect() []byte {
+	var names []string
+	p.reg.Each(func(name string, i interface{}) {
+		names = append(names, name)
+	})
+	sort.Strings(names)
+
+	buf := &bytes.Buffer{}
+	for _, name := range names {
+		key := mutateKey(p.namespace + name)
+
+		switch metric := p.reg.Get(name).(type) {
+		case metrics.Counter:
+			writeValue(buf, key, "counter", metric.Count())
+		case metrics.Gauge:
+			writeValue(buf, key, "gauge", metric.Value())
+		case metrics.GaugeFloat64:
+			writeValue(buf, key, "gauge", metric.Value())
+		case metrics.Meter:
+			writeValue(buf, key, "counter", metric.Count())
+		case metrics.Histogram:
+			ms := metric.Snapshot()
+			writeSummary(buf, key, ms.Count(), ms.Sum(), []float64{0.5, 0.75, 0.95, 0.99}, ms.Percentiles([]float64{0.5, 0.75, 0.95, 0.99}))
+		case metrics.Timer:
+			ms := metric.Snapshot()
+			writeSummary(buf, key, ms.Count(), ms.Sum(), []float64{0.5, 0.75, 0.95, 0.99}, ms.Percentiles([]float64{0.5, 0.75, 0.95, 0.99}))
+		case metrics.ResettingTimer:
+			t := metric.Snapshot()
+			val := t.Values()
+			if len(val) == 0 {
+				continue
+			}
+			var sum int64
+			for _, v := range val {
+				sum += v
+			}
+			ps := t.Percentiles([]float64{50, 95, 99})
+			writeSummary(buf, key, int64(len(val)), sum, []float64{0.5, 0.95, 0.99}, []float64{float64(ps[0]), float64(ps[1]), float64(ps[2])})
+		}
+	}
+	return buf.Bytes()
+}
+
+func writeValue(buf *bytes.Buffer, key, typ string, value interface{}) {
+	fmt.Fprintf(buf, "# TYPE %s %s\n", key, typ)
+	fmt.Fprintf(buf, "%s %v\n", key, value)
+}
+
+func writeSummary(buf *bytes.Buffer, key string, count, sum int64, quantiles, values []float64) {
+	fmt.Fprintf(buf, "# TYPE %s summary\n", key)
+	for i, q := range quantiles {
+		fmt.Fprintf(buf, "%s{quantile=\"%s\"} %v\n", key, strconv.FormatFloat(q, 'f', -1, 64), values[i])
+	}
+	fmt.Fprintf(buf, "%s_sum %d\n", key, sum)
+	fmt.Fprintf(buf, "%s_count %d\n", key, count)
+}
+
+// mutateKey makes the metric name a valid Prometheus metric name
+func mutateKey(key string) string {
+	return strings.NewReplacer("/", "_", ".", "_", "-", "_").Replace(key)
+}
@@ -0,0 +1,88 @@
+// Copyright 2019 The Swarm authors
+// This file is part of the swarm library.
+//
+// The swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package prometheus
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/metrics"
+)
+
+// TestPusherSend checks that the metrics of the registry are pushed to the
+// job path of the push-gateway in the Prometheus text exposition format
+func TestPusherSend(t *testing.T) {
+	defer func(enabled bool) { metrics.Enabled = enabled }(metrics.Enabled)
+	metrics.Enabled = true
+
+	type request struct {
+		method, path, contentType, body string
+	}
+	requests := make(chan request, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		requests <- request{r.Method, r.URL.Path, r.Header.Get("Content-Type"), string(body)}
+	}))
+	defer server.Close()
+
+	r := metrics.NewRegistry()
+	metrics.NewRegisteredCounter("netstore/get", r).Inc(3)
+	metrics.NewRegisteredGauge("kad.depth", r).Update(5)
+
+	p, err := newPusher(r, time.Second, server.URL+"/", "swarm node", "swarm_")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.send(); err != nil {
+		t.Fatal(err)
+	}
+
+	req := <-requests
+	if req.method != http.MethodPut {
+		t.Errorf("got method %s, want %s", req.method, http.MethodPut)
+	}
+	if want := "/metrics/job/swarm node"; req.path != want {
+		t.Errorf("got path %q, want %q", req.path, want)
+	}
+	if !strings.HasPrefix(req.contentType, "text/plain") {
+		t.Errorf("got content type %q", req.contentType)
+	}
+	want := "# TYPE swarm_kad_depth gauge\nswarm_kad_depth 5\n# TYPE swarm_netstore_get counter\nswarm_netstore_get 3\n"
+	if req.body != want {
+		t.Errorf("got body %q, want %q", req.body, want)
+	}
+}
+
+// TestPusherSendError checks that a non 2xx response of the push-gateway is reported
+func TestPusherSendError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	p, err := newPusher(metrics.NewRegistry(), time.Second, server.URL, "swarm", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.send(); err == nil {
+		t.Fatal("expected an error")
+	}
+}
@@ -0,0 +1,149 @@
+// Copyright 2019 The Swarm authors
+// This file is part of the swarm library.
+//
+// The swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package statsd
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+)
+
+// maxPacketSize is the maximum size of a single UDP datagram sent to StatsD
+const maxPacketSize = 1432
+
+type reporter struct {
+	reg      metrics.Registry
+	interval time.Duration
+	prefix   string
+
+	conn net.Conn
+
+	cache map[string]int64
+}
+
+// StatsD starts a StatsD reporter which will send the metrics from the given metrics.Registry
+// to the StatsD endpoint at addr over UDP at each d interval.
+// Counters are sent as the delta between flushes.
+func StatsD(r metrics.Registry, d time.Duration, addr, prefix string) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		log.Warn("Unable to connect to StatsD", "addr", addr, "err", err)
+		return
+	}
+	defer conn.Close()
+
+	rep := &reporter{
+		reg:      r,
+		interval: d,
+		prefix:   prefix,
+		conn:     conn,
+		cache:    make(map[string]int64),
+	}
+	rep.run()
+}
+
+func (r *reporter) run() {
+	for range time.Tick(r.interval) {
+		if err := r.send(); err != nil {
+			log.Warn("Unable to send to StatsD", "err", err)
+		}
+	}
+}
+
+func (r *reporter) send() error {
+	var lines []string
+
+	r.reg.Each(func(name string, i interface{}) {
+		name = r.prefix + mutateKey(name)
+
+		switch metric := i.(type) {
+		case metrics.Counter:
+			v := metric.Count()
+			l := r.cache[name]
+			lines = append(lines, fmt.Sprintf("%s:%d|c", name, v-l))
+			r.cache[name] = v
+		case metrics.Gauge:
+			lines = append(lines, fmt.Sprintf("%s:%d|g", name, metric.Snapshot().Value()))
+		case metrics.GaugeFloat64:
+			lines = append(lines, fmt.Sprintf("%s:%f|g", name, metric.Snapshot().Value()))
+		case metrics.Meter:
+			v := metric.Count()
+			l := r.cache[name]
+			lines = append(lines, fmt.Sprintf("%s:%d|c", name, v-l))
+			r.cache[name] = v
+		case metrics.Histogram:
+			ms := metric.Snapshot()
+			ps := ms.Percentiles([]float64{0.5, 0.95, 0.99})
+			lines = append(lines,
+				fmt.Sprintf("%s.count:%d|g", name, ms.Count()),
+				fmt.Sprintf("%s.mean:%f|g", name, ms.Mean()),
+				fmt.Sprintf("%s.p50:%f|g", name, ps[0]),
+				fmt.Sprintf("%s.p95:%f|g", name, ps[1]),
+				fmt.Sprintf("%s.p99:%f|g", name, ps[2]),
+			)
+		case metrics.Timer:
+			ms := metric.Snapshot()
+			ps := ms.Percentiles([]float64{0.5, 0.95, 0.99})
+			lines = append(lines,
+				fmt.Sprintf("%s.count:%d|g", name, ms.Count()),
+				fmt.Sprintf("%s.mean:%f|ms", name, ms.Mean()/float64(time.Millisecond)),
+				fmt.Sprintf("%s.p50:%f|ms", name, ps[0]/float64(time.Millisecond)),
+				fmt.Sprintf("%s.p95:%f|ms", name, ps[1]/float64(time.Millisecond)),
+				fmt.Sprintf("%s.p99:%f|ms", name, ps[2]/float64(time.Millisecond)),
+			)
+		case metrics.ResettingTimer:
+			// resetting timers hold the values recorded since the last snapshot
+			for _, v := range metric.Snapshot().Values() {
+				lines = append(lines, fmt.Sprintf("%s:%f|ms", name, float64(v)/float64(time.Millisecond)))
+			}
+		}
+	})
+
+	return r.write(lines)
+}
+
+// write sends the lines to StatsD, batching them in packets not exceeding maxPacketSize
+func (r *reporter) write(lines []string) error {
+	var buf bytes.Buffer
+	for _, line := range lines {
+		if buf.Len() > 0 && buf.Len()+len(line)+1 > maxPacketSize {
+			if _, err := r.conn.Write(buf.Bytes()); err != nil {
+				return err
+			}
+			buf.Reset()
+		}
+		if buf.Len() > 0 {
+			buf.WriteByte('\n')
+		}
+		buf.WriteString(line)
+	}
+	if buf.Len() > 0 {
+		if _, err := r.conn.Write(buf.Bytes()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func mutateKey(key string) string {
+	return strings.Replace(key, "/", ".", -1)
+}
@@ -0,0 +1,126 @@
+// Copyright 2019 The Swarm authors
+// This file is part of the swarm library.
+//
+// The swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package statsd
+
+import (
+	"net"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/metrics"
+)
+
+// newTestReporter returns a reporter of the registry sending to a local UDP
+// listener and a function that receives the lines of the next packet
+func newTestReporter(t *testing.T, r metrics.Registry, prefix string) (*reporter, func() []string, func()) {
+	t.Helper()
+	l, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := net.Dial("udp", l.LocalAddr().String())
+	if err != nil {
+		l.Close()
+		t.Fatal(err)
+	}
+	rep := &reporter{
+		reg:      r,
+		interval: time.Second,
+		prefix:   prefix,
+		conn:     conn,
+		cache:    make(map[string]int64),
+	}
+	receive := func() []string {
+		t.Helper()
+		buf := make([]byte, maxPacketSize)
+		l.SetReadDeadline(time.Now().Add(5 * time.Second))
+		n, _, err := l.ReadFrom(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines := strings.Split(string(buf[:n]), "\n")
+		sort.Strings(lines)
+		return lines
+	}
+	return rep, receive, func() {
+		conn.Close()
+		l.Close()
+	}
+}
+
+// TestReporterSend checks that counters are sent as deltas between flushes
+// and gauges as their current values
+func TestReporterSend(t *testing.T) {
+	defer func(enabled bool) { metrics.Enabled = enabled }(metrics.Enabled)
+	metrics.Enabled = true
+
+	r := metrics.NewRegistry()
+	counter := metrics.NewRegisteredCounter("netstore/get", r)
+	gauge := metrics.NewRegisteredGauge("kad/depth", r)
+
+	rep, receive, cleanup := newTestReporter(t, r, "swarm.")
+	defer cleanup()
+
+	for _, tc := range []struct {
+		inc   int64
+		depth int64
+		want  []string
+	}{
+		{inc: 3, depth: 5, want: []string{"swarm.kad.depth:5|g", "swarm.netstore.get:3|c"}},
+		{inc: 2, depth: 4, want: []string{"swarm.kad.depth:4|g", "swarm.netstore.get:2|c"}},
+		{inc: 0, depth: 4, want: []string{"swarm.kad.depth:4|g", "swarm.netstore.get:0|c"}},
+	} {
+		counter.Inc(tc.inc)
+		gauge.Update(tc.depth)
+		if err := rep.send(); err != nil {
+			t.Fatal(err)
+		}
+		got := receive()
+		if strings.Join(got, " ") != strings.Join(tc.want, " ") {
+			t.Fatalf("got lines %v, want %v", got, tc.want)
+		}
+	}
+}
+
+// TestReporterWritePackets checks that lines are batched in packets
+// not exceeding maxPacketSize
+func TestReporterWritePackets(t *testing.T) {
+	rep, receive, cleanup := newTestReporter(t, metrics.NewRegistry(), "")
+	defer cleanup()
+
+	line := strings.Repeat("a", 100) + ":1|c"
+	var lines []string
+	for i := 0; i < 30; i++ {
+		lines = append(lines, line)
+	}
+	if err := rep.write(lines); err != nil {
+		t.Fatal(err)
+	}
+	var count int
+	for count < len(lines) {
+		got := receive()
+		if size := len(strings.Join(got, "\n")); size > maxPacketSize {
+			t.Fatalf("got packet of %d bytes, want at most %d", size, maxPacketSize)
+		}
+		count += len(got)
+	}
+	if count != len(lines) {
+		t.Fatalf("got %d lines, want %d", count, len(lines))
+	}
+}
@@ -1,16 +1,23 @@
 package network
 
 import (
+	"errors"
 	"fmt"
 	"io"
 
 	"github.com/ethereum/go-ethereum/p2p"
 	"github.com/ethereum/go-ethereum/p2p/enode"
 	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/holisticode/swarm/chunk"
 	"github.com/holisticode/swarm/log"
+	"github.com/holisticode/swarm/network/capability"
 	"github.com/holisticode/swarm/p2p/protocols"
 )
 
+// ErrInvalidENRAddr is returned when decoding an ENRAddrEntry
+// whose bzz address does not have the overlay address length
+var ErrInvalidENRAddr = errors.New("invalid bzz address length in enode record")
+
 // ENRAddrEntry is the entry type to store the bzz key in the enode
 type ENRAddrEntry struct {
 	data []byte
@@ -43,11 +50,60 @@ func (b *ENRAddrEntry) DecodeRLP(s *rlp.Stream) error {
 	if err != nil {
 		return err
 	}
+	if len(byt) != chunk.AddressLength {
+		return ErrInvalidENRAddr
+	}
 	b.data = byt
 	log.Debug("in decoderlp", "b", b, "p", fmt.Sprintf("%p", &b))
 	return nil
 }
 
+// ENRCapabilitiesEntry is the entry type to store the node capabilities in the enode
+type ENRCapabilitiesEntry struct {
+	caps *capability.Capabilities
+}
+
+func NewENRCapabilitiesEntry(caps *capability.Capabilities) *ENRCapabilitiesEntry {
+	return &ENRCapabilitiesEntry{
+		caps: caps,
+	}
+}
+
+func (b ENRCapabilitiesEntry) Capabilities() *capability.Capabilities {
+	return b.caps
+}
+
+// ENRKey implements enr.Entry
+func (b ENRCapabilitiesEntry) ENRKey() string {
+	return "bzzcaps"
+}
+
+// EncodeRLP implements rlp.Encoder
+func (b ENRCapabilitiesEntry) EncodeRLP(w io.Writer) error {
+	if b.caps == nil {
+		return rlp.Encode(w, capability.NewCapabilities())
+	}
+	return rlp.Encode(w, b.caps)
+}
+
+// DecodeRLP implements rlp.Decoder
+func (b *ENRCapabilitiesEntry) DecodeRLP(s *rlp.Stream) error {
+	caps := capability.NewCapabilities()
+	if err := caps.DecodeRLP(s); err != nil {
+		return err
+	}
+	b.caps = caps
+	return nil
+}
+
+// ENRVersionEntry is the entry type to store the bzz protocol version in the enode
+type ENRVersionEntry uint
+
+// ENRKey implements enr.Entry
+func (v ENRVersionEntry) ENRKey() string {
+	return "bzzversion"
+}
+
 type ENRBootNodeEntry bool
 
 func (b ENRBootNodeEntry) ENRKey() string {
@@ -55,27 +111,44 @@ func (b ENRBootNodeEntry) ENRKey() string {
 }
 
 func getENRBzzPeer(p *p2p.Peer, rw p2p.MsgReadWriter, spec *protocols.Spec) *BzzPeer {
-	var bootnode ENRBootNodeEntry
+	var version ENRVersionEntry
 
 	// retrieve the ENR Record data
 	record := p.Node().Record()
-	record.Load(&bootnode)
+	record.Load(&version)
 
 	// get the address; separate function as long as we need swarm/network:NewBzzAddrFromEnode() to call it
 	addr := getENRBzzAddr(p.Node())
 
 	// build the peer using the retrieved data
 	return &BzzPeer{
-		Peer:    protocols.NewPeer(p, rw, spec),
-		BzzAddr: addr,
+		Peer:     protocols.NewPeer(p, rw, spec),
+		BzzAddr:  addr,
+		Version:  uint(version),
+		Bootnode: isENRBootnode(p.Node()),
+	}
+}
+
+// isENRBootnode returns whether the node advertises itself as a bootnode in its record
+func isENRBootnode(nod *enode.Node) bool {
+	var bootnode ENRBootNodeEntry
+	if err := nod.Record().Load(&bootnode); err != nil {
+		return false
 	}
+	return bool(bootnode)
 }
 
 func getENRBzzAddr(nod *enode.Node) *BzzAddr {
 	var addr ENRAddrEntry
+	var caps ENRCapabilitiesEntry
 
 	record := nod.Record()
 	record.Load(&addr)
 
-	return NewBzzAddr(addr.data, []byte(nod.String()))
+	bzzAddr := NewBzzAddr(addr.data, []byte(nod.String()))
+	// capabilities are optional in the record, keep the empty ones if not present
+	if err := record.Load(&caps); err == nil {
+		bzzAddr.Capabilities = caps.caps
+	}
+	return bzzAddr
 }
@@ -0,0 +1,155 @@
+package network
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/holisticode/swarm/chunk"
+	"github.com/holisticode/swarm/network/capability"
+)
+
+// TestENRCapabilitiesEntryRLP verifies reversibility of RLP serialization of ENRCapabilitiesEntry
+func TestENRCapabilitiesEntryRLP(t *testing.T) {
+	caps := capability.NewCapabilities()
+	caps.Add(fullCapability)
+	entry := NewENRCapabilitiesEntry(caps)
+	b, err := rlp.EncodeToBytes(entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var entryRecovered ENRCapabilitiesEntry
+	err = rlp.DecodeBytes(b, &entryRecovered)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !caps.Match(entryRecovered.Capabilities()) || !entryRecovered.Capabilities().Match(caps) {
+		t.Fatalf("capabilities mismatch, expected %v, got %v", caps, entryRecovered.Capabilities())
+	}
+}
+
+// TestENRBzzAddrCapabilities verifies that the capabilities stored in the enode record
+// are loaded into the BzzAddr
+func TestENRBzzAddrCapabilities(t *testing.T) {
+	for _, lightNode := range []bool{false, true} {
+		prvKey, err := crypto.GenerateKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		nod, err := NewEnode(&EnodeParams{
+			PrivateKey: prvKey,
+			EnodeKey:   prvKey,
+			Lightnode:  lightNode,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		addr := getENRBzzAddr(nod)
+		c := addr.Capabilities.Get(CapabilityID)
+		if c == nil {
+			t.Fatalf("lightnode %v: expected capability %d in enode record", lightNode, CapabilityID)
+		}
+		if lightNode && !isLightCapability(c) {
+			t.Fatalf("expected light capability, got %v", c)
+		}
+		if !lightNode && !isFullCapability(c) {
+			t.Fatalf("expected full capability, got %v", c)
+		}
+	}
+}
+
+// TestENRAddrEntryRLP verifies reversibility of RLP serialization of ENRAddrEntry
+func TestENRAddrEntryRLP(t *testing.T) {
+	entry := NewENRAddrEntry(RandomBzzAddr().Over())
+	b, err := rlp.EncodeToBytes(entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var entryRecovered ENRAddrEntry
+	err = rlp.DecodeBytes(b, &entryRecovered)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(entry.Address(), entryRecovered.Address()) {
+		t.Fatalf("address mismatch, expected %x, got %x", entry.Address(), entryRecovered.Address())
+	}
+}
+
+// TestENRAddrEntryRLPInvalidLength verifies that decoding an ENRAddrEntry
+// fails if the address is not of the overlay address length
+func TestENRAddrEntryRLPInvalidLength(t *testing.T) {
+	for _, length := range []int{0, chunk.AddressLength - 1, chunk.AddressLength + 1} {
+		entry := NewENRAddrEntry(make([]byte, length))
+		b, err := rlp.EncodeToBytes(entry)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var entryRecovered ENRAddrEntry
+		err = rlp.DecodeBytes(b, &entryRecovered)
+		if err != ErrInvalidENRAddr {
+			t.Fatalf("length %d: got error %v, want %v", length, err, ErrInvalidENRAddr)
+		}
+	}
+}
+
+// TestENRVersionEntryRLP verifies reversibility of RLP serialization of ENRVersionEntry
+func TestENRVersionEntryRLP(t *testing.T) {
+	entry := ENRVersionEntry(BzzSpec.Version)
+	b, err := rlp.EncodeToBytes(entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var entryRecovered ENRVersionEntry
+	err = rlp.DecodeBytes(b, &entryRecovered)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry != entryRecovered {
+		t.Fatalf("version mismatch, expected %d, got %d", entry, entryRecovered)
+	}
+}
+
+// TestENRVersionEntryRecord verifies that the bzz protocol version is written in the enode record
+func TestENRVersionEntryRecord(t *testing.T) {
+	prvKey, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	nod, err := NewEnode(&EnodeParams{
+		PrivateKey: prvKey,
+		EnodeKey:   prvKey,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var version ENRVersionEntry
+	err = nod.Record().Load(&version)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uint(version) != BzzSpec.Version {
+		t.Fatalf("version mismatch, expected %d, got %d", BzzSpec.Version, version)
+	}
+}
+
+// TestENRBootnodeEntryRecord verifies that the bootnode flag is read from the enode record
+func TestENRBootnodeEntryRecord(t *testing.T) {
+	for _, bootnode := range []bool{false, true} {
+		prvKey, err := crypto.GenerateKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		nod, err := NewEnode(&EnodeParams{
+			PrivateKey: prvKey,
+			EnodeKey:   prvKey,
+			Bootnode:   bootnode,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if isENRBootnode(nod) != bootnode {
+			t.Fatalf("expected bootnode %v in enode record", bootnode)
+		}
+	}
+}
@@ -48,8 +48,29 @@ type HiveParams struct {
 	PeersBroadcastSetSize uint8 // how many peers to use when relaying
 	MaxPeersPerRequest    uint8 // max size for peer address batches
 	KeepAliveInterval     time.Duration
+	// MaxConcurrentDials is the maximum number of outstanding dials to suggested peers,
+	// which are dialled at each KeepAliveInterval until the limit is reached.
+	// If 0, the number of outstanding dials is not limited and one peer is dialled at each interval.
+	MaxConcurrentDials int
+	// DialTimeout is the time after which a dial that did not result in a connection
+	// is no longer counted as outstanding. As failed dials are not reported, a dial is
+	// outstanding until the peer connects or the timeout passes. If 0, defaultDialTimeout is used.
+	DialTimeout time.Duration
+	// NeighbourhoodGossip makes the hive request the nearest neighbours of every connected peer
+	// and register them, so that a joining node finds its neighbourhood without waiting for
+	// the peers to be gossiped. It requires discovery, and only peers which advertise the
+	// hive capability in the bzz handshake are requested, as older peers do not handle neighboursMsg.
+	NeighbourhoodGossip bool
+	// RegisterDebounce is the window within which the addresses registered through the hive
+	// are coalesced into a single peer suggestion, so that newly learned addresses are dialled
+	// before the next KeepAliveInterval, but a burst of them does not trigger a suggestion each.
+	// If 0, peers are suggested only at each KeepAliveInterval.
+	RegisterDebounce time.Duration
 }
 
+// defaultDialTimeout is the dial timeout used if HiveParams.DialTimeout is not set
+var defaultDialTimeout = 10 * time.Second
+
 // NewHiveParams returns hive config with only the
 func NewHiveParams() *HiveParams {
 	return &HiveParams{
@@ -57,6 +78,8 @@ func NewHiveParams() *HiveParams {
 		PeersBroadcastSetSize: 3,
 		MaxPeersPerRequest:    5,
 		KeepAliveInterval:     500 * time.Millisecond,
+		DialTimeout:           defaultDialTimeout,
+		RegisterDebounce:      100 * time.Millisecond,
 	}
 }
 
@@ -69,9 +92,12 @@ type Hive struct {
 	// bookkeeping
 	lock    sync.Mutex
 	peers   map[enode.ID]*BzzPeer
+	dials   map[enode.ID]time.Time // outstanding dials with their start time
 	ticker  *time.Ticker
 	done    chan struct{}
 	started bool
+
+	suggest chan struct{} // signals the connect loop to suggest peers out of KeepAliveInterval
 }
 
 // NewHive constructs a new hive
@@ -84,6 +110,8 @@ func NewHive(params *HiveParams, kad *Kademlia, store state.Store) *Hive {
 		Kademlia:   kad,
 		Store:      store,
 		peers:      make(map[enode.ID]*BzzPeer),
+		dials:      make(map[enode.ID]time.Time),
+		suggest:    make(chan struct{}, 1),
 	}
 }
 
@@ -154,43 +182,127 @@ func (h *Hive) Stop() error {
 // connect is a forever loop
 // at each iteration, ask the overlay driver to suggest the most preferred peer to connect to
 // as well as advertises saturation depth if needed
+// Suggestions requested for registered addresses are run once per RegisterDebounce
+// at most, so that a burst of registrations results in a single suggestion
 func (h *Hive) connect() {
+	var debounce <-chan time.Time
 	for {
 		select {
 		case <-h.ticker.C:
 			h.tickHive()
+		case <-h.suggest:
+			if debounce == nil {
+				debounce = time.After(h.RegisterDebounce)
+			}
+		case <-debounce:
+			debounce = nil
+			h.tickHive()
 		case <-h.done:
 			return
 		}
 	}
 }
 
+// tickHive dials the peers suggested by the overlay driver, one peer if
+// MaxConcurrentDials is 0, otherwise until MaxConcurrentDials dials are outstanding
 func (h *Hive) tickHive() {
-	addr, depth, changed := h.SuggestPeer()
-	if h.Discovery && changed {
-		h.NotifyDepth(uint8(depth))
-	}
-	if addr != nil {
-		log.Trace(fmt.Sprintf("%08x hive connect() suggested %08x", h.BaseAddr()[:4], addr.Address()[:4]))
-		underA := addr.Under()
-		s := string(underA)
-		under, err := enode.ParseV4(s)
-		if err != nil {
-			log.Warn(fmt.Sprintf("%08x unable to connect to bee %08x: invalid node URL: %v", h.BaseAddr()[:4], addr.Address()[:4], err))
+	for h.dialAvailable() {
+		addr, depth, changed := h.SuggestPeer()
+		if h.Discovery && changed {
+			h.NotifyDepth(uint8(depth))
+		}
+		if addr == nil || !h.dial(addr) || h.MaxConcurrentDials <= 0 {
 			return
 		}
-		log.Trace(fmt.Sprintf("%08x attempt to connect to bee %08x", h.BaseAddr()[:4], addr.Address()[:4]))
-		h.addPeer(under)
 	}
 }
 
+// Register enters the addresses into the overlay address book like Kademlia.Register
+// and schedules a peer suggestion for them after RegisterDebounce
+func (h *Hive) Register(peers ...*BzzAddr) error {
+	err := h.Kademlia.Register(peers...)
+	h.scheduleSuggest()
+	return err
+}
+
+// scheduleSuggest signals the connect loop to suggest peers after RegisterDebounce,
+// unless a suggestion is already pending, so that addresses registered in bursts are coalesced
+// The addresses loaded or registered before the hive is started are not signalled.
+func (h *Hive) scheduleSuggest() {
+	if h.RegisterDebounce <= 0 || h.DisableAutoConnect {
+		return
+	}
+	h.lock.Lock()
+	started := h.started
+	h.lock.Unlock()
+	if !started {
+		return
+	}
+	select {
+	case h.suggest <- struct{}{}:
+	default:
+	}
+}
+
+// dialAvailable removes the timed out dials and returns whether a new dial can be started
+func (h *Hive) dialAvailable() bool {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	timeout := h.DialTimeout
+	if timeout <= 0 {
+		timeout = defaultDialTimeout
+	}
+	for id, start := range h.dials {
+		if time.Since(start) > timeout {
+			log.Trace(fmt.Sprintf("%08x hive dial to %v timed out", h.BaseAddr()[:4], id))
+			delete(h.dials, id)
+		}
+	}
+	return h.MaxConcurrentDials <= 0 || len(h.dials) < h.MaxConcurrentDials
+}
+
+// dial connects to the peer with the address and counts the dial as outstanding
+// until the peer is connected or the dial times out
+// It returns false if the address is invalid or the peer is already being dialled
+func (h *Hive) dial(addr *BzzAddr) bool {
+	log.Trace(fmt.Sprintf("%08x hive connect() suggested %08x", h.BaseAddr()[:4], addr.Address()[:4]))
+	underA := addr.Under()
+	s := string(underA)
+	under, err := enode.ParseV4(s)
+	if err != nil {
+		log.Warn(fmt.Sprintf("%08x unable to connect to bee %08x: invalid node URL: %v", h.BaseAddr()[:4], addr.Address()[:4], err))
+		return false
+	}
+	h.lock.Lock()
+	_, dialling := h.dials[under.ID()]
+	if !dialling {
+		h.dials[under.ID()] = time.Now()
+	}
+	h.lock.Unlock()
+	if dialling {
+		return false
+	}
+	log.Trace(fmt.Sprintf("%08x attempt to connect to bee %08x", h.BaseAddr()[:4], addr.Address()[:4]))
+	h.addPeer(under)
+	return true
+}
+
 // Run protocol run function
 func (h *Hive) Run(p *BzzPeer) error {
 	h.trackPeer(p)
 	defer h.untrackPeer(p)
 
+	if p.Bootnode {
+		h.MarkBootnodes(p.BzzAddr)
+	}
 	dp := NewPeer(p, h.Kademlia)
-	depth, changed := h.On(dp)
+	depth, changed, evicted, err := h.OnLimited(dp)
+	if err != nil {
+		return err
+	}
+	if evicted != nil {
+		evicted.Drop("evicted from full kademlia bin")
+	}
 	// if we want discovery, advertise change of depth
 	if h.Discovery {
 		if changed {
@@ -201,6 +313,9 @@ func (h *Hive) Run(p *BzzPeer) error {
 			dp.NotifyDepth(depth)
 		}
 		h.NotifyPeer(p.BzzAddr)
+		if h.NeighbourhoodGossip && handlesNeighboursMsg(p.BzzAddr) {
+			go dp.Send(context.TODO(), &neighboursMsg{})
+		}
 	}
 	defer h.Off(dp)
 	return dp.Run(h.handleMsg(dp))
@@ -209,6 +324,7 @@ func (h *Hive) Run(p *BzzPeer) error {
 func (h *Hive) trackPeer(p *BzzPeer) {
 	h.lock.Lock()
 	h.peers[p.ID()] = p
+	delete(h.dials, p.ID())
 	h.lock.Unlock()
 }
 
@@ -341,6 +457,8 @@ func (h *Hive) handleMsg(p *Peer) func(context.Context, interface{}) error {
 			return h.handlePeersMsg(p, msg)
 		case *subPeersMsg:
 			return h.handleSubPeersMsg(ctx, p, msg)
+		case *neighboursMsg:
+			return h.handleNeighboursMsg(ctx, p, msg)
 		}
 
 		return fmt.Errorf("unknown message type: %T", msg)
@@ -375,9 +493,17 @@ func (h *Hive) handlePeersMsg(d *Peer, msg *peersMsg) error {
 	}
 	for _, a := range msg.Peers {
 		d.seen(a)
+	}
+	// only notify peers about addresses that were not known yet,
+	// the known ones have already been gossiped
+	added, _, err := h.RegisterReport(msg.Peers...)
+	for _, a := range added {
 		h.NotifyPeer(a)
 	}
-	return h.Register(msg.Peers...)
+	if len(added) > 0 {
+		h.scheduleSuggest()
+	}
+	return err
 }
 
 // handleSubPeersMsg handles incoming subPeersMsg
@@ -417,3 +543,26 @@ func (h *Hive) handleSubPeersMsg(ctx context.Context, d *Peer, msg *subPeersMsg)
 	}
 	return nil
 }
+
+// handleNeighboursMsg handles incoming neighboursMsg
+// it sends the peer info on all our connected peers within our neighbourhood depth
+// which were not sent to the peer yet
+func (h *Hive) handleNeighboursMsg(ctx context.Context, d *Peer, msg *neighboursMsg) error {
+	depth := h.NeighbourhoodDepth()
+	var peers []*BzzAddr
+	// iterate connections in descending order of proximity to our address
+	h.EachConn(nil, 255, func(p *Peer, po int) bool {
+		// terminate if we are outside the neighbourhood
+		if po < depth {
+			return false
+		}
+		if !d.seen(p.BzzAddr) {
+			peers = append(peers, p.BzzAddr)
+		}
+		return true
+	})
+	if len(peers) > 0 {
+		go d.Send(ctx, &peersMsg{Peers: sortPeers(peers)})
+	}
+	return nil
+}
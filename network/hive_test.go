@@ -28,6 +28,7 @@ import (
 	"github.com/ethereum/go-ethereum/p2p"
 	"github.com/ethereum/go-ethereum/p2p/enode"
 	"github.com/holisticode/swarm/log"
+	"github.com/holisticode/swarm/p2p/protocols"
 	p2ptest "github.com/holisticode/swarm/p2p/testing"
 	"github.com/holisticode/swarm/pot"
 	"github.com/holisticode/swarm/state"
@@ -296,6 +297,65 @@ func TestHiveStateConnections(t *testing.T) {
 	})
 }
 
+// TestHiveMaxConcurrentDials checks that the hive does not have more than MaxConcurrentDials
+// outstanding dials, and that dials stop being outstanding when the peer connects or the dial times out,
+// after the default timeout if no dial timeout is set
+func TestHiveMaxConcurrentDials(t *testing.T) {
+	defer func(timeout time.Duration) { defaultDialTimeout = timeout }(defaultDialTimeout)
+
+	params := NewHiveParams()
+	params.Discovery = false
+	params.MaxConcurrentDials = 2
+	params.DialTimeout = 0
+	h := NewHive(params, NewKademlia(RandomBzzAddr().OAddr, NewKadParams()), nil)
+
+	var dialled []*enode.Node
+	h.addPeer = func(node *enode.Node) {
+		dialled = append(dialled, node)
+	}
+	for i := 0; i < 8; i++ {
+		h.Register(RandomBzzAddr())
+	}
+
+	h.tickHive()
+	if len(dialled) != 2 {
+		t.Fatalf("expected 2 dials, got %d", len(dialled))
+	}
+	h.tickHive()
+	if len(dialled) != 2 {
+		t.Fatalf("expected no dials while 2 are outstanding, got %d", len(dialled)-2)
+	}
+
+	// a connected peer frees a dial
+	p := p2p.NewPeer(dialled[0].ID(), "", nil)
+	h.trackPeer(&BzzPeer{Peer: protocols.NewPeer(p, &p2p.MsgPipeRW{}, &protocols.Spec{})})
+	h.tickHive()
+	if len(dialled) != 3 {
+		t.Fatalf("expected 3 dials, got %d", len(dialled))
+	}
+
+	// timed out dials are not outstanding
+	h.DialTimeout = time.Millisecond
+	time.Sleep(10 * time.Millisecond)
+	h.tickHive()
+	if len(dialled) != 5 {
+		t.Fatalf("expected 5 dials, got %d", len(dialled))
+	}
+
+	// without a dial timeout, dials time out after the default timeout
+	h.DialTimeout = 0
+	h.tickHive()
+	if len(dialled) != 5 {
+		t.Fatalf("expected no dials while 2 are outstanding, got %d", len(dialled)-5)
+	}
+	defaultDialTimeout = time.Millisecond
+	time.Sleep(10 * time.Millisecond)
+	h.tickHive()
+	if len(dialled) != 7 {
+		t.Fatalf("expected 7 dials, got %d", len(dialled))
+	}
+}
+
 // Create a Peer with the suggested address and store the relationshsip enode -> BzzAddr for later retrieval
 func testAddPeer(suggestedPeer *BzzAddr, h1 *Hive, nodeIdToBzzAddr map[string]*BzzAddr) {
 	byteAddresses := suggestedPeer.Address()
@@ -319,3 +379,40 @@ func newConnPeerLocal(addr []byte, kademlia *Kademlia) *Peer {
 	peer.kad = kademlia
 	return peer
 }
+
+// TestHiveRegisterDebounce checks that a burst of registered addresses is coalesced
+// into few peer suggestions instead of one suggestion per address
+// As MaxConcurrentDials is 0, every SuggestPeer call of the hive dials one of the
+// registered addresses, so the dials count the SuggestPeer calls
+func TestHiveRegisterDebounce(t *testing.T) {
+	params := NewHiveParams()
+	params.Discovery = false
+	params.KeepAliveInterval = time.Hour
+	params.RegisterDebounce = 50 * time.Millisecond
+	h := NewHive(params, NewKademlia(RandomBzzAddr().OAddr, NewKadParams()), nil)
+
+	dialled := make(chan struct{}, 1000)
+	if err := h.start(nil, func(node *enode.Node) {
+		dialled <- struct{}{}
+	}); err != nil {
+		t.Fatal(err)
+	}
+	defer h.Stop()
+
+	for i := 0; i < 1000; i++ {
+		if err := h.Register(RandomBzzAddr()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	select {
+	case <-dialled:
+	case <-time.After(time.Second):
+		t.Fatal("expected a peer to be dialled after the registrations")
+	}
+	time.Sleep(4 * params.RegisterDebounce)
+
+	if n := len(dialled) + 1; n > 10 {
+		t.Fatalf("got %d SuggestPeer calls for 1000 registered addresses, want at most 10", n)
+	}
+}
@@ -21,6 +21,7 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"math"
 	"math/rand"
 	"sort"
 	"strings"
@@ -72,6 +73,42 @@ type KadParams struct {
 	// function to sanction or prevent suggesting a peer
 	Reachable    func(*BzzAddr) bool      `json:"-"`
 	Capabilities *capability.Capabilities `json:"-"`
+	// policy applied by On and OnLimited to peers connecting in a bin with MaxBinSize connections,
+	// if nil the number of connections in a bin is not limited
+	BinFullPolicy BinFullPolicy `json:"-"`
+}
+
+// ErrBinFull is returned by OnLimited if the bin of the peer is full and the BinFullPolicy rejects the peer
+var ErrBinFull = errors.New("kademlia bin is full")
+
+// ErrSelfConnection is returned by OnLimited if the peer has the base address of the kademlia
+var ErrSelfConnection = errors.New("kademlia connection to self")
+
+// ErrDuplicatePeer is returned by OnLimited if the overlay address of the peer is live on another connection
+var ErrDuplicatePeer = errors.New("kademlia peer already connected")
+
+// BinFullPolicy decides what happens when a peer connects in a bin which already
+// has MaxBinSize connections. It returns one of the connected peers in the bin
+// to evict in favour of the new peer, or nil to reject the new peer.
+type BinFullPolicy func(newPeer *Peer, bin []*Peer) (evict *Peer)
+
+// RejectOnFullBin is a BinFullPolicy which rejects peers connecting in a full bin
+func RejectOnFullBin(_ *Peer, _ []*Peer) *Peer {
+	return nil
+}
+
+// EvictLowestQuality returns a BinFullPolicy which evicts the connected peer with the lowest quality
+// as reported by the quality function, so that peers connecting in a full bin are always accepted
+func EvictLowestQuality(quality func(*Peer) float64) BinFullPolicy {
+	return func(_ *Peer, bin []*Peer) (evict *Peer) {
+		var lowest float64
+		for _, p := range bin {
+			if q := quality(p); evict == nil || q < lowest {
+				evict, lowest = p, q
+			}
+		}
+		return evict
+	}
 }
 
 // NewKadParams returns a params struct with default values
@@ -85,6 +122,7 @@ func NewKadParams() *KadParams {
 		MaxRetries:        42,
 		RetryExponent:     2,
 		Capabilities:      capability.NewCapabilities(),
+		BinFullPolicy:     RejectOnFullBin,
 	}
 }
 
@@ -96,9 +134,11 @@ type Kademlia struct {
 	*KadParams                                  // Kademlia configuration parameters
 	base            []byte                      // immutable baseaddress of the table
 	saturationDepth uint8                       // stores the last current depth of saturation
+	bootnodes       map[string]struct{}         // overlay addresses of the peers known to be bootnodes
 	nDepth          int                         // stores the last neighbourhood depth
 	nDepthMu        sync.RWMutex                // protects neighbourhood depth nDepth
 	nDepthSig       []chan struct{}             // signals when neighbourhood depth nDepth is changed
+	healthSubs      []*healthSub                // subscriptions to changes of the strict health
 
 	onOffPeerPubSub *pubsubchannel.PubSubChannel // signals on and off peers in the table
 }
@@ -110,6 +150,15 @@ type KademliaInfo struct {
 	TotalKnown       int        `json:"total_known"`
 	Connections      [][]string `json:"connections"`
 	Known            [][]string `json:"known"`
+
+	Capabilities map[string]CapabilityInfo `json:"capabilities"` // info of the registered capability indices by key
+}
+
+// CapabilityInfo is the neighbourhood depth and population of a capability index
+type CapabilityInfo struct {
+	Depth            int `json:"depth"`
+	TotalConnections int `json:"total_connections"`
+	TotalKnown       int `json:"total_known"`
 }
 
 // NewKademlia creates a Kademlia table for base address addr
@@ -127,6 +176,7 @@ func NewKademlia(addr []byte, params *KadParams) *Kademlia {
 		KadParams:       params,
 		capabilityIndex: make(map[string]*capabilityIndex),
 		defaultIndex:    NewDefaultIndex(),
+		bootnodes:       make(map[string]struct{}),
 		onOffPeerPubSub: pubsubchannel.New(100),
 	}
 	k.RegisterCapabilityIndex("full", *fullCapability)
@@ -140,20 +190,72 @@ type onOffPeerSignal struct {
 	on   bool
 }
 
+// CapabilityIndexOption sets an optional parameter of a capability index
+type CapabilityIndexOption func(*capabilityIndex)
+
+// WithMaxAddrs limits the number of addresses in the capability index.
+// Once the limit is reached, registering a new matching address evicts the
+// address which covers the least address space from the capability index,
+// see evictWorstCovering. The default index is not affected.
+func WithMaxAddrs(n int) CapabilityIndexOption {
+	return func(idx *capabilityIndex) {
+		idx.maxAddrs = n
+	}
+}
+
 // RegisterCapabilityIndex adds an entry to the capability index of the kademlia
 // The capability index is associated with the supplied string s
 // Any peers matching any bits set in the capability in the index, will be added to the index (or removed on removal)
-func (k *Kademlia) RegisterCapabilityIndex(s string, c capability.Capability) error {
+func (k *Kademlia) RegisterCapabilityIndex(s string, c capability.Capability, opts ...CapabilityIndexOption) error {
 	if s == "" {
 		return errors.New("Cannot add index with empty string key")
 	} else if _, ok := k.capabilityIndex[s]; ok {
 		return fmt.Errorf("Capability index '%s' already exists", s)
 	}
 	log.Debug("Registered cap index", "s", s, "c", c)
-	k.capabilityIndex[s] = NewCapabilityIndex(c)
+	idx := NewCapabilityIndex(c)
+	for _, o := range opts {
+		o(idx)
+	}
+	k.capabilityIndex[s] = idx
 	return nil
 }
 
+// RegisterCapabilityIndexMask adds an entry to the capability index of the kademlia like RegisterCapabilityIndex,
+// but instead of peers with the exact capability, it indexes the peers whose capability with the given id
+// has at least the required bits set, regardless of their other bits
+func (k *Kademlia) RegisterCapabilityIndexMask(s string, id capability.CapabilityID, requiredBits []int, opts ...CapabilityIndexOption) error {
+	bitCount := 0
+	for _, b := range requiredBits {
+		if b < 0 {
+			return fmt.Errorf("Invalid required bit %d", b)
+		}
+		if b >= bitCount {
+			bitCount = b + 1
+		}
+	}
+	c := capability.NewCapability(id, bitCount)
+	for _, b := range requiredBits {
+		c.Set(b)
+	}
+	opts = append([]CapabilityIndexOption{func(idx *capabilityIndex) {
+		idx.requiredBits = append([]int{}, requiredBits...)
+	}}, opts...)
+	return k.RegisterCapabilityIndex(s, *c, opts...)
+}
+
+// CapabilityIndexSize returns the number of addresses in the capability index
+// It returns an error if the capability index is not registered.
+func (k *Kademlia) CapabilityIndexSize(s string) (int, error) {
+	k.lock.RLock()
+	defer k.lock.RUnlock()
+	idx, ok := k.capabilityIndex[s]
+	if !ok {
+		return 0, fmt.Errorf("Unknown capability index %v", s)
+	}
+	return idx.addrs.Size(), nil
+}
+
 // adds a peer to any capability indices it matches
 func (k *Kademlia) addToCapabilityIndex(p interface{}) {
 	var ok bool
@@ -167,15 +269,15 @@ func (k *Kademlia) addToCapabilityIndex(p interface{}) {
 	}
 	for s, idxItem := range k.capabilityIndex {
 		for _, vCap := range eAddr.Capabilities.Caps {
-			if idxItem.Id != vCap.Id {
-				continue
-			}
-			if vCap.IsSameAs(idxItem.Capability) {
+			if idxItem.match(vCap) {
 				log.Trace("Added peer to capability index", "conn", ok, "s", s, "v", vCap, "p", p)
 				if ok {
 					k.capabilityIndex[s].conns, _, _ = pot.Add(idxItem.conns, newEntryFromPeer(ePeer), Pof)
 				} else {
 					k.capabilityIndex[s].addrs, _, _ = pot.Add(idxItem.addrs, newEntryFromBzzAddress(eAddr), Pof)
+					if idxItem.maxAddrs > 0 && idxItem.addrs.Size() > idxItem.maxAddrs {
+						k.evictWorstCovering(s, idxItem)
+					}
 				}
 			}
 		}
@@ -218,6 +320,45 @@ func (k *Kademlia) removeFromCapabilityIndex(p interface{}, disconnectOnly bool)
 	}
 }
 
+// evictWorstCovering removes the address covering the least address space from
+// the addresses of the capability index. It is the address in the most populated bin
+// which has the highest proximity order to another address in the bin, so removing
+// it leaves the smallest address gap in the bin.
+func (k *Kademlia) evictWorstCovering(s string, idx *capabilityIndex) {
+	var bin *pot.Bin
+	idx.addrs.EachBin(k.base, Pof, 0, func(b *pot.Bin) bool {
+		if bin == nil || b.Size > bin.Size {
+			bin = b
+		}
+		return true
+	}, true)
+	if bin == nil {
+		return
+	}
+	var entries []*entry
+	bin.ValIterator(func(val pot.Val) bool {
+		entries = append(entries, val.(*entry))
+		return true
+	})
+	var evict *entry
+	closest := -1
+	for i, e := range entries {
+		for _, other := range entries[i+1:] {
+			if po, _ := Pof(e, other, bin.ProximityOrder); po > closest {
+				closest = po
+				evict = e
+			}
+		}
+	}
+	if evict == nil {
+		evict = entries[0]
+	}
+	idx.addrs, _, _, _ = pot.Swap(idx.addrs, evict.BzzAddr, Pof, func(_ pot.Val) pot.Val {
+		return nil
+	})
+	log.Trace("Evicted address from capability addrs index", "s", s, "p", evict.BzzAddr)
+}
+
 // entry represents a Kademlia table entry (an extension of BzzAddr)
 type entry struct {
 	*BzzAddr
@@ -246,9 +387,28 @@ func newEntryFromPeer(p *Peer) *entry {
 // index providing quick access to all peers having a certain capability set
 type capabilityIndex struct {
 	*capability.Capability
-	conns *pot.Pot
-	addrs *pot.Pot
-	depth int
+	conns    *pot.Pot
+	addrs    *pot.Pot
+	depth    int
+	maxAddrs int // maximum number of addresses, 0 for no limit
+	// bits which must be set in a matching capability, nil if the capability must be the same
+	requiredBits []int
+}
+
+// match returns true if peers with the capability belong to the capability index
+func (idx *capabilityIndex) match(c *capability.Capability) bool {
+	if idx.Id != c.Id {
+		return false
+	}
+	if idx.requiredBits == nil {
+		return c.IsSameAs(idx.Capability)
+	}
+	for _, b := range idx.requiredBits {
+		if b >= len(c.Cap) || !c.Cap[b] {
+			return false
+		}
+	}
+	return true
 }
 
 // NewDefaultIndex creates a new index for no capability
@@ -282,19 +442,30 @@ func (e *entry) Hex() string {
 // Register enters each address as kademlia peer record into the
 // database of known peer addresses
 func (k *Kademlia) Register(peers ...*BzzAddr) error {
+	_, _, err := k.RegisterReport(peers...)
+	return err
+}
+
+// RegisterReport enters each address as kademlia peer record into the
+// database of known peer addresses, like Register, and reports which addresses
+// were newly added and which were already known with the same underlay address.
+// Addresses known with a different underlay address are replaced and reported as added.
+// On error, the addresses preceding the failing one are registered and reported.
+func (k *Kademlia) RegisterReport(peers ...*BzzAddr) (added, duplicates []*BzzAddr, err error) {
 	k.lock.Lock()
 	defer k.lock.Unlock()
 
 	metrics.GetOrRegisterCounter("kad/register", nil).Inc(1)
+	defer k.setNeighbourhoodDepth()
 
-	var size int
 	for _, p := range peers {
 		log.Trace("kademlia trying to register", "addr", p)
 		// error if self received, peer should know better
 		// and should be punished for this
 		if bytes.Equal(p.Address(), k.base) {
-			return fmt.Errorf("add peers: %x is self", k.base)
+			return added, duplicates, fmt.Errorf("add peers: %x is self", k.base)
 		}
+		isNew := true
 		index := k.defaultIndex
 		index.addrs, _, _, _ = pot.Swap(index.addrs, p, Pof, func(v pot.Val) pot.Val {
 			// if not found
@@ -313,14 +484,19 @@ func (k *Kademlia) Register(peers ...*BzzAddr) error {
 				return newEntryFromBzzAddress(p)
 			}
 
+			isNew = false
 			return v
 		})
 		k.addToCapabilityIndex(newEntryFromBzzAddress(p))
-		size++
+		if isNew {
+			added = append(added, p)
+		} else {
+			duplicates = append(duplicates, p)
+		}
 	}
+	metrics.GetOrRegisterCounter("kad/register/duplicates", nil).Inc(int64(len(duplicates)))
 
-	k.setNeighbourhoodDepth()
-	return nil
+	return added, duplicates, nil
 }
 
 // SuggestPeer returns an unconnected peer address as a peer suggestion for connection
@@ -330,7 +506,142 @@ func (k *Kademlia) SuggestPeer() (suggestedPeer *BzzAddr, saturationDepth int, c
 
 	metrics.GetOrRegisterCounter("kad/suggestpeer", nil).Inc(1)
 
-	radius := neighbourhoodRadiusForPot(k.defaultIndex.conns, k.NeighbourhoodSize, k.base)
+	depth := depthForPot(k.defaultIndex.conns, k.NeighbourhoodSize, k.base)
+	if !k.bootnodesDeprioritized(depth) {
+		suggestedPeer, saturationDepth, _, _ = k.suggestPeerInIndex(k.defaultIndex, depth, k.callable)
+		return k.updateSaturationDepth(suggestedPeer, saturationDepth)
+	}
+	// suggest bootnodes only if no other peer can be suggested
+	suggestedPeer, saturationDepth, _, _ = k.suggestPeerInIndex(k.defaultIndex, depth, func(e *entry) bool {
+		return !k.isBootnode(e.BzzAddr) && k.callable(e)
+	})
+	if suggestedPeer == nil {
+		suggestedPeer, _, _, _ = k.suggestPeerInIndex(k.defaultIndex, depth, func(e *entry) bool {
+			return k.isBootnode(e.BzzAddr) && k.callable(e)
+		})
+	}
+	return k.updateSaturationDepth(suggestedPeer, saturationDepth)
+}
+
+// MarkBootnodes marks the addresses as those of bootnodes,
+// which SuggestPeer suggests only if no other peer can be suggested,
+// once there are enough connections to other peers in the shallow bins
+func (k *Kademlia) MarkBootnodes(addrs ...*BzzAddr) {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+
+	for _, a := range addrs {
+		k.bootnodes[string(a.Address())] = struct{}{}
+	}
+}
+
+// IsBootnode returns whether the address is marked as that of a bootnode
+func (k *Kademlia) IsBootnode(addr *BzzAddr) bool {
+	k.lock.RLock()
+	defer k.lock.RUnlock()
+	return k.isBootnode(addr)
+}
+
+// isBootnode returns whether the address is marked as that of a bootnode
+// caller must hold the lock
+func (k *Kademlia) isBootnode(addr *BzzAddr) bool {
+	_, ok := k.bootnodes[string(addr.Address())]
+	return ok
+}
+
+// bootnodesDeprioritized returns whether there are at least MinBinSize connections
+// to peers other than bootnodes in the bins shallower than the neighbourhood depth,
+// in which case bootnodes are suggested only if no other peer can be suggested
+// caller must hold the lock
+func (k *Kademlia) bootnodesDeprioritized(depth int) bool {
+	if len(k.bootnodes) == 0 {
+		return false
+	}
+	var count int
+	k.defaultIndex.conns.EachBin(k.base, Pof, 0, func(bin *pot.Bin) bool {
+		if bin.ProximityOrder >= depth {
+			return false
+		}
+		bin.ValIterator(func(val pot.Val) bool {
+			if !k.isBootnode(val.(*entry).BzzAddr) {
+				count++
+			}
+			return count < k.MinBinSize
+		})
+		return count < k.MinBinSize
+	}, true)
+	return count >= k.MinBinSize
+}
+
+// SuggestPeerMulti returns an unconnected peer address as a peer suggestion for connection
+// across the capability indices with the given keys. Of the peers suggested for each index,
+// it returns the one for the bin with the fewest connections, preferring the shallower bin,
+// which has the largest gap to its expected minimum size, and then the order of capKeys.
+// Keys of unregistered capability indices are ignored.
+// The returned saturation depth and whether it changed are those of the whole table, as for SuggestPeer.
+func (k *Kademlia) SuggestPeerMulti(capKeys []string) (suggestedPeer *BzzAddr, saturationDepth int, changed bool) {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+
+	metrics.GetOrRegisterCounter("kad/suggestpeermulti", nil).Inc(1)
+
+	// capability indices do not hold the connection and retries state of the addresses,
+	// so check the entries in the default index instead, counting a retry only for the
+	// suggested peer
+	callable := func(e *entry) bool {
+		de := k.defaultEntry(e.BzzAddr)
+		return de != nil && k.isCallable(de)
+	}
+	suggestedSize, suggestedPO := -1, -1
+	for _, capKey := range capKeys {
+		idx, ok := k.capabilityIndex[capKey]
+		if !ok {
+			continue
+		}
+		peer, _, size, po := k.suggestPeerInIndex(idx, idx.depth, callable)
+		if peer == nil {
+			continue
+		}
+		if suggestedPeer == nil || size < suggestedSize || (size == suggestedSize && po < suggestedPO) {
+			suggestedPeer, suggestedSize, suggestedPO = peer, size, po
+		}
+	}
+	if suggestedPeer != nil {
+		k.defaultEntry(suggestedPeer).retries++
+	}
+
+	depth := depthForPot(k.defaultIndex.conns, k.NeighbourhoodSize, k.base)
+	_, saturationDepth, _, _ = k.suggestPeerInIndex(k.defaultIndex, depth, func(*entry) bool { return false })
+	return k.updateSaturationDepth(suggestedPeer, saturationDepth)
+}
+
+// updateSaturationDepth stores the saturation depth if it is lower than the stored one,
+// returning the suggested peer, and the saturation depth if it changed
+func (k *Kademlia) updateSaturationDepth(suggestedPeer *BzzAddr, saturationDepth int) (*BzzAddr, int, bool) {
+	if uint8(saturationDepth) < k.saturationDepth {
+		k.saturationDepth = uint8(saturationDepth)
+		return suggestedPeer, saturationDepth, true
+	}
+	return suggestedPeer, 0, false
+}
+
+// defaultEntry returns the entry of the address in the default index, or nil if it is not known
+func (k *Kademlia) defaultEntry(addr *BzzAddr) (e *entry) {
+	k.defaultIndex.addrs.EachNeighbour(addr, Pof, func(v pot.Val, _ int) bool {
+		if ve := v.(*entry); bytes.Equal(ve.Address(), addr.Address()) {
+			e = ve
+		}
+		return false
+	})
+	return e
+}
+
+// suggestPeerInIndex returns a peer address of the capability index for which callable returns true,
+// from the bin with the fewest connections, and the saturation depth of the index, given its
+// neighbourhood depth. It also returns the number of connections and the proximity order of the
+// bin of the suggested peer.
+func (k *Kademlia) suggestPeerInIndex(idx *capabilityIndex, depth int, callable func(*entry) bool) (suggestedPeer *BzzAddr, saturationDepth int, suggestedSize int, suggestedPO int) {
+	radius := neighbourhoodRadiusForPot(idx.conns, k.NeighbourhoodSize, k.base)
 	// collect undersaturated bins in ascending order of number of connected peers
 	// and from shallow to deep (ascending order of PO)
 	// insert them in a map of bin arrays, keyed with the number of connected peers
@@ -343,7 +654,7 @@ func (k *Kademlia) SuggestPeer() (suggestedPeer *BzzAddr, saturationDepth int, c
 	binConsumer := func(bin *pot.Bin) bool {
 		po := bin.ProximityOrder
 		size := bin.Size
-		expectedMinBinSize := k.expectedMinBinSize(po)
+		expectedMinBinSize := k.expectedMinBinSizeForDepth(po, depth)
 		if currentMaxBinSize < expectedMinBinSize {
 			currentMaxBinSize = expectedMinBinSize
 		}
@@ -378,12 +689,12 @@ func (k *Kademlia) SuggestPeer() (suggestedPeer *BzzAddr, saturationDepth int, c
 		return true
 	}
 
-	k.defaultIndex.conns.EachBin(k.base, Pof, 0, binConsumer, true)
+	idx.conns.EachBin(k.base, Pof, 0, binConsumer, true)
 
 	// to trigger peer requests for peers closer than closest connection, include
 	// all bins from nearest connection upto nearest address as unsaturated
 	var nearestAddrAt int
-	k.defaultIndex.addrs.EachNeighbour(k.base, Pof, func(_ pot.Val, po int) bool {
+	idx.addrs.EachNeighbour(k.base, Pof, func(_ pot.Val, po int) bool {
 		nearestAddrAt = po
 		return false
 	})
@@ -394,7 +705,7 @@ func (k *Kademlia) SuggestPeer() (suggestedPeer *BzzAddr, saturationDepth int, c
 	}
 	// all PO bins are saturated, ie., minsize >= k.MinBinSize, no peer suggested
 	if len(saturation) == 0 {
-		return nil, 0, false
+		return nil, saturationDepth, 0, 0
 	}
 	// find the first callable peer in the address book
 	// starting from the bins with smallest size proceeding from shallow to deep
@@ -407,7 +718,7 @@ func (k *Kademlia) SuggestPeer() (suggestedPeer *BzzAddr, saturationDepth int, c
 		}
 		cur := 0
 		curPO := bins[0]
-		k.defaultIndex.addrs.EachBin(k.base, Pof, curPO, func(bin *pot.Bin) bool {
+		idx.addrs.EachBin(k.base, Pof, curPO, func(bin *pot.Bin) bool {
 			curPO = bins[cur]
 			// find the next bin that has size size
 			po := bin.ProximityOrder
@@ -427,26 +738,29 @@ func (k *Kademlia) SuggestPeer() (suggestedPeer *BzzAddr, saturationDepth int, c
 					return false
 				}
 			}
-			suggestedPeer = k.suggestPeerInBin(bin)
+			suggestedPeer = suggestCallableInBin(bin, callable)
+			if suggestedPeer != nil {
+				suggestedSize, suggestedPO = size, po
+			}
 			return cur < len(bins) && suggestedPeer == nil
 		}, true)
 	}
-
-	if uint8(saturationDepth) < k.saturationDepth {
-		k.saturationDepth = uint8(saturationDepth)
-		return suggestedPeer, saturationDepth, true
-	}
-	return suggestedPeer, 0, false
+	return suggestedPeer, saturationDepth, suggestedSize, suggestedPO
 }
 
 func (k *Kademlia) suggestPeerInBin(bin *pot.Bin) *BzzAddr {
+	return suggestCallableInBin(bin, k.callable)
+}
+
+// suggestCallableInBin returns the first address in the bin for which callable returns true
+func suggestCallableInBin(bin *pot.Bin, callable func(*entry) bool) *BzzAddr {
 	var foundPeer *BzzAddr
 	// curPO found
 	// find a callable peer out of the addresses in the unsaturated bin
 	// stop if found
 	bin.ValIterator(func(val pot.Val) bool {
 		e := val.(*entry)
-		if k.callable(e) {
+		if callable(e) {
 			foundPeer = e.BzzAddr
 			return false
 		}
@@ -498,10 +812,118 @@ func (k *Kademlia) suggestPeerInBinByGap(bin *pot.Bin) *BzzAddr {
 	}
 }
 
-// On inserts the peer as a kademlia peer into the live peers
+// On inserts the peer as a kademlia peer into the live peers like OnLimited,
+// but it only logs the errors of the peers not inserted and disconnects the peer
+// evicted by the BinFullPolicy itself.
+// A peer with the base address of the kademlia or with the overlay address
+// of another live peer is not inserted, see ErrSelfConnection and ErrDuplicatePeer.
 func (k *Kademlia) On(p *Peer) (uint8, bool) {
+	depth, changed, evicted, err := k.OnLimited(p)
+	if err != nil {
+		log.Warn("kademlia peer not inserted", "peer", p, "err", err)
+	}
+	if evicted != nil {
+		evicted.Drop("evicted from full kademlia bin")
+	}
+	return depth, changed
+}
+
+// OnLimited inserts the peer as a kademlia peer into the live peers like On, but applies
+// the BinFullPolicy if the bin of the peer already has MaxBinSize connections.
+// If the policy evicts a connected peer, it is removed from the live peers and returned,
+// so that the caller can disconnect it. If the policy rejects the peer, ErrBinFull is returned
+// and the peer is not inserted.
+func (k *Kademlia) OnLimited(p *Peer) (depth uint8, changed bool, evicted *Peer, err error) {
 	k.lock.Lock()
 	defer k.lock.Unlock()
+	if err := k.checkOn(p); err != nil {
+		return k.saturationDepth, false, nil, err
+	}
+	if k.BinFullPolicy != nil {
+		evicted, err = k.makeRoom(p)
+		if err != nil {
+			return k.saturationDepth, false, nil, err
+		}
+	}
+	depth, changed, err = k.on(p)
+	if err != nil {
+		return depth, changed, nil, err
+	}
+	return depth, changed, evicted, nil
+}
+
+// checkOn returns ErrSelfConnection if the peer has the base address of the kademlia
+// and ErrDuplicatePeer if a live peer has the same overlay address on another connection
+// caller must hold the lock
+func (k *Kademlia) checkOn(p *Peer) error {
+	if bytes.Equal(p.Address(), k.base) {
+		return ErrSelfConnection
+	}
+	var err error
+	k.defaultIndex.conns.EachNeighbour(p, Pof, func(v pot.Val, po int) bool {
+		if po == 256 && v.(*entry).conn.BzzPeer.Peer != p.BzzPeer.Peer {
+			err = ErrDuplicatePeer
+		}
+		return false
+	})
+	return err
+}
+
+// isLive returns whether the peer is among the live peers on the same connection
+// caller must hold the lock
+func (k *Kademlia) isLive(p *Peer) bool {
+	var live bool
+	k.defaultIndex.conns.EachNeighbour(p, Pof, func(v pot.Val, po int) bool {
+		e := v.(*entry)
+		live = bytes.Equal(e.Address(), p.Address()) && e.conn.BzzPeer.Peer == p.BzzPeer.Peer
+		return false
+	})
+	return live
+}
+
+// makeRoom applies the BinFullPolicy if the bin of the peer is full
+// and removes the evicted peer from the live peers
+// caller must hold the lock
+func (k *Kademlia) makeRoom(p *Peer) (evicted *Peer, err error) {
+	po := chunk.Proximity(k.base, p.Address())
+	var bin []*Peer
+	var connected bool
+	k.eachConn(nil, nil, po, false, func(c *Peer, cpo int) bool {
+		if cpo < po {
+			return false
+		}
+		if bytes.Equal(c.Address(), p.Address()) {
+			connected = true
+			return false
+		}
+		bin = append(bin, c)
+		return true
+	})
+	if connected || len(bin) < k.MaxBinSize {
+		return nil, nil
+	}
+	evicted = k.BinFullPolicy(p, bin)
+	if evicted == nil {
+		metrics.GetOrRegisterCounter("kad/on/rejected", nil).Inc(1)
+		return nil, ErrBinFull
+	}
+	for _, c := range bin {
+		if c == evicted {
+			metrics.GetOrRegisterCounter("kad/on/evicted", nil).Inc(1)
+			k.off(evicted)
+			return evicted, nil
+		}
+	}
+	return nil, fmt.Errorf("evicted peer %x is not connected in bin %d", evicted.Address(), po)
+}
+
+// on inserts the peer into the live peers, unless checkOn returns an error
+// caller must hold the lock
+func (k *Kademlia) on(p *Peer) (uint8, bool, error) {
+	if err := k.checkOn(p); err != nil {
+		metrics.GetOrRegisterCounter("kad/on/invalid", nil).Inc(1)
+		return k.saturationDepth, false, err
+	}
 	metrics.GetOrRegisterCounter("kad/on", nil).Inc(1)
 
 	var ins bool
@@ -538,7 +960,8 @@ func (k *Kademlia) On(p *Peer) (uint8, bool) {
 		k.saturationDepth = depth
 	}
 	k.setNeighbourhoodDepth()
-	return k.saturationDepth, changed
+	k.notifyHealth()
+	return k.saturationDepth, changed, nil
 }
 
 func (k *Kademlia) peerPo(peer *Peer) (po int, found bool) {
@@ -575,6 +998,26 @@ func (k *Kademlia) setNeighbourhoodDepth() {
 
 }
 
+// SetNeighbourhoodSize changes the nearest neighbour core minimum cardinality of a running
+// kademlia. The saturation depth and neighbourhood depth are recalculated, and the neighbourhood
+// depth change subscribers are signalled if the depth changes.
+func (k *Kademlia) SetNeighbourhoodSize(n int) error {
+	if n < 1 {
+		return fmt.Errorf("invalid neighbourhood size %d", n)
+	}
+	k.lock.Lock()
+	defer k.lock.Unlock()
+
+	if n == k.NeighbourhoodSize {
+		return nil
+	}
+	k.NeighbourhoodSize = n
+	k.saturationDepth = uint8(k.saturation())
+	k.setNeighbourhoodDepth()
+	k.notifyHealth()
+	return nil
+}
+
 // NeighbourhoodDepth returns the value calculated by depthForPot function
 // in setNeighbourhoodDepth method.
 func (k *Kademlia) NeighbourhoodDepth() int {
@@ -636,6 +1079,17 @@ func (k *Kademlia) SubscribeToPeerChanges() *pubsubchannel.Subscription {
 func (k *Kademlia) Off(p *Peer) {
 	k.lock.Lock()
 	defer k.lock.Unlock()
+	k.off(p)
+}
+
+// off removes the peer from the live peers
+// It does nothing if the peer is not live on the same connection, like a peer
+// already evicted from a full bin, so that no duplicate off signal is published.
+// caller must hold the lock
+func (k *Kademlia) off(p *Peer) {
+	if !k.isLive(p) {
+		return
+	}
 	index := k.defaultIndex
 	index.addrs, _, _, _ = pot.Swap(index.addrs, p, Pof, func(v pot.Val) pot.Val {
 		// v cannot be nil, must check otherwise we overwrite entry
@@ -651,6 +1105,7 @@ func (k *Kademlia) Off(p *Peer) {
 	})
 	k.removeFromCapabilityIndex(p, true)
 	k.setNeighbourhoodDepth()
+	k.notifyHealth()
 	k.onOffPeerPubSub.Publish(onOffPeerSignal{peer: p, po: -1, on: false})
 }
 
@@ -663,7 +1118,42 @@ func (k *Kademlia) EachConnFiltered(base []byte, capKey string, o int, f func(*P
 	if !ok {
 		return fmt.Errorf("Unregistered capability index '%s'", capKey)
 	}
-	k.eachConn(base, c.conns, o, f)
+	k.eachConn(base, c.conns, o, false, f)
+	return nil
+}
+
+// EachConnFilteredReverse performs the same action as EachConnFiltered
+// with the difference that it iterates in the reverse order, from the shallowest bin
+// to the deepest, with the farthest peers from base first
+func (k *Kademlia) EachConnFilteredReverse(base []byte, capKey string, o int, f func(*Peer, int) bool) error {
+	k.lock.RLock()
+	defer k.lock.RUnlock()
+	c, ok := k.capabilityIndex[capKey]
+	if !ok {
+		return fmt.Errorf("Unregistered capability index '%s'", capKey)
+	}
+	k.eachConn(base, c.conns, o, true, f)
+	return nil
+}
+
+// EachConnFilteredAny performs the same action as EachConnFiltered
+// with the difference that it will return peers that match any of the specified capability index filters.
+// A peer that is in more than one of the indices is returned only once.
+func (k *Kademlia) EachConnFilteredAny(base []byte, capKeys []string, o int, f func(*Peer, int) bool) error {
+	k.lock.RLock()
+	defer k.lock.RUnlock()
+	var conns *pot.Pot
+	for _, capKey := range capKeys {
+		c, ok := k.capabilityIndex[capKey]
+		if !ok {
+			return fmt.Errorf("Unregistered capability index '%s'", capKey)
+		}
+		conns, _ = pot.Union(conns, c.conns, Pof)
+	}
+	if conns == nil || conns.Size() == 0 {
+		return nil
+	}
+	k.eachConn(base, conns, o, false, f)
 	return nil
 }
 
@@ -673,17 +1163,17 @@ func (k *Kademlia) EachConnFiltered(base []byte, capKey string, o int, f func(*P
 func (k *Kademlia) EachConn(base []byte, o int, f func(*Peer, int) bool) {
 	k.lock.RLock()
 	defer k.lock.RUnlock()
-	k.eachConn(base, k.defaultIndex.conns, o, f)
+	k.eachConn(base, k.defaultIndex.conns, o, false, f)
 }
 
-func (k *Kademlia) eachConn(base []byte, db *pot.Pot, o int, f func(*Peer, int) bool) {
+func (k *Kademlia) eachConn(base []byte, db *pot.Pot, o int, reverse bool, f func(*Peer, int) bool) {
 	if len(base) == 0 {
 		base = k.base
 	}
 	if db == nil {
 		db = k.defaultIndex.conns
 	}
-	db.EachNeighbour(base, Pof, func(val pot.Val, po int) bool {
+	eachNeighbour(db, base, reverse, func(val pot.Val, po int) bool {
 		if po > o {
 			return true
 		}
@@ -757,7 +1247,21 @@ func (k *Kademlia) EachAddrFiltered(base []byte, capKey string, o int, f func(*B
 		return fmt.Errorf("Unregistered capability index '%s'", capKey)
 	}
 	log.Debug("filter with capname", "key", capKey, "cap", c)
-	k.eachAddr(base, c.addrs, o, f)
+	k.eachAddr(base, c.addrs, o, false, f)
+	return nil
+}
+
+// EachAddrFilteredReverse performs the same action as EachAddrFiltered
+// with the difference that it iterates in the reverse order, from the shallowest bin
+// to the deepest, with the farthest peers from base first
+func (k *Kademlia) EachAddrFilteredReverse(base []byte, capKey string, o int, f func(*BzzAddr, int) bool) error {
+	k.lock.RLock()
+	defer k.lock.RUnlock()
+	c, ok := k.capabilityIndex[capKey]
+	if !ok {
+		return fmt.Errorf("Unregistered capability index '%s'", capKey)
+	}
+	k.eachAddr(base, c.addrs, o, true, f)
 	return nil
 }
 
@@ -767,17 +1271,17 @@ func (k *Kademlia) EachAddrFiltered(base []byte, capKey string, o int, f func(*B
 func (k *Kademlia) EachAddr(base []byte, o int, f func(*BzzAddr, int) bool) {
 	k.lock.RLock()
 	defer k.lock.RUnlock()
-	k.eachAddr(base, k.defaultIndex.addrs, o, f)
+	k.eachAddr(base, k.defaultIndex.addrs, o, false, f)
 }
 
-func (k *Kademlia) eachAddr(base []byte, db *pot.Pot, o int, f func(*BzzAddr, int) bool) {
+func (k *Kademlia) eachAddr(base []byte, db *pot.Pot, o int, reverse bool, f func(*BzzAddr, int) bool) {
 	if len(base) == 0 {
 		base = k.base
 	}
 	if db == nil {
 		db = k.defaultIndex.addrs
 	}
-	db.EachNeighbour(base, Pof, func(val pot.Val, po int) bool {
+	eachNeighbour(db, base, reverse, func(val pot.Val, po int) bool {
 		if po > o {
 			return true
 		}
@@ -785,6 +1289,27 @@ func (k *Kademlia) eachAddr(base []byte, db *pot.Pot, o int, f func(*BzzAddr, in
 	})
 }
 
+// eachNeighbour iterates over the values of the pot in the order of EachNeighbour,
+// from the closest to the farthest from base, or in the reverse order if reverse is true
+func eachNeighbour(db *pot.Pot, base []byte, reverse bool, f func(pot.Val, int) bool) {
+	if !reverse {
+		db.EachNeighbour(base, Pof, f)
+		return
+	}
+	var vals []pot.Val
+	var pos []int
+	db.EachNeighbour(base, Pof, func(val pot.Val, po int) bool {
+		vals = append(vals, val)
+		pos = append(pos, po)
+		return true
+	})
+	for i := len(vals) - 1; i >= 0; i-- {
+		if !f(vals[i], pos[i]) {
+			return
+		}
+	}
+}
+
 // neighbourhoodRadiusForPot returns the neighbourhood radius of the kademlia
 // neighbourhood radius encloses the nearest neighbour set with size >= neighbourhoodSize
 // i.e., neighbourhood radius is the deepest PO such that all bins not shallower altogether
@@ -855,6 +1380,17 @@ func depthForPot(p *pot.Pot, neighbourhoodSize int, pivotAddr []byte) (depth int
 
 // callable decides if an address entry represents a callable peer
 func (k *Kademlia) callable(e *entry) bool {
+	if !k.isCallable(e) {
+		return false
+	}
+	e.retries++
+	log.Trace(fmt.Sprintf("%08x: peer %v is callable", k.BaseAddr()[:4], e))
+
+	return true
+}
+
+// isCallable returns whether the peer of the entry can be called, without counting a retry
+func (k *Kademlia) isCallable(e *entry) bool {
 	// not callable if peer is live or exceeded maxRetries
 	if e.conn != nil || e.retries > k.MaxRetries {
 		return false
@@ -878,12 +1414,36 @@ func (k *Kademlia) callable(e *entry) bool {
 		log.Trace(fmt.Sprintf("%08x: peer %v is temporarily not callable", k.BaseAddr()[:4], e))
 		return false
 	}
-	e.retries++
-	log.Trace(fmt.Sprintf("%08x: peer %v is callable", k.BaseAddr()[:4], e))
-
 	return true
 }
 
+// RetryState returns the number of times the known address was suggested, the time when
+// it can be suggested again and whether it has run out of retries. The time is calculated
+// from RetryInterval and RetryExponent without the random variation applied when peers
+// are suggested. Zero values are returned if the address is not known.
+func (k *Kademlia) RetryState(addr []byte) (retries int, nextEligible time.Time, exhausted bool) {
+	k.lock.RLock()
+	defer k.lock.RUnlock()
+
+	e := k.defaultEntry(NewBzzAddr(addr, nil))
+	if e == nil {
+		return 0, time.Time{}, false
+	}
+	if e.retries == 0 {
+		return 0, e.seenAt, false
+	}
+	// retry n is allowed once RetryInterval * RetryExponent^(n-1) elapsed since the address was seen
+	interval := k.RetryInterval
+	for i := 1; i < e.retries; i++ {
+		if interval > math.MaxInt64/int64(k.RetryExponent) {
+			interval = math.MaxInt64
+			break
+		}
+		interval *= int64(k.RetryExponent)
+	}
+	return e.retries, e.seenAt.Add(time.Duration(interval)), e.retries > k.MaxRetries
+}
+
 // IsClosestTo returns true if self is the closest peer to addr among filtered peers
 // ie. return false iff there is a peer that
 // - filter(bzzpeer) == true AND
@@ -975,6 +1535,16 @@ func (k *Kademlia) kademliaInfo() (ki KademliaInfo) {
 		return true
 	}, true)
 
+	ki.Capabilities = make(map[string]CapabilityInfo, len(k.capabilityIndex))
+	for s, idx := range k.capabilityIndex {
+		depth, _ := k.NeighbourhoodDepthCapability(s)
+		ki.Capabilities[s] = CapabilityInfo{
+			Depth:            depth,
+			TotalConnections: idx.conns.Size(),
+			TotalKnown:       idx.addrs.Size(),
+		}
+	}
+
 	return
 }
 
@@ -985,17 +1555,37 @@ func (k *Kademlia) String() string {
 	return k.string()
 }
 
+// HiveStringStable returns the kademlia table + kaddb table displayed with ascii
+// like String, but without the timestamp and commit hash, so that the output
+// depends only on the state of the table and can be compared exactly
+func (k *Kademlia) HiveStringStable() string {
+	k.lock.RLock()
+	defer k.lock.RUnlock()
+	return k.hiveString(true)
+}
+
 // string returns kademlia table + kaddb table displayed with ascii
 // caller must hold the lock
 func (k *Kademlia) string() string {
+	return k.hiveString(false)
+}
+
+// hiveString returns kademlia table + kaddb table displayed with ascii,
+// without the timestamp and commit hash if stable is true
+// caller must hold the lock
+func (k *Kademlia) hiveString(stable bool) string {
 	wsrow := "                          "
 	var rows []string
 
 	rows = append(rows, "=========================================================================")
-	if len(sv.GitCommit) > 0 {
-		rows = append(rows, fmt.Sprintf("commit hash: %s", sv.GitCommit))
+	if stable {
+		rows = append(rows, fmt.Sprintf("KΛÐΞMLIΛ hive: queen's address: %x", k.BaseAddr()))
+	} else {
+		if len(sv.GitCommit) > 0 {
+			rows = append(rows, fmt.Sprintf("commit hash: %s", sv.GitCommit))
+		}
+		rows = append(rows, fmt.Sprintf("%v KΛÐΞMLIΛ hive: queen's address: %x", time.Now().UTC().Format(time.UnixDate), k.BaseAddr()))
 	}
-	rows = append(rows, fmt.Sprintf("%v KΛÐΞMLIΛ hive: queen's address: %x", time.Now().UTC().Format(time.UnixDate), k.BaseAddr()))
 	rows = append(rows, fmt.Sprintf("population: %d (%d), NeighbourhoodSize: %d, MinBinSize: %d, MaxBinSize: %d", k.defaultIndex.conns.Size(), k.defaultIndex.addrs.Size(), k.NeighbourhoodSize, k.MinBinSize, k.MaxBinSize))
 
 	liverows := make([]string, k.MaxProxDisplay)
@@ -1153,6 +1743,34 @@ func (k *Kademlia) saturation() int {
 	return prev
 }
 
+// CoverageScore returns the fraction of the address space shallower than the
+// neighbourhood depth which is covered by bins with at least MinBinSize connections.
+// A bin of proximity order po covers 1/2^(po+1) of the address space.
+// If the depth is 0, the score is 1 if there are any connections and 0 otherwise.
+func (k *Kademlia) CoverageScore() float64 {
+	k.lock.RLock()
+	defer k.lock.RUnlock()
+
+	depth := depthForPot(k.defaultIndex.conns, k.NeighbourhoodSize, k.base)
+	if depth == 0 {
+		if k.defaultIndex.conns.Size() > 0 {
+			return 1
+		}
+		return 0
+	}
+	var covered float64
+	k.defaultIndex.conns.EachBin(k.base, Pof, 0, func(bin *pot.Bin) bool {
+		if bin.ProximityOrder >= depth {
+			return false
+		}
+		if bin.Size >= k.MinBinSize {
+			covered += math.Ldexp(1, -(bin.ProximityOrder + 1))
+		}
+		return true
+	}, true)
+	return covered / (1 - math.Ldexp(1, -depth))
+}
+
 // isSaturated returns true if the kademlia is considered saturated, or false if not.
 // It checks this by checking an array of ints called unsaturatedBins; each item in that array corresponds
 // to the bin which is unsaturated (number of connections < expectedMinBinSize).
@@ -1194,7 +1812,7 @@ func (k *Kademlia) knowNeighbours(addrs [][]byte) (got bool, n int, missing [][]
 	pm := make(map[string]bool)
 	depth := depthForPot(k.defaultIndex.conns, k.NeighbourhoodSize, k.base)
 	// create a map with all peers at depth and deeper known in the kademlia
-	k.eachAddr(nil, k.defaultIndex.addrs, 255, func(p *BzzAddr, po int) bool {
+	k.eachAddr(nil, k.defaultIndex.addrs, 255, false, func(p *BzzAddr, po int) bool {
 		// in order deepest to shallowest compared to the kademlia base address
 		// all bins (except self) are included (0 <= bin <= 255)
 		if po < depth {
@@ -1233,7 +1851,7 @@ func (k *Kademlia) connectedNeighbours(peers [][]byte) (got bool, n int, missing
 	// in order deepest to shallowest compared to the kademlia base address
 	// all bins (except self) are included (0 <= bin <= 255)
 	depth := depthForPot(k.defaultIndex.conns, k.NeighbourhoodSize, k.base)
-	k.eachConn(nil, nil, 255, func(p *Peer, po int) bool {
+	k.eachConn(nil, nil, 255, false, func(p *Peer, po int) bool {
 		if po < depth {
 			return false
 		}
@@ -1262,7 +1880,12 @@ func (k *Kademlia) connectedNeighbours(peers [][]byte) (got bool, n int, missing
 //Calculates the expected min size of a given bin (minBinSize)
 func (k *Kademlia) expectedMinBinSize(proximityOrder int) int {
 	depth := depthForPot(k.defaultIndex.conns, k.NeighbourhoodSize, k.base)
+	return k.expectedMinBinSizeForDepth(proximityOrder, depth)
+}
 
+// expectedMinBinSizeForDepth returns the expected minimum number of peers
+// in the bin of the proximity order, given the neighbourhood depth
+func (k *Kademlia) expectedMinBinSizeForDepth(proximityOrder int, depth int) int {
 	minBinSize := k.MinBinSize + (depth - proximityOrder - 1)
 
 	if minBinSize < k.MinBinSize {
@@ -1300,6 +1923,14 @@ type Health struct {
 func (k *Kademlia) GetHealthInfo(pp *PeerPot) *Health {
 	k.lock.RLock()
 	defer k.lock.RUnlock()
+	h := k.healthInfo(pp)
+	h.Hive = k.string()
+	return h
+}
+
+// healthInfo reports the health state like GetHealthInfo, without the Hive string
+// caller must hold the lock
+func (k *Kademlia) healthInfo(pp *PeerPot) *Health {
 	if len(pp.NNSet) < k.NeighbourhoodSize {
 		log.Warn("peerpot NNSet < NeighbourhoodSize")
 	}
@@ -1319,10 +1950,130 @@ func (k *Kademlia) GetHealthInfo(pp *PeerPot) *Health {
 		CountConnectNN:   countgotnn,
 		MissingConnectNN: culpritsgotnn,
 		Saturated:        saturated,
-		Hive:             k.string(),
 	}
 }
 
+// healthSub is a subscription to the changes of the strict health for a PeerPot
+type healthSub struct {
+	pp      *PeerPot
+	c       chan bool
+	healthy bool // last sent health
+}
+
+// SubscribeHealth returns the channel that receives true when the kademlia becomes healthy
+// and false when it stops being healthy, by the strict interpretation of Health.Healthy for
+// the PeerPot. The health is checked whenever a peer is connected or disconnected, and once on
+// subscription, so true is received right away if the kademlia is already healthy. Only the
+// latest change is kept for a slow receiver. Returned function unsubscribes the channel from
+// signaling and releases the resources. Returned function is safe to be called multiple times.
+func (k *Kademlia) SubscribeHealth(pp *PeerPot) (c <-chan bool, unsubscribe func()) {
+	sub := &healthSub{
+		pp: pp,
+		c:  make(chan bool, 1),
+	}
+	var closeOnce sync.Once
+
+	k.lock.Lock()
+	defer k.lock.Unlock()
+
+	k.healthSubs = append(k.healthSubs, sub)
+	k.notifyHealthSub(sub)
+
+	unsubscribe = func() {
+		k.lock.Lock()
+		defer k.lock.Unlock()
+
+		for i, s := range k.healthSubs {
+			if s == sub {
+				k.healthSubs = append(k.healthSubs[:i], k.healthSubs[i+1:]...)
+				break
+			}
+		}
+
+		closeOnce.Do(func() { close(sub.c) })
+	}
+
+	return sub.c, unsubscribe
+}
+
+// notifyHealth sends the health to the subscriptions for which it changed
+// caller must hold the lock
+func (k *Kademlia) notifyHealth() {
+	for _, sub := range k.healthSubs {
+		k.notifyHealthSub(sub)
+	}
+}
+
+// notifyHealthSub sends the health to the subscription if it changed
+// caller must hold the lock
+func (k *Kademlia) notifyHealthSub(sub *healthSub) {
+	healthy := k.healthInfo(sub.pp).Healthy()
+	if healthy == sub.healthy {
+		return
+	}
+	sub.healthy = healthy
+	// replace the change not received yet, as only the latest one matters
+	select {
+	case <-sub.c:
+	default:
+	}
+	sub.c <- healthy
+}
+
+// CapabilityHealth reports whether the connections of the capability index are healthy:
+// - at least one peer with the capability is connected
+// - bins shallower than the capability depth have the expected minimum number of
+//   connections, or as many as there are known peers with the capability in the bin
+// - all known peers with the capability within the capability depth are connected
+// It returns an error if the capability index is not registered.
+func (k *Kademlia) CapabilityHealth(capKey string) (bool, error) {
+	k.lock.RLock()
+	defer k.lock.RUnlock()
+	idx, ok := k.capabilityIndex[capKey]
+	if !ok {
+		return false, fmt.Errorf("Unknown capability index %v", capKey)
+	}
+	if idx.conns.Size() == 0 {
+		return false, nil
+	}
+	depth := capabilityDepthForPot(idx, k.NeighbourhoodSize, k.base)
+
+	conns := make(map[int]int)
+	idx.conns.EachBin(k.base, Pof, 0, func(bin *pot.Bin) bool {
+		conns[bin.ProximityOrder] = bin.Size
+		return true
+	}, true)
+
+	healthy := true
+	idx.addrs.EachBin(k.base, Pof, 0, func(bin *pot.Bin) bool {
+		po := bin.ProximityOrder
+		want := bin.Size
+		if po < depth {
+			if expected := k.expectedMinBinSizeForDepth(po, depth); expected < want {
+				want = expected
+			}
+		}
+		if conns[po] < want {
+			healthy = false
+			return false
+		}
+		return true
+	}, true)
+	return healthy, nil
+}
+
+// CapabilityKeys returns the sorted keys of the registered capability indices
+func (k *Kademlia) CapabilityKeys() []string {
+	k.lock.RLock()
+	defer k.lock.RUnlock()
+	keys := make([]string, 0, len(k.capabilityIndex))
+	for s := range k.capabilityIndex {
+		keys = append(keys, s)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
 // Healthy return the strict interpretation of `Healthy` given a `Health` struct
 // definition of strict health: all conditions must be true:
 // - we at least know one peer
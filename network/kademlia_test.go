@@ -18,7 +18,10 @@ package network
 
 import (
 	"fmt"
+	"math"
 	"os"
+	"sort"
+	"strings"
 	"testing"
 	"time"
 
@@ -94,6 +97,62 @@ func (tk *testKademlia) Register(regs ...string) {
 	}
 }
 
+// TestSetNeighbourhoodSize checks that increasing the neighbourhood size of a running
+// kademlia extends the neighbourhood to shallower bins and signals the depth change
+// subscribers, and that invalid sizes are rejected.
+func TestSetNeighbourhoodSize(t *testing.T) {
+	baseAddressBytes := RandomBzzAddr().OAddr
+	kad := NewKademlia(baseAddressBytes, NewKadParams())
+	baseAddress := pot.NewAddressFromBytes(baseAddressBytes)
+
+	// one peer in each bin from 0 to 7
+	for i := 0; i < 8; i++ {
+		kad.On(newTestDiscoveryPeer(pot.RandomAddressAt(baseAddress, i), kad))
+	}
+	if depth := kad.NeighbourhoodDepth(); depth != 6 {
+		t.Fatalf("expected depth 6, was %d", depth)
+	}
+
+	c, unsubscribe := kad.SubscribeToNeighbourhoodDepthChange()
+	defer unsubscribe()
+	signalled := func() bool {
+		select {
+		case <-c:
+			return true
+		default:
+			return false
+		}
+	}
+
+	for _, tc := range []struct {
+		size   int
+		depth  int
+		signal bool
+	}{
+		{size: 4, depth: 4, signal: true},
+		{size: 4, depth: 4, signal: false},
+		{size: 5, depth: 3, signal: true},
+		{size: 2, depth: 6, signal: true},
+	} {
+		if err := kad.SetNeighbourhoodSize(tc.size); err != nil {
+			t.Fatal(err)
+		}
+		if depth := kad.NeighbourhoodDepth(); depth != tc.depth {
+			t.Fatalf("size %d: expected depth %d, was %d", tc.size, tc.depth, depth)
+		}
+		if got := signalled(); got != tc.signal {
+			t.Fatalf("size %d: got depth change signal %v, want %v", tc.size, got, tc.signal)
+		}
+	}
+
+	if err := kad.SetNeighbourhoodSize(0); err == nil {
+		t.Fatal("expected error for neighbourhood size 0")
+	}
+	if kad.NeighbourhoodSize != 2 {
+		t.Fatalf("expected neighbourhood size 2, was %d", kad.NeighbourhoodSize)
+	}
+}
+
 // tests the validity of neighborhood depth calculations
 //
 // in particular, it tests that if there are one or more consecutive
@@ -215,6 +274,49 @@ func TestHighMinBinSize(t *testing.T) {
 	}
 }
 
+// TestCoverageScore tests the coverage score of a well covered and a sparse table
+func TestCoverageScore(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		peers []string
+		want  float64
+	}{
+		{
+			name: "empty",
+			want: 0,
+		},
+		{
+			name: "well covered",
+			peers: []string{
+				"00000000", "00000001", // bin 0
+				"10000000", "10000001", // bin 1
+				"11000000", "11000001", // bin 2
+				"11100000", "11110000", // neighbours
+			},
+			want: 1,
+		},
+		{
+			name: "sparse",
+			peers: []string{
+				"00000000",             // bin 0
+				"10000000", "10000001", // bin 1
+				"11000000",             // bin 2
+				"11100000", "11110000", // neighbours
+			},
+			// only bin 1 is covered, 1/4 of the 7/8 of the address space shallower than depth 3
+			want: 2.0 / 7,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tk := newTestKademlia(t, "11111111")
+			tk.On(tc.peers...)
+			if got := tk.CoverageScore(); math.Abs(got-tc.want) > 1e-9 {
+				t.Fatalf("got coverage score %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
 // TestHealthStrict tests the simplest definition of health
 // Which means whether we are connected to all neighbors we know of
 func TestHealthStrict(t *testing.T) {
@@ -332,6 +434,67 @@ func TestHealthStrict(t *testing.T) {
 	tk.checkHealth(false)
 }
 
+// TestSubscribeHealth checks that health subscriptions receive
+// the changes of the strict health on connecting and disconnecting peers
+func TestSubscribeHealth(t *testing.T) {
+	tk := newTestKademlia(t, "11111111")
+	addrs := [][]byte{tk.BaseAddr()}
+	for _, s := range []string{"11100000", "11111100"} {
+		addrs = append(addrs, testKadPeerAddr(s).Address())
+	}
+	pp := NewPeerPotMap(tk.NeighbourhoodSize, addrs)[common.Bytes2Hex(tk.BaseAddr())]
+
+	c, unsubscribe := tk.SubscribeHealth(pp)
+	defer unsubscribe()
+
+	expect := func(want bool) {
+		t.Helper()
+		select {
+		case healthy := <-c:
+			if healthy != want {
+				t.Fatalf("expected health %v, got %v", want, healthy)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("timeout waiting for health %v", want)
+		}
+	}
+	expectNone := func() {
+		t.Helper()
+		select {
+		case healthy := <-c:
+			t.Fatalf("unexpected health %v", healthy)
+		default:
+		}
+	}
+
+	expectNone()
+	tk.Register("11100000", "11111100")
+	tk.On("11100000")
+	expectNone()
+	tk.On("11111100")
+	expect(true)
+	tk.Off("11111100")
+	expect(false)
+
+	// the current health is sent on subscription
+	tk.On("11111100")
+	expect(true)
+	c2, unsubscribe2 := tk.SubscribeHealth(pp)
+	select {
+	case healthy := <-c2:
+		if !healthy {
+			t.Fatal("expected health true on subscription")
+		}
+	default:
+		t.Fatal("expected health on subscription")
+	}
+	unsubscribe2()
+	unsubscribe2()
+	if _, ok := <-c2; ok {
+		t.Fatal("expected closed channel after unsubscribe")
+	}
+}
+
 func (tk *testKademlia) checkHealth(expectHealthy bool) {
 	tk.t.Helper()
 	kid := common.Bytes2Hex(tk.BaseAddr())
@@ -520,6 +683,44 @@ func TestSuggestPeersSaturationDepthChange(t *testing.T) {
 
 }
 
+// TestSuggestPeerBootnodesOnly checks that bootnodes are suggested
+// when the table is seeded only with bootnodes
+func TestSuggestPeerBootnodesOnly(t *testing.T) {
+	tk := newTestKademlia(t, "00000000")
+	tk.Register("10000000", "01000000")
+	tk.MarkBootnodes(testKadPeerAddr("10000000"), testKadPeerAddr("01000000"))
+	if !tk.IsBootnode(testKadPeerAddr("10000000")) {
+		t.Fatal("expected address to be marked as bootnode")
+	}
+
+	tk.checkSuggestPeer("10000000", 0, false)
+	tk.On("10000000")
+	tk.checkSuggestPeer("01000000", 0, false)
+}
+
+// TestSuggestPeerDeprioritizesBootnodes checks that once there are enough connections
+// to other peers in the shallow bins, bootnodes are suggested only if no other peer can be
+func TestSuggestPeerDeprioritizesBootnodes(t *testing.T) {
+	newTestKademliaWithBootnode := func(mark bool) *testKademlia {
+		tk := newTestKademlia(t, "00000000")
+		tk.On("10000000", "11000000", "01000000", "00100000")
+		tk.Register("00010000", "01100000")
+		if mark {
+			tk.MarkBootnodes(testKadPeerAddr("00010000"))
+		}
+		return tk
+	}
+
+	// the bootnode is in the least saturated bin
+	tk := newTestKademliaWithBootnode(false)
+	tk.checkSuggestPeer("00010000", 0, false)
+
+	tk = newTestKademliaWithBootnode(true)
+	tk.checkSuggestPeer("01100000", 0, false)
+	// the bootnode is still suggested if no other peer can be
+	tk.checkSuggestPeer("00010000", 0, false)
+}
+
 // a node should stay in the address book if it's removed from the kademlia
 func TestOffEffectingAddressBookNormalNode(t *testing.T) {
 	tk := newTestKademlia(t, "00000000")
@@ -583,16 +784,63 @@ func TestSuggestPeerRetries(t *testing.T) {
 	tk.checkSuggestPeer("<nil>", 0, false)
 }
 
+// TestRetryState checks that RetryState reports the retries of a known address
+// consumed by SuggestPeer, when it is eligible again and when its retries are exhausted
+func TestRetryState(t *testing.T) {
+	tk := newTestKademlia(t, "00000000")
+	tk.RetryInterval = int64(time.Hour)
+	tk.MaxRetries = 1
+	tk.RetryExponent = 2
+
+	addr := testKadPeerAddr("01000000").Address()
+	if retries, next, exhausted := tk.RetryState(addr); retries != 0 || !next.IsZero() || exhausted {
+		t.Fatalf("expected zero retry state for unknown address, got %v %v %v", retries, next, exhausted)
+	}
+
+	tk.Register("01000000")
+	tk.On("00000001", "00000010")
+	tk.checkSuggestPeer("01000000", 0, false)
+
+	retries, next, exhausted := tk.RetryState(addr)
+	if retries != 1 || exhausted {
+		t.Fatalf("expected 1 retry not exhausted, got %v %v", retries, exhausted)
+	}
+	if wait := time.Until(next); wait <= 0 || wait > time.Hour {
+		t.Fatalf("expected next eligible time within the retry interval, got %v", wait)
+	}
+	tk.checkSuggestPeer("<nil>", 0, false)
+
+	// make the address eligible again by moving the time it was seen
+	tk.lock.Lock()
+	tk.defaultEntry(testKadPeerAddr("01000000")).seenAt = time.Now().Add(-3 * time.Hour)
+	tk.lock.Unlock()
+	tk.checkSuggestPeer("01000000", 0, false)
+
+	retries, next, exhausted = tk.RetryState(addr)
+	if retries != 2 || !exhausted {
+		t.Fatalf("expected 2 retries exhausted, got %v %v", retries, exhausted)
+	}
+	if wait := time.Until(next); wait > 0 {
+		t.Fatalf("expected next eligible time to be in the past, got %v", wait)
+	}
+}
+
 func TestKademliaHiveString(t *testing.T) {
 	tk := newTestKademlia(t, "00000000")
 	tk.On("01000000", "00100000")
 	tk.Register("10000000", "10000001")
 	tk.MaxProxDisplay = 8
-	h := tk.String()
-	expH := "\n=========================================================================\nMon Feb 27 12:10:28 UTC 2017 KΛÐΞMLIΛ hive: queen's address: 0000000000000000000000000000000000000000000000000000000000000000\npopulation: 2 (4), NeighbourhoodSize: 2, MinBinSize: 2, MaxBinSize: 16\n============ DEPTH: 0 ==========================================\n000  0                              |  2 8100 (0) 8000 (0)\n001  1 4000                         |  1 4000 (0)\n002  1 2000                         |  1 2000 (0)\n003  0                              |  0\n004  0                              |  0\n005  0                              |  0\n006  0                              |  0\n007  0                              |  0\n========================================================================="
-	if expH[104:] != h[104:] {
+	h := tk.HiveStringStable()
+	expH := "\n=========================================================================\nKΛÐΞMLIΛ hive: queen's address: 0000000000000000000000000000000000000000000000000000000000000000\npopulation: 2 (4), NeighbourhoodSize: 2, MinBinSize: 2, MaxBinSize: 16\n============ DEPTH: 0 ==========================================\n000  0                              |  2 8100 (0) 8000 (0)\n001  1 4000                         |  1 4000 (0)\n002  1 2000                         |  1 2000 (0)\n003  0                              |  0\n004  0                              |  0\n005  0                              |  0\n006  0                              |  0\n007  0                              |  0\n========================================================================="
+	if expH != h {
 		t.Fatalf("incorrect hive output. expected %v, got %v", expH, h)
 	}
+
+	// String has the same layout after the header
+	h = tk.String()
+	if expRest, rest := expH[strings.Index(expH, "population:"):], h[strings.Index(h, "population:"):]; expRest != rest {
+		t.Fatalf("incorrect hive output. expected %v, got %v", expRest, rest)
+	}
 }
 
 func newTestDiscoveryPeer(addr pot.Address, kad *Kademlia) *Peer {
@@ -1031,6 +1279,135 @@ func testCapabilityIndexRemove(t *testing.T) {
 	}
 }
 
+// TestEachConnFilteredAny checks that EachConnFilteredAny visits the connected peers
+// matching any of the given capability indices, and each of them only once
+func TestEachConnFilteredAny(t *testing.T) {
+	k, discPeers, _ := testCapabilityIndexHelper()
+	for _, p := range discPeers {
+		k.On(p)
+	}
+
+	for _, tc := range []struct {
+		capKeys []string
+		want    []string
+	}{
+		{[]string{"42:101"}, []string{"42:101", "42:101,666:101"}},
+		{[]string{"42:101", "666:101"}, []string{"42:101", "666:101", "42:101,666:101"}},
+		{[]string{"666:101", "42:101", "666:101"}, []string{"42:101", "666:101", "42:101,666:101"}},
+		{[]string{"42:010", "42:001"}, []string{"42:001"}},
+		{[]string{"42:010"}, nil},
+		{nil, nil},
+	} {
+		visited := make(map[*Peer]int)
+		err := k.EachConnFilteredAny(k.BaseAddr(), tc.capKeys, 255, func(p *Peer, _ int) bool {
+			visited[p]++
+			return true
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(visited) != len(tc.want) {
+			t.Fatalf("%v: got %d peers, want %d", tc.capKeys, len(visited), len(tc.want))
+		}
+		for _, name := range tc.want {
+			if n := visited[discPeers[name]]; n != 1 {
+				t.Fatalf("%v: got peer %s visited %d times, want once", tc.capKeys, name, n)
+			}
+		}
+	}
+
+	if err := k.EachConnFilteredAny(k.BaseAddr(), []string{"42:101", "unknown"}, 255, func(*Peer, int) bool {
+		return true
+	}); err == nil {
+		t.Fatal("expected error for unregistered capability index")
+	}
+}
+
+// TestEachFilteredReverse tests the order in which the peers of a capability index
+// are visited by the filtered iterators and their reverse variants
+func TestEachFilteredReverse(t *testing.T) {
+	tk := newTestKademlia(t, "11111111")
+	c := capability.NewCapability(42, 1)
+	c.Set(0)
+	tk.RegisterCapabilityIndex("42", *c)
+
+	// peers in bins 0, 1 and 2
+	for _, a := range []string{"01111111", "10111111", "11011111"} {
+		p := tk.newTestKadPeerWithCapabilities(a, c)
+		tk.Kademlia.Register(p.BzzAddr)
+		tk.Kademlia.On(p)
+	}
+	// a peer without the capability
+	tk.On("11101111")
+
+	for _, tc := range []struct {
+		name string
+		each func(f func(po int) bool) error
+		want []int
+	}{
+		{
+			name: "conns",
+			each: func(f func(po int) bool) error {
+				return tk.EachConnFiltered(nil, "42", 255, func(_ *Peer, po int) bool { return f(po) })
+			},
+			want: []int{2, 1, 0},
+		},
+		{
+			name: "conns reverse",
+			each: func(f func(po int) bool) error {
+				return tk.EachConnFilteredReverse(nil, "42", 255, func(_ *Peer, po int) bool { return f(po) })
+			},
+			want: []int{0, 1, 2},
+		},
+		{
+			name: "addrs",
+			each: func(f func(po int) bool) error {
+				return tk.EachAddrFiltered(nil, "42", 255, func(_ *BzzAddr, po int) bool { return f(po) })
+			},
+			want: []int{2, 1, 0},
+		},
+		{
+			name: "addrs reverse",
+			each: func(f func(po int) bool) error {
+				return tk.EachAddrFilteredReverse(nil, "42", 255, func(_ *BzzAddr, po int) bool { return f(po) })
+			},
+			want: []int{0, 1, 2},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var got []int
+			if err := tc.each(func(po int) bool {
+				got = append(got, po)
+				return true
+			}); err != nil {
+				t.Fatal(err)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tc.want) {
+				t.Fatalf("got bins %v, want %v", got, tc.want)
+			}
+
+			// stop after the first peer
+			got = nil
+			if err := tc.each(func(po int) bool {
+				got = append(got, po)
+				return false
+			}); err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != 1 || got[0] != tc.want[0] {
+				t.Fatalf("got bins %v, want [%v]", got, tc.want[0])
+			}
+		})
+	}
+
+	if err := tk.EachConnFilteredReverse(nil, "unknown", 255, func(*Peer, int) bool { return true }); err == nil {
+		t.Fatal("expected error for unregistered capability index")
+	}
+	if err := tk.EachAddrFilteredReverse(nil, "unknown", 255, func(*BzzAddr, int) bool { return true }); err == nil {
+		t.Fatal("expected error for unregistered capability index")
+	}
+}
+
 // TestCapabilityNeighbourhoodDepth tests that depth calculations filtered by capability is correct
 func TestCapabilityNeighbourhoodDepth(t *testing.T) {
 	baseAddressBytes := RandomBzzAddr().OAddr
@@ -1085,6 +1462,151 @@ func TestCapabilityNeighbourhoodDepth(t *testing.T) {
 	}
 }
 
+// TestCapabilityIndexMaxAddrs tests that registering addresses beyond the limit of a
+// capability index keeps the index at the limit, evicting from the most populated bin,
+// and does not affect the default index
+func TestCapabilityIndexMaxAddrs(t *testing.T) {
+	baseAddressBytes := RandomBzzAddr().OAddr
+	kad := NewKademlia(baseAddressBytes, NewKadParams())
+	c := capability.NewCapability(42, 1)
+	c.Set(0)
+	if err := kad.RegisterCapabilityIndex("bounded", *c, WithMaxAddrs(4)); err != nil {
+		t.Fatal(err)
+	}
+
+	baseAddress := pot.NewAddressFromBytes(baseAddressBytes)
+	for _, po := range []int{0, 0, 0, 1, 2, 3} {
+		p := newTestDiscoveryPeer(pot.RandomAddressAt(baseAddress, po), kad)
+		p.BzzAddr.Capabilities.Add(c)
+		if err := kad.Register(p.BzzAddr); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	size, err := kad.CapabilityIndexSize("bounded")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != 4 {
+		t.Fatalf("got capability index size %d, want 4", size)
+	}
+	if size := kad.defaultIndex.addrs.Size(); size != 6 {
+		t.Fatalf("got default index size %d, want 6", size)
+	}
+
+	bins := make(map[int]int)
+	if err := kad.EachAddrFiltered(kad.BaseAddr(), "bounded", 255, func(_ *BzzAddr, po int) bool {
+		bins[po]++
+		return true
+	}); err != nil {
+		t.Fatal(err)
+	}
+	for po, want := range map[int]int{0: 1, 1: 1, 2: 1, 3: 1} {
+		if bins[po] != want {
+			t.Errorf("got %d addresses in bin %d, want %d", bins[po], po, want)
+		}
+	}
+
+	if _, err := kad.CapabilityIndexSize("unknown"); err == nil {
+		t.Fatal("expected error for unregistered capability index")
+	}
+}
+
+// TestCapabilityIndexMask checks that a capability index registered with required bits
+// holds the peers having at least those bits set, unlike an index with an exact capability
+func TestCapabilityIndexMask(t *testing.T) {
+	kad := NewKademlia(RandomBzzAddr().OAddr, NewKadParams())
+	if err := kad.RegisterCapabilityIndexMask("mask", 42, []int{2}); err != nil {
+		t.Fatal(err)
+	}
+	exact := capability.NewCapability(42, 4)
+	exact.Set(2)
+	if err := kad.RegisterCapabilityIndex("exact", *exact); err != nil {
+		t.Fatal(err)
+	}
+	if err := kad.RegisterCapabilityIndexMask("invalid", 42, []int{-1}); err == nil {
+		t.Fatal("expected error for negative required bit")
+	}
+
+	for _, c := range []struct {
+		id   capability.CapabilityID
+		bits []int
+		size int
+	}{
+		{42, []int{2}, 4},       // both indices
+		{42, []int{0, 1, 2}, 4}, // mask index only
+		{42, []int{2}, 3},       // mask index only
+		{42, []int{1}, 4},       // none
+		{666, []int{2}, 4},      // none
+	} {
+		p := newTestDiscoveryPeer(pot.RandomAddress(), kad)
+		cp := capability.NewCapability(c.id, c.size)
+		for _, b := range c.bits {
+			cp.Set(b)
+		}
+		p.BzzAddr.Capabilities.Add(cp)
+		if err := kad.Register(p.BzzAddr); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for s, want := range map[string]int{"mask": 3, "exact": 1} {
+		size, err := kad.CapabilityIndexSize(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if size != want {
+			t.Errorf("got capability index %q size %d, want %d", s, size, want)
+		}
+	}
+}
+
+// TestKademliaInfoCapabilities tests that KademliaInfo reports the depth
+// and population of the registered capability indices
+func TestKademliaInfoCapabilities(t *testing.T) {
+	baseAddressBytes := RandomBzzAddr().OAddr
+	kad := NewKademlia(baseAddressBytes, NewKadParams())
+	c := capability.NewCapability(42, 1)
+	c.Set(0)
+	kad.RegisterCapabilityIndex("42", *c)
+
+	baseAddress := pot.NewAddressFromBytes(baseAddressBytes)
+	for i := 0; i < 3; i++ {
+		p := newTestDiscoveryPeer(pot.RandomAddressAt(baseAddress, i), kad)
+		p.BzzAddr.Capabilities.Add(c)
+		kad.Register(p.BzzAddr)
+		if i < 2 {
+			kad.On(p)
+		}
+	}
+	// a peer without the capability
+	p := newTestDiscoveryPeer(pot.RandomAddressAt(baseAddress, 3), kad)
+	kad.Register(p.BzzAddr)
+	kad.On(p)
+
+	ki := kad.KademliaInfo()
+	if ki.TotalConnections != 3 || ki.TotalKnown != 4 {
+		t.Fatalf("got %d connections and %d known, want 3 and 4", ki.TotalConnections, ki.TotalKnown)
+	}
+	depth, err := kad.NeighbourhoodDepthCapability("42")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := CapabilityInfo{
+		Depth:            depth,
+		TotalConnections: 2,
+		TotalKnown:       3,
+	}
+	if got := ki.Capabilities["42"]; got != want {
+		t.Fatalf("got capability info %+v, want %+v", got, want)
+	}
+	for _, key := range kad.CapabilityKeys() {
+		if _, ok := ki.Capabilities[key]; !ok {
+			t.Errorf("missing info of capability index %q", key)
+		}
+	}
+}
+
 //TestSuggestPeerInBinByGap will check that when several addresses are available for register in the same bin, the
 //one suggested is the one that fills the biggest gap of address in that bin.
 func TestSuggestPeerInBinByGap(t *testing.T) {
@@ -1159,3 +1681,319 @@ func (tk *testKademlia) getAddressBin(po int) *pot.Bin {
 func bzzAddrToBinary(bzzAddress *BzzAddr) string {
 	return byteToBitString(bzzAddress.OAddr[0])
 }
+
+// TestSuggestPeerMulti checks that SuggestPeerMulti suggests the unconnected peer
+// of the least saturated bin across the capability indices
+func TestSuggestPeerMulti(t *testing.T) {
+	capA := capability.NewCapability(42, 1)
+	capA.Set(0)
+	capB := capability.NewCapability(43, 1)
+	capB.Set(0)
+
+	// newKademlia returns a kademlia with connected peers with capability a
+	// and the given addresses registered with capabilities a or b
+	newKademlia := func(regA, regB []string) *testKademlia {
+		tk := newTestKademlia(t, "00000000")
+		tk.RegisterCapabilityIndex("a", *capA)
+		tk.RegisterCapabilityIndex("b", *capB)
+		register := func(s string, cap *capability.Capability) {
+			addr := testKadPeerAddr(s)
+			addr.Capabilities.Add(cap)
+			if err := tk.Kademlia.Register(addr); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for _, s := range []string{"10000000", "11000000"} {
+			register(s, capA)
+			tk.Kademlia.On(tk.newTestKadPeerWithCapabilities(s, capA))
+		}
+		for _, s := range regA {
+			register(s, capA)
+		}
+		for _, s := range regB {
+			register(s, capB)
+		}
+		return tk
+	}
+
+	for _, tc := range []struct {
+		name    string
+		regA    []string
+		regB    []string
+		capKeys []string
+		want    string
+	}{
+		{"connected peers are not suggested", nil, nil, []string{"a", "b"}, "<nil>"},
+		{"unknown keys are ignored", []string{"10100000"}, nil, []string{"a", "unknown"}, "10100000"},
+		{"least saturated bin", []string{"10100000"}, []string{"01000000"}, []string{"a", "b"}, "01000000"},
+		{"least saturated bin reversed", []string{"10100000"}, []string{"01000000"}, []string{"b", "a"}, "01000000"},
+		{"equally saturated bins", []string{"01100000"}, []string{"01000000"}, []string{"a", "b"}, "01100000"},
+		{"equally saturated bins reversed", []string{"01100000"}, []string{"01000000"}, []string{"b", "a"}, "01000000"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tk := newKademlia(tc.regA, tc.regB)
+			if addr, _, _ := tk.SuggestPeerMulti(tc.capKeys); binStr(addr) != tc.want {
+				t.Fatalf("expected suggestion %v, got %v", tc.want, binStr(addr))
+			}
+		})
+	}
+
+	// only the suggested peer is counted as retried
+	tk := newKademlia([]string{"10100000"}, []string{"01000000"})
+	if addr, _, _ := tk.SuggestPeerMulti([]string{"a", "b"}); binStr(addr) != "01000000" {
+		t.Fatalf("expected suggestion 01000000, got %v", binStr(addr))
+	}
+	if addr, _, _ := tk.SuggestPeerMulti([]string{"a"}); binStr(addr) != "10100000" {
+		t.Fatalf("expected suggestion 10100000, got %v", binStr(addr))
+	}
+}
+
+// TestCapabilityHealth checks that the health of a capability index
+// only depends on the connections of peers with the capability
+func TestCapabilityHealth(t *testing.T) {
+	capA := capability.NewCapability(42, 1)
+	capA.Set(0)
+
+	tk := newTestKademlia(t, "00000000")
+	tk.RegisterCapabilityIndex("a", *capA)
+	register := func(s string) {
+		addr := testKadPeerAddr(s)
+		addr.Capabilities.Add(capA)
+		if err := tk.Kademlia.Register(addr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	connect := func(s string) {
+		register(s)
+		tk.Kademlia.On(tk.newTestKadPeerWithCapabilities(s, capA))
+	}
+	check := func(want bool) {
+		t.Helper()
+		healthy, err := tk.CapabilityHealth("a")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if healthy != want {
+			t.Fatalf("expected capability health %v, got %v\n%v", want, healthy, tk.String())
+		}
+	}
+
+	if _, err := tk.CapabilityHealth("unknown"); err == nil {
+		t.Fatal("expected error for unknown capability index")
+	}
+
+	// peers without the capability do not count
+	tk.On("10000000", "01000000")
+	check(false)
+
+	// within depth all known peers must be connected
+	connect("10000000")
+	connect("01000000")
+	check(true)
+	register("11000000")
+	check(false)
+	connect("11000000")
+	check(true)
+
+	// depth 1, bin 0 needs MinBinSize connections only
+	connect("00100000")
+	register("10100000")
+	check(true)
+	if keys := tk.CapabilityKeys(); !sort.StringsAreSorted(keys) || keys[sort.SearchStrings(keys, "a")] != "a" {
+		t.Fatalf("expected sorted capability keys including a, got %v", keys)
+	}
+}
+
+// TestRegisterReport checks that RegisterReport distinguishes newly added
+// addresses from the ones already known with the same underlay address
+func TestRegisterReport(t *testing.T) {
+	tk := newTestKademlia(t, "00000000")
+
+	binStrs := func(addrs []*BzzAddr) (s []string) {
+		for _, a := range addrs {
+			s = append(s, binStr(a))
+		}
+		return s
+	}
+	check := func(addrs []*BzzAddr, wantAdded, wantDuplicates []string) {
+		t.Helper()
+		added, duplicates, err := tk.RegisterReport(addrs...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := binStrs(added); fmt.Sprint(got) != fmt.Sprint(wantAdded) {
+			t.Fatalf("expected added %v, got %v", wantAdded, got)
+		}
+		if got := binStrs(duplicates); fmt.Sprint(got) != fmt.Sprint(wantDuplicates) {
+			t.Fatalf("expected duplicates %v, got %v", wantDuplicates, got)
+		}
+	}
+
+	check([]*BzzAddr{testKadPeerAddr("10000000"), testKadPeerAddr("01000000")}, []string{"10000000", "01000000"}, nil)
+	check([]*BzzAddr{testKadPeerAddr("10000000"), testKadPeerAddr("00100000")}, []string{"00100000"}, []string{"10000000"})
+
+	// a known address with a different underlay address is added again
+	changed := testKadPeerAddr("01000000")
+	changed.UAddr = []byte("changed")
+	check([]*BzzAddr{changed}, []string{"01000000"}, nil)
+
+	// registering self fails, but preceding addresses are registered
+	added, _, err := tk.RegisterReport(testKadPeerAddr("00010000"), testKadPeerAddr("00000000"))
+	if err == nil {
+		t.Fatal("expected error registering self")
+	}
+	if got := binStrs(added); fmt.Sprint(got) != "[00010000]" {
+		t.Fatalf("expected added [00010000], got %v", got)
+	}
+}
+
+// TestOnLimited checks that OnLimited applies the BinFullPolicy, RejectOnFullBin
+// by default, only to peers connecting in a bin with MaxBinSize connections
+func TestOnLimited(t *testing.T) {
+	newKademlia := func(policy BinFullPolicy) *testKademlia {
+		tk := newTestKademlia(t, "00000000")
+		tk.MaxBinSize = 2
+		tk.BinFullPolicy = policy
+		return tk
+	}
+	connected := func(tk *testKademlia) (addrs []string) {
+		tk.EachConn(nil, 255, func(p *Peer, _ int) bool {
+			addrs = append(addrs, binStr(p.BzzAddr))
+			return true
+		})
+		sort.Strings(addrs)
+		return addrs
+	}
+	onLimited := func(tk *testKademlia, s string) (*Peer, error) {
+		_, _, evicted, err := tk.OnLimited(tk.newTestKadPeer(s))
+		return evicted, err
+	}
+
+	t.Run("no policy", func(t *testing.T) {
+		tk := newKademlia(nil)
+		for _, s := range []string{"10000000", "11000000", "10100000"} {
+			if _, err := onLimited(tk, s); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if got := connected(tk); len(got) != 3 {
+			t.Fatalf("expected 3 connected peers, got %v", got)
+		}
+	})
+
+	t.Run("reject", func(t *testing.T) {
+		tk := newKademlia(RejectOnFullBin)
+		for _, s := range []string{"10000000", "11000000", "01000000"} {
+			if _, err := onLimited(tk, s); err != nil {
+				t.Fatal(err)
+			}
+		}
+		// already connected peers are not limited
+		if _, err := onLimited(tk, "10000000"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := onLimited(tk, "10100000"); err != ErrBinFull {
+			t.Fatalf("expected error %v, got %v", ErrBinFull, err)
+		}
+		want := "[01000000 10000000 11000000]"
+		if got := connected(tk); fmt.Sprint(got) != want {
+			t.Fatalf("expected connected peers %v, got %v", want, got)
+		}
+	})
+
+	t.Run("evict", func(t *testing.T) {
+		quality := map[string]float64{
+			"10000000": 2,
+			"11000000": 1,
+			"10100000": 0,
+		}
+		tk := newKademlia(EvictLowestQuality(func(p *Peer) float64 {
+			return quality[binStr(p.BzzAddr)]
+		}))
+		for _, s := range []string{"10000000", "11000000"} {
+			if _, err := onLimited(tk, s); err != nil {
+				t.Fatal(err)
+			}
+		}
+		evicted, err := onLimited(tk, "10100000")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := binStr(evicted.BzzAddr); got != "11000000" {
+			t.Fatalf("expected evicted peer 11000000, got %v", got)
+		}
+		want := "[10000000 10100000]"
+		if got := connected(tk); fmt.Sprint(got) != want {
+			t.Fatalf("expected connected peers %v, got %v", want, got)
+		}
+		// the evicted peer disconnecting afterwards must not fail
+		// nor publish another off signal
+		sub := tk.SubscribeToPeerChanges()
+		defer sub.Unsubscribe()
+		tk.Kademlia.Off(evicted)
+		tk.Off("10000000")
+		select {
+		case msg := <-sub.ReceiveChannel():
+			if got := binStr(msg.(onOffPeerSignal).peer.BzzAddr); got != "10000000" {
+				t.Fatalf("expected off signal of peer 10000000, got %v", got)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("timeout waiting for off signal")
+		}
+	})
+
+	t.Run("default", func(t *testing.T) {
+		tk := newTestKademlia(t, "00000000")
+		tk.MaxBinSize = 2
+		tk.On("10000000", "11000000", "10100000")
+		want := "[10000000 11000000]"
+		if got := connected(tk); fmt.Sprint(got) != want {
+			t.Fatalf("expected connected peers %v, got %v", want, got)
+		}
+	})
+}
+
+// TestOnSelfAndDuplicate checks that peers with the base address or with the
+// overlay address of a peer live on another connection are not inserted
+func TestOnSelfAndDuplicate(t *testing.T) {
+	base := pot.NewAddressFromBytes(pot.NewAddressFromString("00000000"))
+	tk := newTestKademlia(t, "00000000")
+	size := func() (n int) {
+		tk.EachConn(nil, 255, func(_ *Peer, _ int) bool {
+			n++
+			return true
+		})
+		return n
+	}
+
+	if _, _, _, err := tk.OnLimited(newTestDiscoveryPeer(base, tk.Kademlia)); err != ErrSelfConnection {
+		t.Fatalf("expected error %v, got %v", ErrSelfConnection, err)
+	}
+	tk.On(binStr(testKadPeerAddr("00000000")))
+	if n := size(); n != 0 {
+		t.Fatalf("expected no connected peers, got %d", n)
+	}
+
+	addr := pot.NewAddressFromBytes(pot.NewAddressFromString("10000000"))
+	p := newTestDiscoveryPeer(addr, tk.Kademlia)
+	if _, _, _, err := tk.OnLimited(p); err != nil {
+		t.Fatal(err)
+	}
+	// the same connection can be inserted again
+	tk.Kademlia.On(p)
+
+	dup := newTestDiscoveryPeer(addr, tk.Kademlia)
+	if _, _, _, err := tk.OnLimited(dup); err != ErrDuplicatePeer {
+		t.Fatalf("expected error %v, got %v", ErrDuplicatePeer, err)
+	}
+	tk.Kademlia.On(dup)
+	if n := size(); n != 1 {
+		t.Fatalf("expected 1 connected peer, got %d", n)
+	}
+	tk.EachConn(nil, 255, func(c *Peer, _ int) bool {
+		if c != p {
+			t.Fatal("expected the original connection to be kept")
+		}
+		return true
+	})
+}
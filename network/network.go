@@ -185,7 +185,17 @@ func NewEnodeRecord(params *EnodeParams) (*enr.Record, error) {
 
 	var record enr.Record
 	record.Set(NewENRAddrEntry(bzzkeybytes))
+	record.Set(ENRVersionEntry(BzzSpec.Version))
 	record.Set(ENRBootNodeEntry(params.Bootnode))
+
+	// temporary soon-to-be-legacy light/full, as in NewBzz
+	caps := capability.NewCapabilities()
+	if params.Lightnode {
+		caps.Add(newLightCapability())
+	} else {
+		caps.Add(newFullCapability())
+	}
+	record.Set(NewENRCapabilitiesEntry(caps))
 	return &record, nil
 }
 
@@ -193,6 +193,8 @@ func newServices() adapters.Services {
 		params.MaxRetries = 1000
 		params.RetryExponent = 2
 		params.RetryInterval = 1000000
+		// all the nodes are connected to each other, so the bins are not limited
+		params.BinFullPolicy = nil
 		kademlias[id] = NewKademlia(id[:], params)
 		return kademlias[id]
 	}
@@ -140,6 +140,15 @@ func (msg subPeersMsg) String() string {
 	return fmt.Sprintf("%T: request peers > PO%02d. ", msg, msg.Depth)
 }
 
+// neighboursMsg requests the nearest neighbours of the remote peer,
+// which are sent in a peersMsg
+type neighboursMsg struct{}
+
+// String returns the pretty printer
+func (msg neighboursMsg) String() string {
+	return fmt.Sprintf("%T: request nearest neighbours", msg)
+}
+
 // seen takes a peer address and checks if it was sent to a peer already
 // if not, marks the peer as sent
 func (d *Peer) seen(p *BzzAddr) bool {
@@ -222,6 +222,123 @@ func testInitialPeersMsg(t *testing.T, peerPO, peerDepth int) {
 	}
 }
 
+// TestNeighboursMsg tests that with NeighbourhoodGossip the hive requests the nearest neighbours
+// of a connected peer which advertises the hive capability, and that it responds to the request
+// with its own nearest neighbours
+func TestNeighboursMsg(t *testing.T) {
+	t.Run("supported", func(t *testing.T) {
+		testNeighboursMsg(t, true)
+	})
+	t.Run("not supported", func(t *testing.T) {
+		testNeighboursMsg(t, false)
+	})
+}
+
+func testNeighboursMsg(t *testing.T, supported bool) {
+	prvkey, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func(orig func([]*BzzAddr) []*BzzAddr) {
+		sortPeers = orig
+	}(sortPeers)
+	sortPeers = testSortPeers
+	pivotAddr := pot.NewAddressFromBytes(PrivateKeyToBzzKey(prvkey))
+	peerAddr := pot.RandomAddressAt(pivotAddr, 0)
+	params := NewHiveParams()
+	params.NeighbourhoodGossip = true
+	hive := NewHive(params, NewKademlia(pivotAddr[:], NewKadParams()), nil)
+	for po := 1; po < maxPO; po++ {
+		for i := 0; i < 2; i++ {
+			hive.On(newDiscPeer(pot.RandomAddressAt(pivotAddr, po)))
+		}
+	}
+
+	run := func(p *BzzPeer) error {
+		if supported {
+			p.BzzAddr.Capabilities.Add(newHiveCapability())
+		}
+		return hive.Run(p)
+	}
+	s, _, err := newBzzBaseTesterWithAddrs(prvkey, [][]byte{peerAddr[:]}, DiscoverySpec, run)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Stop()
+
+	peerID := s.Nodes[0].ID()
+	found := false
+	for attempts := 0; attempts < 2000; attempts++ {
+		found = hive.Peer(peerID) != nil
+		if found {
+			break
+		}
+		time.Sleep(1 * time.Millisecond)
+	}
+	if !found {
+		t.Fatal("timeout waiting for peer connection to start")
+	}
+
+	depth := hive.NeighbourhoodDepth()
+	var expBzzAddrs []*BzzAddr
+	hive.EachConn(nil, 255, func(p *Peer, po int) bool {
+		if po < depth {
+			return false
+		}
+		if !bytes.Equal(p.Address(), peerAddr[:]) {
+			expBzzAddrs = append(expBzzAddrs, p.BzzAddr)
+		}
+		return true
+	})
+	if len(expBzzAddrs) == 0 {
+		t.Fatal("expected nearest neighbours")
+	}
+
+	// a peer which does not advertise the hive capability is not sent neighboursMsg,
+	// which would otherwise be received instead of the expected peersMsg
+	expects := []p2ptest.Expect{
+		{
+			Code: 1,
+			Msg:  &subPeersMsg{Depth: uint8(hive.Saturation())},
+			Peer: peerID,
+		},
+	}
+	if supported {
+		expects = append(expects, p2ptest.Expect{
+			Code: 2,
+			Msg:  &neighboursMsg{},
+			Peer: peerID,
+		})
+	}
+	err = s.TestExchanges(
+		p2ptest.Exchange{
+			Label:   "outgoing subPeersMsg and neighboursMsg",
+			Expects: expects,
+		},
+		p2ptest.Exchange{
+			Label: "trigger neighboursMsg and expect peersMsg",
+			Triggers: []p2ptest.Trigger{
+				{
+					Code: 2,
+					Msg:  &neighboursMsg{},
+					Peer: peerID,
+				},
+			},
+			Expects: []p2ptest.Expect{
+				{
+					Code:    0,
+					Msg:     &peersMsg{Peers: testSortPeers(expBzzAddrs)},
+					Peer:    peerID,
+					Timeout: 100 * time.Millisecond,
+				},
+			},
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
 func testSortPeers(peers []*BzzAddr) []*BzzAddr {
 	comp := func(i, j int) bool {
 		vi := binary.BigEndian.Uint64(peers[i].OAddr)
@@ -41,6 +41,10 @@ var (
 	capabilitiesRelayPush     = 5
 	capabilitiesStorer        = 15
 
+	// HiveCapabilityID is the id of the hive capability advertised in the bzz handshake
+	HiveCapabilityID       = capability.CapabilityID(3)
+	capabilitiesNeighbours = 0 // node handles neighboursMsg
+
 	// temporary presets to emulate the legacy LightNode/full node regime
 	fullCapability  *capability.Capability
 	lightCapability *capability.Capability
@@ -72,6 +76,7 @@ var DiscoverySpec = &protocols.Spec{
 	Messages: []interface{}{
 		peersMsg{},
 		subPeersMsg{},
+		neighboursMsg{},
 	},
 }
 
@@ -107,6 +112,22 @@ func isFullCapability(c *capability.Capability) bool {
 	return fullCapability.IsSameAs(c)
 }
 
+// newHiveCapability returns the capability advertising the optional hive messages the node handles
+func newHiveCapability() *capability.Capability {
+	c := capability.NewCapability(HiveCapabilityID, 8)
+	c.Set(capabilitiesNeighbours)
+	return c
+}
+
+// handlesNeighboursMsg returns true if the address advertises that it handles neighboursMsg
+func handlesNeighboursMsg(addr *BzzAddr) bool {
+	if addr == nil || addr.Capabilities == nil {
+		return false
+	}
+	c := addr.Capabilities.Get(HiveCapabilityID)
+	return c != nil && len(c.Cap) > capabilitiesNeighbours && c.Cap[capabilitiesNeighbours]
+}
+
 // BzzConfig captures the config params used by the hive
 type BzzConfig struct {
 	Address      *BzzAddr
@@ -166,6 +187,7 @@ func NewBzz(config *BzzConfig, kad *Kademlia, store state.Store, streamerSpec, r
 	} else {
 		bzz.localAddr.Capabilities.Add(newFullCapability())
 	}
+	bzz.localAddr.Capabilities.Add(newHiveCapability())
 
 	return bzz
 }
@@ -277,6 +299,7 @@ func (b *Bzz) RunProtocol(spec *protocols.Spec, run func(*BzzPeer) error) func(*
 		peer := &BzzPeer{
 			Peer:       protocols.NewPeer(p, rw, spec),
 			BzzAddr:    handshake.peerAddr,
+			Bootnode:   isENRBootnode(p.Node()),
 			lastActive: time.Now(),
 		}
 
@@ -333,6 +356,8 @@ func (b *Bzz) runBzz(p *p2p.Peer, rw p2p.MsgReadWriter) error {
 type BzzPeer struct {
 	*protocols.Peer           // represents the connection for online peers
 	*BzzAddr                  // remote address -> implements Addr interface = protocols.Peer
+	Version         uint      // bzz protocol version advertised in the enode record, 0 if unknown
+	Bootnode        bool      // whether the peer advertises itself as a bootnode in the enode record
 	lastActive      time.Time // time is updated whenever mutexes are releasing
 }
 
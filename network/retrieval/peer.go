@@ -20,6 +20,7 @@ import (
 	"bytes"
 	"errors"
 	"sync"
+	"time"
 
 	"github.com/holisticode/swarm/chunk"
 	"github.com/holisticode/swarm/log"
@@ -27,13 +28,24 @@ import (
 	"github.com/holisticode/swarm/storage"
 )
 
+// latencyAverageWeight is the number of deliveries over which
+// the peer delivery latency is averaged
+const latencyAverageWeight = 8
+
 // Peer wraps BzzPeer with a contextual logger and tracks open
 // retrievals for that peer
 type Peer struct {
 	*network.BzzPeer
-	logger     log.Logger             // logger with base and peer address
-	mtx        sync.Mutex             // synchronize retrievals
-	retrievals map[uint]chunk.Address // current ongoing retrievals
+	logger     log.Logger         // logger with base and peer address
+	mtx        sync.Mutex         // synchronize retrievals
+	retrievals map[uint]retrieval // current ongoing retrievals
+	latency    time.Duration      // moving average of chunk delivery latency, zero if no chunks were delivered
+}
+
+// retrieval is an ongoing retrieve request sent to the peer
+type retrieval struct {
+	addr        chunk.Address // address of the requested chunk
+	requestedAt time.Time     // time when the request was sent, to measure delivery latency
 }
 
 // NewPeer is the constructor for Peer
@@ -41,7 +53,7 @@ func NewPeer(peer *network.BzzPeer, baseKey *network.BzzAddr) *Peer {
 	return &Peer{
 		BzzPeer:    peer,
 		logger:     log.NewBaseAddressLogger(baseKey.ShortString(), "peer", peer.BzzAddr.ShortString()),
-		retrievals: make(map[uint]chunk.Address),
+		retrievals: make(map[uint]retrieval),
 	}
 }
 
@@ -50,7 +62,31 @@ func NewPeer(peer *network.BzzPeer, baseKey *network.BzzAddr) *Peer {
 func (p *Peer) addRetrieval(ruid uint, addr storage.Address) {
 	p.mtx.Lock()
 	defer p.mtx.Unlock()
-	p.retrievals[ruid] = addr
+	p.retrievals[ruid] = retrieval{
+		addr:        addr,
+		requestedAt: time.Now(),
+	}
+}
+
+// updateLatency adds the latency of a chunk delivery
+// to the moving average of the peer delivery latency
+func (p *Peer) updateLatency(d time.Duration) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	if p.latency == 0 {
+		p.latency = d
+		return
+	}
+	p.latency += (d - p.latency) / latencyAverageWeight
+}
+
+// getLatency returns the average chunk delivery latency of the peer
+func (p *Peer) getLatency() time.Duration {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	return p.latency
 }
 
 func (p *Peer) expireRetrieval(ruid uint) {
@@ -62,17 +98,18 @@ func (p *Peer) expireRetrieval(ruid uint) {
 
 // chunkReceived is called upon ChunkDelivery message reception
 // it is meant to idenfify unsolicited chunk deliveries
-func (p *Peer) checkRequest(ruid uint, addr storage.Address) error {
+// it returns the time when the retrieve request was sent
+func (p *Peer) checkRequest(ruid uint, addr storage.Address) (requestedAt time.Time, err error) {
 	p.mtx.Lock()
 	defer p.mtx.Unlock()
 	v, ok := p.retrievals[ruid]
 	if !ok {
-		return errors.New("cannot find ruid")
+		return requestedAt, errors.New("cannot find ruid")
 	}
 	delete(p.retrievals, ruid) // since we got the delivery we wanted - it is safe to delete the retrieve request
-	if !bytes.Equal(v, addr) {
-		return errors.New("retrieve request found but address does not match")
+	if !bytes.Equal(v.addr, addr) {
+		return requestedAt, errors.New("retrieve request found but address does not match")
 	}
 
-	return nil
+	return v.requestedAt, nil
 }
@@ -215,6 +215,14 @@ func (r *Retrieval) findPeerLB(ctx context.Context, req *storage.Request) (retPe
 		return nil, errors.New("not forwarding request, origin node is closer to chunk than this node")
 	}
 
+	var selectPeer storage.SelectPeerFunc
+	if r.netStore != nil {
+		selectPeer = r.netStore.SelectPeer
+	}
+
+	// collect the eligible peers in the order of preference
+	var candidates []network.LBPeer
+	var candidatePos []int
 	r.kademliaLB.EachBinDesc(req.Addr, func(bin network.LBBin) bool {
 		for _, lbPeer := range bin.LBPeers {
 			id := lbPeer.Peer.ID()
@@ -260,15 +268,15 @@ func (r *Retrieval) findPeerLB(ctx context.Context, req *storage.Request) (retPe
 				return false
 			}
 
-			retPeer = lbPeer.Peer
-
-			// sp could be nil, if we encountered a peer that is not registered for delivery, i.e. doesn't support the `stream` protocol
-			// if sp is not nil, then we have selected the next peer and we stop iterating
-			// if sp is nil, we continue iterating
-			if retPeer != nil {
-				selectedPeerPo = bin.ProximityOrder
-				lbPeer.AddUseCount()
+			// lbPeer.Peer could be nil, if we encountered a peer that is not registered for delivery,
+			// i.e. doesn't support the `stream` protocol
+			if lbPeer.Peer != nil {
+				candidates = append(candidates, lbPeer)
+				candidatePos = append(candidatePos, bin.ProximityOrder)
+			}
 
+			// without a peer selection strategy the first eligible peer is selected
+			if selectPeer == nil && len(candidates) > 0 {
 				return false
 			}
 		}
@@ -276,6 +284,19 @@ func (r *Retrieval) findPeerLB(ctx context.Context, req *storage.Request) (retPe
 		return true
 	})
 
+	if len(candidates) > 0 {
+		// errors are only relevant if no eligible peer was found
+		err = nil
+
+		selected := 0
+		if selectPeer != nil && len(candidates) > 1 {
+			selected = selectPeer(req, r.peerCandidates(candidates))
+		}
+		retPeer = candidates[selected].Peer
+		selectedPeerPo = candidatePos[selected]
+		candidates[selected].AddUseCount()
+	}
+
 	if osp != nil {
 		osp.LogFields(olog.Int("selectedPeerPo", selectedPeerPo))
 	}
@@ -291,6 +312,19 @@ func (r *Retrieval) findPeerLB(ctx context.Context, req *storage.Request) (retPe
 	return retPeer, nil
 }
 
+// peerCandidates returns the eligible peers with their delivery latencies
+// to be passed to the NetStore peer selection strategy
+func (r *Retrieval) peerCandidates(lbPeers []network.LBPeer) []storage.PeerCandidate {
+	candidates := make([]storage.PeerCandidate, len(lbPeers))
+	for i, lbPeer := range lbPeers {
+		candidates[i].ID = lbPeer.Peer.ID()
+		if p := r.getPeer(lbPeer.Peer.ID()); p != nil {
+			candidates[i].Latency = p.getLatency()
+		}
+	}
+	return candidates
+}
+
 // handleRetrieveRequest handles an incoming retrieve request from a certain Peer
 // if the chunk is found in the localstore it is served immediately, otherwise
 // it results in a new retrieve request to candidate peers in our kademlia
@@ -341,7 +375,7 @@ func (r *Retrieval) handleRetrieveRequest(ctx context.Context, p *Peer, msg *Ret
 // we treat the chunk as a chunk received in syncing
 func (r *Retrieval) handleChunkDelivery(ctx context.Context, p *Peer, msg *ChunkDelivery) error {
 	p.logger.Debug("retrieval.handleChunkDelivery", "ref", msg.Addr)
-	err := p.checkRequest(msg.Ruid, msg.Addr)
+	requestedAt, err := p.checkRequest(msg.Ruid, msg.Addr)
 	if err != nil {
 		unsolicitedChunkDelivery.Inc(1)
 		return protocols.Break(fmt.Errorf("unsolicited chunk delivery from peer, ruid %d, addr %s: %w", msg.Ruid, msg.Addr, err))
@@ -357,6 +391,11 @@ func (r *Retrieval) handleChunkDelivery(ctx context.Context, p *Peer, msg *Chunk
 	peermetric := fmt.Sprintf("network/retrieve/chunk/delivery/%x", p.BzzAddr.Over()[:16])
 	metrics.GetOrRegisterCounter(peermetric, nil).Inc(1)
 
+	// time the deliveries per peer to be able to tell slow peers
+	latencymetric := fmt.Sprintf("network/retrieve/chunk/delivery/latency/%x", p.BzzAddr.Over()[:16])
+	metrics.GetOrRegisterTimer(latencymetric, nil).UpdateSince(requestedAt)
+	p.updateLatency(time.Since(requestedAt))
+
 	peerPO := chunk.Proximity(p.BzzAddr.Over(), msg.Addr)
 	po := chunk.Proximity(r.kad.BaseAddr(), msg.Addr)
 	depth := r.kad.NeighbourhoodDepth()
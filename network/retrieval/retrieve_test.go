@@ -184,7 +184,7 @@ func TestNoSuitablePeer(t *testing.T) {
 		if err == nil {
 			return errors.New("expected netstore retrieval error but got none")
 		}
-		if err != storage.ErrNoSuitablePeer {
+		if !errors.Is(err, storage.ErrNoSuitablePeer) {
 			return fmt.Errorf("expected ErrNoSuitablePeer but got %v instead", err)
 		}
 		return nil
@@ -519,6 +519,63 @@ func TestRequestFromPeers(t *testing.T) {
 	}
 }
 
+// TestRequestFromPeersLowestLatency tests that with the lowest latency peer selection
+// strategy the peer with the lowest delivery latency is always selected
+func TestRequestFromPeersLowestLatency(t *testing.T) {
+	addr := network.RandomBzzAddr()
+	to := network.NewKademlia(addr.OAddr, network.NewKadParams())
+
+	var id enode.ID
+	rand.Read(id[:])
+	localStore, cleanup, err := newTestLocalStore(id, addr, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+	netStore := storage.NewNetStore(localStore, addr)
+	s := New(to, netStore, addr, nil)
+
+	// all peers are closer to the chunk than the node, so that they are all eligible
+	var peers []*Peer
+	for i := 0; i < 3; i++ {
+		var id enode.ID
+		rand.Read(id[:])
+		bzzAddr := network.RandomBzzAddr()
+		bzzAddr.OAddr = append([]byte{}, hash0[:]...)
+		bzzAddr.OAddr[len(bzzAddr.OAddr)-1] ^= byte(i + 1)
+		bp := &network.BzzPeer{
+			BzzAddr: bzzAddr,
+			Peer:    protocols.NewPeer(p2p.NewPeer(id, "dummy", []p2p.Cap{{Name: "bzz-retrieve", Version: 1}}), nil, nil),
+		}
+		to.On(network.NewPeer(bp, to))
+		p := NewPeer(bp, addr)
+		s.addPeer(p)
+		peers = append(peers, p)
+	}
+
+	netStore.SelectPeer = storage.SelectLowestLatencyPeer
+
+	fast := peers[len(peers)-1]
+	for _, p := range peers {
+		if p == fast {
+			p.updateLatency(10 * time.Millisecond)
+		} else {
+			p.updateLatency(time.Second)
+		}
+	}
+
+	for i := 0; i < 10; i++ {
+		req := storage.NewRequest(storage.Address(hash0[:]))
+		p, err := s.findPeerLB(context.Background(), req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.ID() != fast.ID() {
+			t.Fatalf("expected fastest peer %v, got %v", fast.ID(), p.ID())
+		}
+	}
+}
+
 //TestHasPriceImplementation is to check that Retrieval provides priced messages
 func TestHasPriceImplementation(t *testing.T) {
 	price := (&ChunkDelivery{}).Price()
@@ -717,3 +774,29 @@ func newTestNetstore(t *testing.T) (prvkey *ecdsa.PrivateKey, netStore *storage.
 	}
 	return prvkey, netStore, cleanup
 }
+
+// TestCheckRequestTime tests that checking a delivery against its retrieve request
+// returns the time when the request was sent
+func TestCheckRequestTime(t *testing.T) {
+	addr := network.RandomBzzAddr()
+	bp := &network.BzzPeer{
+		Peer:    protocols.NewPeer(p2p.NewPeer(enode.ID{}, "test", nil), nil, spec),
+		BzzAddr: addr,
+	}
+	p := NewPeer(bp, addr)
+
+	before := time.Now()
+	p.addRetrieval(1234, []byte{0, 1, 2, 3})
+
+	requestedAt, err := p.checkRequest(1234, []byte{0, 1, 2, 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if requestedAt.Before(before) || requestedAt.After(time.Now()) {
+		t.Fatalf("got request time %v, want a time after %v", requestedAt, before)
+	}
+
+	if _, err := p.checkRequest(1234, []byte{0, 1, 2, 3}); err == nil {
+		t.Fatal("expected error for an already delivered retrieve request")
+	}
+}
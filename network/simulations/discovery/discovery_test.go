@@ -49,6 +49,7 @@ const discoveryPersistenceDatadir = "discovery_persistence_test_store"
 var discoveryPersistencePath = path.Join(os.TempDir(), discoveryPersistenceDatadir)
 var discoveryEnabled = true
 var persistenceEnabled = false
+var neighbourhoodGossipEnabled = false
 
 var services = adapters.Services{
 	serviceName: newService,
@@ -180,6 +181,25 @@ func testDiscoverySimulation(t *testing.T, nodes, conns int, adapter adapters.No
 	t.Logf("Setup: %s, shutdown: %s", result.StartedAt.Sub(startedAt), finishedAt.Sub(result.FinishedAt))
 }
 
+// TestDiscoveryNeighbourhoodGossipSimulation checks that nodes which request the
+// nearest neighbours of their peers know and connect to all their nearest neighbours
+func TestDiscoveryNeighbourhoodGossipSimulation(t *testing.T) {
+	neighbourhoodGossipEnabled = true
+	defer func() {
+		neighbourhoodGossipEnabled = false
+	}()
+	result, err := discoverySimulation(*nodeCount, *initCount, adapters.NewSimAdapter(services))
+	if err != nil {
+		t.Fatalf("Setting up simulation failed: %v", err)
+	}
+	if result.Error != nil {
+		t.Fatalf("Simulation failed: %s", result.Error)
+	}
+	if len(result.Passes) != *nodeCount {
+		t.Fatalf("expected %d nodes to know their nearest neighbours, got %d", *nodeCount, len(result.Passes))
+	}
+}
+
 func testDiscoveryPersistenceSimulation(t *testing.T, nodes, conns int, adapter adapters.NodeAdapter) map[int][]byte {
 	persistenceEnabled = true
 	discoveryEnabled = true
@@ -505,6 +525,7 @@ func newService(ctx *adapters.ServiceContext) (node.Service, error) {
 	hp := network.NewHiveParams()
 	hp.KeepAliveInterval = time.Duration(200) * time.Millisecond
 	hp.Discovery = discoveryEnabled
+	hp.NeighbourhoodGossip = neighbourhoodGossipEnabled
 
 	log.Info(fmt.Sprintf("discovery for nodeID %s is %t", ctx.Config.ID.String(), hp.Discovery))
 
@@ -0,0 +1,78 @@
+// Copyright 2019 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package stream
+
+import (
+	"github.com/holisticode/swarm/network/stream/intervals"
+	"github.com/holisticode/swarm/state"
+)
+
+// IntervalStore persists the intervals of stream ranges that were synced from peers,
+// so that syncing can resume from them after a restart
+type IntervalStore interface {
+	// Get returns the intervals stored under key, or state.ErrNotFound if there are none
+	Get(key string) (*intervals.Intervals, error)
+	// Put stores the intervals under key
+	Put(key string, i *intervals.Intervals) error
+	// Delete removes the intervals stored under key
+	Delete(key string) error
+	// Iterate calls f for all intervals with keys starting with prefix, until f returns true or an error
+	Iterate(prefix string, f func(key string, i *intervals.Intervals) (stop bool, err error)) error
+}
+
+// stateIntervalStore is the IntervalStore backed by a state.Store
+type stateIntervalStore struct {
+	store state.Store
+}
+
+// NewStateIntervalStore returns an IntervalStore that keeps the intervals in the provided state.Store.
+// Intervals survive restarts if the state.Store is persistent, as the leveldb backed state.DBStore is.
+func NewStateIntervalStore(store state.Store) IntervalStore {
+	return &stateIntervalStore{
+		store: store,
+	}
+}
+
+// Get returns the intervals stored under key
+func (s *stateIntervalStore) Get(key string) (*intervals.Intervals, error) {
+	i := &intervals.Intervals{}
+	if err := s.store.Get(key, i); err != nil {
+		return nil, err
+	}
+	return i, nil
+}
+
+// Put stores the intervals under key
+func (s *stateIntervalStore) Put(key string, i *intervals.Intervals) error {
+	return s.store.Put(key, i)
+}
+
+// Delete removes the intervals stored under key
+func (s *stateIntervalStore) Delete(key string) error {
+	return s.store.Delete(key)
+}
+
+// Iterate calls f for all intervals with keys starting with prefix
+func (s *stateIntervalStore) Iterate(prefix string, f func(key string, i *intervals.Intervals) (stop bool, err error)) error {
+	return s.store.Iterate(prefix, func(key, value []byte) (stop bool, err error) {
+		i := new(intervals.Intervals)
+		if err := i.UnmarshalBinary(value); err != nil {
+			return true, err
+		}
+		return f(string(key), i)
+	})
+}
@@ -0,0 +1,292 @@
+// Copyright 2019 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package stream
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru"
+
+	"github.com/holisticode/swarm/chunk"
+	"github.com/holisticode/swarm/log"
+	"github.com/holisticode/swarm/network"
+	"github.com/holisticode/swarm/storage"
+)
+
+const (
+	manifestStreamName    = "MANIFEST"
+	manifestCacheCapacity = 100    // number of chunk trees kept in the cache
+	manifestCacheAddrs    = 100000 // total number of chunk addresses of the trees kept in the cache
+)
+
+// ManifestStreamProvider is a stream provider serving the chunks of the tree under a root reference,
+// such as the chunks of a file or manifest, as a bounded stream. The stream key is the root reference
+// and the IDs of the chunks in the stream are their positions in the pre-order walk of the tree,
+// starting from 1 for the root chunk. Only trees of unencrypted references are supported.
+// Streams are not started automatically for peers, the downstream peer requests them with RequestStream.
+type ManifestStreamProvider struct {
+	netStore *storage.NetStore
+	logger   log.Logger
+	quit     chan struct{}
+
+	cacheMu         sync.Mutex // serializes additions to the cache with the counting of its addresses
+	cache           *lru.Cache // chunk addresses of the walked trees, keyed by root reference
+	cacheAddrs      int        // total number of chunk addresses in the cache
+	cacheAddrsLimit int        // maximum total number of chunk addresses in the cache
+}
+
+// NewManifestStreamProvider creates a new ManifestStreamProvider serving chunk trees from the NetStore
+func NewManifestStreamProvider(ns *storage.NetStore, baseAddr *network.BzzAddr) *ManifestStreamProvider {
+	m := &ManifestStreamProvider{
+		netStore:        ns,
+		logger:          log.NewBaseAddressLogger(baseAddr.ShortString()),
+		quit:            make(chan struct{}),
+		cacheAddrsLimit: manifestCacheAddrs,
+	}
+	c, err := lru.NewWithEvict(manifestCacheCapacity, func(_, v interface{}) {
+		// called by the cache methods, with cacheMu held
+		m.cacheAddrs -= len(v.([]chunk.Address))
+	})
+	if err != nil {
+		panic(err)
+	}
+	m.cache = c
+	return m
+}
+
+// RequestStream requests the stream of the chunk tree under the root reference from the peer
+// The stream is started when the peer responds with its cursor, as it is not started automatically.
+func (m *ManifestStreamProvider) RequestStream(ctx context.Context, p *Peer, root chunk.Address) error {
+	key, err := m.EncodeKey(root)
+	if err != nil {
+		return err
+	}
+	stream := NewID(m.StreamName(), key)
+	if _, err := p.getOrCreateInterval(p.peerStreamIntervalKey(stream)); err != nil {
+		return err
+	}
+	p.setRequested(stream)
+	return p.Send(ctx, &StreamInfoReq{Streams: []ID{stream}})
+}
+
+// NeedData checks which of the supplied addrs are not in the local storage
+func (m *ManifestStreamProvider) NeedData(ctx context.Context, addrs ...chunk.Address) ([]bool, error) {
+	wants := make([]bool, len(addrs))
+
+	// don't check if we're shutting down
+	select {
+	case <-m.quit:
+		return wants, nil
+	default:
+	}
+
+	has, err := m.netStore.Store.HasMulti(ctx, addrs...)
+	if err != nil {
+		return nil, err
+	}
+	for i, have := range has {
+		wants[i] = !have
+	}
+	return wants, nil
+}
+
+// Get the supplied addresses for delivery
+func (m *ManifestStreamProvider) Get(ctx context.Context, addrs ...chunk.Address) ([]chunk.Chunk, error) {
+	return m.netStore.Store.GetMulti(ctx, chunk.ModeGetRequest, addrs...)
+}
+
+// Put the given chunks to the local storage
+func (m *ManifestStreamProvider) Put(ctx context.Context, ch ...chunk.Chunk) (exists []bool, err error) {
+	return m.netStore.Put(ctx, chunk.ModePutRequest, ch...)
+}
+
+// Set is a no-op, as the chunks of a tree are retrieved, not synced
+func (m *ManifestStreamProvider) Set(ctx context.Context, addrs ...chunk.Address) error {
+	return nil
+}
+
+// Subscribe returns the descriptors of the chunks of the tree under the root reference key
+// with IDs in the [from, to] interval. The returned channel is closed after the last one.
+func (m *ManifestStreamProvider) Subscribe(ctx context.Context, key interface{}, from, to uint64) (<-chan chunk.Descriptor, func()) {
+	c := make(chan chunk.Descriptor)
+	stop := make(chan struct{})
+	var stopOnce sync.Once
+
+	root, ok := key.(chunk.Address)
+	if !ok {
+		m.logger.Error("manifest stream subscribe with invalid key", "key", key)
+		close(c)
+		return c, func() {}
+	}
+
+	go func() {
+		defer close(c)
+		addrs, err := m.walk(ctx, root)
+		if err != nil {
+			m.logger.Debug("manifest stream subscribe", "root", root, "err", err)
+			return
+		}
+		if from == 0 {
+			from = 1
+		}
+		if to == 0 || to > uint64(len(addrs)) {
+			to = uint64(len(addrs))
+		}
+		for id := from; id <= to; id++ {
+			select {
+			case c <- chunk.Descriptor{Address: addrs[id-1], BinID: id}:
+			case <-stop:
+				return
+			case <-m.quit:
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return c, func() {
+		stopOnce.Do(func() {
+			close(stop)
+		})
+	}
+}
+
+// Cursor returns the number of chunks in the tree under the root reference key,
+// or 0 if the tree is not complete in the local storage
+func (m *ManifestStreamProvider) Cursor(ctx context.Context, k string) (uint64, error) {
+	key, err := m.ParseKey(k)
+	if err != nil {
+		return 0, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	addrs, err := m.walk(ctx, key.(chunk.Address))
+	if err != nil {
+		m.logger.Debug("manifest stream cursor", "root", k, "err", err)
+		return 0, nil
+	}
+	return uint64(len(addrs)), nil
+}
+
+// walk returns the addresses of the chunks of the tree under the root reference
+// in pre-order, returning an error if any of them is not in the local storage
+func (m *ManifestStreamProvider) walk(ctx context.Context, root chunk.Address) ([]chunk.Address, error) {
+	if v, ok := m.cache.Get(root.Hex()); ok {
+		return v.([]chunk.Address), nil
+	}
+
+	var addrs []chunk.Address
+	var walk func(addr chunk.Address) error
+	walk = func(addr chunk.Address) error {
+		ch, err := m.netStore.Store.Get(ctx, chunk.ModeGetLookup, addr)
+		if err != nil {
+			return fmt.Errorf("get chunk %s: %w", addr, err)
+		}
+		addrs = append(addrs, addr)
+
+		data := ch.Data()
+		if len(data) < 8 {
+			return fmt.Errorf("invalid chunk %s data length %d", addr, len(data))
+		}
+		// data chunks have a span of at most one chunk, intermediate chunks hold the references to their children
+		if binary.LittleEndian.Uint64(data[:8]) <= chunk.DefaultSize {
+			return nil
+		}
+		refs := data[8:]
+		if len(refs)%chunk.AddressLength != 0 {
+			return fmt.Errorf("invalid intermediate chunk %s data length %d", addr, len(data))
+		}
+		for i := 0; i < len(refs); i += chunk.AddressLength {
+			if err := walk(chunk.Address(refs[i : i+chunk.AddressLength])); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := walk(root); err != nil {
+		return nil, err
+	}
+
+	m.addToCache(root, addrs)
+	return addrs, nil
+}
+
+// addToCache adds the chunk addresses of the tree under the root reference to the cache
+// and evicts the least recently used trees until the cache holds at most cacheAddrsLimit addresses
+func (m *ManifestStreamProvider) addToCache(root chunk.Address, addrs []chunk.Address) {
+	if len(addrs) > m.cacheAddrsLimit {
+		return
+	}
+	m.cacheMu.Lock()
+	defer m.cacheMu.Unlock()
+
+	if ok, _ := m.cache.ContainsOrAdd(root.Hex(), addrs); ok {
+		return
+	}
+	m.cacheAddrs += len(addrs)
+	for m.cacheAddrs > m.cacheAddrsLimit {
+		m.cache.RemoveOldest()
+	}
+}
+
+// InitPeer is a no-op, as manifest streams are requested explicitly with RequestStream
+func (m *ManifestStreamProvider) InitPeer(p *Peer) {}
+
+// WantStream returns true for manifest streams, as they are requested only with RequestStream
+func (m *ManifestStreamProvider) WantStream(p *Peer, streamID ID) bool {
+	_, err := m.ParseKey(streamID.Key)
+	return streamID.Name == m.StreamName() && err == nil
+}
+
+// ParseKey parses the hex encoded root reference of the stream key
+func (m *ManifestStreamProvider) ParseKey(streamKey string) (interface{}, error) {
+	b, err := hex.DecodeString(streamKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) != chunk.AddressLength {
+		return nil, fmt.Errorf("invalid stream key %q length %d", streamKey, len(b))
+	}
+	return chunk.Address(b), nil
+}
+
+// EncodeKey hex encodes the root reference as the stream key
+func (m *ManifestStreamProvider) EncodeKey(i interface{}) (string, error) {
+	v, ok := i.(chunk.Address)
+	if !ok {
+		return "", errors.New("error encoding key")
+	}
+	if len(v) != chunk.AddressLength {
+		return "", fmt.Errorf("invalid root reference length %d", len(v))
+	}
+	return hex.EncodeToString(v), nil
+}
+
+func (m *ManifestStreamProvider) StreamName() string { return manifestStreamName }
+
+func (m *ManifestStreamProvider) Boundedness() bool { return true }
+
+// Autostart returns false, as manifest streams are started only when requested with RequestStream
+func (m *ManifestStreamProvider) Autostart() bool { return false }
+
+func (m *ManifestStreamProvider) Close() { close(m.quit) }
@@ -0,0 +1,271 @@
+// Copyright 2019 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package stream
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/node"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/holisticode/swarm/chunk"
+	"github.com/holisticode/swarm/network"
+	"github.com/holisticode/swarm/network/simulation"
+	"github.com/holisticode/swarm/state"
+	"github.com/holisticode/swarm/storage"
+	"github.com/holisticode/swarm/testutil"
+)
+
+// TestManifestStreamProvider checks the keys, the cursor and the subscriptions
+// of the stream of the chunks of a file tree
+func TestManifestStreamProvider(t *testing.T) {
+	addr := network.RandomBzzAddr()
+	localStore, cleanup, err := newTestLocalStore(enode.ID{}, addr, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+	netStore := storage.NewNetStore(localStore, addr)
+	lnetStore := storage.NewLNetStore(netStore)
+	fileStore := storage.NewFileStore(lnetStore, lnetStore, storage.NewFileStoreParams(), chunk.NewTags())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// 131 data chunks, 2 intermediate chunks and the root chunk
+	size := 130*chunk.DefaultSize + 100
+	root, wait, err := fileStore.Store(ctx, bytes.NewReader(testutil.RandomBytes(1, size)), int64(size), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+	wantCount := uint64(134)
+
+	m := NewManifestStreamProvider(netStore, addr)
+	defer m.Close()
+
+	key, err := m.EncodeKey(chunk.Address(root))
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := m.ParseKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(parsed.(chunk.Address), root) {
+		t.Fatalf("got parsed key %v, want %v", parsed, root)
+	}
+	if _, err := m.ParseKey("invalid"); err == nil {
+		t.Fatal("expected error parsing invalid key")
+	}
+	if !m.Boundedness() {
+		t.Fatal("expected bounded stream")
+	}
+	if m.Autostart() {
+		t.Fatal("expected stream not started automatically")
+	}
+
+	cursor, err := m.Cursor(context.Background(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cursor != wantCount {
+		t.Fatalf("got cursor %v, want %v", cursor, wantCount)
+	}
+
+	// unknown roots have no chunks to offer
+	unknown, _ := m.EncodeKey(chunk.Address(storage.GenerateRandomChunk(10).Address()))
+	if cursor, err := m.Cursor(context.Background(), unknown); err != nil || cursor != 0 {
+		t.Fatalf("got cursor %v and error %v for unknown root, want 0 and no error", cursor, err)
+	}
+
+	collect := func(from, to uint64) (ds []chunk.Descriptor) {
+		c, stop := m.Subscribe(ctx, parsed, from, to)
+		defer stop()
+		for d := range c {
+			ds = append(ds, d)
+		}
+		return ds
+	}
+
+	all := collect(1, 0)
+	if uint64(len(all)) != wantCount {
+		t.Fatalf("got %v descriptors, want %v", len(all), wantCount)
+	}
+	if !bytes.Equal(all[0].Address, root) {
+		t.Fatalf("got first address %v, want root %v", all[0].Address, root)
+	}
+	seen := make(map[string]bool)
+	addrs := make([]chunk.Address, len(all))
+	for i, d := range all {
+		if d.BinID != uint64(i+1) {
+			t.Fatalf("got descriptor id %v at position %v", d.BinID, i)
+		}
+		if seen[d.Address.Hex()] {
+			t.Fatalf("duplicate address %v", d.Address)
+		}
+		seen[d.Address.Hex()] = true
+		addrs[i] = d.Address
+	}
+	has, err := localStore.HasMulti(ctx, addrs...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, h := range has {
+		if !h {
+			t.Fatalf("address %v of the tree not in the store", addrs[i])
+		}
+	}
+
+	part := collect(5, 10)
+	if len(part) != 6 || part[0].BinID != 5 || part[5].BinID != 10 {
+		t.Fatalf("got descriptors %v for range [5, 10]", part)
+	}
+	for _, d := range part {
+		if !bytes.Equal(d.Address, all[d.BinID-1].Address) {
+			t.Fatalf("got address %v for id %v, want %v", d.Address, d.BinID, all[d.BinID-1].Address)
+		}
+	}
+}
+
+// TestManifestStreamProviderCacheLimit checks that the cache of the walked trees
+// holds at most cacheAddrsLimit chunk addresses, evicting the least recently used trees
+func TestManifestStreamProviderCacheLimit(t *testing.T) {
+	m := NewManifestStreamProvider(nil, network.RandomBzzAddr())
+	defer m.Close()
+	m.cacheAddrsLimit = 10
+
+	roots := make([]chunk.Address, 3)
+	for i := range roots {
+		roots[i] = storage.GenerateRandomChunk(10).Address()
+	}
+	m.addToCache(roots[0], make([]chunk.Address, 4))
+	m.addToCache(roots[1], make([]chunk.Address, 4))
+	// already cached trees are not counted again
+	m.addToCache(roots[1], make([]chunk.Address, 4))
+	if m.cacheAddrs != 8 {
+		t.Fatalf("got %v cached addresses, want 8", m.cacheAddrs)
+	}
+	m.addToCache(roots[2], make([]chunk.Address, 4))
+	if m.cacheAddrs != 8 || m.cache.Contains(roots[0].Hex()) {
+		t.Fatalf("got %v cached addresses and first tree cached %v, want 8 and false", m.cacheAddrs, m.cache.Contains(roots[0].Hex()))
+	}
+	// trees larger than the limit are not cached
+	m.addToCache(storage.GenerateRandomChunk(10).Address(), make([]chunk.Address, 11))
+	if m.cacheAddrs != 8 || m.cache.Len() != 2 {
+		t.Fatalf("got %v cached addresses in %v trees, want 8 in 2", m.cacheAddrs, m.cache.Len())
+	}
+}
+
+// TestManifestStreamTwoNodes checks that the chunks of a file are transferred
+// to a peer that requests the manifest stream of its root
+func TestManifestStreamTwoNodes(t *testing.T) {
+	var providers sync.Map // manifest stream providers by overlay address
+	sim := simulation.NewBzzInProc(map[string]simulation.ServiceFunc{
+		serviceNameStream: newSyncSimServiceFunc(&SyncSimServiceOptions{
+			StreamConstructorFunc: func(s state.Store, b *network.BzzAddr, p ...StreamProvider) node.Service {
+				m := NewManifestStreamProvider(p[0].(*syncProvider).netStore, b)
+				providers.Store(string(b.Over()), m)
+				return New(s, b, append(p, m)...)
+			},
+		}),
+	}, false)
+	defer sim.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	uploadNode, err := sim.AddNode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fileStore := sim.MustNodeItem(uploadNode, bucketKeyFileStore).(*storage.FileStore)
+	size := 10*chunk.DefaultSize + 100
+	root, wait, err := fileStore.Store(ctx, bytes.NewReader(testutil.RandomBytes(1, size)), int64(size), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+	// 11 data chunks and the root chunk
+	wantCount := uint64(12)
+
+	fetchNode, err := sim.AddNode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sim.Net.Connect(fetchNode, uploadNode); err != nil {
+		t.Fatal(err)
+	}
+
+	registry := nodeRegistry(sim, fetchNode)
+	var p *Peer
+	for p == nil {
+		select {
+		case <-ctx.Done():
+			t.Fatal(ctx.Err())
+		case <-time.After(10 * time.Millisecond):
+		}
+		p = registry.getPeer(uploadNode)
+	}
+
+	m, _ := providers.Load(string(registry.address.Over()))
+	if err := m.(*ManifestStreamProvider).RequestStream(ctx, p, chunk.Address(root)); err != nil {
+		t.Fatal(err)
+	}
+
+	uploadRegistry := nodeRegistry(sim, uploadNode)
+	u, _ := providers.Load(string(uploadRegistry.address.Over()))
+	addrs, err := u.(*ManifestStreamProvider).walk(ctx, chunk.Address(root))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uint64(len(addrs)) != wantCount {
+		t.Fatalf("got %v chunks in the tree, want %v", len(addrs), wantCount)
+	}
+
+	fetchStore := sim.MustNodeItem(fetchNode, bucketKeyLocalStore).(chunk.Store)
+	for {
+		has, err := fetchStore.HasMulti(ctx, addrs...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var count int
+		for _, h := range has {
+			if h {
+				count++
+			}
+		}
+		if count == len(addrs) {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			t.Fatalf("got %v chunks of the tree, want %v: %v", count, len(addrs), ctx.Err())
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+	if cursor, err := m.(*ManifestStreamProvider).Cursor(context.Background(), root.Hex()); err != nil || cursor != wantCount {
+		t.Fatalf("got cursor %v and error %v on the fetching node, want %v", cursor, err, wantCount)
+	}
+}
@@ -22,9 +22,13 @@ import (
 	"sync"
 	"time"
 
+	"golang.org/x/time/rate"
+
+	"github.com/ethereum/go-ethereum/metrics"
 	"github.com/holisticode/swarm/chunk"
 	"github.com/holisticode/swarm/log"
 	"github.com/holisticode/swarm/network"
+	bv "github.com/holisticode/swarm/network/bitvector"
 	"github.com/holisticode/swarm/network/stream/intervals"
 	"github.com/holisticode/swarm/state"
 )
@@ -34,7 +38,7 @@ type Peer struct {
 	*network.BzzPeer
 	mtx            sync.RWMutex
 	providers      map[string]StreamProvider
-	intervalsStore state.Store //move to stream
+	intervalsStore IntervalStore
 
 	logger log.Logger
 
@@ -45,11 +49,23 @@ type Peer struct {
 	clientOpenGetRange map[string]uint   // maintain open GetRange requests to eliminate overlapping requests on the client side
 	serverOpenGetRange map[string]uint   // maintain open GetRange requests to eliminate overlapping requests on the server side
 
+	deliveryAcks bool   // chunk deliveries are acknowledged, set if both peers support it
+	closedWants  []uint // ruids of the recently closed wants, for which unacknowledged chunks may be delivered again
+	chunkProofs  bool   // the peer serves chunk proofs
+	streamStates bool   // stream states are reported to the peer, set if both peers support it
+
+	proofLimiter *rate.Limiter // limits the rate of chunk proofs served to the peer
+
+	requested map[string]struct{} // streams requested explicitly, started when their cursors arrive even if they do not autostart, protected by streamCursorsMu
+
+	resyncsMu sync.Mutex
+	resyncs   map[string]*resync // key: Stream ID string representation, value: history stream requested again from the start
+
 	quit chan struct{} // closed when peer is going offline
 }
 
 // newPeer is the constructor for Peer
-func newPeer(peer *network.BzzPeer, baseAddress *network.BzzAddr, i state.Store, providers map[string]StreamProvider) *Peer {
+func newPeer(peer *network.BzzPeer, baseAddress *network.BzzAddr, i IntervalStore, providers map[string]StreamProvider) *Peer {
 	p := &Peer{
 		BzzPeer:            peer,
 		providers:          providers,
@@ -59,6 +75,9 @@ func newPeer(peer *network.BzzPeer, baseAddress *network.BzzAddr, i state.Store,
 		openOffers:         make(map[uint]offer),
 		clientOpenGetRange: make(map[string]uint),
 		serverOpenGetRange: make(map[string]uint),
+		resyncs:            make(map[string]*resync),
+		requested:          make(map[string]struct{}),
+		proofLimiter:       rate.NewLimiter(chunkProofRate, chunkProofBurst),
 		quit:               make(chan struct{}),
 		logger:             log.NewBaseAddressLogger(baseAddress.ShortString(), "peer", peer.BzzAddr.ShortString()),
 	}
@@ -97,16 +116,78 @@ func (p *Peer) setCursor(stream ID, cursor uint64) {
 	p.streamCursors[stream.String()] = cursor
 }
 
+// setRequested marks the stream as requested explicitly, so that it is started
+// when its cursor arrives from the peer even if its provider does not autostart
+func (p *Peer) setRequested(stream ID) {
+	p.streamCursorsMu.Lock()
+	defer p.streamCursorsMu.Unlock()
+
+	p.requested[stream.String()] = struct{}{}
+}
+
+// takeRequested returns whether the stream was requested explicitly and unmarks it
+func (p *Peer) takeRequested(stream ID) bool {
+	p.streamCursorsMu.Lock()
+	defer p.streamCursorsMu.Unlock()
+
+	_, ok := p.requested[stream.String()]
+	delete(p.requested, stream.String())
+	return ok
+}
+
 func (p *Peer) deleteCursor(stream ID) {
 	p.streamCursorsMu.Lock()
 	defer p.streamCursorsMu.Unlock()
 
 	delete(p.streamCursors, stream.String())
+	metrics.Unregister(p.cursorLagMetricName(stream.String()))
+}
+
+// cursorLag returns the number of bin ids up to the peer's cursor for the stream
+// that are not yet in the first contiguous interval synced from the peer.
+// The second return value is false if there is no cursor for the stream.
+func (p *Peer) cursorLag(stream ID) (lag uint64, ok bool, err error) {
+	cursor, ok := p.getCursor(stream)
+	if !ok {
+		return 0, false, nil
+	}
+	from, _, _, err := p.nextInterval(stream, 0)
+	if err != nil {
+		return 0, true, err
+	}
+	if from > cursor {
+		return 0, true, nil
+	}
+	return cursor - from + 1, true, nil
+}
+
+// updateCursorLag updates the per-stream cursor lag metric of the peer
+func (p *Peer) updateCursorLag(stream ID) {
+	lag, ok, err := p.cursorLag(stream)
+	if err != nil {
+		p.logger.Debug("getting cursor lag", "stream", stream, "err", err)
+		return
+	}
+	if !ok {
+		return
+	}
+	metrics.GetOrRegisterGauge(p.cursorLagMetricName(stream.String()), nil).Update(int64(lag))
+}
+
+// unregisterCursorLags removes the cursor lag metrics of all streams of the peer
+func (p *Peer) unregisterCursorLags() {
+	for stream := range p.getCursorsCopy() {
+		metrics.Unregister(p.cursorLagMetricName(stream))
+	}
+}
+
+func (p *Peer) cursorLagMetricName(stream string) string {
+	return fmt.Sprintf("network/stream/cursor_lag/%s/%s", p.BzzAddr.ShortString(), stream)
 }
 
 // InitProviders initializes a provider for a certain peer
 func (p *Peer) InitProviders() {
-	p.logger.Debug("peer.InitProviders")
+	p.logger.Debug("peer.InitProviders", "providers", len(p.providers))
 
 	for _, sp := range p.providers {
 		go sp.InitPeer(p)
@@ -120,6 +201,62 @@ type offer struct {
 	stream    ID        // the stream id
 	hashes    []byte    // all hashes offered to the client
 	requested time.Time // requested at time
+
+	acks *deliveryAcks // chunk deliveries acknowledged by the client, nil if deliveries are not acknowledged
+}
+
+// deliveryAcks tracks the chunks of an offer that the client acknowledged as stored
+type deliveryAcks struct {
+	mtx   sync.Mutex
+	l     int           // number of offered hashes
+	acked *bv.BitVector // acknowledged chunks by their offered index
+	c     chan struct{} // signals that an acknowledgement was received
+}
+
+func newDeliveryAcks(l int) (*deliveryAcks, error) {
+	acked, err := bv.New(l)
+	if err != nil {
+		return nil, err
+	}
+	return &deliveryAcks{
+		l:     l,
+		acked: acked,
+		c:     make(chan struct{}, 1),
+	}, nil
+}
+
+// add marks the chunks set in the acknowledgement bit vector as acknowledged
+func (a *deliveryAcks) add(bitVector []byte) error {
+	ack, err := bv.NewFromBytes(bitVector, a.l)
+	if err != nil {
+		return err
+	}
+	a.mtx.Lock()
+	for i := 0; i < a.l; i++ {
+		if ack.Get(i) {
+			a.acked.Set(i)
+		}
+	}
+	a.mtx.Unlock()
+
+	select {
+	case a.c <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// unacked returns the chunks that are not acknowledged, indices are the offered indices of the chunks
+func (a *deliveryAcks) unacked(chunks []chunk.Chunk, indices []int) (u []chunk.Chunk) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	for i, c := range chunks {
+		if !a.acked.Get(indices[i]) {
+			u = append(u, c)
+		}
+	}
+	return u
 }
 
 // want represents an open want for a hash range from a client to a server
@@ -135,6 +272,10 @@ type want struct {
 	requested time.Time           // requested at time
 	chunks    chan chunk.Address  // chunk arrived notification channel
 	closeC    chan error          // signal polling goroutine to terminate due to empty batch or timeout
+	retries   int                 // number of times the range was requested again after a timeout
+
+	stored  *bv.BitVector  // offered chunks stored so far, nil if deliveries are not acknowledged
+	indices map[string]int // key: chunk address, value: offered index, used to acknowledge deliveries
 }
 
 // getOffer gets on open offer for the requested ruid
@@ -162,13 +303,78 @@ func (p *Peer) getWant(ruid uint) (w *want, err error) {
 	return w, nil
 }
 
+// setStored marks the delivered chunks of the want as stored. It returns the chunks that were not
+// stored before with their seen flags, so that chunks delivered again are not counted twice, and the
+// acknowledgement bit vector of all offered chunks stored so far. Chunks that were not offered are
+// returned as well, for the batch sealing to drop the peer.
+func (p *Peer) setStored(w *want, chunks []chunk.Chunk, seen []bool) (fresh []chunk.Chunk, freshSeen []bool, ack []byte) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	for j, c := range chunks {
+		i, ok := w.indices[c.Address().Hex()]
+		if ok {
+			if w.stored.Get(i) {
+				continue
+			}
+			w.stored.Set(i)
+		}
+		fresh = append(fresh, c)
+		if j < len(seen) {
+			freshSeen = append(freshSeen, seen[j])
+		}
+	}
+	return fresh, freshSeen, append([]byte{}, w.stored.Bytes()...)
+}
+
+// closeWant removes the want from the open wants. With delivery acknowledgements, its ruid is kept
+// among the last maxClosedWants closed ones, as the server may deliver unacknowledged chunks again.
+func (p *Peer) closeWant(ruid uint) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	p.closeWantLocked(ruid)
+}
+
+// closeWantLocked is closeWant for callers holding the peer lock
+func (p *Peer) closeWantLocked(ruid uint) {
+	delete(p.openWants, ruid)
+	if !p.deliveryAcks {
+		return
+	}
+	if len(p.closedWants) == maxClosedWants {
+		p.closedWants = p.closedWants[1:]
+	}
+	p.closedWants = append(p.closedWants, ruid)
+}
+
+// isClosedWant returns true if the want with the ruid was recently closed
+func (p *Peer) isClosedWant(ruid uint) bool {
+	p.mtx.RLock()
+	defer p.mtx.RUnlock()
+
+	for _, r := range p.closedWants {
+		if r == ruid {
+			return true
+		}
+	}
+	return false
+}
+
+// deleteOffer removes the offer from the open offers
+func (p *Peer) deleteOffer(ruid uint) {
+	p.mtx.Lock()
+	delete(p.openOffers, ruid)
+	p.mtx.Unlock()
+}
+
 func (p *Peer) addInterval(stream ID, start, end uint64) (err error) {
 	p.mtx.Lock()
 	defer p.mtx.Unlock()
 
 	peerStreamKey := p.peerStreamIntervalKey(stream)
-	i := &intervals.Intervals{}
-	if err = p.intervalsStore.Get(peerStreamKey, i); err != nil {
+	i, err := p.intervalsStore.Get(peerStreamKey)
+	if err != nil {
 		return err
 	}
 	i.Add(start, end)
@@ -179,8 +385,7 @@ func (p *Peer) nextInterval(stream ID, ceil uint64) (start, end uint64, empty bo
 	p.mtx.RLock()
 	defer p.mtx.RUnlock()
 
-	i := &intervals.Intervals{}
-	err = p.intervalsStore.Get(p.peerStreamIntervalKey(stream), i)
+	i, err := p.intervalsStore.Get(p.peerStreamIntervalKey(stream))
 	if err != nil {
 		return 0, 0, false, err
 	}
@@ -194,8 +399,9 @@ func (p *Peer) sealWant(w *want) error {
 	if err != nil {
 		return err
 	}
+	p.updateCursorLag(w.stream)
 	p.mtx.Lock()
-	delete(p.openWants, w.ruid)
+	p.closeWantLocked(w.ruid)
 	s := p.getRangeKey(w.stream, w.head)
 	delete(p.clientOpenGetRange, s)
 	p.mtx.Unlock()
@@ -207,8 +413,7 @@ func (p *Peer) getOrCreateInterval(key string) (*intervals.Intervals, error) {
 	defer p.mtx.Unlock()
 
 	// check that an interval entry exists
-	i := &intervals.Intervals{}
-	err := p.intervalsStore.Get(key, i)
+	i, err := p.intervalsStore.Get(key)
 	switch err {
 	case nil:
 	case state.ErrNotFound:
@@ -224,6 +429,29 @@ func (p *Peer) getOrCreateInterval(key string) (*intervals.Intervals, error) {
 	return i, nil
 }
 
+// reconcileInterval discards the persisted intervals for the stream if they extend
+// beyond the cursor reported by the peer, which means that the peer's stream was reset
+// (e.g. its localstore was wiped) and the persisted intervals no longer apply
+func (p *Peer) reconcileInterval(stream ID, cursor uint64) error {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	key := p.peerStreamIntervalKey(stream)
+	i, err := p.intervalsStore.Get(key)
+	switch err {
+	case nil:
+	case state.ErrNotFound:
+		return nil
+	default:
+		return err
+	}
+	if last := i.Last(); last > cursor {
+		p.logger.Debug("persisted stream interval beyond peer cursor, resetting", "stream", stream, "last", last, "cursor", cursor)
+		return p.intervalsStore.Put(key, intervals.NewIntervals(1))
+	}
+	return nil
+}
+
 func (p *Peer) peerStreamIntervalKey(stream ID) string {
 	k := fmt.Sprintf("%s|%s", hex.EncodeToString(p.BzzAddr.OAddr), stream.String())
 	return k
@@ -0,0 +1,147 @@
+// Copyright 2019 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package stream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/holisticode/swarm/chunk"
+	"github.com/holisticode/swarm/network/stream/intervals"
+)
+
+// ErrNoSyncProvider is returned by ResyncBin if the registry has no sync stream provider
+var ErrNoSyncProvider = errors.New("no sync stream provider")
+
+// resync tracks a history stream that is requested again from the start of the stream
+type resync struct {
+	recovered uint64        // number of chunks stored that were missing before
+	done      chan struct{} // closed when the history stream is synced up to the cursor
+	once      sync.Once
+}
+
+// ResyncBin requests the sync stream of the proximity order bin again from the start of the
+// stream from all peers the stream is synced from, in order to fetch the chunks of the bin
+// that are missing from the local store. Chunks that are already stored are not fetched again.
+// It blocks until the streams are synced up to their cursors and returns the number of
+// recovered chunks.
+func (r *Registry) ResyncBin(ctx context.Context, bin uint8) (recovered int, err error) {
+	if bin > chunk.MaxPO {
+		return 0, fmt.Errorf("bin %d over max po %d", bin, chunk.MaxPO)
+	}
+	provider := r.getProvider(NewID(syncStreamName, ""))
+	if provider == nil {
+		return 0, ErrNoSyncProvider
+	}
+	key, err := provider.EncodeKey(bin)
+	if err != nil {
+		return 0, err
+	}
+	return r.resyncStream(ctx, provider, NewID(syncStreamName, key))
+}
+
+// resyncStream discards the persisted intervals of the stream for all peers with a cursor
+// for it and requests the stream again up to the cursor
+func (r *Registry) resyncStream(ctx context.Context, provider StreamProvider, stream ID) (recovered int, err error) {
+	r.mtx.RLock()
+	peers := make([]*Peer, 0, len(r.peers))
+	for _, p := range r.peers {
+		peers = append(peers, p)
+	}
+	r.mtx.RUnlock()
+
+	resyncs := make(map[*Peer]*resync)
+	for _, p := range peers {
+		cursor, ok := p.getCursor(stream)
+		if !ok {
+			continue
+		}
+		p.logger.Debug("resyncing stream", "stream", stream, "cursor", cursor)
+		rs := p.startResync(stream)
+		resyncs[p] = rs
+		if err := p.resetInterval(stream); err != nil {
+			return 0, fmt.Errorf("reset stream interval %s: %w", stream, err)
+		}
+		if err := r.clientRequestStreamRange(ctx, p, provider, stream, cursor); err != nil {
+			return 0, fmt.Errorf("request stream range %s: %w", stream, err)
+		}
+	}
+
+	for p, rs := range resyncs {
+		select {
+		case <-rs.done:
+		case <-p.quit:
+		case <-r.quit:
+		case <-ctx.Done():
+			return recovered, ctx.Err()
+		}
+		recovered += int(atomic.LoadUint64(&rs.recovered))
+	}
+	return recovered, nil
+}
+
+// startResync returns the resync of the stream, starting it if it is not already in progress
+func (p *Peer) startResync(stream ID) *resync {
+	p.resyncsMu.Lock()
+	defer p.resyncsMu.Unlock()
+
+	rs, ok := p.resyncs[stream.String()]
+	if !ok {
+		rs = &resync{done: make(chan struct{})}
+		p.resyncs[stream.String()] = rs
+	}
+	return rs
+}
+
+// finishResync ends the resync of the stream, if there is one in progress
+func (p *Peer) finishResync(stream ID) {
+	p.resyncsMu.Lock()
+	defer p.resyncsMu.Unlock()
+
+	if rs, ok := p.resyncs[stream.String()]; ok {
+		rs.once.Do(func() { close(rs.done) })
+		delete(p.resyncs, stream.String())
+	}
+}
+
+// addResynced counts the chunks delivered on the stream that were not stored before,
+// if the stream is being resynced
+func (p *Peer) addResynced(stream ID, seen []bool) {
+	p.resyncsMu.Lock()
+	rs, ok := p.resyncs[stream.String()]
+	p.resyncsMu.Unlock()
+	if !ok {
+		return
+	}
+	for _, s := range seen {
+		if !s {
+			atomic.AddUint64(&rs.recovered, 1)
+		}
+	}
+}
+
+// resetInterval discards the persisted intervals for the stream,
+// so that the stream is requested again from the start
+func (p *Peer) resetInterval(stream ID) error {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	return p.intervalsStore.Put(p.peerStreamIntervalKey(stream), intervals.NewIntervals(1))
+}
@@ -27,17 +27,20 @@ import (
 	"sync/atomic"
 	"time"
 
+	"golang.org/x/crypto/sha3"
 	"golang.org/x/sync/errgroup"
 
-	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/metrics"
 	"github.com/ethereum/go-ethereum/node"
 	"github.com/ethereum/go-ethereum/p2p"
 	"github.com/ethereum/go-ethereum/p2p/enode"
 	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/holisticode/swarm/bmt"
 	"github.com/holisticode/swarm/chunk"
+	"github.com/holisticode/swarm/log"
 	"github.com/holisticode/swarm/network"
 	bv "github.com/holisticode/swarm/network/bitvector"
+	"github.com/holisticode/swarm/network/capability"
 	"github.com/holisticode/swarm/network/stream/intervals"
 	"github.com/holisticode/swarm/network/timeouts"
 	"github.com/holisticode/swarm/p2p/protocols"
@@ -49,6 +52,30 @@ const (
 	HashSize     = 32
 	BatchSize    = 64
 	MinFrameSize = 16
+
+	// buffer size of the channels returned by SubscribeStreamState
+	streamStateSubBufferSize = 16
+
+	// allowance for the encoding of the message fields and the propagated context
+	// in the payload size of messages bounded by the message limits
+	msgSizeOverhead = 1024
+	// allowance for the encoding of a delivered chunk besides its address and data
+	deliveredChunkOverhead = 16
+
+	// maximal number of times unacknowledged chunks of a batch are delivered again
+	maxDeliveryResends = 3
+	// maximal number of recently closed wants for which chunks delivered again are ignored
+	maxClosedWants = 64
+
+	// number of chunk proofs served to a peer per second, and in a burst
+	chunkProofRate  = 50
+	chunkProofBurst = 100
+
+	// CapabilityID is the id of the stream capability advertised in the bzz handshake
+	CapabilityID            = capability.CapabilityID(2)
+	capabilitiesDeliveryAck = 0 // node acknowledges chunk deliveries and resends unacknowledged chunks
+	capabilitiesChunkProof  = 1 // node serves BMT inclusion proofs of its chunks
+	capabilitiesStreamState = 2 // node handles StreamState messages
 )
 
 var (
@@ -59,12 +86,16 @@ var (
 	processReceivedChunksMsgCount = metrics.GetOrRegisterCounter("network/stream/received_chunks_msg", nil)
 	processReceivedChunksCount    = metrics.GetOrRegisterCounter("network/stream/received_chunks_handled", nil)
 	streamSeenChunkDelivery       = metrics.GetOrRegisterCounter("network/stream/seen_chunk_delivery", nil)
+	streamOfferedNotWanted        = metrics.GetOrRegisterCounter("network/stream/offered_not_wanted", nil)
+	receivedChunksMeter           = metrics.GetOrRegisterMeter("network/stream/received_chunks_rate", nil)
 	streamEmptyWantedHashes       = metrics.GetOrRegisterCounter("network/stream/empty_wanted_hashes", nil)
 	streamWantedHashes            = metrics.GetOrRegisterCounter("network/stream/wanted_hashes", nil)
 
 	streamBatchFail               = metrics.GetOrRegisterCounter("network/stream/batch_fail", nil)
 	streamChunkDeliveryFail       = metrics.GetOrRegisterCounter("network/stream/delivery_fail", nil)
 	streamRequestNextIntervalFail = metrics.GetOrRegisterCounter("network/stream/next_interval_fail", nil)
+	streamDeliveryResend          = metrics.GetOrRegisterCounter("network/stream/delivery_resend", nil)
+	streamDeliveryIgnored         = metrics.GetOrRegisterCounter("network/stream/delivery_ignored", nil)
 
 	headBatchSizeGauge = metrics.GetOrRegisterGauge("network/stream/batch_size_head", nil)
 	batchSizeGauge     = metrics.GetOrRegisterGauge("network/stream/batch_size", nil)
@@ -90,19 +121,86 @@ var (
 			OfferedHashes{},
 			ChunkDelivery{},
 			WantedHashes{},
+			StreamState{},
+			DeliveryAck{},
+			ChunkProofRequest{},
+			ChunkProof{},
 		},
 	}
 
 	// pause the msgHandler execution, used only for tests
 	handleMsgPauser protocols.MsgPauser = nil
+
+	// ErrMessageLimitExceeded is returned when a peer sends a message larger than allowed by MessageLimits
+	ErrMessageLimitExceeded = errors.New("message limit exceeded")
+
+	// ErrInvalidOfferedHashes is returned when a peer offers hashes whose length is not a multiple of HashSize
+	ErrInvalidOfferedHashes = errors.New("invalid offered hashes length")
+
+	// ErrChunkProofRateExceeded is returned when a peer requests chunk proofs faster than they are served
+	ErrChunkProofRateExceeded = errors.New("chunk proof rate exceeded")
+
+	// ErrChunkProofsNotSupported is returned by RequestChunkProof if the peer does not serve chunk proofs
+	ErrChunkProofsNotSupported = errors.New("peer does not serve chunk proofs")
+
+	// ErrInvalidChunkProof is returned by RequestChunkProof if the proof sent by the peer does not verify
+	ErrInvalidChunkProof = errors.New("invalid chunk proof")
+
+	// DefaultRetryParams are the GetRange retry parameters used by a new Registry
+	DefaultRetryParams = RetryParams{
+		Interval:   time.Second,
+		Exponent:   2,
+		MaxRetries: 3,
+	}
+
+	// DefaultMessageLimits are the message limits used by a new Registry
+	DefaultMessageLimits = MessageLimits{
+		MaxOfferedHashes:   BatchSize,
+		MaxDeliveredChunks: BatchSize,
+		MaxBitVectorLength: BatchSize/8 + 1, // bitvector.New allocates l/8+1 bytes
+	}
 )
 
+// RetryParams holds the parameters of retrying GetRange requests whose batches timed out.
+// The n-th retry is sent after Interval * Exponent^(n-1) and the peer is dropped
+// if the batch still times out after MaxRetries retries.
+type RetryParams struct {
+	Interval   time.Duration // interval before the first retry
+	Exponent   int           // exponent to multiply retry intervals with
+	MaxRetries int           // maximum number of retries of a single range
+}
+
+// Validate returns an error if the retries would not back off, with a non positive
+// Interval or an Exponent lower than 1, or if MaxRetries is negative
+func (p RetryParams) Validate() error {
+	if p.Interval <= 0 {
+		return fmt.Errorf("invalid retry interval %v", p.Interval)
+	}
+	if p.Exponent < 1 {
+		return fmt.Errorf("invalid retry exponent %d", p.Exponent)
+	}
+	if p.MaxRetries < 0 {
+		return fmt.Errorf("invalid max retries %d", p.MaxRetries)
+	}
+	return nil
+}
+
+// MessageLimits holds the maximal sizes of stream protocol messages accepted from peers.
+// Peers that send larger messages are dropped. The payload sizes of the messages are
+// bounded accordingly in the registry protocol spec, so that messages which can not be
+// within the limits are rejected before they are decoded.
+type MessageLimits struct {
+	MaxOfferedHashes   int // maximal number of hashes in an OfferedHashes message
+	MaxDeliveredChunks int // maximal number of chunks in a ChunkDelivery message
+	MaxBitVectorLength int // maximal length in bytes of the BitVector in a WantedHashes message
+}
+
 // Registry is the base type that handles all client/server operations on a node
 // it is instantiated once per stream protocol instance, that is, it should have
 // one instance per node
 type Registry struct {
 	mtx                     sync.RWMutex
-	intervalsStore          state.Store               // store intervals for all peers
+	intervalsStore          IntervalStore             // store intervals for all peers
 	peers                   map[enode.ID]*Peer        // peers
 	address                 *network.BzzAddr          // this node's base address
 	providers               map[string]StreamProvider // stream providers by name of stream
@@ -111,18 +209,49 @@ type Registry struct {
 	lastReceivedChunkTimeMu sync.RWMutex              // synchronize access to lastReceivedChunkTime
 	lastReceivedChunkTime   time.Time                 // last received chunk time
 	logger                  log.Logger                // the logger for the registry. appends base address to all logs
+	limits                  MessageLimits             // maximal sizes of messages accepted from peers
+	retry                   RetryParams               // backoff parameters for retrying timed out GetRange requests
+	deliveryAcks            bool                      // acknowledge chunk deliveries with peers that support it
+	deliveryAckTimeout      time.Duration             // time to wait for delivery acknowledgements before resending chunks
+	streamStates            bool                      // report stream states to peers that support it
+
+	streamStateSubsMu sync.RWMutex                  // synchronize access to streamStateSubs
+	streamStateSubs   map[string][]chan StreamState // StreamState subscriptions by peer ID
+
+	proofStore      chunk.Store                          // store to serve chunk proofs from, nil if chunk proofs are not served
+	proofRequestsMu sync.Mutex                           // synchronize access to proofRequests
+	proofRequests   map[proofRequestKey]chan *ChunkProof // pending chunk proof requests
+}
+
+// proofRequestKey identifies a pending chunk proof request
+type proofRequestKey struct {
+	peer enode.ID
+	ruid uint
 }
 
-// New creates a new stream protocol handler
+// New creates a new stream protocol handler that persists stream intervals in the provided state.Store
 func New(intervalsStore state.Store, address *network.BzzAddr, providers ...StreamProvider) *Registry {
+	return NewWithIntervalStore(NewStateIntervalStore(intervalsStore), address, providers...)
+}
+
+// NewWithIntervalStore creates a new stream protocol handler that persists stream intervals in the provided IntervalStore
+func NewWithIntervalStore(intervalsStore IntervalStore, address *network.BzzAddr, providers ...StreamProvider) *Registry {
 	r := &Registry{
 		intervalsStore: intervalsStore,
 		peers:          make(map[enode.ID]*Peer),
 		providers:      make(map[string]StreamProvider),
 		quit:           make(chan struct{}),
 		address:        address,
-		logger:         log.New("base", address.ShortString()),
-		spec:           Spec,
+		logger:         log.NewBaseAddressLogger(address.ShortString()),
+		spec:           newSpec(DefaultMessageLimits),
+		limits:         DefaultMessageLimits,
+		retry:          DefaultRetryParams,
+
+		deliveryAckTimeout: timeouts.DeliveryAckTimeout,
+
+		streamStateSubs: make(map[string][]chan StreamState),
+
+		proofRequests: make(map[proofRequestKey]chan *ChunkProof),
 	}
 	for _, p := range providers {
 		r.providers[p.StreamName()] = p
@@ -131,21 +260,175 @@ func New(intervalsStore state.Store, address *network.BzzAddr, providers ...Stre
 	return r
 }
 
+// SetMessageLimits sets the maximal sizes of messages accepted from peers.
+// It must be called before the registry is started.
+func (r *Registry) SetMessageLimits(limits MessageLimits) {
+	r.limits = limits
+	r.spec = newSpec(limits)
+}
+
+// Spec returns the protocol spec of the registry, which bounds the
+// payload sizes of the messages according to the message limits
+func (r *Registry) Spec() *protocols.Spec {
+	return r.spec
+}
+
+// newSpec returns a copy of Spec with the payload sizes of the messages
+// bounded by the message limits
+func newSpec(limits MessageLimits) *protocols.Spec {
+	code := func(msg interface{}) uint64 {
+		c, _ := Spec.GetCode(msg)
+		return c
+	}
+	size := func(n int) uint32 {
+		if n < 0 || n+msgSizeOverhead > int(Spec.MaxMsgSize) {
+			return Spec.MaxMsgSize
+		}
+		return uint32(n + msgSizeOverhead)
+	}
+	// delivered chunk data is prefixed with the span
+	deliveredChunkSize := HashSize + chunk.DefaultSize + 8 + deliveredChunkOverhead
+	return &protocols.Spec{
+		Name:       Spec.Name,
+		Version:    Spec.Version,
+		MaxMsgSize: Spec.MaxMsgSize,
+		MaxMsgSizes: map[uint64]uint32{
+			code(OfferedHashes{}): size(limits.MaxOfferedHashes * HashSize),
+			code(ChunkDelivery{}): size(limits.MaxDeliveredChunks * deliveredChunkSize),
+			code(WantedHashes{}):  size(limits.MaxBitVectorLength),
+			code(DeliveryAck{}):   size(limits.MaxBitVectorLength),
+		},
+		Messages: Spec.Messages,
+	}
+}
+
+// SetRetryParams sets the backoff parameters for retrying timed out GetRange requests.
+// It returns an error if the parameters are not valid, see RetryParams.Validate.
+// It must be called before the registry is started.
+func (r *Registry) SetRetryParams(params RetryParams) error {
+	if err := params.Validate(); err != nil {
+		return err
+	}
+	r.retry = params
+	return nil
+}
+
+// SetDeliveryAckTimeout sets the time to wait for the acknowledgement of delivered chunks,
+// after which the unacknowledged chunks are delivered again.
+// It must be called before the registry is started.
+func (r *Registry) SetDeliveryAckTimeout(d time.Duration) {
+	r.deliveryAckTimeout = d
+}
+
+// EnableDeliveryAcks enables acknowledging chunk deliveries, and resending unacknowledged
+// chunks, with peers that support it. Support is advertised by adding the stream capability
+// to the provided capabilities, which are exchanged in the bzz handshake, so that peers
+// without it keep using unacknowledged deliveries.
+// It must be called before the registry is started.
+func (r *Registry) EnableDeliveryAcks(caps *capability.Capabilities) error {
+	if err := setCapability(caps, capabilitiesDeliveryAck); err != nil {
+		return err
+	}
+	r.deliveryAcks = true
+	return nil
+}
+
+// EnableStreamStates reports the errors and the end of the streams served to peers with
+// StreamState messages, and advertises handling them by adding the stream capability to
+// the provided capabilities, which are exchanged in the bzz handshake, so that StreamState
+// messages are sent only to peers that advertise it.
+// It must be called before the registry is started.
+func (r *Registry) EnableStreamStates(caps *capability.Capabilities) error {
+	if err := setCapability(caps, capabilitiesStreamState); err != nil {
+		return err
+	}
+	r.streamStates = true
+	return nil
+}
+
+// EnableChunkProofs serves BMT inclusion proofs of the chunks in the store to peers
+// that request them with RequestChunkProof, and advertises it by adding the stream
+// capability to the provided capabilities, which are exchanged in the bzz handshake.
+// Peers that request proofs faster than they are served are dropped.
+// It must be called before the registry is started.
+func (r *Registry) EnableChunkProofs(caps *capability.Capabilities, store chunk.Store) error {
+	if err := setCapability(caps, capabilitiesChunkProof); err != nil {
+		return err
+	}
+	r.proofStore = store
+	return nil
+}
+
+// setCapability sets the bit of the stream capability in the capabilities,
+// adding the stream capability if it is not there yet
+func setCapability(caps *capability.Capabilities, bit int) error {
+	c := caps.Get(CapabilityID)
+	if c == nil {
+		c = capability.NewCapability(CapabilityID, 8)
+		if err := caps.Add(c); err != nil {
+			return err
+		}
+	}
+	return c.Set(bit)
+}
+
+// hasCapability returns true if the address advertises the bit of the stream capability
+func hasCapability(addr *network.BzzAddr, bit int) bool {
+	if addr == nil || addr.Capabilities == nil {
+		return false
+	}
+	c := addr.Capabilities.Get(CapabilityID)
+	return c != nil && len(c.Cap) > bit && c.Cap[bit]
+}
+
+// negotiate enables the optional protocol features which are supported by the peer
+func (r *Registry) negotiate(p *Peer) {
+	p.deliveryAcks = r.deliveryAcks && hasCapability(p.BzzAddr, capabilitiesDeliveryAck)
+	p.chunkProofs = hasCapability(p.BzzAddr, capabilitiesChunkProof)
+	p.streamStates = r.streamStates && hasCapability(p.BzzAddr, capabilitiesStreamState)
+}
+
+// SetDisabledProviders removes and closes the providers of the streams with the given names,
+// so that their streams are neither requested nor served. Names which do not match any
+// provider are logged and ignored. It must be called before the registry is started.
+func (r *Registry) SetDisabledProviders(names []string) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	for _, name := range names {
+		p, ok := r.providers[name]
+		if !ok {
+			r.logger.Warn("unknown stream provider cannot be disabled", "name", name)
+			continue
+		}
+		delete(r.providers, name)
+		p.Close()
+		r.logger.Info("stream provider disabled", "name", name)
+	}
+}
+
 // Run is being dispatched when 2 nodes connect
 func (r *Registry) Run(bp *network.BzzPeer) error {
 	sp := newPeer(bp, r.address, r.intervalsStore, r.providers)
+	r.negotiate(sp)
 	// enable msg pauser for stream protocol, this is used only in tests
 	sp.Peer.SetMsgPauser(handleMsgPauser)
 	r.addPeer(sp)
 	defer r.removePeer(sp)
+	sp.logger.Debug("stream peer connected", "deliveryAcks", sp.deliveryAcks, "chunkProofs", sp.chunkProofs, "streamStates", sp.streamStates)
 	go sp.InitProviders()
 
-	return sp.Peer.Run(r.HandleMsg(sp))
+	err := sp.Peer.Run(r.HandleMsg(sp))
+	sp.logger.Debug("stream peer disconnected", "err", err)
+	return err
 }
 
 // HandleMsg is the main message handler for the stream protocol
 func (r *Registry) HandleMsg(p *Peer) func(context.Context, interface{}) error {
 	return func(ctx context.Context, msg interface{}) error {
+		if err := r.checkMessageLimits(msg); err != nil {
+			return protocols.Break(err)
+		}
 		switch msg := msg.(type) {
 		case *StreamInfoReq:
 			return r.serverHandleStreamInfoReq(ctx, p, msg)
@@ -159,6 +442,14 @@ func (r *Registry) HandleMsg(p *Peer) func(context.Context, interface{}) error {
 			return r.serverHandleWantedHashes(ctx, p, msg)
 		case *ChunkDelivery:
 			return r.clientHandleChunkDelivery(ctx, p, msg)
+		case *StreamState:
+			return r.handleStreamState(ctx, p, msg)
+		case *DeliveryAck:
+			return r.serverHandleDeliveryAck(ctx, p, msg)
+		case *ChunkProofRequest:
+			return r.serverHandleChunkProofRequest(ctx, p, msg)
+		case *ChunkProof:
+			return r.clientHandleChunkProof(ctx, p, msg)
 
 		default:
 			// todo: maybe a special error for unknown message, or at least just log it
@@ -167,6 +458,32 @@ func (r *Registry) HandleMsg(p *Peer) func(context.Context, interface{}) error {
 	}
 }
 
+// checkMessageLimits validates the size of the received message against the registry message limits
+func (r *Registry) checkMessageLimits(msg interface{}) error {
+	switch msg := msg.(type) {
+	case *OfferedHashes:
+		if len(msg.Hashes)%HashSize != 0 {
+			return fmt.Errorf("offered hashes length %d, ruid %d: %w", len(msg.Hashes), msg.Ruid, ErrInvalidOfferedHashes)
+		}
+		if l := len(msg.Hashes) / HashSize; l > r.limits.MaxOfferedHashes {
+			return fmt.Errorf("offered hashes count %d over limit %d, ruid %d: %w", l, r.limits.MaxOfferedHashes, msg.Ruid, ErrMessageLimitExceeded)
+		}
+	case *ChunkDelivery:
+		if l := len(msg.Chunks); l > r.limits.MaxDeliveredChunks {
+			return fmt.Errorf("delivered chunks count %d over limit %d, ruid %d: %w", l, r.limits.MaxDeliveredChunks, msg.Ruid, ErrMessageLimitExceeded)
+		}
+	case *WantedHashes:
+		if l := len(msg.BitVector); l > r.limits.MaxBitVectorLength {
+			return fmt.Errorf("wanted hashes bit vector length %d over limit %d, ruid %d: %w", l, r.limits.MaxBitVectorLength, msg.Ruid, ErrMessageLimitExceeded)
+		}
+	case *DeliveryAck:
+		if l := len(msg.BitVector); l > r.limits.MaxBitVectorLength {
+			return fmt.Errorf("delivery ack bit vector length %d over limit %d, ruid %d: %w", l, r.limits.MaxBitVectorLength, msg.Ruid, ErrMessageLimitExceeded)
+		}
+	}
+	return nil
+}
+
 // serverHandleStreamInfoReq handles the StreamInfoReq message on the server side (Peer is the client)
 func (r *Registry) serverHandleStreamInfoReq(ctx context.Context, p *Peer, msg *StreamInfoReq) error {
 	// illegal to request empty streams, drop peer
@@ -178,12 +495,14 @@ func (r *Registry) serverHandleStreamInfoReq(ctx context.Context, p *Peer, msg *
 	for _, v := range msg.Streams {
 		provider := r.getProvider(v)
 		if provider == nil {
+			r.sendStreamState(ctx, p, v, StreamStateUnsupported, "unsupported provider")
 			return fmt.Errorf("unsupported provider for stream: %s", v)
 		}
 
 		// get the current cursor from the data source
-		streamCursor, err := provider.Cursor(v.Key)
+		streamCursor, err := provider.Cursor(ctx, v.Key)
 		if err != nil {
+			r.sendStreamState(ctx, p, v, StreamStateFailed, fmt.Sprintf("getting cursor: %v", err))
 			return protocols.Break(fmt.Errorf("get cursor for stream key failed, name %s, key %s: %w", v.Name, v.Key, err))
 		}
 		descriptor := StreamDescriptor{
@@ -212,6 +531,72 @@ func (r *Registry) serverHandleStreamInfoReq(ctx context.Context, p *Peer, msg *
 	return nil
 }
 
+// sendStreamState reports the state of the stream to the peer, if it handles StreamState messages
+func (r *Registry) sendStreamState(ctx context.Context, p *Peer, stream ID, code uint16, message string) {
+	if !p.streamStates {
+		return
+	}
+	if err := p.Send(ctx, &StreamState{Stream: stream, Code: code, Message: message}); err != nil {
+		p.logger.Debug("sending stream state", "stream", stream, "code", code, "err", err)
+	}
+}
+
+// handleStreamState handles the StreamState message by notifying all subscribers for the peer
+func (r *Registry) handleStreamState(ctx context.Context, p *Peer, msg *StreamState) error {
+	if msg.Code != 0 {
+		p.logger.Warn("peer reported stream error", "stream", msg.Stream, "code", msg.Code, "message", msg.Message)
+	} else {
+		p.logger.Debug("peer reported stream state", "stream", msg.Stream, "message", msg.Message)
+	}
+
+	r.streamStateSubsMu.RLock()
+	defer r.streamStateSubsMu.RUnlock()
+
+	for _, c := range r.streamStateSubs[p.ID().String()] {
+		select {
+		case c <- *msg:
+		default:
+			metrics.GetOrRegisterCounter("network/stream/stream_state_dropped", nil).Inc(1)
+			p.logger.Warn("stream state subscriber is not keeping up, dropping message", "stream", msg.Stream)
+		}
+	}
+	return nil
+}
+
+// SubscribeStreamState returns a channel that receives every StreamState message
+// sent by the peer with the given ID (the hex encoded enode ID) for any stream,
+// and a function that cancels the subscription and closes the channel.
+// The channel is buffered; messages are dropped if the subscriber does not keep up.
+func (r *Registry) SubscribeStreamState(peerID string) (<-chan StreamState, func()) {
+	c := make(chan StreamState, streamStateSubBufferSize)
+
+	r.streamStateSubsMu.Lock()
+	r.streamStateSubs[peerID] = append(r.streamStateSubs[peerID], c)
+	r.streamStateSubsMu.Unlock()
+
+	var once sync.Once
+	return c, func() {
+		once.Do(func() {
+			r.streamStateSubsMu.Lock()
+			defer r.streamStateSubsMu.Unlock()
+
+			subs := r.streamStateSubs[peerID]
+			for i, sub := range subs {
+				if sub == c {
+					subs = append(subs[:i], subs[i+1:]...)
+					break
+				}
+			}
+			if len(subs) == 0 {
+				delete(r.streamStateSubs, peerID)
+			} else {
+				r.streamStateSubs[peerID] = subs
+			}
+			close(c)
+		})
+	}
+}
+
 // clientHandleStreamInfoRes handles the StreamInfoRes message (Peer is the server)
 func (r *Registry) clientHandleStreamInfoRes(ctx context.Context, p *Peer, msg *StreamInfoRes) error {
 	if len(msg.Streams) == 0 {
@@ -247,7 +632,12 @@ func (r *Registry) clientHandleStreamInfoRes(ctx context.Context, p *Peer, msg *
 		p.logger.Debug("setting stream cursor", "stream", s.Stream, "cursor", s.Cursor)
 		p.setCursor(s.Stream, s.Cursor)
 
-		if provider.Autostart() {
+		// persisted intervals from previous sessions are reused, unless the peer's stream was reset
+		if err := p.reconcileInterval(s.Stream, s.Cursor); err != nil {
+			return protocols.Break(fmt.Errorf("reconcile stream interval %s: %w", s.Stream, err))
+		}
+
+		if provider.Autostart() || p.takeRequested(s.Stream) {
 			// don't request historical ranges for streams with cursor == 0
 			if s.Cursor > 0 {
 				p.logger.Debug("requesting history stream", "stream", s.Stream, "cursor", s.Cursor)
@@ -285,7 +675,7 @@ func (r *Registry) clientHandleStreamInfoRes(ctx context.Context, p *Peer, msg *
 // new chunks from the supplied cursor position
 func (r *Registry) clientRequestStreamHead(ctx context.Context, p *Peer, stream ID, from uint64) error {
 	p.logger.Debug("clientRequestStreamHead", "stream", stream, "from", from)
-	return r.clientCreateSendWant(ctx, p, stream, from, nil, true)
+	return r.clientCreateSendWant(ctx, p, stream, from, nil, true, 0)
 }
 
 // clientRequestStreamRange sends a GetRange message to the server requesting
@@ -303,12 +693,13 @@ func (r *Registry) clientRequestStreamRange(ctx context.Context, p *Peer, provid
 	// nothing to do - the next interval is bigger than the cursor or theinterval is empty
 	if from > cursor || empty {
 		p.logger.Debug("peer.requestStreamRange stream finished", "stream", stream, "cursor", cursor)
+		p.finishResync(stream)
 		return nil
 	}
-	return r.clientCreateSendWant(ctx, p, stream, from, &cursor, false)
+	return r.clientCreateSendWant(ctx, p, stream, from, &cursor, false, 0)
 }
 
-func (r *Registry) clientCreateSendWant(ctx context.Context, p *Peer, stream ID, from uint64, to *uint64, head bool) error {
+func (r *Registry) clientCreateSendWant(ctx context.Context, p *Peer, stream ID, from uint64, to *uint64, head bool, retries int) error {
 	g := GetRange{
 		Ruid:      uint(rand.Uint32()),
 		Stream:    stream,
@@ -337,6 +728,7 @@ func (r *Registry) clientCreateSendWant(ctx context.Context, p *Peer, stream ID,
 		closeC: make(chan error),
 
 		requested: time.Now(),
+		retries:   retries,
 	}
 	p.mtx.Unlock()
 
@@ -351,14 +743,15 @@ func (r *Registry) clientCreateSendWant(ctx context.Context, p *Peer, stream ID,
 func (r *Registry) serverHandleGetRange(ctx context.Context, p *Peer, msg *GetRange) error {
 	provider := r.getProvider(msg.Stream)
 	if provider == nil {
+		r.sendStreamState(ctx, p, msg.Stream, StreamStateUnsupported, "unsupported provider")
 		return protocols.Break(fmt.Errorf("unsupported provider"))
 	}
 
-	p.logger.Debug("serverHandleGetRange", "ruid", msg.Ruid, "head?", msg.To == nil)
+	p.logger.Debug("serverHandleGetRange", "ruid", msg.Ruid, "stream", msg.Stream, "from", msg.From, "head?", msg.To == nil)
 	p.mtx.Lock()
 	s := p.getRangeKey(msg.Stream, msg.To == nil)
 	if ruid, exists := p.serverOpenGetRange[s]; exists {
-		p.logger.Debug("stream request already ongoing, skipping", "ruid in flight", ruid)
+		p.logger.Debug("stream request already ongoing, skipping", "stream", msg.Stream, "ruid in flight", ruid)
 		p.mtx.Unlock()
 		return nil
 	}
@@ -376,6 +769,7 @@ func (r *Registry) serverHandleGetRange(ctx context.Context, p *Peer, msg *GetRa
 
 	key, err := provider.ParseKey(msg.Stream.Key)
 	if err != nil {
+		r.sendStreamState(ctx, p, msg.Stream, StreamStateInvalidKey, err.Error())
 		return protocols.Break(fmt.Errorf("parsing stream key for stream %s: %w", msg.Stream, err))
 	}
 
@@ -386,6 +780,7 @@ func (r *Registry) serverHandleGetRange(ctx context.Context, p *Peer, msg *GetRa
 	}
 	h, _, t, e, err := r.serverCollectBatch(ctx, p, provider, key, msg.From, to)
 	if err != nil {
+		r.sendStreamState(ctx, p, msg.Stream, StreamStateFailed, fmt.Sprintf("getting batch: %v", err))
 		return protocols.Break(fmt.Errorf("getting live batch for stream %s: %w", msg.Stream, err))
 	}
 
@@ -413,6 +808,9 @@ func (r *Registry) serverHandleGetRange(ctx context.Context, p *Peer, msg *GetRa
 			if err := p.Send(ctx, offered); err != nil {
 				return protocols.Break(fmt.Errorf("sending empty live offered hashes, ruid %d: %w", msg.Ruid, err))
 			}
+			if provider.Boundedness() {
+				r.sendStreamState(ctx, p, msg.Stream, StreamStateEnded, fmt.Sprintf("no data from %d", msg.From))
+			}
 			return nil
 		}
 	}
@@ -433,6 +831,7 @@ func (r *Registry) serverHandleGetRange(ctx context.Context, p *Peer, msg *GetRa
 		Hashes:    h,
 	}
 	l := len(h) / HashSize
+	p.logger.Trace("offering hashes", "ruid", msg.Ruid, "stream", msg.Stream, "count", l, "last index", t)
 	if msg.To == nil {
 		headBatchSizeGauge.Update(int64(l))
 	} else {
@@ -519,6 +918,18 @@ func (r *Registry) clientHandleOfferedHashes(ctx context.Context, p *Peer, msg *
 		p.logger.Trace("clientHandleOfferedHashes peer offered hash", "ruid", msg.Ruid, "stream", w.stream, "chunk", addresses[i/HashSize])
 	}
 
+	if p.deliveryAcks {
+		// track the stored chunks by their offered index to acknowledge deliveries
+		w.stored, err = bv.New(lenHashes / HashSize)
+		if err != nil {
+			return protocols.Break(fmt.Errorf("initialising stored bitvector, len %d, ruid %d: %w", lenHashes/HashSize, msg.Ruid, err))
+		}
+		w.indices = make(map[string]int, len(addresses))
+		for i, addr := range addresses {
+			w.indices[addr.Hex()] = i
+		}
+	}
+
 	startNeed := time.Now()
 
 	// check which hashes we want
@@ -536,6 +947,7 @@ func (r *Registry) clientHandleOfferedHashes(ctx context.Context, p *Peer, msg *
 	}
 
 	providerNeedDataTimer.UpdateSince(startNeed)
+	streamOfferedNotWanted.Inc(int64(uint64(len(wants)) - ctr))
 
 	// set the number of remaining chunks to ctr
 	atomic.AddUint64(&w.remaining, ctr)
@@ -580,18 +992,20 @@ func (r *Registry) clientHandleOfferedHashes(ctx context.Context, p *Peer, msg *
 	case <-time.After(timeouts.SyncBatchTimeout):
 		p.logger.Error("batch has timed out", "ruid", w.ruid)
 		close(w.closeC) // signal the polling goroutine to terminate
-		p.mtx.Lock()
-		delete(p.openWants, msg.Ruid)
-		p.mtx.Unlock()
+		p.closeWant(msg.Ruid)
 
 		// todo: this should happen because of the returned error anyway
 		// if the stream is wanted and has timed out
-		// then drop the peer. this safeguards the edge
-		// case that a batch times out when a kademlia
-		// depth change occurs between the call to
-		// clientSealBatch and a subsequent chunk delivery
-		// message
+		// then retry the range with a backoff and drop
+		// the peer when all retries are exhausted.
+		// this safeguards the edge case that a batch
+		// times out when a kademlia depth change occurs
+		// between the call to clientSealBatch and a
+		// subsequent chunk delivery message
 		if provider.WantStream(p, w.stream) {
+			if w.retries < r.retry.MaxRetries {
+				return r.clientRetryWant(ctx, p, w)
+			}
 			return protocols.Break(errors.New("batch has timed out"))
 		}
 		return nil
@@ -616,23 +1030,26 @@ func (r *Registry) serverHandleWantedHashes(ctx context.Context, p *Peer, msg *W
 		return protocols.Break(errors.New("unsupported provider"))
 	}
 
-	p.logger.Debug("serverHandleWantedHashes", "ruid", msg.Ruid)
+	p.logger.Debug("serverHandleWantedHashes", "ruid", msg.Ruid, "stream", o.stream)
 	start := time.Now()
 	defer func(start time.Time) {
 		metrics.GetOrRegisterResettingTimer("network/stream/handle_wanted_hashes/total-time", nil).UpdateSince(start)
 	}(start)
 
+	// the offer is kept open while the delivery acknowledgements are awaited
+	awaitAcks := false
 	defer func() {
-		p.mtx.Lock()
-		delete(p.openOffers, msg.Ruid)
-		p.mtx.Unlock()
+		if !awaitAcks {
+			p.deleteOffer(msg.Ruid)
+		}
 	}()
 
 	var (
-		l          = len(o.hashes) / HashSize
-		cd         = &ChunkDelivery{Ruid: msg.Ruid}
-		wantHashes = []chunk.Address{}
-		allHashes  = make([]chunk.Address, l)
+		l           = len(o.hashes) / HashSize
+		cd          = &ChunkDelivery{Ruid: msg.Ruid}
+		wantHashes  = []chunk.Address{}
+		wantIndices = []int{} // offered indices of the wanted hashes
+		allHashes   = make([]chunk.Address, l)
 	)
 
 	if len(msg.BitVector) == 0 {
@@ -662,9 +1079,23 @@ func (r *Registry) serverHandleWantedHashes(ctx context.Context, p *Peer, msg *W
 		if want.Get(i) {
 			metrics.GetOrRegisterCounter("network/stream/handle_wanted/want_get", nil).Inc(1)
 			wantHashes = append(wantHashes, hash)
+			wantIndices = append(wantIndices, i)
 		}
 		allHashes[i] = hash
 	}
+
+	var acks *deliveryAcks
+	if p.deliveryAcks {
+		// track acknowledgements before the first frame is sent
+		acks, err = newDeliveryAcks(l)
+		if err != nil {
+			return protocols.Break(fmt.Errorf("initialising delivery acks, l %d: %w", l, err))
+		}
+		p.mtx.Lock()
+		o.acks = acks
+		p.openOffers[msg.Ruid] = o
+		p.mtx.Unlock()
+	}
 	startGet := time.Now()
 
 	// get the chunks from the provider
@@ -674,6 +1105,7 @@ func (r *Registry) serverHandleWantedHashes(ctx context.Context, p *Peer, msg *W
 	}
 
 	providerGetTimer.UpdateSince(startGet) // measure how long we spend on getting the chunks
+	p.logger.Trace("delivering wanted chunks", "ruid", msg.Ruid, "stream", o.stream, "wanted", len(chunks), "offered", l)
 
 	// append the chunks to the chunk delivery message. when reaching maxFrameSize send the current batch
 	for _, v := range chunks {
@@ -711,24 +1143,230 @@ func (r *Registry) serverHandleWantedHashes(ctx context.Context, p *Peer, msg *W
 		}
 	}
 
+	if acks != nil {
+		// wait for the acknowledgements in a separate goroutine, not to hold the message handler
+		awaitAcks = true
+		go func() {
+			defer p.deleteOffer(msg.Ruid)
+
+			if err := r.serverAwaitDeliveryAcks(ctx, p, msg.Ruid, acks, chunks, wantIndices, maxFrame); err != nil {
+				p.logger.Error("awaiting delivery acks", "ruid", msg.Ruid, "stream", o.stream, "err", err)
+				p.Drop(err.Error())
+				return
+			}
+			// don't set the chunks as synced on shutdown or peer dropout
+			select {
+			case <-p.quit:
+				return
+			case <-r.quit:
+				return
+			default:
+			}
+			if err := r.serverSetSynced(ctx, provider, allHashes); err != nil {
+				p.logger.Error("setting delivered chunks as synced", "ruid", msg.Ruid, "stream", o.stream, "err", err)
+				p.Drop(err.Error())
+			}
+		}()
+		return nil
+	}
+
+	if err := r.serverSetSynced(ctx, provider, allHashes); err != nil {
+		return protocols.Break(err)
+	}
+	return nil
+}
+
+// serverSetSynced sets the offered chunks as synced with the provider
+func (r *Registry) serverSetSynced(ctx context.Context, provider StreamProvider, allHashes []chunk.Address) error {
 	startSet := time.Now()
 
 	// set the chunks as synced
-	err = provider.Set(ctx, allHashes...)
-	if err != nil {
-		return protocols.Break(fmt.Errorf("sending chunk as synced, addr: %s: %w", allHashes, err))
-
+	if err := provider.Set(ctx, allHashes...); err != nil {
+		return fmt.Errorf("sending chunk as synced, addr: %s: %w", allHashes, err)
 	}
 	providerSetTimer.UpdateSince(startSet)
 
 	return nil
 }
 
+// serverAwaitDeliveryAcks waits until the client acknowledges all delivered chunks of a batch.
+// The chunks that are not acknowledged within the delivery ack timeout after the last acknowledgement
+// are delivered again, at most maxDeliveryResends times. The indices are the offered indices
+// of the chunks.
+func (r *Registry) serverAwaitDeliveryAcks(ctx context.Context, p *Peer, ruid uint, acks *deliveryAcks, chunks []chunk.Chunk, indices []int, maxFrame int) error {
+	for resends := 0; ; {
+		if len(acks.unacked(chunks, indices)) == 0 {
+			return nil
+		}
+		select {
+		case <-acks.c:
+			continue
+		case <-time.After(r.deliveryAckTimeout):
+		case <-p.quit:
+			return nil
+		case <-r.quit:
+			return nil
+		}
+
+		unacked := acks.unacked(chunks, indices)
+		if len(unacked) == 0 {
+			return nil
+		}
+		if resends == maxDeliveryResends {
+			p.logger.Warn("chunk deliveries not acknowledged", "ruid", ruid, "count", len(unacked))
+			return nil
+		}
+		resends++
+		p.logger.Debug("resending unacknowledged chunks", "ruid", ruid, "count", len(unacked), "resends", resends)
+		streamDeliveryResend.Inc(int64(len(unacked)))
+
+		for len(unacked) > 0 {
+			n := maxFrame
+			if n > len(unacked) {
+				n = len(unacked)
+			}
+			cd := &ChunkDelivery{Ruid: ruid}
+			for _, v := range unacked[:n] {
+				cd.Chunks = append(cd.Chunks, DeliveredChunk{
+					Addr: v.Address(),
+					Data: v.Data(),
+				})
+			}
+			unacked = unacked[n:]
+			if err := p.Send(ctx, cd); err != nil {
+				return fmt.Errorf("resending chunk delivery frame, ruid %d: %w", ruid, err)
+			}
+		}
+	}
+}
+
+// serverHandleDeliveryAck handles the DeliveryAck message on the server side (Peer is the client)
+func (r *Registry) serverHandleDeliveryAck(ctx context.Context, p *Peer, msg *DeliveryAck) error {
+	o, err := p.getOffer(msg.Ruid)
+	if err != nil || o.acks == nil {
+		// acknowledgements may arrive after all chunks of the offer were acknowledged
+		return nil
+	}
+	if err := o.acks.add(msg.BitVector); err != nil {
+		return protocols.Break(fmt.Errorf("delivery ack, ruid %d: %w", msg.Ruid, err))
+	}
+	return nil
+}
+
+// newChunkProofHasher returns the reference BMT hasher for chunk proofs
+func newChunkProofHasher() *bmt.RefHasher {
+	return bmt.NewRefHasher(sha3.NewLegacyKeccak256, chunk.DefaultSize/HashSize)
+}
+
+// RequestChunkProof requests the BMT inclusion proof of the segment with the given index of
+// the chunk with the address from the peer. It returns the segment once the proof verifies
+// against the address, which assures that the peer stores the chunk without retrieving it.
+func (r *Registry) RequestChunkProof(ctx context.Context, peerID enode.ID, addr chunk.Address, segment int) ([]byte, error) {
+	p := r.getPeer(peerID)
+	if p == nil {
+		return nil, fmt.Errorf("peer %s not found", peerID)
+	}
+	if !p.chunkProofs {
+		return nil, ErrChunkProofsNotSupported
+	}
+	if segment < 0 || segment >= chunk.DefaultSize/HashSize {
+		return nil, fmt.Errorf("segment index %d out of range", segment)
+	}
+
+	key := proofRequestKey{peer: peerID, ruid: uint(rand.Uint32())}
+	c := make(chan *ChunkProof, 1)
+	r.proofRequestsMu.Lock()
+	r.proofRequests[key] = c
+	r.proofRequestsMu.Unlock()
+	defer func() {
+		r.proofRequestsMu.Lock()
+		delete(r.proofRequests, key)
+		r.proofRequestsMu.Unlock()
+	}()
+
+	if err := p.Send(ctx, &ChunkProofRequest{Ruid: key.ruid, Addr: addr, Segment: uint(segment)}); err != nil {
+		return nil, fmt.Errorf("sending chunk proof request: %w", err)
+	}
+
+	select {
+	case res := <-c:
+		if len(res.Span) == 0 {
+			return nil, chunk.ErrChunkNotFound
+		}
+		if !bmt.VerifyProof(sha3.NewLegacyKeccak256, addr, res.Span, res.Segment, segment, res.Proof) {
+			return nil, ErrInvalidChunkProof
+		}
+		return res.Segment, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-p.quit:
+		return nil, fmt.Errorf("peer %s quit", peerID)
+	case <-r.quit:
+		return nil, errors.New("shutting down")
+	}
+}
+
+// serverHandleChunkProofRequest handles the ChunkProofRequest message on the server side (Peer is the client)
+func (r *Registry) serverHandleChunkProofRequest(ctx context.Context, p *Peer, msg *ChunkProofRequest) error {
+	if r.proofStore == nil {
+		return protocols.Break(errors.New("chunk proofs are not served"))
+	}
+	if !p.proofLimiter.Allow() {
+		return protocols.Break(fmt.Errorf("chunk proof, ruid %d: %w", msg.Ruid, ErrChunkProofRateExceeded))
+	}
+	res := &ChunkProof{Ruid: msg.Ruid}
+	ch, err := r.proofStore.Get(ctx, chunk.ModeGetLookup, msg.Addr)
+	switch {
+	case errors.Is(err, chunk.ErrChunkNotFound):
+		// respond with an empty span
+	case err != nil:
+		return fmt.Errorf("get chunk for proof, ruid %d: %w", msg.Ruid, err)
+	default:
+		data := ch.Data()
+		if len(data) < 8 {
+			return fmt.Errorf("chunk %s data too short for proof: %d", msg.Addr, len(data))
+		}
+		segment, proof, err := newChunkProofHasher().Proof(data[8:], int(msg.Segment))
+		if err != nil {
+			return protocols.Break(fmt.Errorf("chunk proof, ruid %d: %w", msg.Ruid, err))
+		}
+		res.Span = data[:8]
+		res.Segment = segment
+		res.Proof = proof
+	}
+	if err := p.Send(ctx, res); err != nil {
+		return protocols.Break(fmt.Errorf("sending chunk proof, ruid %d: %w", msg.Ruid, err))
+	}
+	return nil
+}
+
+// clientHandleChunkProof handles the ChunkProof message on the client side (Peer is the server)
+func (r *Registry) clientHandleChunkProof(ctx context.Context, p *Peer, msg *ChunkProof) error {
+	r.proofRequestsMu.Lock()
+	c, ok := r.proofRequests[proofRequestKey{peer: p.ID(), ruid: msg.Ruid}]
+	r.proofRequestsMu.Unlock()
+	if !ok {
+		// the request may have been cancelled
+		return nil
+	}
+	select {
+	case c <- msg:
+	default:
+	}
+	return nil
+}
+
 // clientHandleChunkDelivery handles chunk delivery messages
 func (r *Registry) clientHandleChunkDelivery(ctx context.Context, p *Peer, msg *ChunkDelivery) error {
 	// get the existing want for ruid from peer, otherwise drop
 	w, err := p.getWant(msg.Ruid)
 	if err != nil {
+		if p.isClosedWant(msg.Ruid) {
+			// unacknowledged chunks may be delivered again after the want is closed
+			p.logger.Debug("ignoring chunk delivery for closed want", "ruid", msg.Ruid, "chunks", len(msg.Chunks))
+			streamDeliveryIgnored.Inc(1)
+			return nil
+		}
 		streamChunkDeliveryFail.Inc(1)
 		return protocols.Break(err)
 	}
@@ -737,7 +1375,7 @@ func (r *Registry) clientHandleChunkDelivery(ctx context.Context, p *Peer, msg *
 		return protocols.Break(fmt.Errorf("unsupported provider"))
 	}
 
-	p.logger.Debug("clientHandleChunkDelivery", "ruid", msg.Ruid)
+	p.logger.Debug("clientHandleChunkDelivery", "ruid", msg.Ruid, "stream", w.stream, "chunks", len(msg.Chunks))
 
 	// don't process this message if we're no longer
 	// interested in this stream
@@ -745,6 +1383,7 @@ func (r *Registry) clientHandleChunkDelivery(ctx context.Context, p *Peer, msg *
 		return nil
 	}
 	processReceivedChunksMsgCount.Inc(1)
+	receivedChunksMeter.Mark(int64(len(msg.Chunks)))
 	r.setLastReceivedChunkTime() // needed for IsPullSyncing
 
 	defer func(start time.Time) {
@@ -763,8 +1402,10 @@ func (r *Registry) clientHandleChunkDelivery(ctx context.Context, p *Peer, msg *
 	if err != nil {
 		if err == storage.ErrChunkInvalid {
 			streamChunkDeliveryFail.Inc(1)
+			p.logger.Warn("peer delivered an invalid chunk", "ruid", msg.Ruid, "stream", w.stream)
 			return protocols.Break(fmt.Errorf("put chunks to provider: %w", err))
 		}
+		p.logger.Error("putting delivered chunks", "ruid", msg.Ruid, "stream", w.stream, "err", err)
 
 		return fmt.Errorf("clientHandleChunkDelivery putting chunk: %w", err)
 	}
@@ -777,6 +1418,17 @@ func (r *Registry) clientHandleChunkDelivery(ctx context.Context, p *Peer, msg *
 			streamSeenChunkDelivery.Inc(1)
 		}
 	}
+	if w.stored != nil {
+		// acknowledge the stored chunks and skip the chunks that were delivered again
+		var ack []byte
+		chunks, seen, ack = p.setStored(w, chunks, seen)
+		if err := p.Send(ctx, &DeliveryAck{Ruid: msg.Ruid, BitVector: ack}); err != nil {
+			return protocols.Break(fmt.Errorf("sending delivery ack, ruid %d: %w", msg.Ruid, err))
+		}
+	}
+	if !w.head {
+		p.addResynced(w.stream, seen)
+	}
 
 	for _, dc := range chunks {
 		select {
@@ -816,7 +1468,7 @@ func (r *Registry) clientSealBatch(ctx context.Context, p *Peer, provider Stream
 				processReceivedChunksCount.Inc(1)
 				p.mtx.Lock()
 				if _, ok := w.hashes[c.Hex()]; !ok {
-					p.logger.Error("got an unsolicited chunk from peer", "peer", p.ShortString(), "caddr", c)
+					p.logger.Error("got an unsolicited chunk from peer", "caddr", c)
 					streamChunkDeliveryFail.Inc(1)
 					p.Drop("got an unsolicited chunk from peer")
 					p.mtx.Unlock()
@@ -925,9 +1577,7 @@ func (r *Registry) requestSubsequentRange(ctx context.Context, p *Peer, provider
 	if !ok {
 		metrics.GetOrRegisterCounter("network/stream/quit_unwanted", nil).Inc(1)
 		p.logger.Debug("no longer interested in stream. quitting", "stream", w.stream)
-		p.mtx.Lock()
-		delete(p.openWants, w.ruid)
-		p.mtx.Unlock()
+		p.closeWant(w.ruid)
 		return nil
 	}
 	if w.head {
@@ -945,6 +1595,42 @@ func (r *Registry) requestSubsequentRange(ctx context.Context, p *Peer, provider
 	return nil
 }
 
+// clientRetryWant requests the range of a timed out want again after the backoff interval
+// for the number of retries already made. The whole range is requested again from the start
+// of the want; the chunks delivered before the timeout are already stored, so they are not
+// wanted again from the new offer.
+func (r *Registry) clientRetryWant(ctx context.Context, p *Peer, w *want) error {
+	p.mtx.Lock()
+	delete(p.clientOpenGetRange, p.getRangeKey(w.stream, w.head))
+	p.mtx.Unlock()
+
+	backoff := r.retry.Interval
+	for i := 0; i < w.retries; i++ {
+		backoff *= time.Duration(r.retry.Exponent)
+	}
+	metrics.GetOrRegisterCounter("network/stream/get_range_retry", nil).Inc(1)
+	p.logger.Debug("retrying timed out range", "stream", w.stream, "from", w.from, "to", w.to, "retry", w.retries+1, "backoff", backoff)
+
+	timer := time.NewTimer(backoff)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-r.quit:
+		return nil
+	case <-p.quit:
+		return nil
+	}
+
+	to := w.to
+	if w.head {
+		to = nil
+	}
+	if err := r.clientCreateSendWant(ctx, p, w.stream, w.from, to, w.head, w.retries+1); err != nil {
+		return protocols.Break(fmt.Errorf("retrying range from %d: %w", w.from, err))
+	}
+	return nil
+}
+
 func (r *Registry) getProvider(stream ID) StreamProvider {
 	r.mtx.RLock()
 	defer r.mtx.RUnlock()
@@ -974,6 +1660,7 @@ func (r *Registry) removePeer(p *Peer) {
 		p.logger.Error("removing peer")
 		delete(r.peers, p.ID())
 		close(p.quit)
+		p.unregisterCursorLags()
 	}
 	streamPeersCount.Update(int64(len(r.peers)))
 }
@@ -1014,7 +1701,7 @@ func (r *Registry) PeerInfo() (*PeerInfo, error) {
 			if err != nil {
 				return nil, err
 			}
-			cursor, err := p.Cursor(key)
+			cursor, err := p.Cursor(context.Background(), key)
 			if err != nil {
 				return nil, err
 			}
@@ -1022,12 +1709,8 @@ func (r *Registry) PeerInfo() (*PeerInfo, error) {
 		}
 	}
 	info.Intervals = make(map[string]string)
-	if err := r.intervalsStore.Iterate("", func(key, value []byte) (stop bool, err error) {
-		i := new(intervals.Intervals)
-		if err := i.UnmarshalBinary(value); err != nil {
-			return true, err
-		}
-		info.Intervals[string(key)] = i.String()
+	if err := r.intervalsStore.Iterate("", func(key string, i *intervals.Intervals) (stop bool, err error) {
+		info.Intervals[key] = i.String()
 		return false, nil
 	}); err != nil {
 		return nil, err
@@ -1084,7 +1767,7 @@ func (r *Registry) Start(server *p2p.Server) error {
 }
 
 func (r *Registry) Stop() error {
-	log.Debug("stream registry stopping")
+	r.logger.Debug("stream registry stopping")
 	r.mtx.Lock()
 	defer r.mtx.Unlock()
 	close(r.quit)
@@ -0,0 +1,1031 @@
+// Copyright 2019 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package stream
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/holisticode/swarm/chunk"
+	"github.com/holisticode/swarm/network"
+	bv "github.com/holisticode/swarm/network/bitvector"
+	"github.com/holisticode/swarm/network/capability"
+	"github.com/holisticode/swarm/network/timeouts"
+	"github.com/holisticode/swarm/p2p/protocols"
+	p2ptest "github.com/holisticode/swarm/p2p/testing"
+	"github.com/holisticode/swarm/state"
+	"github.com/holisticode/swarm/storage"
+	"github.com/holisticode/swarm/testutil"
+)
+
+// TestSubscribeStreamState checks that StreamState messages received from a peer
+// are delivered to the subscribers for that peer only, and not after unsubscribing.
+func TestSubscribeStreamState(t *testing.T) {
+	r := New(state.NewInmemoryStore(), network.RandomBzzAddr())
+
+	p := newTestPeer(r, newTestBzzPeer())
+	other := newTestPeer(r, newTestBzzPeer())
+
+	c, unsubscribe := r.SubscribeStreamState(p.ID().String())
+	otherC, otherUnsubscribe := r.SubscribeStreamState(other.ID().String())
+	defer otherUnsubscribe()
+
+	handle := r.HandleMsg(p)
+	want := StreamState{
+		Stream:  NewID("SYNC", "1"),
+		Code:    1,
+		Message: "stream failed",
+	}
+	if err := handle(context.Background(), &want); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case got := <-c:
+		if got != want {
+			t.Fatalf("got stream state %+v, want %+v", got, want)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for stream state")
+	}
+
+	select {
+	case got := <-otherC:
+		t.Fatalf("got stream state %+v for another peer", got)
+	default:
+	}
+
+	unsubscribe()
+	if _, ok := <-c; ok {
+		t.Fatal("expected closed channel after unsubscribe")
+	}
+	// unsubscribing twice must not panic
+	unsubscribe()
+
+	if err := handle(context.Background(), &want); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestStreamStateSent checks that the server reports the errors of a stream
+// only to peers that advertise handling StreamState messages
+func TestStreamStateSent(t *testing.T) {
+	for _, supported := range []bool{true, false} {
+		t.Run(fmt.Sprintf("supported %v", supported), func(t *testing.T) {
+			r := New(state.NewInmemoryStore(), network.RandomBzzAddr())
+			if err := r.EnableStreamStates(capability.NewCapabilities()); err != nil {
+				t.Fatal(err)
+			}
+			addr := network.RandomBzzAddr()
+			if supported {
+				if err := setCapability(addr.Capabilities, capabilitiesStreamState); err != nil {
+					t.Fatal(err)
+				}
+			}
+			p, receive, cleanup := newPipeTestPeer(t, r, addr)
+			defer cleanup()
+			if p.streamStates != supported {
+				t.Fatalf("got stream states %v, want %v", p.streamStates, supported)
+			}
+
+			stream := NewID("UNSUPPORTED", "1")
+			if err := r.serverHandleGetRange(context.Background(), p, &GetRange{Ruid: 1, Stream: stream, BatchSize: 1}); err == nil {
+				t.Fatal("expected error for an unsupported stream, got nil")
+			}
+			if !supported {
+				// the stream state is not sent, so the next message is the one sent below
+				if err := p.Send(context.Background(), &StreamInfoReq{}); err != nil {
+					t.Fatal(err)
+				}
+				if msg, ok := receive().(*StreamInfoReq); !ok {
+					t.Fatalf("got message %#v, want StreamInfoReq", msg)
+				}
+				return
+			}
+			msg, ok := receive().(*StreamState)
+			if !ok {
+				t.Fatalf("got message %#v, want StreamState", msg)
+			}
+			if msg.Stream != stream || msg.Code != StreamStateUnsupported {
+				t.Fatalf("got stream state %+v, want stream %s and code %d", msg, stream, StreamStateUnsupported)
+			}
+		})
+	}
+}
+
+// TestIntervalsPersistence checks that stream intervals are reloaded after recreating
+// the registry with the same store, and that they are reset if they extend beyond the peer cursor.
+func TestIntervalsPersistence(t *testing.T) {
+	store := state.NewInmemoryStore()
+	baseAddr := network.RandomBzzAddr()
+	bp := newTestBzzPeer()
+	stream := NewID("SYNC", "1")
+
+	p := newTestPeer(New(store, baseAddr), bp)
+	if _, err := p.getOrCreateInterval(p.peerStreamIntervalKey(stream)); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.addInterval(stream, 1, 100); err != nil {
+		t.Fatal(err)
+	}
+
+	// recreate the registry with the same store
+	p = newTestPeer(New(store, baseAddr), bp)
+	if err := p.reconcileInterval(stream, 150); err != nil {
+		t.Fatal(err)
+	}
+	from, _, _, err := p.nextInterval(stream, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if from != 101 {
+		t.Fatalf("got next interval start %v, want %v", from, 101)
+	}
+
+	// peer reports a cursor lower than the persisted intervals
+	if err := p.reconcileInterval(stream, 50); err != nil {
+		t.Fatal(err)
+	}
+	from, _, _, err = p.nextInterval(stream, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if from != 1 {
+		t.Fatalf("got next interval start %v after reset, want %v", from, 1)
+	}
+}
+
+// TestCursorLag checks that the cursor lag of a stream is the number of bin ids
+// up to the peer cursor that are not in the first contiguous synced interval.
+func TestCursorLag(t *testing.T) {
+	p := newTestPeer(New(state.NewInmemoryStore(), network.RandomBzzAddr()), newTestBzzPeer())
+	stream := NewID("SYNC", "1")
+
+	if _, ok, err := p.cursorLag(stream); err != nil || ok {
+		t.Fatalf("got ok %v, err %v without cursor, want no lag", ok, err)
+	}
+
+	p.setCursor(stream, 100)
+	if _, err := p.getOrCreateInterval(p.peerStreamIntervalKey(stream)); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		from, to uint64
+		lag      uint64
+	}{
+		{0, 0, 100}, // no intervals
+		{1, 10, 90},
+		{21, 30, 90}, // gap before the new interval
+		{11, 20, 70},
+		{31, 150, 0}, // synced beyond the cursor in the live stream
+	} {
+		if tc.to > 0 {
+			if err := p.addInterval(stream, tc.from, tc.to); err != nil {
+				t.Fatal(err)
+			}
+		}
+		lag, ok, err := p.cursorLag(stream)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ok {
+			t.Fatal("got no cursor")
+		}
+		if lag != tc.lag {
+			t.Fatalf("after interval [%v,%v]: got lag %v, want %v", tc.from, tc.to, lag, tc.lag)
+		}
+	}
+}
+
+func TestSetDisabledProviders(t *testing.T) {
+	r := New(state.NewInmemoryStore(), network.RandomBzzAddr(), &retryTestProvider{})
+	r.SetDisabledProviders([]string{"UNKNOWN"})
+	if r.getProvider(ID{Name: "RETRY"}) == nil {
+		t.Fatal("expected provider to be enabled")
+	}
+	r.SetDisabledProviders([]string{"RETRY", "UNKNOWN"})
+	if r.getProvider(ID{Name: "RETRY"}) != nil {
+		t.Fatal("expected provider to be disabled")
+	}
+}
+
+// TestMessageLimits checks that messages exceeding the registry message limits
+// are rejected before they are handled, so that the peer is dropped.
+func TestMessageLimits(t *testing.T) {
+	r := New(state.NewInmemoryStore(), network.RandomBzzAddr())
+	r.SetMessageLimits(MessageLimits{
+		MaxOfferedHashes:   4,
+		MaxDeliveredChunks: 2,
+		MaxBitVectorLength: 1,
+	})
+	handle := r.HandleMsg(newTestPeer(r, newTestBzzPeer()))
+
+	for _, tc := range []struct {
+		name     string
+		msg      interface{}
+		exceeded bool
+	}{
+		{
+			name:     "offered hashes over limit",
+			msg:      &OfferedHashes{Hashes: make([]byte, 5*HashSize)},
+			exceeded: true,
+		},
+		{
+			name: "offered hashes at limit",
+			msg:  &OfferedHashes{Hashes: make([]byte, 4*HashSize)},
+		},
+		{
+			name:     "offered hashes with a partial hash",
+			msg:      &OfferedHashes{Hashes: make([]byte, 4*HashSize+1)},
+			exceeded: true,
+		},
+		{
+			name:     "delivered chunks over limit",
+			msg:      &ChunkDelivery{Chunks: make([]DeliveredChunk, 3)},
+			exceeded: true,
+		},
+		{
+			name: "delivered chunks at limit",
+			msg:  &ChunkDelivery{Chunks: make([]DeliveredChunk, 2)},
+		},
+		{
+			name:     "wanted hashes bit vector over limit",
+			msg:      &WantedHashes{BitVector: make([]byte, 2)},
+			exceeded: true,
+		},
+		{
+			name: "wanted hashes bit vector at limit",
+			msg:  &WantedHashes{BitVector: make([]byte, 1)},
+		},
+		{
+			name:     "delivery ack bit vector over limit",
+			msg:      &DeliveryAck{BitVector: make([]byte, 2)},
+			exceeded: true,
+		},
+		{
+			name: "delivery ack bit vector at limit",
+			msg:  &DeliveryAck{BitVector: make([]byte, 1)},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			// messages within limits fail later as there are no
+			// open wants or offers, but not because of the limits
+			err := handle(context.Background(), tc.msg)
+			if got := errors.Is(err, ErrMessageLimitExceeded) || errors.Is(err, ErrInvalidOfferedHashes); got != tc.exceeded {
+				t.Fatalf("got error %v, want limit exceeded %v", err, tc.exceeded)
+			}
+		})
+	}
+}
+
+// TestMessageLimitsWire checks that the registry protocol spec rejects messages
+// over the message limits before they are decoded, dropping the peer.
+func TestMessageLimitsWire(t *testing.T) {
+	r := New(state.NewInmemoryStore(), network.RandomBzzAddr())
+	r.SetMessageLimits(MessageLimits{
+		MaxOfferedHashes:   4,
+		MaxDeliveredChunks: 2,
+		MaxBitVectorLength: 1,
+	})
+
+	handled := make(chan interface{}, 10)
+	run := func(p *p2p.Peer, rw p2p.MsgReadWriter) error {
+		return protocols.NewPeer(p, rw, r.Spec()).Run(func(_ context.Context, msg interface{}) error {
+			handled <- msg
+			return nil
+		})
+	}
+	prvkey, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tester := p2ptest.NewProtocolTester(prvkey, 1, run)
+	defer tester.Stop()
+	peerID := tester.Nodes[0].ID()
+	code, _ := Spec.GetCode(OfferedHashes{})
+
+	err = tester.TestExchanges(p2ptest.Exchange{
+		Label: "offered hashes at limit",
+		Triggers: []p2ptest.Trigger{
+			{
+				Code: code,
+				Msg:  &OfferedHashes{Hashes: make([]byte, 4*HashSize)},
+				Peer: peerID,
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-handled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for the message to be handled")
+	}
+
+	err = tester.TestExchanges(p2ptest.Exchange{
+		Label: "offered hashes over limit",
+		Triggers: []p2ptest.Trigger{
+			{
+				Code: code,
+				Msg:  &OfferedHashes{Hashes: make([]byte, 100*HashSize)},
+				Peer: peerID,
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tester.TestDisconnected(&p2ptest.Disconnect{Peer: peerID, Error: errors.New("subprotocol error")}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case msg := <-handled:
+		t.Fatalf("handled message %v over the limit", msg)
+	default:
+	}
+}
+
+// TestSetRetryParams checks that retry parameters which would not back off are rejected
+func TestSetRetryParams(t *testing.T) {
+	r := New(state.NewInmemoryStore(), network.RandomBzzAddr())
+	for _, tc := range []struct {
+		params RetryParams
+		valid  bool
+	}{
+		{params: DefaultRetryParams, valid: true},
+		{params: RetryParams{Interval: time.Millisecond, Exponent: 1}, valid: true},
+		{params: RetryParams{Interval: 0, Exponent: 2, MaxRetries: 3}},
+		{params: RetryParams{Interval: -time.Second, Exponent: 2, MaxRetries: 3}},
+		{params: RetryParams{Interval: time.Second, Exponent: 0, MaxRetries: 3}},
+		{params: RetryParams{Interval: time.Second, Exponent: 2, MaxRetries: -1}},
+	} {
+		err := r.SetRetryParams(tc.params)
+		if tc.valid && err != nil {
+			t.Errorf("got error %v for params %+v", err, tc.params)
+		}
+		if !tc.valid && err == nil {
+			t.Errorf("expected error for params %+v", tc.params)
+		}
+	}
+	if r.retry != (RetryParams{Interval: time.Millisecond, Exponent: 1}) {
+		t.Fatalf("got retry params %+v, want the last valid ones", r.retry)
+	}
+}
+
+// TestGetRangeRetry checks that a range whose batch times out is requested again
+// with a backoff, and that the interval is sealed without a gap when the retried
+// batch is delivered.
+func TestGetRangeRetry(t *testing.T) {
+	defer func(d time.Duration) { timeouts.SyncBatchTimeout = d }(timeouts.SyncBatchTimeout)
+	timeouts.SyncBatchTimeout = 100 * time.Millisecond
+
+	provider := &retryTestProvider{}
+	r := New(state.NewInmemoryStore(), network.RandomBzzAddr(), provider)
+	if err := r.SetRetryParams(RetryParams{
+		Interval:   10 * time.Millisecond,
+		Exponent:   2,
+		MaxRetries: 1,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// messages sent to the upstream peer are received on the other end of the pipe
+	rw1, rw2 := p2p.MsgPipe()
+	defer rw1.Close()
+	var id enode.ID
+	copy(id[:], network.RandomBzzAddr().Over())
+	p := newTestPeer(r, &network.BzzPeer{
+		Peer:    protocols.NewPeer(p2p.NewPeer(id, "test", nil), rw1, Spec),
+		BzzAddr: network.RandomBzzAddr(),
+	})
+	upstream := protocols.NewPeer(p2p.NewPeer(enode.ID{}, "upstream", nil), rw2, Spec)
+	received := make(chan interface{}, 10)
+	go upstream.Run(func(_ context.Context, msg interface{}) error {
+		received <- msg
+		return nil
+	})
+	receive := func() interface{} {
+		t.Helper()
+		select {
+		case msg := <-received:
+			return msg
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout waiting for message")
+		}
+		return nil
+	}
+
+	ctx := context.Background()
+	stream := NewID(provider.StreamName(), "1")
+	cursor := uint64(10)
+	p.setCursor(stream, cursor)
+	if _, err := p.getOrCreateInterval(p.peerStreamIntervalKey(stream)); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.clientRequestStreamRange(ctx, p, provider, stream, cursor); err != nil {
+		t.Fatal(err)
+	}
+
+	addrs := []chunk.Address{testutil.RandomBytes(1, HashSize), testutil.RandomBytes(2, HashSize)}
+	offered := func(ruid uint) *OfferedHashes {
+		return &OfferedHashes{
+			Ruid:      ruid,
+			LastIndex: cursor,
+			Hashes:    append(append([]byte{}, addrs[0]...), addrs[1]...),
+		}
+	}
+	handle := r.HandleMsg(p)
+
+	// the first batch is never delivered
+	first := receive().(*GetRange)
+	errc := make(chan error, 1)
+	go func() { errc <- handle(ctx, offered(first.Ruid)) }()
+	if _, ok := receive().(*WantedHashes); !ok {
+		t.Fatal("expected wanted hashes")
+	}
+
+	retried := receive().(*GetRange)
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+	if retried.Ruid == first.Ruid {
+		t.Fatal("expected a new ruid for the retried range")
+	}
+	if retried.From != first.From || retried.To == nil || *retried.To != cursor {
+		t.Fatalf("got retried range from %v to %v, want from %v to %v", retried.From, retried.To, first.From, cursor)
+	}
+
+	go func() { errc <- handle(ctx, offered(retried.Ruid)) }()
+	if _, ok := receive().(*WantedHashes); !ok {
+		t.Fatal("expected wanted hashes")
+	}
+	delivery := &ChunkDelivery{Ruid: retried.Ruid}
+	for _, addr := range addrs {
+		delivery.Chunks = append(delivery.Chunks, DeliveredChunk{Addr: addr, Data: []byte{1}})
+	}
+	if err := handle(ctx, delivery); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+
+	from, _, _, err := p.nextInterval(stream, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if from != cursor+1 {
+		t.Fatalf("got next interval start %v, want %v", from, cursor+1)
+	}
+}
+
+// TestDeliveryAckResend checks that the chunks of a delivery frame which the client
+// does not acknowledge are delivered again after the ack timeout, and that the batch
+// is completed once all chunks are acknowledged.
+func TestDeliveryAckResend(t *testing.T) {
+	ackTimeout := 200 * time.Millisecond
+	provider := &ackTestProvider{}
+	r := New(state.NewInmemoryStore(), network.RandomBzzAddr(), provider)
+	r.SetDeliveryAckTimeout(ackTimeout)
+	if err := r.EnableDeliveryAcks(capability.NewCapabilities()); err != nil {
+		t.Fatal(err)
+	}
+	p, receive, cleanup := newAckTestPeer(t, r)
+	defer cleanup()
+
+	// more chunks than fit in a single frame
+	n := MinFrameSize + 4
+	var hashes []byte
+	indices := make(map[string]int)
+	wanted, err := bv.New(n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < n; i++ {
+		addr := chunk.Address(testutil.RandomBytes(i, HashSize))
+		hashes = append(hashes, addr...)
+		indices[addr.Hex()] = i
+		wanted.Set(i)
+	}
+	ruid := uint(1)
+	p.openOffers[ruid] = offer{
+		ruid:      ruid,
+		stream:    NewID(provider.StreamName(), "1"),
+		hashes:    hashes,
+		requested: time.Now(),
+	}
+	ack := func(frames ...*ChunkDelivery) *DeliveryAck {
+		t.Helper()
+		acked, err := bv.New(n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, f := range frames {
+			for _, c := range f.Chunks {
+				acked.Set(indices[c.Addr.Hex()])
+			}
+		}
+		return &DeliveryAck{Ruid: ruid, BitVector: acked.Bytes()}
+	}
+
+	ctx := context.Background()
+	handle := r.HandleMsg(p)
+	// the handler returns once the chunks are delivered, without waiting for acknowledgements
+	if err := handle(ctx, &WantedHashes{Ruid: ruid, BitVector: wanted.Bytes()}); err != nil {
+		t.Fatal(err)
+	}
+
+	acked := receive().(*ChunkDelivery)
+	dropped := receive().(*ChunkDelivery)
+
+	// acknowledge only one frame, as if the other one was lost
+	start := time.Now()
+	if err := handle(ctx, ack(acked)); err != nil {
+		t.Fatal(err)
+	}
+	resent := receive().(*ChunkDelivery)
+	if d := time.Since(start); d < ackTimeout {
+		t.Fatalf("chunks resent after %v, before the ack timeout %v", d, ackTimeout)
+	}
+	if len(resent.Chunks) != len(dropped.Chunks) {
+		t.Fatalf("got %v resent chunks, want %v", len(resent.Chunks), len(dropped.Chunks))
+	}
+	for i, c := range resent.Chunks {
+		if !bytes.Equal(c.Addr, dropped.Chunks[i].Addr) {
+			t.Fatalf("got resent chunk %s, want %s", c.Addr, dropped.Chunks[i].Addr)
+		}
+	}
+
+	if err := handle(ctx, ack(acked, resent)); err != nil {
+		t.Fatal(err)
+	}
+	for start := time.Now(); ; time.Sleep(10 * time.Millisecond) {
+		if _, err := p.getOffer(ruid); err != nil {
+			break
+		}
+		if time.Since(start) > 5*time.Second {
+			t.Fatal("timeout waiting for the batch to complete")
+		}
+	}
+}
+
+// TestDeliveryAckClosedWant checks that with peers that acknowledge deliveries, chunks delivered
+// again for a recently closed want are ignored, while deliveries for other unknown wants, or for
+// wants closed before the last maxClosedWants ones, break the connection.
+func TestDeliveryAckClosedWant(t *testing.T) {
+	r := New(state.NewInmemoryStore(), network.RandomBzzAddr(), &ackTestProvider{})
+	if err := r.EnableDeliveryAcks(capability.NewCapabilities()); err != nil {
+		t.Fatal(err)
+	}
+	p, _, cleanup := newAckTestPeer(t, r)
+	defer cleanup()
+
+	delivery := func(ruid uint) *ChunkDelivery {
+		return &ChunkDelivery{
+			Ruid:   ruid,
+			Chunks: []DeliveredChunk{{Addr: testutil.RandomBytes(int(ruid), HashSize), Data: []byte("data")}},
+		}
+	}
+	if err := r.clientHandleChunkDelivery(context.Background(), p, delivery(1)); err == nil {
+		t.Fatal("expected error for a delivery of an unknown want, got nil")
+	}
+
+	for ruid := uint(1); ruid <= maxClosedWants+1; ruid++ {
+		p.closeWant(ruid)
+	}
+	if err := r.clientHandleChunkDelivery(context.Background(), p, delivery(maxClosedWants+1)); err != nil {
+		t.Fatalf("got error %v for a delivery of a closed want, want nil", err)
+	}
+	if err := r.clientHandleChunkDelivery(context.Background(), p, delivery(1)); err == nil {
+		t.Fatal("expected error for a delivery of a want closed before the last ones, got nil")
+	}
+}
+
+// TestDeliveryAckClient checks that the client acknowledges the stored chunks
+// of a batch and that chunks delivered again neither fail the batch nor are
+// counted again as recovered by a resync.
+func TestDeliveryAckClient(t *testing.T) {
+	provider := &ackTestProvider{}
+	r := New(state.NewInmemoryStore(), network.RandomBzzAddr(), provider)
+	if err := r.EnableDeliveryAcks(capability.NewCapabilities()); err != nil {
+		t.Fatal(err)
+	}
+	p, receive, cleanup := newAckTestPeer(t, r)
+	defer cleanup()
+
+	ctx := context.Background()
+	stream := NewID(provider.StreamName(), "1")
+	cursor := uint64(10)
+	p.setCursor(stream, cursor)
+	if _, err := p.getOrCreateInterval(p.peerStreamIntervalKey(stream)); err != nil {
+		t.Fatal(err)
+	}
+	rs := &resync{done: make(chan struct{})}
+	p.resyncs[stream.String()] = rs
+	if err := r.clientRequestStreamRange(ctx, p, provider, stream, cursor); err != nil {
+		t.Fatal(err)
+	}
+	ruid := receive().(*GetRange).Ruid
+
+	addrs := []chunk.Address{testutil.RandomBytes(1, HashSize), testutil.RandomBytes(2, HashSize)}
+	handle := r.HandleMsg(p)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- handle(ctx, &OfferedHashes{
+			Ruid:      ruid,
+			LastIndex: cursor,
+			Hashes:    append(append([]byte{}, addrs[0]...), addrs[1]...),
+		})
+	}()
+	if _, ok := receive().(*WantedHashes); !ok {
+		t.Fatal("expected wanted hashes")
+	}
+
+	deliver := func(want []bool, addrs ...chunk.Address) {
+		t.Helper()
+		delivery := &ChunkDelivery{Ruid: ruid}
+		for _, addr := range addrs {
+			delivery.Chunks = append(delivery.Chunks, DeliveredChunk{Addr: addr, Data: []byte{1}})
+		}
+		if err := handle(ctx, delivery); err != nil {
+			t.Fatal(err)
+		}
+		msg, ok := receive().(*DeliveryAck)
+		if !ok {
+			t.Fatal("expected delivery ack")
+		}
+		acked, err := bv.NewFromBytes(msg.BitVector, len(want))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, w := range want {
+			if acked.Get(i) != w {
+				t.Fatalf("got chunk %v acknowledged %v, want %v", i, acked.Get(i), w)
+			}
+		}
+	}
+	deliver([]bool{true, false}, addrs[0])
+	// the first chunk is delivered again, as if its acknowledgement was lost
+	deliver([]bool{true, true}, addrs[0], addrs[1])
+
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+	from, _, _, err := p.nextInterval(stream, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if from != cursor+1 {
+		t.Fatalf("got next interval start %v, want %v", from, cursor+1)
+	}
+	if got := atomic.LoadUint64(&rs.recovered); got != uint64(len(addrs)) {
+		t.Fatalf("got %v recovered chunks, want %v", got, len(addrs))
+	}
+}
+
+// TestResyncStream checks that a stream is requested again from the start even if its
+// intervals are already synced, that the chunks missing from the local store are counted
+// as recovered, and that resyncing a stream without missing chunks recovers none.
+func TestResyncStream(t *testing.T) {
+	provider := &retryTestProvider{}
+	r := New(state.NewInmemoryStore(), network.RandomBzzAddr(), provider)
+	p, receive, cleanup := newPipeTestPeer(t, r, network.RandomBzzAddr())
+	defer cleanup()
+
+	ctx := context.Background()
+	stream := NewID(provider.StreamName(), "1")
+	cursor := uint64(10)
+	p.setCursor(stream, cursor)
+	if _, err := p.getOrCreateInterval(p.peerStreamIntervalKey(stream)); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.addInterval(stream, 1, cursor); err != nil {
+		t.Fatal(err)
+	}
+	handle := r.HandleMsg(p)
+
+	resync := func(hashes []byte) int {
+		t.Helper()
+		type result struct {
+			recovered int
+			err       error
+		}
+		resc := make(chan result, 1)
+		go func() {
+			recovered, err := r.resyncStream(ctx, provider, stream)
+			resc <- result{recovered, err}
+		}()
+
+		get := receive().(*GetRange)
+		if get.From != 1 || get.To == nil || *get.To != cursor {
+			t.Fatalf("got range from %v to %v, want from 1 to %v", get.From, get.To, cursor)
+		}
+		errc := make(chan error, 1)
+		go func() {
+			errc <- handle(ctx, &OfferedHashes{
+				Ruid:      get.Ruid,
+				LastIndex: cursor,
+				Hashes:    hashes,
+			})
+		}()
+		if len(hashes) > 0 {
+			if _, ok := receive().(*WantedHashes); !ok {
+				t.Fatal("expected wanted hashes")
+			}
+			delivery := &ChunkDelivery{Ruid: get.Ruid}
+			for i := 0; i < len(hashes); i += HashSize {
+				delivery.Chunks = append(delivery.Chunks, DeliveredChunk{Addr: hashes[i : i+HashSize], Data: []byte{1}})
+			}
+			if err := handle(ctx, delivery); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := <-errc; err != nil {
+			t.Fatal(err)
+		}
+
+		select {
+		case res := <-resc:
+			if res.err != nil {
+				t.Fatal(res.err)
+			}
+			return res.recovered
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout waiting for resync")
+		}
+		return 0
+	}
+
+	hashes := append(testutil.RandomBytes(1, HashSize), testutil.RandomBytes(2, HashSize)...)
+	if got := resync(hashes); got != 2 {
+		t.Fatalf("got %v recovered chunks, want 2", got)
+	}
+	// the upstream peer offers no chunks as none are missing
+	if got := resync(nil); got != 0 {
+		t.Fatalf("got %v recovered chunks, want 0", got)
+	}
+
+	from, _, _, err := p.nextInterval(stream, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if from != cursor+1 {
+		t.Fatalf("got next interval start %v, want %v", from, cursor+1)
+	}
+}
+
+// TestResyncBinErrors checks that ResyncBin rejects bins over the max po
+// and fails if the registry has no sync stream provider.
+func TestResyncBinErrors(t *testing.T) {
+	r := New(state.NewInmemoryStore(), network.RandomBzzAddr(), &retryTestProvider{})
+	if _, err := r.ResyncBin(context.Background(), chunk.MaxPO+1); err == nil {
+		t.Fatal("expected error for bin over max po")
+	}
+	if _, err := r.ResyncBin(context.Background(), 1); err != ErrNoSyncProvider {
+		t.Fatalf("got error %v, want %v", err, ErrNoSyncProvider)
+	}
+}
+
+// newAckTestPeer returns a peer of the registry which supports delivery acknowledgements,
+// a function that receives the messages sent to the peer and a cleanup function
+func newAckTestPeer(t *testing.T, r *Registry) (*Peer, func() interface{}, func()) {
+	addr := network.RandomBzzAddr()
+	if err := setCapability(addr.Capabilities, capabilitiesDeliveryAck); err != nil {
+		t.Fatal(err)
+	}
+	p, receive, cleanup := newPipeTestPeer(t, r, addr)
+	if !p.deliveryAcks {
+		t.Fatal("expected delivery acks to be negotiated")
+	}
+	return p, receive, cleanup
+}
+
+// newPipeTestPeer returns a registered peer of the registry with the provided address,
+// a function that receives the messages sent to the peer and a cleanup function
+func newPipeTestPeer(t *testing.T, r *Registry, addr *network.BzzAddr) (*Peer, func() interface{}, func()) {
+	rw1, rw2 := p2p.MsgPipe()
+	var id enode.ID
+	copy(id[:], network.RandomBzzAddr().Over())
+	p := newTestPeer(r, &network.BzzPeer{
+		Peer:    protocols.NewPeer(p2p.NewPeer(id, "test", nil), rw1, Spec),
+		BzzAddr: addr,
+	})
+	r.addPeer(p)
+	remote := protocols.NewPeer(p2p.NewPeer(enode.ID{}, "remote", nil), rw2, Spec)
+	received := make(chan interface{}, 10)
+	go remote.Run(func(_ context.Context, msg interface{}) error {
+		received <- msg
+		return nil
+	})
+	receive := func() interface{} {
+		t.Helper()
+		select {
+		case msg := <-received:
+			return msg
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout waiting for message")
+		}
+		return nil
+	}
+	return p, receive, func() {
+		r.removePeer(p)
+		rw1.Close()
+	}
+}
+
+// ackTestProvider is a bounded stream provider that needs all offered chunks
+// and gets chunks with their address as data
+type ackTestProvider struct {
+	retryTestProvider
+}
+
+func (*ackTestProvider) Get(_ context.Context, addrs ...chunk.Address) ([]chunk.Chunk, error) {
+	chunks := make([]chunk.Chunk, len(addrs))
+	for i, addr := range addrs {
+		chunks[i] = chunk.NewChunk(addr, addr)
+	}
+	return chunks, nil
+}
+
+// retryTestProvider is a bounded stream provider that needs all offered chunks
+type retryTestProvider struct{}
+
+func (*retryTestProvider) NeedData(_ context.Context, addrs ...chunk.Address) ([]bool, error) {
+	need := make([]bool, len(addrs))
+	for i := range need {
+		need[i] = true
+	}
+	return need, nil
+}
+
+func (*retryTestProvider) Get(_ context.Context, _ ...chunk.Address) ([]chunk.Chunk, error) {
+	return nil, nil
+}
+
+func (*retryTestProvider) Put(_ context.Context, chs ...chunk.Chunk) ([]bool, error) {
+	return make([]bool, len(chs)), nil
+}
+
+func (*retryTestProvider) Set(_ context.Context, _ ...chunk.Address) error { return nil }
+
+func (*retryTestProvider) Subscribe(_ context.Context, _ interface{}, _, _ uint64) (<-chan chunk.Descriptor, func()) {
+	c := make(chan chunk.Descriptor)
+	close(c)
+	return c, func() {}
+}
+
+func (*retryTestProvider) Cursor(context.Context, string) (uint64, error) { return 0, nil }
+func (*retryTestProvider) InitPeer(*Peer)                                 {}
+func (*retryTestProvider) WantStream(*Peer, ID) bool                      { return true }
+func (*retryTestProvider) StreamName() string                             { return "RETRY" }
+func (*retryTestProvider) ParseKey(key string) (interface{}, error)       { return key, nil }
+func (*retryTestProvider) EncodeKey(key interface{}) (string, error) {
+	return key.(string), nil
+}
+func (*retryTestProvider) Autostart() bool   { return true }
+func (*retryTestProvider) Boundedness() bool { return true }
+func (*retryTestProvider) Close()            {}
+
+// newTestBzzPeer returns a BzzPeer with a random address that is not connected to any node
+func newTestBzzPeer() *network.BzzPeer {
+	var id enode.ID
+	copy(id[:], network.RandomBzzAddr().Over())
+	return &network.BzzPeer{
+		Peer:    protocols.NewPeer(p2p.NewPeer(id, "test", nil), nil, Spec),
+		BzzAddr: network.RandomBzzAddr(),
+	}
+}
+
+// newTestPeer returns a stream Peer of the registry for the provided BzzPeer
+func newTestPeer(r *Registry, bp *network.BzzPeer) *Peer {
+	p := newPeer(bp, r.address, r.intervalsStore, r.providers)
+	r.negotiate(p)
+	return p
+}
+
+// TestChunkProof checks that chunk proofs are served from the proof store,
+// that RequestChunkProof verifies them and that missing chunks are reported.
+func TestChunkProof(t *testing.T) {
+	store := storage.NewMapChunkStore()
+	ch := storage.GenerateRandomChunk(chunk.DefaultSize)
+	if _, err := store.Put(context.Background(), chunk.ModePutUpload, ch); err != nil {
+		t.Fatal(err)
+	}
+
+	server := New(state.NewInmemoryStore(), network.RandomBzzAddr())
+	if err := server.EnableChunkProofs(capability.NewCapabilities(), store); err != nil {
+		t.Fatal(err)
+	}
+	sp, serverReceive, serverCleanup := newPipeTestPeer(t, server, network.RandomBzzAddr())
+	defer serverCleanup()
+
+	addr := network.RandomBzzAddr()
+	if err := setCapability(addr.Capabilities, capabilitiesChunkProof); err != nil {
+		t.Fatal(err)
+	}
+	client := New(state.NewInmemoryStore(), network.RandomBzzAddr())
+	cp, clientReceive, clientCleanup := newPipeTestPeer(t, client, addr)
+	defer clientCleanup()
+	if !cp.chunkProofs {
+		t.Fatal("expected chunk proofs to be negotiated")
+	}
+
+	// relay the request of the client to the server and the proof back to the client
+	relay := func(ctx context.Context, tamper func(*ChunkProof)) {
+		req := clientReceive().(*ChunkProofRequest)
+		if err := server.HandleMsg(sp)(ctx, req); err != nil {
+			t.Error(err)
+			return
+		}
+		res := serverReceive().(*ChunkProof)
+		if tamper != nil {
+			tamper(res)
+		}
+		if err := client.HandleMsg(cp)(ctx, res); err != nil {
+			t.Error(err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	segment := 3
+	go relay(ctx, nil)
+	got, err := client.RequestChunkProof(ctx, cp.ID(), ch.Address(), segment)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := ch.Data()[8+segment*HashSize : 8+(segment+1)*HashSize]; !bytes.Equal(got, want) {
+		t.Fatalf("got segment %x, want %x", got, want)
+	}
+
+	go relay(ctx, func(res *ChunkProof) {
+		res.Segment[0]++
+	})
+	if _, err := client.RequestChunkProof(ctx, cp.ID(), ch.Address(), segment); err != ErrInvalidChunkProof {
+		t.Fatalf("got error %v, want %v", err, ErrInvalidChunkProof)
+	}
+
+	go relay(ctx, nil)
+	if _, err := client.RequestChunkProof(ctx, cp.ID(), testutil.RandomBytes(1, HashSize), segment); err != chunk.ErrChunkNotFound {
+		t.Fatalf("got error %v, want %v", err, chunk.ErrChunkNotFound)
+	}
+
+	if _, err := server.RequestChunkProof(ctx, sp.ID(), ch.Address(), segment); err != ErrChunkProofsNotSupported {
+		t.Fatalf("got error %v, want %v", err, ErrChunkProofsNotSupported)
+	}
+}
+
+// TestChunkProofRateLimit checks that a peer requesting chunk proofs faster
+// than they are served is dropped
+func TestChunkProofRateLimit(t *testing.T) {
+	store := storage.NewMapChunkStore()
+	ch := storage.GenerateRandomChunk(chunk.DefaultSize)
+	if _, err := store.Put(context.Background(), chunk.ModePutUpload, ch); err != nil {
+		t.Fatal(err)
+	}
+	r := New(state.NewInmemoryStore(), network.RandomBzzAddr())
+	if err := r.EnableChunkProofs(capability.NewCapabilities(), store); err != nil {
+		t.Fatal(err)
+	}
+	p, receive, cleanup := newPipeTestPeer(t, r, network.RandomBzzAddr())
+	defer cleanup()
+	p.proofLimiter = rate.NewLimiter(rate.Every(time.Hour), 1)
+
+	req := &ChunkProofRequest{Ruid: 1, Addr: ch.Address(), Segment: 0}
+	if err := r.serverHandleChunkProofRequest(context.Background(), p, req); err != nil {
+		t.Fatal(err)
+	}
+	if res, ok := receive().(*ChunkProof); !ok || res.Span == nil {
+		t.Fatalf("got message %#v, want a chunk proof", res)
+	}
+	req.Ruid = 2
+	if err := r.serverHandleChunkProofRequest(context.Background(), p, req); !errors.Is(err, ErrChunkProofRateExceeded) {
+		t.Fatalf("got error %v, want %v", err, ErrChunkProofRateExceeded)
+	}
+}
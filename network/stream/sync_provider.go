@@ -258,17 +258,17 @@ var putSeenTestHook func(addr chunk.Address, id enode.ID)
 func (s *syncProvider) Subscribe(ctx context.Context, key interface{}, from, to uint64) (<-chan chunk.Descriptor, func()) {
 	// convert the key to the actual value and call SubscribePull
 	bin := key.(uint8)
-	log.Debug("syncProvider.Subscribe", "bin", bin, "from", from, "to", to)
+	s.logger.Debug("syncProvider.Subscribe", "bin", bin, "from", from, "to", to)
 
 	return s.netStore.SubscribePull(ctx, bin, from, to)
 }
 
 // Cursor gets the cursor from the localstore for a given stream key
-func (s *syncProvider) Cursor(k string) (cursor uint64, err error) {
+func (s *syncProvider) Cursor(_ context.Context, k string) (cursor uint64, err error) {
 	key, err := s.ParseKey(k)
 	if err != nil {
 		// error parsing the stream key,
-		log.Error("error parsing the stream key", "key", k)
+		s.logger.Error("error parsing the stream key", "key", k)
 		return 0, err
 	}
 
@@ -50,8 +50,9 @@ type StreamProvider interface {
 	// Subscribe to a data stream from an arbitrary data source
 	Subscribe(ctx context.Context, key interface{}, from, to uint64) (<-chan chunk.Descriptor, func())
 
-	// Cursor returns the last known Cursor for a given Stream Key string
-	Cursor(string) (uint64, error)
+	// Cursor returns the last known Cursor for a given Stream Key string.
+	// The context allows cancelling the lookup in slow data sources
+	Cursor(ctx context.Context, key string) (uint64, error)
 
 	// InitPeer is a provider specific implementation on how to maintain running streams with
 	// an arbitrary Peer. This method should always be run in a separate goroutine
@@ -127,6 +128,31 @@ type ChunkDelivery struct {
 	Chunks []DeliveredChunk
 }
 
+// DeliveryAck is a message sent from the downstream peer to the upstream peer in response to a
+// ChunkDelivery message, if both peers support delivery acknowledgements. The BitVector has a bit
+// set for every chunk of the preceding OfferedHashes message that was successfully stored so far
+type DeliveryAck struct {
+	Ruid      uint
+	BitVector []byte
+}
+
+// ChunkProofRequest is a message sent to a peer that serves chunk proofs, asking for the BMT
+// inclusion proof of the segment with index Segment of the chunk with address Addr
+type ChunkProofRequest struct {
+	Ruid    uint
+	Addr    storage.Address
+	Segment uint
+}
+
+// ChunkProof is a message sent in response to a ChunkProofRequest with the span of the chunk,
+// the requested segment and its BMT inclusion proof. Span is empty if the chunk is not stored
+type ChunkProof struct {
+	Ruid    uint
+	Span    []byte
+	Segment []byte
+	Proof   [][]byte
+}
+
 // DeliveredChunk encapsulates a particular chunk's underlying data within a ChunkDelivery message
 type DeliveredChunk struct {
 	Addr storage.Address //chunk address
@@ -140,6 +166,14 @@ type StreamState struct {
 	Message string
 }
 
+// StreamState codes
+const (
+	StreamStateEnded       uint16 = iota // a bounded stream has no more data to offer
+	StreamStateUnsupported               // the stream is not provided by the server
+	StreamStateInvalidKey                // the stream key is not valid for the provider
+	StreamStateFailed                    // the server failed to serve the stream
+)
+
 // Stream defines a unique stream identifier in a textual representation
 type ID struct {
 	// Name is used for the Stream provider identification
@@ -25,3 +25,7 @@ var SyncBatchTimeout = 10 * time.Second
 // Within serverCollectBatch - If at least one chunk is added to the batch and no new chunks
 // are added in BatchTimeout period, the batch will be returned.
 var BatchTimeout = 2 * time.Second
+
+// DeliveryAckTimeout is the default time the upstream peer waits for a chunk delivery acknowledgement
+// from the downstream peer, after which the unacknowledged chunks of the batch are delivered again
+var DeliveryAckTimeout = 2 * time.Second
@@ -75,6 +75,10 @@ type Spec struct {
 	// MaxMsgSize is the maximum accepted length of the message payload
 	MaxMsgSize uint32
 
+	// MaxMsgSizes optionally sets lower maximum accepted payload lengths by message code,
+	// so that messages over them are rejected before they are decoded
+	MaxMsgSizes map[uint64]uint32
+
 	// Messages is a list of message data types which this protocol uses, with
 	// each message type being sent with its array index as the code (so
 	// [&foo{}, &bar{}, &baz{}] would send foo, bar and baz with codes
@@ -356,6 +360,9 @@ func (p *Peer) handleMsg(msg p2p.Msg, handle func(ctx context.Context, msg inter
 	if msg.Size > p.spec.MaxMsgSize {
 		return Break(fmt.Errorf("message too long: %v > %v", msg.Size, p.spec.MaxMsgSize))
 	}
+	if max, ok := p.spec.MaxMsgSizes[msg.Code]; ok && msg.Size > max {
+		return Break(fmt.Errorf("message too long: %v > %v (msg code %v)", msg.Size, max, msg.Code))
+	}
 
 	val, ok := p.spec.NewMsg(msg.Code)
 	if !ok {
@@ -394,6 +394,8 @@ func newProxServices(td *testData, allowRaw bool, handlerContextFuncs map[messag
 		params.MaxRetries = 1000
 		params.RetryExponent = 2
 		params.RetryInterval = 1000000
+		// the simulated nodes connect to more peers than MaxBinSize in a bin
+		params.BinFullPolicy = nil
 		kademlias[id] = network.NewKademlia(bzzkey, params)
 		return kademlias[id]
 	}
@@ -1524,6 +1524,8 @@ func newServices(allowRaw bool) map[string]simulation.ServiceFunc {
 		params.MaxRetries = 1000
 		params.RetryExponent = 2
 		params.RetryInterval = 1000000
+		// the simulated nodes connect to more peers than MaxBinSize in a bin
+		params.BinFullPolicy = nil
 		kademlias[id] = network.NewKademlia(bzzKey, params)
 		return kademlias[id]
 	}
@@ -33,6 +33,7 @@ import (
 	"github.com/syndtr/goleveldb/leveldb"
 	"github.com/syndtr/goleveldb/leveldb/iterator"
 	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/storage"
 )
 
 const (
@@ -59,6 +60,23 @@ func NewDB(path string, metricsPrefix string) (db *DB, err error) {
 	if err != nil {
 		return nil, err
 	}
+	return newDB(ldb, metricsPrefix)
+}
+
+// NewInmemoryDB constructs a new DB that keeps all data in memory,
+// which is lost when the DB is closed.
+// metricsPrefix is used for metrics collection for the given DB.
+func NewInmemoryDB(metricsPrefix string) (db *DB, err error) {
+	ldb, err := leveldb.Open(storage.NewMemStorage(), nil)
+	if err != nil {
+		return nil, err
+	}
+	return newDB(ldb, metricsPrefix)
+}
+
+// newDB constructs a new DB on the opened LevelDB and validates the schema
+// if it exists in the database.
+func newDB(ldb *leveldb.DB, metricsPrefix string) (db *DB, err error) {
 	db = &DB{
 		ldb: ldb,
 	}
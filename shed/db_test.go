@@ -46,6 +46,27 @@ func TestNewDB(t *testing.T) {
 	}
 }
 
+// TestNewInmemoryDB constructs a new in-memory DB
+// and validates if the schema is initialized properly.
+func TestNewInmemoryDB(t *testing.T) {
+	db, err := NewInmemoryDB("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	s, err := db.getSchema()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Fields) != 0 {
+		t.Errorf("got schema fields length %v, want %v", len(s.Fields), 0)
+	}
+	if len(s.Indexes) != 0 {
+		t.Errorf("got schema indexes length %v, want %v", len(s.Indexes), 0)
+	}
+}
+
 // TestDB_persistence creates one DB, saves a field and closes that DB.
 // Then, it constructs another DB and trues to retrieve the saved value.
 func TestDB_persistence(t *testing.T) {
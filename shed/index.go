@@ -43,6 +43,8 @@ type Item struct {
 	BinID           uint64
 	PinCounter      uint64 // maintains the no of time a chunk is pinned
 	Tag             uint32
+	ExpiryTimestamp int64  // time after which the chunk is removed, 0 if it does not expire
+	AccessCount     uint64 // number of requests for the chunk
 }
 
 // Merge is a helper method to construct a new
@@ -70,6 +72,12 @@ func (i Item) Merge(i2 Item) (new Item) {
 	if i.Tag == 0 {
 		i.Tag = i2.Tag
 	}
+	if i.ExpiryTimestamp == 0 {
+		i.ExpiryTimestamp = i2.ExpiryTimestamp
+	}
+	if i.AccessCount == 0 {
+		i.AccessCount = i2.AccessCount
+	}
 	return i
 }
 
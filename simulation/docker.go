@@ -9,6 +9,7 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/ethereum/go-ethereum/p2p"
@@ -28,6 +29,7 @@ const (
 	dockerWebsocketPort = 8546
 	dockerHTTPPort      = 8500
 	dockerPProfPort     = 6060
+	dockerDataDir       = "/data"
 )
 
 // DockerAdapter is an adapter that can manage DockerNodes
@@ -48,6 +50,12 @@ type DockerAdapterConfig struct {
 	DockerImage string `json:"image,omitempty"`
 	// DaemonAddr is the docker daemon address
 	DaemonAddr string `json:"daemonAddr,omitempty"`
+	// NetworkConditions is applied to every node's network interface if set.
+	// The docker image needs to provide the tc command.
+	NetworkConditions *NetworkConditions `json:"networkConditions,omitempty"`
+	// KeepData keeps the data volumes of the nodes when they are stopped.
+	// By default a volume is removed with its node, unless the node is restarted.
+	KeepData bool `json:"keepData,omitempty"`
 }
 
 // DockerBuildContext defines the build context to build
@@ -68,6 +76,9 @@ type DockerNode struct {
 	adapter *DockerAdapter
 	info    NodeInfo
 	ipAddr  string
+
+	blockedMu sync.Mutex
+	blocked   [][]string // iptables commands of the rules added by Block
 }
 
 // DefaultDockerAdapterConfig returns the default configuration
@@ -114,6 +125,12 @@ func NewDockerAdapter(config DockerAdapterConfig) (*DockerAdapter, error) {
 		return nil, errors.New("required: BuildContext or ExecutablePath")
 	}
 
+	if config.NetworkConditions != nil {
+		if err := config.NetworkConditions.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid network conditions: %v", err)
+		}
+	}
+
 	// Create docker client
 	cli, err := client.NewClientWithOpts(
 		client.WithHost(config.DaemonAddr),
@@ -183,11 +200,24 @@ func (n *DockerNode) Info() NodeInfo {
 
 // Start starts the node
 func (n *DockerNode) Start() error {
+	return n.start(!n.adapter.config.KeepData)
+}
+
+// Restart stops the node and starts it again with the same data volume
+func (n *DockerNode) Restart() error {
+	if err := n.stop(false); err != nil {
+		return err
+	}
+	return n.start(false)
+}
+
+// start starts the node, removing its data volume if it fails to start and removeData is true
+func (n *DockerNode) start(removeData bool) error {
 	var err error
 	defer func() {
 		if err != nil {
 			log.Error("Stopping node due to errors", "err", err)
-			if err := n.Stop(); err != nil {
+			if err := n.stop(removeData); err != nil {
 				log.Error("Failed stopping node", "err", err)
 			}
 		}
@@ -199,6 +229,9 @@ func (n *DockerNode) Start() error {
 	// Append user defined arguments
 	args = append(args, n.config.Args...)
 
+	// Configure data directory, stored in a volume so that it survives a node restart
+	args = append(args, "--datadir", dockerDataDir)
+
 	// Append network ports arguments
 	args = append(args, "--pprofport", strconv.Itoa(dockerPProfPort))
 	args = append(args, "--bzzport", strconv.Itoa(dockerHTTPPort))
@@ -215,11 +248,18 @@ func (n *DockerNode) Start() error {
 	ctx := context.Background()
 	dockercli := n.adapter.client
 
+	// tc and iptables need to be able to change the network settings
+	// in order to apply network conditions and partitions
+	hostConfig := &container.HostConfig{
+		CapAdd: []string{"NET_ADMIN"},
+		Binds:  []string{n.volumeName() + ":" + dockerDataDir},
+	}
+
 	resp, err := dockercli.ContainerCreate(ctx, &container.Config{
 		Image: n.adapter.image,
 		Cmd:   args,
 		Env:   n.config.Env,
-	}, &container.HostConfig{}, nil, n.containerName())
+	}, hostConfig, nil, n.containerName())
 	if err != nil {
 		return fmt.Errorf("failed to create container %s: %v", n.containerName(), err)
 	}
@@ -228,6 +268,12 @@ func (n *DockerNode) Start() error {
 		return fmt.Errorf("failed to start container %s: %v", n.containerName(), err)
 	}
 
+	if nc := n.adapter.config.NetworkConditions; nc != nil {
+		if err = n.exec(ctx, nc.tcCommand("eth0")); err != nil {
+			return fmt.Errorf("failed to apply network conditions to container %s: %v", n.containerName(), err)
+		}
+	}
+
 	// Get container logs
 	if n.config.Stderr != nil {
 		go func() {
@@ -311,8 +357,13 @@ func (n *DockerNode) Start() error {
 	return nil
 }
 
-// Stop stops the node
+// Stop stops the node and removes its data volume, unless the adapter is configured to keep it
 func (n *DockerNode) Stop() error {
+	return n.stop(!n.adapter.config.KeepData)
+}
+
+// stop stops and removes the node's container, and its data volume if removeData is true
+func (n *DockerNode) stop(removeData bool) error {
 	cli := n.adapter.client
 
 	var stopTimeout = 30 * time.Second
@@ -325,9 +376,63 @@ func (n *DockerNode) Stop() error {
 	if err != nil {
 		return fmt.Errorf("failed to remove container %s : %v", n.containerName(), err)
 	}
+
+	if removeData {
+		err = cli.VolumeRemove(context.Background(), n.volumeName(), false)
+		if err != nil {
+			return fmt.Errorf("failed to remove volume %s : %v", n.volumeName(), err)
+		}
+	}
+	return nil
+}
+
+// Block drops all network traffic between the node and the given nodes.
+// The docker image needs to provide the iptables command.
+func (n *DockerNode) Block(nodes []Node) error {
+	ctx := context.Background()
+	n.blockedMu.Lock()
+	defer n.blockedMu.Unlock()
+	for _, node := range nodes {
+		ip, err := nodeIP(node)
+		if err != nil {
+			return err
+		}
+		for _, cmd := range iptablesBlockCommands("-A", ip) {
+			if err := n.exec(ctx, cmd); err != nil {
+				return fmt.Errorf("failed to block traffic with %s on container %s: %v", ip, n.containerName(), err)
+			}
+			// record every added rule, so that Unblock deletes it even if the other one failed
+			n.blocked = append(n.blocked, cmd)
+		}
+	}
+	return nil
+}
+
+// Unblock deletes the iptables rules added by Block, leaving any other rules in place
+func (n *DockerNode) Unblock() error {
+	ctx := context.Background()
+	n.blockedMu.Lock()
+	defer n.blockedMu.Unlock()
+	for len(n.blocked) > 0 {
+		rule := n.blocked[0]
+		cmd := append([]string{"iptables", "-D"}, rule[2:]...)
+		if err := n.exec(ctx, cmd); err != nil {
+			return fmt.Errorf("failed to unblock traffic on container %s: %v", n.containerName(), err)
+		}
+		n.blocked = n.blocked[1:]
+	}
 	return nil
 }
 
+// iptablesBlockCommands returns the iptables commands which drop the traffic from and to the ip,
+// with the action -A to add the rules or -D to delete them
+func iptablesBlockCommands(action, ip string) [][]string {
+	return [][]string{
+		{"iptables", action, "INPUT", "-s", ip, "-j", "DROP"},
+		{"iptables", action, "OUTPUT", "-d", ip, "-j", "DROP"},
+	}
+}
+
 // Snapshot returns a snapshot of the node
 func (n *DockerNode) Snapshot() (NodeSnapshot, error) {
 	snap := NodeSnapshot{
@@ -342,6 +447,39 @@ func (n *DockerNode) containerName() string {
 	return fmt.Sprintf("sim-docker-%s", n.config.ID)
 }
 
+// exec runs the command in the node's container and waits for it to finish
+func (n *DockerNode) exec(ctx context.Context, cmd []string) error {
+	cli := n.adapter.client
+	execResp, err := cli.ContainerExecCreate(ctx, n.containerName(), types.ExecConfig{
+		Cmd: cmd,
+	})
+	if err != nil {
+		return err
+	}
+	if err := cli.ContainerExecStart(ctx, execResp.ID, types.ExecStartCheck{}); err != nil {
+		return err
+	}
+	for start := time.Now(); time.Since(start) < 10*time.Second; time.Sleep(50 * time.Millisecond) {
+		inspect, err := cli.ContainerExecInspect(ctx, execResp.ID)
+		if err != nil {
+			return err
+		}
+		if inspect.Running {
+			continue
+		}
+		if inspect.ExitCode != 0 {
+			return fmt.Errorf("command %v exited with code %d", cmd, inspect.ExitCode)
+		}
+		return nil
+	}
+	return fmt.Errorf("timeout waiting for command %v", cmd)
+}
+
+// volumeName is the name of the docker volume holding the node's data directory
+func (n *DockerNode) volumeName() string {
+	return fmt.Sprintf("%s-data", n.containerName())
+}
+
 func (n *DockerNode) rpcClient() (*rpc.Client, error) {
 	var client *rpc.Client
 	var err error
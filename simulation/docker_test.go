@@ -2,6 +2,11 @@ package simulation
 
 import (
 	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
 	"testing"
 
 	"github.com/docker/docker/api/types"
@@ -49,6 +54,84 @@ func TestDockerAdapterBuild(t *testing.T) {
 	}
 }
 
+// TestDockerNodeStop validates that a stopped node's data volume is removed,
+// unless the adapter keeps it or the node is restarted.
+func TestDockerNodeStop(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		requests []string
+	)
+	// fake docker daemon recording the requests without the api version prefix
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := r.URL.Path
+		if i := strings.Index(path[1:], "/"); strings.HasPrefix(path, "/v") && i >= 0 {
+			path = path[i+1:]
+		}
+		mu.Lock()
+		requests = append(requests, r.Method+" "+path)
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	cli, err := client.NewClientWithOpts(client.WithHost("tcp://" + srv.Listener.Addr().String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+
+	stopRequests := []string{
+		"POST /containers/sim-docker-node/stop",
+		"DELETE /containers/sim-docker-node",
+	}
+	for _, tc := range []struct {
+		name     string
+		keepData bool
+		stop     func(n *DockerNode) error
+		expected []string
+	}{
+		{
+			name:     "stop",
+			stop:     (*DockerNode).Stop,
+			expected: append(stopRequests, "DELETE /volumes/sim-docker-node-data"),
+		},
+		{
+			name:     "keep data",
+			keepData: true,
+			stop:     (*DockerNode).Stop,
+			expected: stopRequests,
+		},
+		{
+			name: "restart",
+			stop: func(n *DockerNode) error {
+				return n.stop(false)
+			},
+			expected: stopRequests,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			mu.Lock()
+			requests = nil
+			mu.Unlock()
+
+			adapter := DockerAdapter{
+				client: cli,
+				config: DockerAdapterConfig{KeepData: tc.keepData},
+			}
+			node := adapter.NewNode(NodeConfig{ID: "node"}).(*DockerNode)
+			if err := tc.stop(node); err != nil {
+				t.Fatal(err)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if !reflect.DeepEqual(requests, tc.expected) {
+				t.Fatalf("got requests %v, want %v", requests, tc.expected)
+			}
+		})
+	}
+}
+
 // Create docker client
 func dockerClient() (*client.Client, error) {
 	return client.NewClientWithOpts(
@@ -1,12 +1,14 @@
 package cluster
 
 import (
+	"context"
 	"encoding/json"
 	"flag"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/holisticode/swarm/internal/build"
 	"github.com/holisticode/swarm/simulation"
@@ -14,7 +16,9 @@ import (
 )
 
 var (
-	nodes = flag.Int("nodes", 20, "number of nodes to create")
+	nodes         = flag.Int("nodes", 20, "number of nodes to create")
+	healthTimeout = flag.Duration("health-timeout", 5*time.Minute, "time to wait for a healthy network")
+	keySeed       = flag.Int64("key-seed", 0, "seed of the node keys to reproduce a topology, random keys if 0")
 )
 
 func init() {
@@ -89,6 +93,9 @@ func TestCluster(t *testing.T) {
 
 func startSimulation(t *testing.T, adapter simulation.Adapter, count int) {
 	sim := simulation.NewSimulation(adapter)
+	if *keySeed != 0 {
+		sim.SetKeySeed(*keySeed)
+	}
 
 	defer sim.StopAll()
 
@@ -104,7 +111,9 @@ func startSimulation(t *testing.T, adapter simulation.Adapter, count int) {
 	}
 
 	// Wait for all nodes to be considered healthy
-	err = sim.WaitForHealthyNetwork()
+	ctx, cancel := context.WithTimeout(context.Background(), *healthTimeout)
+	defer cancel()
+	err = sim.WaitForHealthyNetworkContext(ctx)
 	if err != nil {
 		t.Errorf("Failed to get healthy network: %v", err)
 	}
@@ -25,6 +25,10 @@ type ExecAdapterConfig struct {
 	ExecutablePath string `json:"executable"`
 	// BaseDataDirectory stores all the nodes' data directories
 	BaseDataDirectory string `json:"basedir"`
+	// NetworkConditions is not supported by the exec adapter, as all nodes share
+	// the host network interfaces. Setting it makes NewExecAdapter fail with
+	// ErrNetworkConditionsNotSupported.
+	NetworkConditions *NetworkConditions `json:"networkConditions,omitempty"`
 }
 
 // ExecNode is a node that is executed locally
@@ -46,6 +50,10 @@ func NewExecAdapter(config ExecAdapterConfig) (*ExecAdapter, error) {
 		return nil, fmt.Errorf("'%s' executable does not exist", config.ExecutablePath)
 	}
 
+	if config.NetworkConditions != nil {
+		return nil, fmt.Errorf("exec adapter: %w, use the docker or kubernetes adapter", ErrNetworkConditionsNotSupported)
+	}
+
 	absExec, err := filepath.Abs(config.ExecutablePath)
 	if err != nil {
 		return nil, fmt.Errorf("could not get absolute path for %s: %v", config.ExecutablePath, err)
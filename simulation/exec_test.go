@@ -2,9 +2,11 @@ package simulation
 
 import (
 	"encoding/hex"
+	"errors"
 	"io/ioutil"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/ethereum/go-ethereum/crypto"
 )
@@ -92,3 +94,20 @@ func TestExecAdapter(t *testing.T) {
 		t.Fatalf("node didn't stop: %v", err)
 	}
 }
+
+func TestExecAdapterNetworkConditions(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "test-adapter-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	_, err = NewExecAdapter(ExecAdapterConfig{
+		ExecutablePath:    os.Args[0],
+		BaseDataDirectory: tmpdir,
+		NetworkConditions: &NetworkConditions{Latency: 10 * time.Millisecond},
+	})
+	if !errors.Is(err, ErrNetworkConditionsNotSupported) {
+		t.Fatalf("expected %v, got %v", ErrNetworkConditionsNotSupported, err)
+	}
+}
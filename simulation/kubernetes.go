@@ -28,6 +28,7 @@ import (
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
@@ -52,8 +53,20 @@ type KubernetesAdapterConfig struct {
 	// DockerImage points to an existing docker image
 	// e.g. holisticode/swarm:latest
 	DockerImage string `json:"image,omitempty"`
+	// NetworkConditions is applied to every pod's network interface if set.
+	// The docker image needs to provide the tc command.
+	NetworkConditions *NetworkConditions `json:"networkConditions,omitempty"`
+	// DataVolumeSize is the size of the persistent volume claimed for every
+	// pod's data directory, e.g. 1Gi. The default is kubernetesDataVolumeSize.
+	DataVolumeSize string `json:"dataVolumeSize,omitempty"`
+	// KeepData keeps the data volume claims of the nodes when they are stopped.
+	// By default a claim is deleted with its node, unless the node is restarted.
+	KeepData bool `json:"keepData,omitempty"`
 }
 
+// kubernetesDataVolumeSize is the default size of the volume holding a pod's data directory
+const kubernetesDataVolumeSize = "1Gi"
+
 // KubernetesBuildContext defines the build context to build
 // local docker images
 type KubernetesBuildContext struct {
@@ -105,10 +118,22 @@ func NewKubernetesAdapter(config KubernetesAdapterConfig) (*KubernetesAdapter, e
 			config.BuildContext, config.DockerImage)
 	}
 
+	if config.DataVolumeSize != "" {
+		if _, err := resource.ParseQuantity(config.DataVolumeSize); err != nil {
+			return nil, fmt.Errorf("invalid data volume size %q: %v", config.DataVolumeSize, err)
+		}
+	}
+
 	if config.DockerImage == "" && config.BuildContext == nil {
 		return nil, errors.New("required: Dockerfile or DockerImage")
 	}
 
+	if config.NetworkConditions != nil {
+		if err := config.NetworkConditions.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid network conditions: %v", err)
+		}
+	}
+
 	// Define k8s client configuration
 	k8scfg, err := clientcmd.BuildConfigFromFlags("", config.KubeConfigPath)
 	if err != nil {
@@ -239,6 +264,9 @@ func (n *KubernetesNode) Start() error {
 	// Append user defined arguments
 	args = append(args, n.config.Args...)
 
+	// Configure data directory, stored in a persistent volume so that it survives a node restart
+	args = append(args, "--datadir", dockerDataDir)
+
 	// Append network ports arguments
 	args = append(args, "--pprofport", strconv.Itoa(dockerPProfPort))
 	args = append(args, "--bzzport", strconv.Itoa(dockerHTTPPort))
@@ -278,31 +306,14 @@ func (n *KubernetesNode) Start() error {
 
 	adapter := n.adapter
 
-	// Create Kubernetes Pod
-	podRequest := &v1.Pod{
-		ObjectMeta: metav1.ObjectMeta{
-			Name: n.podName(),
-			Labels: map[string]string{
-				"app": "simulation",
-			},
-		},
-		Spec: v1.PodSpec{
-			Containers: []v1.Container{
-				{
-					Name:  n.podName(),
-					Image: adapter.image,
-					Args:  args,
-					Env:   env,
-					Resources: v1.ResourceRequirements{
-						Limits: v1.ResourceList{
-							v1.ResourceMemory: resource.MustParse("400Mi"),
-						},
-					},
-				},
-			},
-		},
+	// Claim the data volume, it already exists if the node is restarted
+	_, err := adapter.client.CoreV1().PersistentVolumeClaims(adapter.config.Namespace).Create(n.dataVolumeClaim())
+	if err != nil && !apierrors.IsAlreadyExists(err) {
+		return fmt.Errorf("failed to create persistent volume claim: %v", err)
 	}
-	pod, err := adapter.client.CoreV1().Pods(adapter.config.Namespace).Create(podRequest)
+
+	// Create Kubernetes Pod
+	pod, err := adapter.client.CoreV1().Pods(adapter.config.Namespace).Create(n.podRequest(args, env))
 	if err != nil {
 		return fmt.Errorf("failed to create pod: %v", err)
 	}
@@ -386,8 +397,33 @@ func (n *KubernetesNode) Start() error {
 	return nil
 }
 
-// Stop stops the node
+// Stop stops the node and deletes its data volume claim, unless the adapter is configured to keep it
 func (n *KubernetesNode) Stop() error {
+	return n.stop(!n.adapter.config.KeepData)
+}
+
+// Restart stops the node and starts it again with the same data volume claim
+func (n *KubernetesNode) Restart() error {
+	if err := n.stop(false); err != nil {
+		return err
+	}
+
+	// the pod is recreated with the same name, so wait until the old one is gone
+	adapter := n.adapter
+	for start := time.Now(); ; time.Sleep(500 * time.Millisecond) {
+		_, err := adapter.client.CoreV1().Pods(adapter.config.Namespace).Get(n.podName(), metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			break
+		}
+		if time.Since(start) > 5*time.Minute {
+			return errors.New("timeout waiting for pod deletion")
+		}
+	}
+	return n.Start()
+}
+
+// stop deletes the node's pod, and its data volume claim if removeData is true
+func (n *KubernetesNode) stop(removeData bool) error {
 	adapter := n.adapter
 
 	gracePeriod := int64(30)
@@ -399,6 +435,13 @@ func (n *KubernetesNode) Stop() error {
 	if err != nil {
 		return fmt.Errorf("could not delete pod: %v", err)
 	}
+
+	if removeData {
+		err = adapter.client.CoreV1().PersistentVolumeClaims(adapter.config.Namespace).Delete(n.dataVolumeClaimName(), &metav1.DeleteOptions{})
+		if err != nil {
+			return fmt.Errorf("could not delete persistent volume claim: %v", err)
+		}
+	}
 	return nil
 }
 
@@ -416,6 +459,96 @@ func (n *KubernetesNode) podName() string {
 	return fmt.Sprintf("sim-k8s-%s", n.config.ID)
 }
 
+// podRequest returns the pod running the node with the arguments and environment,
+// with the node's data volume claim mounted on the data directory
+func (n *KubernetesNode) podRequest(args []string, env []v1.EnvVar) *v1.Pod {
+	podRequest := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: n.podName(),
+			Labels: map[string]string{
+				"app": "simulation",
+			},
+		},
+		Spec: v1.PodSpec{
+			Containers: []v1.Container{
+				{
+					Name:  n.podName(),
+					Image: n.adapter.image,
+					Args:  args,
+					Env:   env,
+					Resources: v1.ResourceRequirements{
+						Limits: v1.ResourceList{
+							v1.ResourceMemory: resource.MustParse("400Mi"),
+						},
+					},
+					VolumeMounts: []v1.VolumeMount{
+						{
+							Name:      "data",
+							MountPath: dockerDataDir,
+						},
+					},
+				},
+			},
+			Volumes: []v1.Volume{
+				{
+					Name: "data",
+					VolumeSource: v1.VolumeSource{
+						PersistentVolumeClaim: &v1.PersistentVolumeClaimVolumeSource{
+							ClaimName: n.dataVolumeClaimName(),
+						},
+					},
+				},
+			},
+		},
+	}
+	if nc := n.adapter.config.NetworkConditions; nc != nil {
+		// containers in a pod share the network namespace, so the
+		// network conditions can be applied once by an init container
+		podRequest.Spec.InitContainers = []v1.Container{
+			{
+				Name:    n.podName() + "-netem",
+				Image:   n.adapter.image,
+				Command: nc.tcCommand("eth0"),
+				SecurityContext: &v1.SecurityContext{
+					Capabilities: &v1.Capabilities{
+						Add: []v1.Capability{"NET_ADMIN"},
+					},
+				},
+			},
+		}
+	}
+	return podRequest
+}
+
+// dataVolumeClaim returns the persistent volume claim of the node's data directory
+func (n *KubernetesNode) dataVolumeClaim() *v1.PersistentVolumeClaim {
+	size := n.adapter.config.DataVolumeSize
+	if size == "" {
+		size = kubernetesDataVolumeSize
+	}
+	return &v1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: n.dataVolumeClaimName(),
+			Labels: map[string]string{
+				"app": "simulation",
+			},
+		},
+		Spec: v1.PersistentVolumeClaimSpec{
+			AccessModes: []v1.PersistentVolumeAccessMode{v1.ReadWriteOnce},
+			Resources: v1.ResourceRequirements{
+				Requests: v1.ResourceList{
+					v1.ResourceStorage: resource.MustParse(size),
+				},
+			},
+		},
+	}
+}
+
+// dataVolumeClaimName is the name of the persistent volume claim of the node's data directory
+func (n *KubernetesNode) dataVolumeClaimName() string {
+	return fmt.Sprintf("%s-data", n.podName())
+}
+
 func homeDir() string {
 	if h := os.Getenv("HOME"); h != "" {
 		return h
@@ -0,0 +1,37 @@
+package simulation
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// TestKubernetesNodeDataVolume validates that the pod of a node
+// mounts the data volume claim on the data directory.
+func TestKubernetesNodeDataVolume(t *testing.T) {
+	adapter := KubernetesAdapter{
+		config: KubernetesAdapterConfig{DataVolumeSize: "2Gi"},
+	}
+	node := adapter.NewNode(NodeConfig{ID: "node"}).(*KubernetesNode)
+
+	claim := node.dataVolumeClaim()
+	if claim.Name != "sim-k8s-node-data" {
+		t.Fatalf("got claim name %s, want sim-k8s-node-data", claim.Name)
+	}
+	if size := claim.Spec.Resources.Requests["storage"]; size.Cmp(resource.MustParse("2Gi")) != 0 {
+		t.Fatalf("got claim size %s, want 2Gi", size.String())
+	}
+
+	pod := node.podRequest(nil, nil)
+	if len(pod.Spec.Volumes) != 1 {
+		t.Fatalf("got %d volumes, want 1", len(pod.Spec.Volumes))
+	}
+	volume := pod.Spec.Volumes[0]
+	if volume.PersistentVolumeClaim == nil || volume.PersistentVolumeClaim.ClaimName != claim.Name {
+		t.Fatalf("got volume %+v, want claim %s", volume, claim.Name)
+	}
+	mounts := pod.Spec.Containers[0].VolumeMounts
+	if len(mounts) != 1 || mounts[0].Name != volume.Name || mounts[0].MountPath != dockerDataDir {
+		t.Fatalf("got volume mounts %+v, want %s on %s", mounts, volume.Name, dockerDataDir)
+	}
+}
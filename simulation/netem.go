@@ -0,0 +1,52 @@
+package simulation
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrNetworkConditionsNotSupported is returned by adapters which can not apply network conditions.
+// Only the Docker and Kubernetes adapters support them.
+var ErrNetworkConditionsNotSupported = errors.New("network conditions are not supported by the adapter")
+
+// NetworkConditions describes a degraded network between the nodes of a simulation.
+// It is applied on the network interface of each node with tc/netem, so it is only
+// supported by the Docker and Kubernetes adapters, whose nodes have their own interfaces.
+type NetworkConditions struct {
+	// Latency is the delay added to every outgoing packet
+	Latency time.Duration `json:"latency,omitempty"`
+	// Jitter is the random variation of the latency
+	Jitter time.Duration `json:"jitter,omitempty"`
+	// Loss is the percentage (0-100) of outgoing packets that are dropped
+	Loss float64 `json:"loss,omitempty"`
+}
+
+// Validate checks that the network conditions have sensible values
+func (c *NetworkConditions) Validate() error {
+	if c.Latency < 0 || c.Jitter < 0 {
+		return errors.New("latency and jitter must not be negative")
+	}
+	if c.Jitter > 0 && c.Latency == 0 {
+		return errors.New("jitter requires a latency")
+	}
+	if c.Loss < 0 || c.Loss > 100 {
+		return fmt.Errorf("loss must be a percentage between 0 and 100, got %v", c.Loss)
+	}
+	return nil
+}
+
+// tcCommand returns the tc command which applies the network conditions on the given network device
+func (c *NetworkConditions) tcCommand(dev string) []string {
+	cmd := []string{"tc", "qdisc", "add", "dev", dev, "root", "netem"}
+	if c.Latency > 0 {
+		cmd = append(cmd, "delay", fmt.Sprintf("%dms", c.Latency.Milliseconds()))
+		if c.Jitter > 0 {
+			cmd = append(cmd, fmt.Sprintf("%dms", c.Jitter.Milliseconds()))
+		}
+	}
+	if c.Loss > 0 {
+		cmd = append(cmd, "loss", fmt.Sprintf("%v%%", c.Loss))
+	}
+	return cmd
+}
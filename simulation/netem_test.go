@@ -0,0 +1,32 @@
+package simulation
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNetworkConditionsTCCommand(t *testing.T) {
+	nc := &NetworkConditions{
+		Latency: 100 * time.Millisecond,
+		Jitter:  10 * time.Millisecond,
+		Loss:    1,
+	}
+	if err := nc.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"tc", "qdisc", "add", "dev", "eth0", "root", "netem", "delay", "100ms", "10ms", "loss", "1%"}
+	if cmd := nc.tcCommand("eth0"); !reflect.DeepEqual(cmd, expected) {
+		t.Fatalf("expected %v, got %v", expected, cmd)
+	}
+
+	for _, invalid := range []*NetworkConditions{
+		{Latency: -time.Millisecond},
+		{Jitter: time.Millisecond},
+		{Loss: 101},
+	} {
+		if err := invalid.Validate(); err == nil {
+			t.Fatalf("expected error for %+v", invalid)
+		}
+	}
+}
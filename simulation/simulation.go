@@ -2,6 +2,7 @@ package simulation
 
 import (
 	"context"
+	"encoding/binary"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
@@ -9,6 +10,7 @@ import (
 	"io/ioutil"
 	"os"
 	"reflect"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -16,6 +18,7 @@ import (
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/enode"
 	"github.com/ethereum/go-ethereum/rpc"
 	"github.com/holisticode/swarm/log"
 	"github.com/holisticode/swarm/network"
@@ -60,6 +63,11 @@ func (nm *nodeMap) Store(key NodeID, value Node) {
 type Simulation struct {
 	adapter Adapter
 	nodes   *nodeMap
+
+	partitionMu sync.Mutex
+	partitioned []BlockableNode // nodes with blocked connectivity, unblocked by Heal
+
+	keySeed *int64 // seed of the node keys, random keys are used if nil
 }
 
 // NewSimulation creates a new simulation given an adapter
@@ -293,6 +301,28 @@ func (s *Simulation) Stop(id NodeID) error {
 	return nil
 }
 
+// RestartNode stops a node by ID and starts it again with the same arguments
+// and data directory.
+func (s *Simulation) RestartNode(id NodeID) error {
+	node, ok := s.nodes.Load(id)
+	if !ok {
+		return fmt.Errorf("a node with id %s does not exist", id)
+	}
+
+	if node, ok := node.(RestartableNode); ok {
+		if err := node.Restart(); err != nil {
+			return fmt.Errorf("could not restart node: %v", err)
+		}
+		return nil
+	}
+
+	// nodes which keep their data directory when stopped are restarted by stopping and starting them
+	if err := s.Stop(id); err != nil {
+		return err
+	}
+	return s.Start(id)
+}
+
 // StartAll starts all nodes
 func (s *Simulation) StartAll() error {
 	g, _ := errgroup.WithContext(context.Background())
@@ -311,6 +341,96 @@ func (s *Simulation) StopAll() error {
 	return g.Wait()
 }
 
+// ErrPartitionNotSupported is returned by Partition if a node does not support network partitions.
+// Only the nodes of the Docker adapter support them.
+var ErrPartitionNotSupported = errors.New("network partitions are not supported by the node adapter")
+
+// Partition splits the network in two groups of nodes which can not reach each other.
+// Existing connections between the groups are dropped. Connectivity is restored with Heal.
+// The nodes need to be BlockableNodes, otherwise ErrPartitionNotSupported is returned.
+// Only the Docker adapter supports partitions; the exec and Kubernetes adapters do not.
+func (s *Simulation) Partition(groupA, groupB []NodeID) error {
+	a, err := s.blockableNodes(groupA)
+	if err != nil {
+		return err
+	}
+	b, err := s.blockableNodes(groupB)
+	if err != nil {
+		return err
+	}
+
+	s.partitionMu.Lock()
+	defer s.partitionMu.Unlock()
+
+	block := func(nodes []BlockableNode, others []BlockableNode) error {
+		o := make([]Node, len(others))
+		for i, n := range others {
+			o[i] = n
+		}
+		for _, n := range nodes {
+			s.partitioned = append(s.partitioned, n)
+			if err := n.Block(o); err != nil {
+				return fmt.Errorf("could not partition node %s: %v", n.Info().ID, err)
+			}
+			if err := s.disconnect(n, others); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := block(a, b); err != nil {
+		return err
+	}
+	return block(b, a)
+}
+
+// Heal restores the connectivity between the nodes that were partitioned with Partition
+func (s *Simulation) Heal() error {
+	s.partitionMu.Lock()
+	defer s.partitionMu.Unlock()
+
+	for len(s.partitioned) > 0 {
+		n := s.partitioned[0]
+		if err := n.Unblock(); err != nil {
+			return fmt.Errorf("could not heal node %s: %v", n.Info().ID, err)
+		}
+		s.partitioned = s.partitioned[1:]
+	}
+	return nil
+}
+
+// blockableNodes returns the nodes with the given ids, failing if any of them doesn't support partitions
+func (s *Simulation) blockableNodes(ids []NodeID) ([]BlockableNode, error) {
+	nodes := make([]BlockableNode, len(ids))
+	for i, id := range ids {
+		node, err := s.Get(id)
+		if err != nil {
+			return nil, err
+		}
+		bn, ok := node.(BlockableNode)
+		if !ok {
+			return nil, fmt.Errorf("node %s: %w", id, ErrPartitionNotSupported)
+		}
+		nodes[i] = bn
+	}
+	return nodes, nil
+}
+
+// disconnect drops the connections of the node to the given peers
+func (s *Simulation) disconnect(node Node, peers []BlockableNode) error {
+	client, err := s.RPCClient(node.Info().ID)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	for _, p := range peers {
+		if err := client.Call(nil, "admin_removePeer", p.Info().Enode); err != nil {
+			return fmt.Errorf("could not disconnect node %s from %s: %v", node.Info().ID, p.Info().ID, err)
+		}
+	}
+	return nil
+}
+
 // RPCClient returns an RPC Client for a given node
 func (s *Simulation) RPCClient(id NodeID) (*rpc.Client, error) {
 	node, ok := s.nodes.Load(id)
@@ -399,6 +519,14 @@ func (s *Simulation) Snapshot() (*Snapshot, error) {
 	return &snap, nil
 }
 
+// SetKeySeed makes the keys of the nodes added with AddNode, and thus their
+// overlay addresses, derived from the seed and the node id, so that a
+// simulation can be re-run with the same topology.
+// It must be called before the nodes are added.
+func (s *Simulation) SetKeySeed(seed int64) {
+	s.keySeed = &seed
+}
+
 // AddBootnode adds and starts a bootnode with the given id and arguments
 func (s *Simulation) AddBootnode(id NodeID, args []string) (Node, error) {
 	a := []string{
@@ -411,11 +539,7 @@ func (s *Simulation) AddBootnode(id NodeID, args []string) (Node, error) {
 
 // AddNode adds and starts a node with the given id and arguments
 func (s *Simulation) AddNode(id NodeID, args []string) (Node, error) {
-	bzzkey, err := randomHexKey()
-	if err != nil {
-		return nil, err
-	}
-	nodekey, err := randomHexKey()
+	bzzkey, nodekey, err := s.nodeKeys(id)
 	if err != nil {
 		return nil, err
 	}
@@ -508,9 +632,67 @@ func (s *Simulation) CreateClusterWithBootnode(idPrefix string, count int, args
 	return nodes, nil
 }
 
+// CollectMetrics retrieves the values of the requested counters and gauges from every node.
+// Nodes which fail to report their metrics are omitted from the result and
+// listed in the returned error, so the partial result can still be used.
+func (s *Simulation) CollectMetrics(names []string) (map[NodeID]map[string]float64, error) {
+	var res struct {
+		metrics map[NodeID]map[string]float64
+		failed  []string
+		mu      sync.Mutex
+	}
+	res.metrics = make(map[NodeID]map[string]float64)
+
+	var wg sync.WaitGroup
+	for _, node := range s.GetAll() {
+		id := node.Info().ID
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			m, err := s.nodeMetrics(id, names)
+			res.mu.Lock()
+			defer res.mu.Unlock()
+			if err != nil {
+				log.Warn("Failed to collect metrics", "node", id, "err", err)
+				res.failed = append(res.failed, fmt.Sprintf("%s (%v)", id, err))
+				return
+			}
+			res.metrics[id] = m
+		}()
+	}
+	wg.Wait()
+
+	if len(res.failed) > 0 {
+		return res.metrics, fmt.Errorf("failed to collect metrics from nodes: %s", strings.Join(res.failed, ", "))
+	}
+	return res.metrics, nil
+}
+
+func (s *Simulation) nodeMetrics(id NodeID, names []string) (map[string]float64, error) {
+	client, err := s.RPCClient(id)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	var m map[string]float64
+	if err := client.Call(&m, "bzz_metrics", names); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 // WaitForHealthyNetwork will block until all the nodes are considered
 // to have a healthy kademlia table
 func (s *Simulation) WaitForHealthyNetwork() error {
+	return s.WaitForHealthyNetworkContext(context.Background())
+}
+
+// WaitForHealthyNetworkContext will block until all the nodes are considered
+// to have a healthy kademlia table or until the context is done.
+// In the latter case the returned error reports the depth and the known and
+// connected neighbour counts of every node which is not healthy.
+func (s *Simulation) WaitForHealthyNetworkContext(ctx context.Context) error {
 	nodes := s.GetAll()
 
 	// Generate RPC clients
@@ -520,7 +702,7 @@ func (s *Simulation) WaitForHealthyNetwork() error {
 	}
 	clients.RPC = make([]*rpc.Client, len(nodes))
 
-	g, _ := errgroup.WithContext(context.Background())
+	g, _ := errgroup.WithContext(ctx)
 
 	for idx, node := range nodes {
 		node := node
@@ -560,33 +742,90 @@ func (s *Simulation) WaitForHealthyNetwork() error {
 
 	// Check for healthInfo on all nodes
 	for {
-		g, _ = errgroup.WithContext(context.Background())
-		for i := 0; i < len(nodes)-1; i++ {
+		var unhealthy struct {
+			nodes []string
+			mu    sync.Mutex
+		}
+		var wg sync.WaitGroup
+		for i := range nodes {
 			i := i
-			g.Go(func() error {
-				log.Debug("Checking hive_getHealthInfo", "node", nodes[i].Info().ID)
-				healthy := &network.Health{}
-				if err := clients.RPC[i].Call(&healthy, "hive_getHealthInfo", ppmap[nodes[i].Info().BzzAddr[2:]]); err != nil {
-					return err
-				}
-				if !healthy.Healthy() {
-					return fmt.Errorf("node %s is not healthy: known <%v> ; connected <%v>", nodes[i].Info().ID, healthy.CountKnowNN, healthy.CountConnectNN)
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if err := nodeHealth(ctx, clients.RPC[i], nodes[i], ppmap[nodes[i].Info().BzzAddr[2:]]); err != nil {
+					unhealthy.mu.Lock()
+					unhealthy.nodes = append(unhealthy.nodes, err.Error())
+					unhealthy.mu.Unlock()
 				}
-				return nil
-			})
+			}()
 		}
-		err := g.Wait()
-		if err == nil {
+		wg.Wait()
+		if len(unhealthy.nodes) == 0 {
 			break
 		}
-		log.Info("Not healthy yet...", "msg", err.Error())
-		time.Sleep(500 * time.Millisecond)
+		log.Info("Not healthy yet...", "msg", strings.Join(unhealthy.nodes, "; "))
+		select {
+		case <-ctx.Done():
+			sort.Strings(unhealthy.nodes)
+			return fmt.Errorf("network is not healthy: %v: %s", ctx.Err(), strings.Join(unhealthy.nodes, "; "))
+		case <-time.After(500 * time.Millisecond):
+		}
 	}
 
 	log.Info("Healthy kademlia on all nodes")
 	return nil
 }
 
+// nodeHealth returns an error describing the kademlia table of the node
+// if it is not healthy in regard to the provided PeerPot.
+func nodeHealth(ctx context.Context, client *rpc.Client, node Node, pp *network.PeerPot) error {
+	id := node.Info().ID
+	log.Debug("Checking hive_getHealthInfo", "node", id)
+	healthy := &network.Health{}
+	if err := client.CallContext(ctx, &healthy, "hive_getHealthInfo", pp); err != nil {
+		return fmt.Errorf("node %s: could not get health info: %v", id, err)
+	}
+	if healthy.Healthy() {
+		return nil
+	}
+	var depth int
+	if err := client.CallContext(ctx, &depth, "hive_neighbourhoodDepth"); err != nil {
+		return fmt.Errorf("node %s: could not get depth: %v", id, err)
+	}
+	return fmt.Errorf("node %s is not healthy: depth <%v> ; known <%v/%v> ; connected <%v/%v> ; saturated <%v>", id, depth, healthy.CountKnowNN, len(pp.NNSet), healthy.CountConnectNN, len(pp.NNSet), healthy.Saturated)
+}
+
+// nodeKeys returns the hex encoded bzz and node private keys for the node with the given id
+func (s *Simulation) nodeKeys(id NodeID) (bzzkey, nodekey string, err error) {
+	if s.keySeed != nil {
+		return seededHexKey(*s.keySeed, id, "bzz"), seededHexKey(*s.keySeed, id, "node"), nil
+	}
+	bzzkey, err = randomHexKey()
+	if err != nil {
+		return "", "", err
+	}
+	nodekey, err = randomHexKey()
+	if err != nil {
+		return "", "", err
+	}
+	return bzzkey, nodekey, nil
+}
+
+// seededHexKey derives a private key from the seed, the node id and the name of the key
+func seededHexKey(seed int64, id NodeID, name string) string {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(seed))
+	h := crypto.Keccak256(b, []byte(id), []byte(name))
+	for {
+		// rehash in the unlikely case the hash is not a valid private key
+		key, err := crypto.ToECDSA(h)
+		if err == nil {
+			return hex.EncodeToString(crypto.FromECDSA(key))
+		}
+		h = crypto.Keccak256(h)
+	}
+}
+
 func randomHexKey() (string, error) {
 	key, err := crypto.GenerateKey()
 	if err != nil {
@@ -596,6 +835,15 @@ func randomHexKey() (string, error) {
 	return keyhex, nil
 }
 
+// nodeIP returns the IP address of the node from its enode
+func nodeIP(node Node) (string, error) {
+	n, err := enode.ParseV4(node.Info().Enode)
+	if err != nil {
+		return "", fmt.Errorf("could not parse enode of node %s: %v", node.Info().ID, err)
+	}
+	return n.IP().String(), nil
+}
+
 func removeNetworkAddressFromEnode(enode string) string {
 	if idx := strings.Index(enode, "@"); idx != -1 {
 		return enode[:idx]
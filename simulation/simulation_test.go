@@ -0,0 +1,153 @@
+package simulation
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestSimulationKeySeed(t *testing.T) {
+	sim := NewSimulation(nil)
+	sim.SetKeySeed(42)
+
+	bzzkey, nodekey, err := sim.nodeKeys("node-0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bzzkey == nodekey {
+		t.Fatal("expected different bzz and node keys")
+	}
+
+	other := NewSimulation(nil)
+	other.SetKeySeed(42)
+	bzzkey2, nodekey2, err := other.nodeKeys("node-0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bzzkey != bzzkey2 || nodekey != nodekey2 {
+		t.Fatal("expected the same keys for the same seed and node id")
+	}
+
+	bzzkey3, _, err := other.nodeKeys("node-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bzzkey == bzzkey3 {
+		t.Fatal("expected different keys for different node ids")
+	}
+
+	other.SetKeySeed(43)
+	bzzkey4, _, err := other.nodeKeys("node-0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bzzkey == bzzkey4 {
+		t.Fatal("expected different keys for different seeds")
+	}
+}
+
+// testNode is a node that is never started, used to test the simulation bookkeeping
+type testNode struct {
+	id NodeID
+}
+
+func (n *testNode) Info() NodeInfo                  { return NodeInfo{ID: n.id} }
+func (n *testNode) Start() error                    { return nil }
+func (n *testNode) Stop() error                     { return nil }
+func (n *testNode) Snapshot() (NodeSnapshot, error) { return NodeSnapshot{}, nil }
+
+// testBlockableNode is a testNode recording the number of Unblock calls
+type testBlockableNode struct {
+	testNode
+	unblocks   int
+	unblockErr error
+}
+
+func (n *testBlockableNode) Block(nodes []Node) error { return nil }
+func (n *testBlockableNode) Unblock() error {
+	n.unblocks++
+	return n.unblockErr
+}
+
+// testRestartableNode is a testNode recording the number of Stop and Restart calls
+type testRestartableNode struct {
+	testNode
+	stops    int
+	restarts int
+}
+
+func (n *testRestartableNode) Stop() error {
+	n.stops++
+	return nil
+}
+
+func (n *testRestartableNode) Restart() error {
+	n.restarts++
+	return nil
+}
+
+func TestRestartNode(t *testing.T) {
+	sim := NewSimulation(nil)
+	node := &testRestartableNode{testNode: testNode{id: "a"}}
+	sim.nodes.Store("a", node)
+
+	if err := sim.RestartNode("a"); err != nil {
+		t.Fatal(err)
+	}
+	// the node is restarted without being stopped, which would remove its data
+	if node.restarts != 1 || node.stops != 0 {
+		t.Fatalf("got %d restarts and %d stops, want 1 and 0", node.restarts, node.stops)
+	}
+
+	if err := sim.RestartNode("b"); err == nil {
+		t.Fatal("expected an error restarting an unknown node")
+	}
+}
+
+func TestPartitionNotSupported(t *testing.T) {
+	sim := NewSimulation(nil)
+	sim.nodes.Store("a", &testNode{id: "a"})
+	sim.nodes.Store("b", &testBlockableNode{testNode: testNode{id: "b"}})
+
+	if err := sim.Partition([]NodeID{"a"}, []NodeID{"b"}); !errors.Is(err, ErrPartitionNotSupported) {
+		t.Fatalf("got error %v, want %v", err, ErrPartitionNotSupported)
+	}
+	if len(sim.partitioned) != 0 {
+		t.Fatalf("got %d partitioned nodes, want none", len(sim.partitioned))
+	}
+}
+
+func TestHeal(t *testing.T) {
+	sim := NewSimulation(nil)
+	a := &testBlockableNode{testNode: testNode{id: "a"}}
+	b := &testBlockableNode{testNode: testNode{id: "b"}, unblockErr: errors.New("unblock failed")}
+	sim.partitioned = []BlockableNode{a, b}
+
+	if err := sim.Heal(); err == nil {
+		t.Fatal("expected an error")
+	}
+	if a.unblocks != 1 || b.unblocks != 1 {
+		t.Fatalf("got unblocks %d and %d, want 1 and 1", a.unblocks, b.unblocks)
+	}
+	// the node that failed to unblock is healed on the next call
+	b.unblockErr = nil
+	if err := sim.Heal(); err != nil {
+		t.Fatal(err)
+	}
+	if a.unblocks != 1 || b.unblocks != 2 {
+		t.Fatalf("got unblocks %d and %d, want 1 and 2", a.unblocks, b.unblocks)
+	}
+	if len(sim.partitioned) != 0 {
+		t.Fatalf("got %d partitioned nodes, want none", len(sim.partitioned))
+	}
+}
+
+func TestIptablesBlockCommands(t *testing.T) {
+	expected := [][]string{
+		{"iptables", "-A", "INPUT", "-s", "10.0.0.2", "-j", "DROP"},
+		{"iptables", "-A", "OUTPUT", "-d", "10.0.0.2", "-j", "DROP"},
+	}
+	if cmds := iptablesBlockCommands("-A", "10.0.0.2"); !reflect.DeepEqual(cmds, expected) {
+		t.Fatalf("expected %v, got %v", expected, cmds)
+	}
+}
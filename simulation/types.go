@@ -15,6 +15,23 @@ type Node interface {
 	Snapshot() (NodeSnapshot, error)
 }
 
+// BlockableNode is a node whose network connectivity to other nodes can be blocked.
+// Only DockerNode implements it, so Partition is only supported by the Docker adapter.
+type BlockableNode interface {
+	Node
+	// Block blocks all network traffic between the node and the given nodes
+	Block(nodes []Node) error
+	// Unblock removes the network traffic blocks added by Block, leaving other rules in place
+	Unblock() error
+}
+
+// RestartableNode is a node that can be restarted without losing its data directory
+type RestartableNode interface {
+	Node
+	// Restart stops the node and starts it again with the same data directory
+	Restart() error
+}
+
 // Adapter can handle Node creation
 type Adapter interface {
 	// NewNode creates a new node based on the NodeConfig
@@ -0,0 +1,89 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package storage
+
+import (
+	"encoding/binary"
+	"sync"
+)
+
+const (
+	// number of filter bits per expected chunk
+	bloomBitsPerItem = 10
+	// number of bits set for each chunk, giving a false positive rate of
+	// about 1% with bloomBitsPerItem bits per chunk
+	bloomHashes = 7
+)
+
+// addressFilter is a bloom filter of chunk addresses.
+// As chunk addresses are hashes, the bit positions are derived
+// from the address bytes directly, with no further hashing.
+type addressFilter struct {
+	mu   sync.RWMutex
+	bits []uint64
+	m    uint64 // number of bits in the filter
+}
+
+// newAddressFilter creates an addressFilter sized for the expected number of chunks
+func newAddressFilter(items uint64) *addressFilter {
+	words := (items*bloomBitsPerItem + 63) / 64
+	if words == 0 {
+		words = 1
+	}
+	return &addressFilter{
+		bits: make([]uint64, words),
+		m:    words * 64,
+	}
+}
+
+// Add adds the addresses to the filter
+func (f *addressFilter) Add(addrs ...Address) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, addr := range addrs {
+		h1, h2 := addressHashes(addr)
+		for i := uint64(0); i < bloomHashes; i++ {
+			pos := (h1 + i*h2) % f.m
+			f.bits[pos/64] |= 1 << (pos % 64)
+		}
+	}
+}
+
+// Contains returns false if the address was definitely not added to the filter,
+// and true if it may have been
+func (f *addressFilter) Contains(addr Address) bool {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	h1, h2 := addressHashes(addr)
+	for i := uint64(0); i < bloomHashes; i++ {
+		pos := (h1 + i*h2) % f.m
+		if f.bits[pos/64]&(1<<(pos%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// addressHashes returns the two hashes of an address used for double hashing
+func addressHashes(addr Address) (h1, h2 uint64) {
+	var b [16]byte
+	copy(b[:], addr)
+	// h2 is never zero, so that an address sets more than one bit
+	return binary.BigEndian.Uint64(b[:8]), binary.BigEndian.Uint64(b[8:]) | 1
+}
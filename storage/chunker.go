@@ -348,7 +348,10 @@ func (tc *TreeChunker) runWorker(ctx context.Context) {
 
 				h, err := tc.putter.Put(ctx, job.chunk)
 				if err != nil {
-					tc.errC <- err
+					select {
+					case tc.errC <- err:
+					case <-tc.quitC:
+					}
 					return
 				}
 				copy(job.key, h)
@@ -447,6 +450,9 @@ func (r *LazyChunkReader) ReadAt(b []byte, off int64) (read int, err error) {
 		log.Debug("lazychunkreader.readat.size", "size", size, "err", err)
 		return 0, err
 	}
+	if off >= size {
+		return 0, io.EOF
+	}
 
 	errC := make(chan error)
 
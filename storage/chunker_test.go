@@ -23,7 +23,9 @@ import (
 	"fmt"
 	"io"
 	"testing"
+	"time"
 
+	"github.com/holisticode/swarm/bmt"
 	"github.com/holisticode/swarm/chunk"
 	"github.com/holisticode/swarm/testutil"
 	"golang.org/x/crypto/sha3"
@@ -259,6 +261,21 @@ func TestRandomData(t *testing.T) {
 	}
 }
 
+// TestRefBMTHash checks that content split with the reference BMT implementation
+// gets the same address as with the BMT hasher
+func TestRefBMTHash(t *testing.T) {
+	sizes := []int{1, 60, 4095, 4096, 4097, 8192, 12289, 524288 + 4097}
+	tester := &chunkerTester{t: t}
+
+	for _, s := range sizes {
+		bmtAddress := testRandomData(true, BMTHash, s, tester)
+		refAddress := testRandomData(true, RefBMTHash, s, tester)
+		if bmtAddress.String() != refAddress.String() {
+			tester.t.Fatalf("bmt and reference bmt key mismatch for size %v\n BMT: %v\n REF: %v\n", s, bmtAddress.String(), refAddress.String())
+		}
+	}
+}
+
 func TestRandomBrokenData(t *testing.T) {
 	sizes := []int{1, 60, 83, 179, 253, 1024, 4095, 4096, 4097, 8191, 8192, 8193, 12287, 12288, 12289, 123456, 2345678}
 	tester := &chunkerTester{t: t}
@@ -469,3 +486,24 @@ func BenchmarkSplitAppendPyramid_7(t *testing.B)  { benchmarkSplitAppendPyramid(
 
 // go test -timeout 20m -cpu 4 -bench=./swarm/storage -run no
 // If you dont add the timeout argument above .. the benchmark will timeout and dump
+
+// TestTreeSplitClosedPool checks that splitting fails with bmt.ErrPoolClosed
+// if the tree pool of the BMT hashers is closed
+func TestTreeSplitClosedPool(t *testing.T) {
+	pool := bmt.NewTreePool(sha3.NewLegacyKeccak256, chunk.DefaultSize/sha3.NewLegacyKeccak256().Size(), bmt.PoolSize)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := pool.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	hashFunc := func() SwarmHash {
+		return bmt.New(pool)
+	}
+	putGetter := NewHasherStore(NewMapChunkStore(), hashFunc, false, chunk.NewTag(0, "test-tag", 0, false))
+
+	n := 3 * chunk.DefaultSize
+	_, _, err := TreeSplit(context.Background(), testutil.RandomReader(1, n), int64(n), putGetter)
+	if err != bmt.ErrPoolClosed {
+		t.Fatalf("got error %v, want %v", err, bmt.ErrPoolClosed)
+	}
+}
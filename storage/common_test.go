@@ -53,23 +53,25 @@ func brokenLimitReader(data io.Reader, size int, errAt int) *brokenLimitedReader
 }
 
 func mputRandomChunks(store ChunkStore, n int) ([]Chunk, error) {
-	return mput(store, n, GenerateRandomChunk)
+	return mput(store, n, 0, GenerateRandomChunk)
 }
 
-func mput(store ChunkStore, n int, f func(i int64) Chunk) (hs []Chunk, err error) {
+// mput puts n chunks generated by f to the store, with at most
+// concurrency puts in flight; concurrency <= 0 means no limit.
+func mput(store ChunkStore, n int, concurrency int, f func(i int64) Chunk) (hs []Chunk, err error) {
 	// put to localstore and wait for stored channel
 	// does not check delivery error state
-	errc := make(chan error)
+	errc := make(chan error, n)
 	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Minute)
 	defer cancel()
+	sem := newSemaphore(concurrency)
 	for i := int64(0); i < int64(n); i++ {
 		ch := f(chunk.DefaultSize)
+		sem.acquire()
 		go func() {
+			defer sem.release()
 			_, err := store.Put(ctx, chunk.ModePutUpload, ch)
-			select {
-			case errc <- err:
-			case <-ctx.Done():
-			}
+			errc <- err
 		}()
 		hs = append(hs, ch)
 	}
@@ -84,14 +86,19 @@ func mput(store ChunkStore, n int, f func(i int64) Chunk) (hs []Chunk, err error
 	return hs, nil
 }
 
-func mget(store ChunkStore, hs []Address, f func(h Address, chunk Chunk) error) error {
+// mget gets the chunks with addresses hs from the store, with at most
+// concurrency gets in flight; concurrency <= 0 means no limit.
+func mget(store ChunkStore, hs []Address, concurrency int, f func(h Address, chunk Chunk) error) error {
 	wg := sync.WaitGroup{}
 	wg.Add(len(hs))
-	errc := make(chan error)
+	errc := make(chan error, len(hs))
 
+	sem := newSemaphore(concurrency)
 	for _, k := range hs {
+		sem.acquire()
 		go func(h Address) {
 			defer wg.Done()
+			defer sem.release()
 			// TODO: write timeout with context
 			ch, err := store.Get(context.TODO(), chunk.ModeGetRequest, h)
 			if err != nil {
@@ -121,6 +128,29 @@ func mget(store ChunkStore, hs []Address, f func(h Address, chunk Chunk) error)
 	return err
 }
 
+// semaphore bounds the number of concurrent store calls in mput and mget.
+// A nil semaphore does not limit concurrency.
+type semaphore chan struct{}
+
+func newSemaphore(concurrency int) semaphore {
+	if concurrency <= 0 {
+		return nil
+	}
+	return make(semaphore, concurrency)
+}
+
+func (s semaphore) acquire() {
+	if s != nil {
+		s <- struct{}{}
+	}
+}
+
+func (s semaphore) release() {
+	if s != nil {
+		<-s
+	}
+}
+
 func (r *brokenLimitedReader) Read(buf []byte) (int, error) {
 	if r.off+len(buf) > r.errAt {
 		return 0, fmt.Errorf("Broken reader")
@@ -134,7 +164,7 @@ func testStoreRandom(m ChunkStore, n int, t *testing.T) {
 	if err != nil {
 		t.Fatalf("expected no error, got %v", err)
 	}
-	err = mget(m, chunkAddresses(chunks), nil)
+	err = mget(m, chunkAddresses(chunks), 0, nil)
 	if err != nil {
 		t.Fatalf("testStore failed: %v", err)
 	}
@@ -149,18 +179,12 @@ func testStoreCorrect(m ChunkStore, n int, t *testing.T) {
 		if !bytes.Equal(h, chunk.Address()) {
 			return fmt.Errorf("key does not match retrieved chunk Address")
 		}
-		hasher := MakeHashFunc(DefaultHash)()
-		data := chunk.Data()
-		hasher.Reset()
-		hasher.SetSpanBytes(data[:8])
-		hasher.Write(data[8:])
-		exp := hasher.Sum(nil)
-		if !bytes.Equal(h, exp) {
-			return fmt.Errorf("key is not hash of chunk data")
+		if err := ValidateChunk(chunk); err != nil {
+			return fmt.Errorf("key is not hash of chunk data: %v", err)
 		}
 		return nil
 	}
-	err = mget(m, chunkAddresses(chunks), f)
+	err = mget(m, chunkAddresses(chunks), 0, f)
 	if err != nil {
 		t.Fatalf("testStore failed: %v", err)
 	}
@@ -176,7 +200,7 @@ func benchmarkStorePut(store ChunkStore, n int, b *testing.B) {
 		return chunk
 	}
 
-	mput(store, n, f)
+	mput(store, n, 0, f)
 
 	f = func(dataSize int64) Chunk {
 		chunk := chunks[i]
@@ -189,110 +213,33 @@ func benchmarkStorePut(store ChunkStore, n int, b *testing.B) {
 
 	for j := 0; j < b.N; j++ {
 		i = 0
-		mput(store, n, f)
+		mput(store, n, 0, f)
 	}
 }
 
 func benchmarkStoreGet(store ChunkStore, n int, b *testing.B) {
+	benchmarkStoreGetConcurrency(store, n, 0, b)
+}
+
+// benchmarkStoreGetConcurrency measures the throughput of getting n chunks
+// from the store with at most concurrency gets in flight.
+func benchmarkStoreGetConcurrency(store ChunkStore, n int, concurrency int, b *testing.B) {
 	chunks, err := mputRandomChunks(store, n)
 	if err != nil {
 		b.Fatalf("expected no error, got %v", err)
 	}
 	b.ReportAllocs()
+	b.SetBytes(int64(n) * chunk.DefaultSize)
 	b.ResetTimer()
 	addrs := chunkAddresses(chunks)
 	for i := 0; i < b.N; i++ {
-		err := mget(store, addrs, nil)
+		err := mget(store, addrs, concurrency, nil)
 		if err != nil {
 			b.Fatalf("mget failed: %v", err)
 		}
 	}
 }
 
-// MapChunkStore is a very simple ChunkStore implementation to store chunks in a map in memory.
-type MapChunkStore struct {
-	chunks map[string]Chunk
-	mu     sync.RWMutex
-}
-
-func NewMapChunkStore() *MapChunkStore {
-	return &MapChunkStore{
-		chunks: make(map[string]Chunk),
-	}
-}
-
-func (m *MapChunkStore) Put(_ context.Context, _ chunk.ModePut, chs ...Chunk) ([]bool, error) {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-
-	exist := make([]bool, len(chs))
-	for i, ch := range chs {
-		addr := ch.Address().Hex()
-		_, exist[i] = m.chunks[addr]
-		m.chunks[addr] = ch
-	}
-	return exist, nil
-}
-
-func (m *MapChunkStore) Get(_ context.Context, _ chunk.ModeGet, ref Address) (Chunk, error) {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
-	chunk := m.chunks[ref.Hex()]
-	if chunk == nil {
-		return nil, ErrChunkNotFound
-	}
-	return chunk, nil
-}
-
-func (m *MapChunkStore) GetMulti(_ context.Context, _ chunk.ModeGet, refs ...Address) (chunks []Chunk, err error) {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
-	for _, ref := range refs {
-		chunk := m.chunks[ref.Hex()]
-		if chunk == nil {
-			return nil, ErrChunkNotFound
-		}
-		chunks = append(chunks, chunk)
-	}
-	return chunks, nil
-}
-
-// Need to implement Has from SyncChunkStore
-func (m *MapChunkStore) Has(ctx context.Context, ref Address) (has bool, err error) {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
-
-	_, has = m.chunks[ref.Hex()]
-	return has, nil
-}
-
-func (m *MapChunkStore) HasMulti(ctx context.Context, refs ...Address) (have []bool, err error) {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
-
-	have = make([]bool, len(refs))
-	for i, ref := range refs {
-		_, have[i] = m.chunks[ref.Hex()]
-	}
-	return have, nil
-}
-
-func (m *MapChunkStore) Set(ctx context.Context, mode chunk.ModeSet, addrs ...chunk.Address) (err error) {
-	return nil
-}
-
-func (m *MapChunkStore) LastPullSubscriptionBinID(bin uint8) (id uint64, err error) {
-	return 0, nil
-}
-
-func (m *MapChunkStore) SubscribePull(ctx context.Context, bin uint8, since, until uint64) (c <-chan chunk.Descriptor, stop func()) {
-	return nil, nil
-}
-
-func (m *MapChunkStore) Close() error {
-	return nil
-}
-
 func chunkAddresses(chunks []Chunk) []Address {
 	addrs := make([]Address, len(chunks))
 	for i, ch := range chunks {
@@ -31,6 +31,7 @@ type Key []byte
 type Encryption interface {
 	Encrypt(data []byte) ([]byte, error)
 	Decrypt(data []byte) ([]byte, error)
+	DecryptInto(dst, data []byte) error
 	Reset()
 }
 
@@ -81,6 +82,24 @@ func (e *encryption) Decrypt(data []byte) ([]byte, error) {
 	return out, nil
 }
 
+// DecryptInto decrypts the data into dst, which must be at least as long as the data.
+// As the data is decrypted segment-wise, the data may also be a prefix of padded data,
+// in which case only the prefix is decrypted
+func (e *encryption) DecryptInto(dst, data []byte) error {
+	length := len(data)
+	if e.padding > 0 && length > e.padding {
+		return fmt.Errorf("Data length longer than padding, data length %v padding %v", length, e.padding)
+	}
+	if len(dst) < length {
+		return fmt.Errorf("Destination shorter than data, destination length %v data length %v", len(dst), length)
+	}
+	if length == 0 {
+		return nil
+	}
+	e.transform(data, dst[:length])
+	return nil
+}
+
 // Reset resets the counter. It is only safe to call after an encryption operation is completed
 // After Reset is called, the Encryption object can be re-used for other data
 func (e *encryption) Reset() {
@@ -191,3 +191,39 @@ func TestEncryptSectioned(t *testing.T) {
 		}
 	}
 }
+
+// TestDecryptIntoPrefix tests that decrypting a prefix of the padded data into a buffer
+// yields the same bytes as the corresponding prefix of the whole decrypted data
+func TestDecryptIntoPrefix(t *testing.T) {
+	enc := New(testKey, 4096, uint32(0), hashFunc)
+	data := testutil.RandomBytes(1, 1000)
+	encrypted, err := enc.Encrypt(data)
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+
+	for _, length := range []int{0, 1, 31, 32, 33, 1000, 4096} {
+		enc.Reset()
+		dst := make([]byte, length)
+		if err := enc.DecryptInto(dst, encrypted[:length]); err != nil {
+			t.Fatalf("length %v: Expected no error got %v", length, err)
+		}
+		enc.Reset()
+		decrypted, err := enc.Decrypt(encrypted)
+		if err != nil {
+			t.Fatalf("Expected no error got %v", err)
+		}
+		if !bytes.Equal(decrypted[:length], dst) {
+			t.Fatalf("length %v: Expected decrypted %v got %v", length, common.Bytes2Hex(decrypted[:length]), common.Bytes2Hex(dst))
+		}
+	}
+
+	enc.Reset()
+	if err := enc.DecryptInto(make([]byte, 10), encrypted[:11]); err == nil {
+		t.Fatal("Expected error for destination shorter than data")
+	}
+	enc.Reset()
+	if err := enc.DecryptInto(make([]byte, 4097), make([]byte, 4097)); err == nil {
+		t.Fatal("Expected error for data longer than padding")
+	}
+}
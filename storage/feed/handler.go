@@ -21,6 +21,7 @@ package feed
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"sync"
 	"sync/atomic"
@@ -193,7 +194,7 @@ func (h *Handler) Lookup(ctx context.Context, query *Query) (*cacheEntry, error)
 		r := storage.NewRequest(id.Addr())
 		ch, err := h.chunkStore.Get(ctx, chunk.ModeGetLookup, r)
 		if err != nil {
-			if err == context.DeadlineExceeded || err == storage.ErrNoSuitablePeer { // chunk not found
+			if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, storage.ErrNoSuitablePeer) { // chunk not found
 				return nil, nil
 			}
 			return nil, err
@@ -18,11 +18,14 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"io"
 	"sort"
 	"sync"
+	"sync/atomic"
 
 	"github.com/holisticode/swarm/chunk"
+	"github.com/holisticode/swarm/storage/encryption"
 	"github.com/holisticode/swarm/storage/localstore"
 )
 
@@ -43,10 +46,17 @@ const (
 	defaultCacheCapacity = 10000   // capacity for in-memory chunks' cache
 )
 
+// ErrEmptyEncryptionKey is returned by StoreEncrypted if the root key is empty.
+// Content stored with the same root key always gets the same references, which reveals
+// to anyone who sees them that the content is identical. Store with toEncrypt set uses
+// random keys instead, which do not have this trade-off.
+var ErrEmptyEncryptionKey = errors.New("empty encryption root key, use Store with toEncrypt for random keys")
+
 type FileStore struct {
 	ChunkStore
 	putterStore ChunkStore
 	hashFunc    SwarmHasher
+	chunkSize   int64
 	tags        *chunk.Tags
 }
 
@@ -73,13 +83,25 @@ func NewLocalFileStore(datadir string, basekey []byte, tags *chunk.Tags) (*FileS
 }
 
 func NewFileStore(store ChunkStore, putterStore ChunkStore, params *FileStoreParams, tags *chunk.Tags) *FileStore {
-	hashFunc := MakeHashFunc(params.Hash)
+	f, _ := NewFileStoreWithChunkSize(store, putterStore, params, tags, chunk.DefaultSize)
+	return f
+}
+
+// NewFileStoreWithChunkSize creates a new FileStore like NewFileStore, which splits content
+// into chunks of at most chunkSize bytes of data instead of chunk.DefaultSize.
+// Content can be retrieved only with a FileStore with the same chunk size as it was stored with.
+// It returns ErrUnsupportedChunkSize if the chunk size is not valid by ValidateChunkSize.
+func NewFileStoreWithChunkSize(store ChunkStore, putterStore ChunkStore, params *FileStoreParams, tags *chunk.Tags, chunkSize int64) (*FileStore, error) {
+	if err := ValidateChunkSize(chunkSize); err != nil {
+		return nil, err
+	}
 	return &FileStore{
 		ChunkStore:  store,
 		putterStore: putterStore,
-		hashFunc:    hashFunc,
+		hashFunc:    MakeHashFuncForChunkSize(params.Hash, chunkSize),
+		chunkSize:   chunkSize,
 		tags:        tags,
-	}
+	}, nil
 }
 
 // Retrieve is a public API. Main entry point for document retrieval directly. Used by the
@@ -94,13 +116,36 @@ func (f *FileStore) Retrieve(ctx context.Context, addr Address) (reader *LazyChu
 		tag = chunk.NewTag(0, "ephemeral-retrieval-tag", 0, false)
 	}
 
-	getter := NewHasherStore(f.ChunkStore, f.hashFunc, isEncrypted, tag)
-	reader = TreeJoin(ctx, addr, getter, 0)
+	getter := f.newHasherStore(f.ChunkStore, isEncrypted, tag)
+	reader = NewTreeJoiner(&JoinerParams{
+		ChunkerParams: ChunkerParams{
+			chunkSize: f.chunkSize,
+			hashSize:  int64(len(addr)),
+		},
+		addr:   addr,
+		getter: getter,
+		ctx:    ctx,
+	}).Join(ctx)
 	return
 }
 
+// OpenReaderAt is a public API. It returns a reader for random access to the content with
+// the root reference and the size of the content. Reads fetch only the chunks covering the
+// requested range, encrypted content is decrypted. Only the root chunk is retrieved here,
+// to get the size, so the returned reader is safe for concurrent reads.
+func (f *FileStore) OpenReaderAt(ctx context.Context, root Reference) (io.ReaderAt, int64, error) {
+	reader, _ := f.Retrieve(ctx, Address(root))
+	size, err := reader.Size(ctx, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	return reader, size, nil
+}
+
 // Store is a public API. Main entry point for document storage directly. Used by the
 // FS-aware API and httpaccess
+// If the tag in the context is resumed with Tag.Resume, chunks which are already
+// stored by an earlier, interrupted upload are not stored again.
 func (f *FileStore) Store(ctx context.Context, data io.Reader, size int64, toEncrypt bool) (addr Address, wait func(context.Context) error, err error) {
 	tag, err := f.tags.GetFromContext(ctx)
 	if err != nil {
@@ -111,8 +156,61 @@ func (f *FileStore) Store(ctx context.Context, data io.Reader, size int64, toEnc
 		tag = chunk.NewTag(0, "", 0, false)
 		//return nil, nil, err
 	}
-	putter := NewHasherStore(f.putterStore, f.hashFunc, toEncrypt, tag)
-	return PyramidSplit(ctx, data, putter, putter, tag)
+	var opts []HasherStoreOption
+	if tag.Resuming() {
+		opts = append(opts, WithSkipStored())
+	}
+	putter := f.newHasherStore(f.putterStore, toEncrypt, tag, opts...)
+	return f.split(ctx, data, putter, putter, tag)
+}
+
+// StoreEncrypted is a public API. It stores the data encrypted like Store with toEncrypt set,
+// but derives the encryption key of each chunk from the root key and the chunk data instead
+// of generating random keys, so the same data stored with the same root key yields the same
+// reference. It returns ErrEmptyEncryptionKey if the root key is empty.
+func (f *FileStore) StoreEncrypted(ctx context.Context, data io.Reader, size int64, key encryption.Key) (addr Address, wait func(context.Context) error, err error) {
+	if len(key) == 0 {
+		return nil, nil, ErrEmptyEncryptionKey
+	}
+	tag, err := f.tags.GetFromContext(ctx)
+	if err != nil {
+		tag = chunk.NewTag(0, "", 0, false)
+	}
+	opts := []HasherStoreOption{WithEncryptionKey(key)}
+	if tag.Resuming() {
+		opts = append(opts, WithSkipStored())
+	}
+	putter := f.newHasherStore(f.putterStore, true, tag, opts...)
+	return f.split(ctx, data, putter, putter, tag)
+}
+
+// EstimateStore is a public API. It chunks the data exactly like Store does, but discards
+// the chunks instead of storing them. It returns the root address and the number of chunks
+// that Store would produce for the same input. For unencrypted content the address is
+// identical to the one returned by Store; encrypted content uses random keys, so only the
+// chunk count is meaningful.
+func (f *FileStore) EstimateStore(ctx context.Context, data io.Reader, size int64, toEncrypt bool) (addr Address, count uint64, err error) {
+	tag := chunk.NewTag(0, "ephemeral-estimate-tag", 0, false) // mock tag, estimation must not change any real tag
+
+	putter := f.newHasherStore(&FakeChunkStore{}, toEncrypt, tag)
+	addr, wait, err := f.split(ctx, data, putter, putter, tag)
+	if err != nil {
+		return nil, 0, err
+	}
+	if err := wait(ctx); err != nil {
+		return nil, 0, err
+	}
+	return addr, atomic.LoadUint64(&putter.nrChunks), nil
+}
+
+// newHasherStore creates a hasherStore with the hash function and chunk size of the FileStore
+func (f *FileStore) newHasherStore(store ChunkStore, toEncrypt bool, tag *chunk.Tag, opts ...HasherStoreOption) *hasherStore {
+	return NewHasherStore(store, f.hashFunc, toEncrypt, tag, append([]HasherStoreOption{WithChunkSize(f.chunkSize)}, opts...)...)
+}
+
+// split splits the data into chunks of the chunk size of the FileStore
+func (f *FileStore) split(ctx context.Context, data io.Reader, putter Putter, getter Getter, tag *chunk.Tag) (Address, func(context.Context) error, error) {
+	return NewPyramidSplitter(NewPyramidSplitterParams(nil, data, putter, getter, f.chunkSize), tag).Split(ctx)
 }
 
 func (f *FileStore) HashSize() int {
@@ -125,10 +223,10 @@ func (f *FileStore) GetAllReferences(ctx context.Context, data io.Reader) (addrs
 
 	// create a special kind of putter, which only will store the references
 	putter := &hashExplorer{
-		hasherStore: NewHasherStore(f.ChunkStore, f.hashFunc, false, tag),
+		hasherStore: f.newHasherStore(f.ChunkStore, false, tag),
 	}
 	// do the actual splitting anyway, no way around it
-	_, wait, err := PyramidSplit(ctx, data, putter, putter, tag)
+	_, wait, err := f.split(ctx, data, putter, putter, tag)
 	if err != nil {
 		return nil, err
 	}
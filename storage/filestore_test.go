@@ -19,13 +19,18 @@ package storage
 import (
 	"bytes"
 	"context"
+	"errors"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/holisticode/swarm/chunk"
+	"github.com/holisticode/swarm/sctx"
 	"github.com/holisticode/swarm/storage/localstore"
 	"github.com/holisticode/swarm/testutil"
 )
@@ -200,3 +205,359 @@ func TestGetAllReferences(t *testing.T) {
 		}
 	}
 }
+
+// TestEstimateStore tests that EstimateStore returns the same root address and
+// number of chunks as Store without storing any chunk
+func TestEstimateStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "swarm-storage-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	localStore, err := localstore.New(dir, make([]byte, 32), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer localStore.Close()
+
+	fileStore := NewFileStore(localStore, localStore, NewFileStoreParams(), chunk.NewTags())
+
+	// testRuns[i] and expectedCounts[i] are dataSize and expected chunk count respectively
+	testRuns := []int{1024, 8192, 16000, 30000, 1000000}
+	expectedCounts := []uint64{1, 3, 5, 9, 248}
+	for i, r := range testRuns {
+		slice := testutil.RandomBytes(1, r)
+		ctx := context.Background()
+
+		addr, count, err := fileStore.EstimateStore(ctx, bytes.NewReader(slice), int64(r), false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if count != expectedCounts[i] {
+			t.Fatalf("Expected chunk count for size %d to be %d, but is %d", r, expectedCounts[i], count)
+		}
+		has, err := localStore.Has(ctx, addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if has {
+			t.Fatalf("Expected root chunk %v not to be stored", addr)
+		}
+
+		storedAddr, wait, err := fileStore.Store(ctx, bytes.NewReader(slice), int64(r), false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := wait(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(addr, storedAddr) {
+			t.Fatalf("Expected estimated address %v to match stored address %v", addr, storedAddr)
+		}
+	}
+}
+
+// TestFileStoreEncrypted tests that content stored encrypted with the same root key
+// gets the same reference, a different one with another key, and can be retrieved
+func TestFileStoreEncrypted(t *testing.T) {
+	dir, err := ioutil.TempDir("", "swarm-storage-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	localStore, err := localstore.New(dir, make([]byte, 32), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer localStore.Close()
+
+	fileStore := NewFileStore(localStore, localStore, NewFileStoreParams(), chunk.NewTags())
+	ctx := context.Background()
+
+	if _, _, err := fileStore.StoreEncrypted(ctx, bytes.NewReader(nil), 0, nil); err != ErrEmptyEncryptionKey {
+		t.Fatalf("Expected error %v, got %v", ErrEmptyEncryptionKey, err)
+	}
+
+	dataSize := 30000
+	slice := testutil.RandomBytes(1, dataSize)
+	store := func(key []byte) Address {
+		addr, wait, err := fileStore.StoreEncrypted(ctx, bytes.NewReader(slice), int64(dataSize), key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := wait(ctx); err != nil {
+			t.Fatal(err)
+		}
+		return addr
+	}
+	key := testutil.RandomBytes(2, 32)
+	addr := store(key)
+	if !bytes.Equal(addr, store(key)) {
+		t.Fatal("Expected the same address for the same content and key")
+	}
+	if bytes.Equal(addr, store(testutil.RandomBytes(3, 32))) {
+		t.Fatal("Expected a different address for another key")
+	}
+
+	reader, isEncrypted := fileStore.Retrieve(ctx, addr)
+	if !isEncrypted {
+		t.Fatal("Expected content to be encrypted")
+	}
+	result := make([]byte, dataSize)
+	if _, err := reader.ReadAt(result, 0); err != nil && err != io.EOF {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(slice, result) {
+		t.Fatal("Retrieved content does not match stored content")
+	}
+}
+
+// TestFileStoreOpenReaderAt tests that the reader returned by OpenReaderAt
+// reads arbitrary ranges of plain and encrypted content
+func TestFileStoreOpenReaderAt(t *testing.T) {
+	for _, toEncrypt := range []bool{false, true} {
+		t.Run(fmt.Sprintf("encrypt=%v", toEncrypt), func(t *testing.T) {
+			store := NewMapChunkStore()
+			fileStore := NewFileStore(store, store, NewFileStoreParams(), chunk.NewTags())
+			ctx := context.Background()
+
+			dataSize := 3*chunk.DefaultSize*chunk.DefaultSize/32 + 1000
+			data := testutil.RandomBytes(1, dataSize)
+			addr, wait, err := fileStore.Store(ctx, bytes.NewReader(data), int64(dataSize), toEncrypt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := wait(ctx); err != nil {
+				t.Fatal(err)
+			}
+
+			reader, size, err := fileStore.OpenReaderAt(ctx, Reference(addr))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if size != int64(dataSize) {
+				t.Fatalf("Expected size %d, got %d", dataSize, size)
+			}
+			for _, r := range [][2]int{{0, 10}, {4090, 10}, {dataSize / 2, 5000}, {dataSize - 100, 100}} {
+				off, length := r[0], r[1]
+				buf := make([]byte, length)
+				n, err := reader.ReadAt(buf, int64(off))
+				if err != nil && err != io.EOF {
+					t.Fatal(err)
+				}
+				if n != length || !bytes.Equal(buf, data[off:off+length]) {
+					t.Fatalf("Wrong data read at offset %d length %d", off, length)
+				}
+			}
+			if n, err := reader.ReadAt(make([]byte, 10), int64(dataSize)); n != 0 || err != io.EOF {
+				t.Fatalf("Expected EOF reading at the end, got %d, %v", n, err)
+			}
+		})
+	}
+}
+
+// TestFileStoreChunkSize tests that content stored with a custom chunk size
+// is split into chunks of at most that size, hashed for that size and can be retrieved.
+func TestFileStoreChunkSize(t *testing.T) {
+	for _, size := range []int64{0, 100, 64, 1000, 4097} {
+		if _, err := NewFileStoreWithChunkSize(NewMapChunkStore(), NewMapChunkStore(), NewFileStoreParams(), chunk.NewTags(), size); !errors.Is(err, ErrUnsupportedChunkSize) {
+			t.Errorf("chunk size %v: got error %v, want %v", size, err, ErrUnsupportedChunkSize)
+		}
+	}
+
+	for _, chunkSize := range []int64{128, 1024, chunk.DefaultSize, 16384} {
+		for _, toEncrypt := range []bool{false, true} {
+			t.Run(fmt.Sprintf("size_%d_encrypt_%v", chunkSize, toEncrypt), func(t *testing.T) {
+				store := NewMapChunkStore()
+				fileStore, err := NewFileStoreWithChunkSize(store, store, NewFileStoreParams(), chunk.NewTags(), chunkSize)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				// data spanning at least two levels of intermediate chunks
+				dataSize := 5*chunkSize*chunkSize/AddressLength + 17
+				if dataSize > 1<<22 {
+					dataSize = 1<<22 + 17
+				}
+				data := testutil.RandomBytes(1, int(dataSize))
+				ctx := context.Background()
+				addr, wait, err := fileStore.Store(ctx, bytes.NewReader(data), dataSize, toEncrypt)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := wait(ctx); err != nil {
+					t.Fatal(err)
+				}
+
+				hashFunc := MakeHashFuncForChunkSize(DefaultHash, chunkSize)
+				for _, ch := range store.chunks {
+					if l := int64(len(ch.Data())); l > chunkSize+8 {
+						t.Fatalf("got chunk data length %v, want at most %v", l, chunkSize+8)
+					}
+					h := hashFunc()
+					if !toEncrypt && !bytes.Equal(h.SumWithSpan(ch.Data()[8:], ch.Data()[:8]), ch.Address()) {
+						t.Fatalf("chunk %s address is not its hash for chunk size %v", ch.Address(), chunkSize)
+					}
+				}
+
+				reader, _ := fileStore.Retrieve(ctx, addr)
+				got, err := ioutil.ReadAll(reader)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(got, data) {
+					t.Fatal("retrieved data does not match stored data")
+				}
+
+				estimated, count, err := fileStore.EstimateStore(ctx, bytes.NewReader(data), dataSize, toEncrypt)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if count != uint64(len(store.chunks)) {
+					t.Fatalf("got estimated chunk count %v, want %v", count, len(store.chunks))
+				}
+				if !toEncrypt && !bytes.Equal(estimated, addr) {
+					t.Fatalf("got estimated address %s, want %s", estimated, addr)
+				}
+			})
+		}
+	}
+}
+
+// TestFileStoreDuplicateChunks tests that storing content with repeated data
+// chunks completes and that the tag counts the repeated chunks as both stored
+// and seen.
+func TestFileStoreDuplicateChunks(t *testing.T) {
+	store := NewMapChunkStore()
+	tags := chunk.NewTags()
+	fileStore := NewFileStore(store, store, NewFileStoreParams(), tags)
+
+	tag, err := tags.Create("test-duplicates", 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(sctx.SetTag(context.Background(), tag.Uid), getTimeout)
+	defer cancel()
+
+	// the same data chunk repeated, followed by a distinct one
+	repeats := 10
+	block := testutil.RandomBytes(1, chunk.DefaultSize)
+	data := append(bytes.Repeat(block, repeats), testutil.RandomBytes(2, chunk.DefaultSize)...)
+
+	_, wait, err := fileStore.Store(ctx, bytes.NewReader(data), int64(len(data)), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// repeated data chunks, the distinct data chunk and the root chunk
+	wantTotal := int64(repeats + 2)
+	if got := tag.Get(chunk.StateStored); got != wantTotal {
+		t.Errorf("got %v stored chunks, want %v", got, wantTotal)
+	}
+	if got, want := tag.Get(chunk.StateSeen), int64(repeats-1); got != want {
+		t.Errorf("got %v seen chunks, want %v", got, want)
+	}
+	if got, want := len(store.chunks), repeats+2-(repeats-1); got != want {
+		t.Errorf("got %v chunks in store, want %v", got, want)
+	}
+}
+
+// failingChunkStore is a MapChunkStore which fails to put chunks once
+// the limit of put chunks is reached and counts the chunks it is asked to put
+type failingChunkStore struct {
+	*MapChunkStore
+	mu    sync.Mutex
+	limit int
+	puts  int
+}
+
+func (s *failingChunkStore) Put(ctx context.Context, mode chunk.ModePut, chs ...Chunk) ([]bool, error) {
+	s.mu.Lock()
+	if s.limit > 0 && s.puts >= s.limit {
+		s.mu.Unlock()
+		return nil, errors.New("store failure")
+	}
+	s.puts += len(chs)
+	s.mu.Unlock()
+	return s.MapChunkStore.Put(ctx, mode, chs...)
+}
+
+// TestFileStoreResume tests that an interrupted upload can be resumed
+// with the same tag, storing only the chunks which are not yet stored.
+func TestFileStoreResume(t *testing.T) {
+	store := &failingChunkStore{
+		MapChunkStore: NewMapChunkStore(),
+		limit:         20,
+	}
+	tags := chunk.NewTags()
+	fileStore := NewFileStore(store, store, NewFileStoreParams(), tags)
+
+	tag, err := tags.Create("test-resume", 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(sctx.SetTag(context.Background(), tag.Uid), getTimeout)
+	defer cancel()
+
+	data := testutil.RandomBytes(1, 100*chunk.DefaultSize)
+
+	_, wait, err := fileStore.Store(ctx, bytes.NewReader(data), int64(len(data)), false)
+	if err == nil {
+		err = wait(ctx)
+	}
+	if err == nil {
+		t.Fatal("expected the first upload to fail")
+	}
+	// wait for the chunks put before the failure to be counted on the tag
+	for tag.Get(chunk.StateStored) < int64(store.limit) {
+		select {
+		case <-ctx.Done():
+			t.Fatal(ctx.Err())
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	stored := len(store.chunks)
+
+	// resume on the same chunks without the limit, while chunks of the failed
+	// upload which may still be in flight keep failing on the first store
+	store = &failingChunkStore{
+		MapChunkStore: store.MapChunkStore,
+	}
+	fileStore = NewFileStore(store, store, NewFileStoreParams(), tags)
+
+	tag.Resume()
+	addr, wait, err := fileStore.Store(ctx, bytes.NewReader(data), int64(len(data)), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// 100 data chunks and the root chunk
+	total := 101
+	if len(store.chunks) != total {
+		t.Fatalf("got %v chunks in store, want %v", len(store.chunks), total)
+	}
+	if store.puts != total-stored {
+		t.Errorf("got %v chunks put on resume, want %v", store.puts, total-stored)
+	}
+	if got := tag.Get(chunk.StateStored); got != int64(total) {
+		t.Errorf("got %v stored chunks, want %v", got, total)
+	}
+	if got := tag.Get(chunk.StateSeen); got != int64(stored) {
+		t.Errorf("got %v seen chunks, want %v", got, stored)
+	}
+
+	reader, _ := fileStore.Retrieve(ctx, addr)
+	got, err := ioutil.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatal("retrieved data does not match stored data")
+	}
+}
@@ -18,6 +18,7 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"sync"
 	"sync/atomic"
@@ -32,29 +33,90 @@ const (
 
 )
 
+// ErrUnsupportedChunkSize is returned by ValidateChunkSize for chunk sizes
+// that can not be used for splitting and hashing content.
+var ErrUnsupportedChunkSize = errors.New("unsupported chunk size")
+
+// ValidateChunkSize checks that the chunk size is a power of two multiple of the
+// segment size of the BMT hash, large enough for intermediate chunks to hold at
+// least two encrypted references.
+func ValidateChunkSize(size int64) error {
+	if size < 2*(AddressLength+encryption.KeyLength) || size&(size-1) != 0 || size%AddressLength != 0 {
+		return fmt.Errorf("%w: %d", ErrUnsupportedChunkSize, size)
+	}
+	return nil
+}
+
+// HasherStoreOption configures optional behaviour of a hasherStore.
+type HasherStoreOption func(*hasherStore)
+
+// WithChunkSize sets the maximum size of the data of the chunks put and
+// decrypted by the hasherStore, which is chunk.DefaultSize by default.
+// The size must be validated with ValidateChunkSize and the hash function
+// of the hasherStore must be made for it with MakeHashFuncForChunkSize.
+func WithChunkSize(size int64) HasherStoreOption {
+	return func(h *hasherStore) {
+		h.chunkSize = size
+	}
+}
+
+// WithSkipStored makes the hasherStore check if the underlying ChunkStore
+// already has a chunk before putting it. Chunks which are already stored are
+// not put again, but are counted as stored and seen on the tag, which allows
+// resuming an interrupted upload without storing its chunks again.
+func WithSkipStored() HasherStoreOption {
+	return func(h *hasherStore) {
+		h.skipStored = true
+	}
+}
+
+// WithMaxPendingChunks sets the number of chunks which can be submitted to the
+// hasherStore but not yet stored by the underlying ChunkStore. Once the limit is
+// reached, Put blocks until a chunk is stored or its context is done.
+// Values smaller than 1 leave the default of noOfStorageWorkers in place.
+func WithMaxPendingChunks(n int) HasherStoreOption {
+	return func(h *hasherStore) {
+		if n > 0 {
+			h.workers = make(chan Chunk, n)
+		}
+	}
+}
+
+// WithEncryptionKey makes the hasherStore derive the encryption key of each chunk from
+// the root key and the chunk data, instead of generating a random key, so that the same
+// content encrypted with the same root key yields the same references.
+func WithEncryptionKey(key encryption.Key) HasherStoreOption {
+	return func(h *hasherStore) {
+		h.rootKey = key
+	}
+}
+
 type hasherStore struct {
 	// nrChunks is used with atomic functions
 	// it is required to be at the start of the struct to ensure 64bit alignment for ARM, x86-32, and 32-bit MIPS architectures
 	// see: https://golang.org/pkg/sync/atomic/#pkg-note-BUG
-	nrChunks  uint64 // number of chunks to store
-	store     ChunkStore
-	tag       *chunk.Tag
-	toEncrypt bool
-	doWait    sync.Once
-	hashFunc  SwarmHasher
-	hashSize  int           // content hash size
-	refSize   int64         // reference size (content hash + possibly encryption key)
-	errC      chan error    // global error channel
-	waitC     chan error    // global wait channel
-	doneC     chan struct{} // closed by Close() call to indicate that count is the final number of chunks
-	quitC     chan struct{} // closed to quit unterminated routines
-	workers   chan Chunk    // back pressure for limiting storage workers goroutines
+	nrChunks   uint64 // number of chunks to store, including duplicates
+	store      ChunkStore
+	tag        *chunk.Tag
+	toEncrypt  bool
+	doWait     sync.Once
+	hashFunc   SwarmHasher
+	hashSize   int            // content hash size
+	refSize    int64          // reference size (content hash + possibly encryption key)
+	chunkSize  int64          // maximum chunk data size
+	skipStored bool           // do not put chunks which are already in the store
+	rootKey    encryption.Key // key to derive chunk encryption keys from, random keys are used if nil
+	errC       chan error     // global error channel
+	waitC      chan error     // global wait channel
+	doneC      chan struct{}  // closed by Close() call to indicate that count is the final number of chunks
+	quitC      chan struct{}  // closed to quit unterminated routines
+	workers    chan Chunk     // back pressure for limiting chunks submitted but not yet stored
 }
 
 // NewHasherStore creates a hasherStore object, which implements Putter and Getter interfaces.
 // With the HasherStore you can put and get chunk data (which is just []byte) into a ChunkStore
 // and the hasherStore will take core of encryption/decryption of data if necessary
-func NewHasherStore(store ChunkStore, hashFunc SwarmHasher, toEncrypt bool, tag *chunk.Tag) *hasherStore {
+func NewHasherStore(store ChunkStore, hashFunc SwarmHasher, toEncrypt bool, tag *chunk.Tag, opts ...HasherStoreOption) *hasherStore {
 	hashSize := hashFunc().Size()
 	refSize := int64(hashSize)
 	if toEncrypt {
@@ -68,18 +130,24 @@ func NewHasherStore(store ChunkStore, hashFunc SwarmHasher, toEncrypt bool, tag
 		hashFunc:  hashFunc,
 		hashSize:  hashSize,
 		refSize:   refSize,
+		chunkSize: chunk.DefaultSize,
 		errC:      make(chan error),
 		waitC:     make(chan error),
 		doneC:     make(chan struct{}),
 		quitC:     make(chan struct{}),
 		workers:   make(chan Chunk, noOfStorageWorkers),
 	}
+	for _, o := range opts {
+		o(h)
+	}
 	return h
 }
 
 // Put stores the chunkData into the ChunkStore of the hasherStore and returns the reference.
 // If hasherStore has a chunkEncryption object, the data will be encrypted.
 // Asynchronous function, the data will not necessarily be stored when it returns.
+// If too many chunks are waiting to be stored, Put blocks until one of them is
+// stored or the context is done.
 func (h *hasherStore) Put(ctx context.Context, chunkData ChunkData) (Reference, error) {
 	c := chunkData
 	var encryptionKey encryption.Key
@@ -90,8 +158,13 @@ func (h *hasherStore) Put(ctx context.Context, chunkData ChunkData) (Reference,
 			return nil, err
 		}
 	}
-	chunk := h.createChunk(c)
-	h.storeChunk(ctx, chunk)
+	chunk, err := h.createChunk(c)
+	if err != nil {
+		return nil, err
+	}
+	if err := h.storeChunk(ctx, chunk); err != nil {
+		return nil, err
+	}
 
 	// Start the wait function which will detect completion of put
 	h.doWait.Do(func() {
@@ -182,18 +255,26 @@ func (h *hasherStore) startWait(ctx context.Context) {
 	}
 }
 
-func (h *hasherStore) createHash(chunkData ChunkData) Address {
+// createHash returns the hash of the chunk data, or the error of the hasher
+// if it failed to compute it, like bmt.ErrPoolClosed
+func (h *hasherStore) createHash(chunkData ChunkData) (Address, error) {
 	hasher := h.hashFunc()
-	hasher.Reset()
-	hasher.SetSpanBytes(chunkData[:8]) // 8 bytes of length
-	hasher.Write(chunkData[8:])        // minus 8 []byte length
-	return hasher.Sum(nil)
+	hash := hasher.SumWithSpan(chunkData[8:], chunkData[:8]) // data minus the 8 bytes of length
+	if e, ok := hasher.(hashErrer); ok {
+		if err := e.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return hash, nil
 }
 
-func (h *hasherStore) createChunk(chunkData ChunkData) Chunk {
-	hash := h.createHash(chunkData)
+func (h *hasherStore) createChunk(chunkData ChunkData) (Chunk, error) {
+	hash, err := h.createHash(chunkData)
+	if err != nil {
+		return nil, err
+	}
 	chunk := NewChunk(hash, chunkData).WithTagID(h.tag.Uid)
-	return chunk
+	return chunk, nil
 }
 
 func (h *hasherStore) encryptChunkData(chunkData ChunkData) (ChunkData, encryption.Key, error) {
@@ -212,28 +293,58 @@ func (h *hasherStore) encryptChunkData(chunkData ChunkData) (ChunkData, encrypti
 }
 
 func (h *hasherStore) decryptChunkData(chunkData ChunkData, encryptionKey encryption.Key) (ChunkData, error) {
+	c := make(ChunkData, h.chunkSize+8)
+	n, err := h.DecryptInto(c, chunkData, encryptionKey)
+	if err != nil {
+		return nil, err
+	}
+	return c[:n], nil
+}
+
+// DecryptInto decrypts the encrypted chunk data into dst and returns the length
+// of the decrypted chunk data, without the padding added by the encryption.
+// Only the data within that length is decrypted. dst must be large enough to hold
+// the decrypted chunk data, which is at most the chunk size + 8 bytes long.
+func (h *hasherStore) DecryptInto(dst, chunkData []byte, key encryption.Key) (int, error) {
 	if len(chunkData) < 8 {
-		return nil, fmt.Errorf("Invalid ChunkData, min length 8 got %v", len(chunkData))
+		return 0, fmt.Errorf("Invalid ChunkData, min length 8 got %v", len(chunkData))
+	}
+	if len(dst) < 8 {
+		return 0, fmt.Errorf("Invalid destination, min length 8 got %v", len(dst))
 	}
 
-	decryptedSpan, decryptedData, err := h.decrypt(chunkData, encryptionKey)
-	if err != nil {
-		return nil, err
+	if err := h.newSpanEncryption(key).DecryptInto(dst[:8], chunkData[:8]); err != nil {
+		return 0, err
 	}
 
 	// removing extra bytes which were just added for padding
-	length := ChunkData(decryptedSpan).Size()
-	for length > chunk.DefaultSize {
-		length = length + (chunk.DefaultSize - 1)
-		length = length / chunk.DefaultSize
-		length *= uint64(h.refSize)
+	length := decryptedDataLength(ChunkData(dst[:8]).Size(), h.refSize, h.chunkSize)
+	if length > uint64(len(chunkData)-8) {
+		return 0, fmt.Errorf("Invalid ChunkData, data length %v shorter than decrypted length %v", len(chunkData)-8, length)
+	}
+	if length > uint64(len(dst)-8) {
+		return 0, fmt.Errorf("Invalid destination, length %v shorter than decrypted length %v", len(dst), length+8)
 	}
 
-	c := make(ChunkData, length+8)
-	copy(c[:8], decryptedSpan)
-	copy(c[8:], decryptedData[:length])
+	if err := h.newDataEncryption(key).DecryptInto(dst[8:], chunkData[8:8+length]); err != nil {
+		return 0, err
+	}
+	return int(length) + 8, nil
+}
 
-	return c, nil
+// decryptedDataLength returns the length of the data of a chunk with the given span.
+// Data chunks hold the span bytes, while intermediate chunks hold one reference
+// of refSize bytes for each of their children, each of which spans chunkSize
+// times the number of references in a chunk to the power of the level of the child.
+func decryptedDataLength(span uint64, refSize, chunkSize int64) uint64 {
+	length := span
+	size := uint64(chunkSize)
+	for length > size {
+		length = length + (size - 1)
+		length = length / size
+		length *= uint64(refSize)
+	}
+	return length
 }
 
 func (h *hasherStore) RefSize() int64 {
@@ -241,55 +352,75 @@ func (h *hasherStore) RefSize() int64 {
 }
 
 func (h *hasherStore) encrypt(chunkData ChunkData) (encryption.Key, []byte, []byte, error) {
-	key := encryption.GenerateRandomKey(encryption.KeyLength)
+	key := h.chunkKey(chunkData)
 	encryptedSpan, err := h.newSpanEncryption(key).Encrypt(chunkData[:8])
 	if err != nil {
 		return nil, nil, nil, err
 	}
-	encryptedData, err := h.newDataEncryption(key).Encrypt(chunkData[8:])
+	data := chunkData[8:]
+	if h.rootKey != nil {
+		// pad the data with zeros instead of the random padding of the encryption,
+		// so that chunks encrypted with keys derived from the root key are deterministic
+		data = make([]byte, h.chunkSize)
+		copy(data, chunkData[8:])
+	}
+	encryptedData, err := h.newDataEncryption(key).Encrypt(data)
 	if err != nil {
 		return nil, nil, nil, err
 	}
 	return key, encryptedSpan, encryptedData, nil
 }
 
-func (h *hasherStore) decrypt(chunkData ChunkData, key encryption.Key) ([]byte, []byte, error) {
-	encryptedSpan, err := h.newSpanEncryption(key).Encrypt(chunkData[:8])
-	if err != nil {
-		return nil, nil, err
-	}
-	encryptedData, err := h.newDataEncryption(key).Encrypt(chunkData[8:])
-	if err != nil {
-		return nil, nil, err
+// chunkKey returns a random encryption key for the chunk data, or
+// the hash of the root key and the chunk data if the root key is set
+func (h *hasherStore) chunkKey(chunkData ChunkData) encryption.Key {
+	if h.rootKey == nil {
+		return encryption.GenerateRandomKey(encryption.KeyLength)
 	}
-	return encryptedSpan, encryptedData, nil
+	hasher := sha3.NewLegacyKeccak256()
+	hasher.Write(h.rootKey)
+	hasher.Write(chunkData)
+	return hasher.Sum(nil)
 }
 
 func (h *hasherStore) newSpanEncryption(key encryption.Key) encryption.Encryption {
-	return encryption.New(key, 0, uint32(chunk.DefaultSize/h.refSize), sha3.NewLegacyKeccak256)
+	return encryption.New(key, 0, uint32(h.chunkSize/h.refSize), sha3.NewLegacyKeccak256)
 }
 
 func (h *hasherStore) newDataEncryption(key encryption.Key) encryption.Encryption {
-	return encryption.New(key, int(chunk.DefaultSize), 0, sha3.NewLegacyKeccak256)
+	return encryption.New(key, int(h.chunkSize), 0, sha3.NewLegacyKeccak256)
 }
 
-func (h *hasherStore) storeChunk(ctx context.Context, ch Chunk) {
-	h.workers <- ch
+// storeChunk submits the chunk to the underlying store in its own goroutine.
+// It blocks while the number of pending chunks is at the limit and returns the
+// context error if the context is done before the chunk could be submitted.
+func (h *hasherStore) storeChunk(ctx context.Context, ch Chunk) error {
+	select {
+	case h.workers <- ch:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 	atomic.AddUint64(&h.nrChunks, 1)
 	go func() {
 		defer func() {
 			<-h.workers
 		}()
-		seen, err := h.store.Put(ctx, chunk.ModePutUpload, ch)
-		h.tag.Inc(chunk.StateStored)
-		if err == nil && seen[0] {
-			h.tag.Inc(chunk.StateSeen)
+		seen, err := h.put(ctx, ch)
+		if err == nil {
+			// a chunk that has been seen before, either in an earlier upload
+			// or earlier in this one, is already in the store, so it counts
+			// as stored for both the tag and the wait logic
+			h.tag.Inc(chunk.StateStored)
+			if len(seen) > 0 && seen[0] {
+				h.tag.Inc(chunk.StateSeen)
+			}
 		}
 		select {
 		case h.errC <- err:
 		case <-h.quitC:
 		}
 	}()
+	return nil
 }
 
 func parseReference(ref Reference, hashSize int) (Address, encryption.Key, error) {
@@ -304,3 +435,18 @@ func parseReference(ref Reference, hashSize int) (Address, encryption.Key, error
 		return nil, nil, fmt.Errorf("Invalid reference length, expected %v or %v got %v", hashSize, encryptedRefLength, len(ref))
 	}
 }
+
+// put puts the chunk to the underlying store, unless skipStored is set and the
+// store already has the chunk, in which case the chunk is reported as seen.
+func (h *hasherStore) put(ctx context.Context, ch Chunk) (seen []bool, err error) {
+	if h.skipStored {
+		has, err := h.store.HasMulti(ctx, ch.Address())
+		if err != nil {
+			return nil, err
+		}
+		if len(has) > 0 && has[0] {
+			return has, nil
+		}
+	}
+	return h.store.Put(ctx, chunk.ModePutUpload, ch)
+}
@@ -19,7 +19,9 @@ package storage
 import (
 	"bytes"
 	"context"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/holisticode/swarm/chunk"
@@ -123,3 +125,162 @@ func TestHasherStore(t *testing.T) {
 		}
 	}
 }
+
+// TestDecryptedDataLength tests the length of the data of chunks in multi-level trees,
+// for both plain and encrypted references
+func TestDecryptedDataLength(t *testing.T) {
+	const size = chunk.DefaultSize
+	for _, tc := range []struct {
+		span    uint64
+		refSize int64
+		want    uint64
+	}{
+		{0, AddressLength, 0},
+		{1000, AddressLength, 1000},
+		{size, AddressLength, size},
+		{size + 1, AddressLength, 2 * AddressLength},
+		{128 * size, AddressLength, 128 * AddressLength},
+		{128*size + 1, AddressLength, 2 * AddressLength},
+		{128 * 128 * size, AddressLength, 128 * AddressLength},
+		{128*128*size + 1, AddressLength, 2 * AddressLength},
+		{size, 2 * AddressLength, size},
+		{size + 1, 2 * AddressLength, 2 * 2 * AddressLength},
+		{64 * size, 2 * AddressLength, 64 * 2 * AddressLength},
+		{64*size + 1, 2 * AddressLength, 2 * 2 * AddressLength},
+		{64*64*size - 1, 2 * AddressLength, 64 * 2 * AddressLength},
+		{64 * 64 * size, 2 * AddressLength, 64 * 2 * AddressLength},
+		{64*64*size + 1, 2 * AddressLength, 2 * 2 * AddressLength},
+		{64*64*64*size + size, 2 * AddressLength, 2 * 2 * AddressLength},
+	} {
+		if got := decryptedDataLength(tc.span, tc.refSize, size); got != tc.want {
+			t.Errorf("span %v ref size %v: got length %v, want %v", tc.span, tc.refSize, got, tc.want)
+		}
+	}
+}
+
+// TestHasherStoreDecryptInto tests that encrypted chunk data is decrypted into
+// the caller buffer without the padding
+func TestHasherStoreDecryptInto(t *testing.T) {
+	chunkStore := NewMapChunkStore()
+	hasherStore := NewHasherStore(chunkStore, MakeHashFunc(DefaultHash), true, chunk.NewTag(0, "test-tag", 1, false))
+
+	ctx, cancel := context.WithTimeout(context.Background(), getTimeout)
+	defer cancel()
+
+	chunkData := GenerateRandomChunk(1000).Data()
+	ref, err := hasherStore.Put(ctx, chunkData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hasherStore.Close()
+	if err := hasherStore.Wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	hash, key, err := parseReference(ref, hasherStore.hashSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch, err := chunkStore.Get(ctx, chunk.ModeGetRequest, hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dst := make([]byte, chunk.DefaultSize+8)
+	n, err := hasherStore.DecryptInto(dst, ch.Data(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(chunkData, dst[:n]) {
+		t.Fatalf("Expected decrypted chunk data %v, got %v", common.Bytes2Hex(chunkData), common.Bytes2Hex(dst[:n]))
+	}
+
+	if _, err := hasherStore.DecryptInto(make([]byte, n-1), ch.Data(), key); err == nil {
+		t.Fatal("Expected error for destination shorter than decrypted chunk data")
+	}
+}
+
+// slowChunkStore blocks every Put until release is closed and records the
+// highest number of concurrent Put calls
+type slowChunkStore struct {
+	*MapChunkStore
+	release chan struct{}
+	mu      sync.Mutex
+	pending int
+	max     int
+}
+
+func (s *slowChunkStore) Put(ctx context.Context, mode chunk.ModePut, chs ...Chunk) ([]bool, error) {
+	s.mu.Lock()
+	s.pending++
+	if s.pending > s.max {
+		s.max = s.pending
+	}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.pending--
+		s.mu.Unlock()
+	}()
+	<-s.release
+	return s.MapChunkStore.Put(ctx, mode, chs...)
+}
+
+// TestHasherStoreMaxPendingChunks tests that hasherStore.Put blocks once the
+// configured number of chunks is waiting to be stored by a slow store, and
+// that it respects the context while blocked
+func TestHasherStoreMaxPendingChunks(t *testing.T) {
+	maxPending := 4
+	store := &slowChunkStore{
+		MapChunkStore: NewMapChunkStore(),
+		release:       make(chan struct{}),
+	}
+	hasherStore := NewHasherStore(store, MakeHashFunc(DefaultHash), false, chunk.NewTag(0, "test-tag", 0, false), WithMaxPendingChunks(maxPending))
+
+	ctx, cancel := context.WithTimeout(context.Background(), getTimeout)
+	defer cancel()
+
+	for i := 0; i < maxPending; i++ {
+		if _, err := hasherStore.Put(ctx, GenerateRandomChunk(1000).Data()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	blockedCtx, blockedCancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer blockedCancel()
+	if _, err := hasherStore.Put(blockedCtx, GenerateRandomChunk(1000).Data()); err != context.DeadlineExceeded {
+		t.Fatalf("expected error %v, got %v", context.DeadlineExceeded, err)
+	}
+
+	putC := make(chan error)
+	go func() {
+		for i := 0; i < 2*maxPending; i++ {
+			if _, err := hasherStore.Put(ctx, GenerateRandomChunk(1000).Data()); err != nil {
+				putC <- err
+				return
+			}
+		}
+		putC <- nil
+	}()
+	select {
+	case err := <-putC:
+		t.Fatalf("expected put to block, got %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(store.release)
+	if err := <-putC; err != nil {
+		t.Fatal(err)
+	}
+	hasherStore.Close()
+	if err := hasherStore.Wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if store.max > maxPending {
+		t.Fatalf("expected at most %v pending chunks, got %v", maxPending, store.max)
+	}
+	if got := len(store.chunks); got != 3*maxPending {
+		t.Fatalf("expected %v stored chunks, got %v", 3*maxPending, got)
+	}
+}
@@ -0,0 +1,53 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package localstore
+
+import (
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/holisticode/swarm/chunk"
+)
+
+// BlobStore stores chunk data outside of the leveldb database.
+// If it is configured with Options.BlobStore, the retrieval data index
+// keeps only the chunk metadata and delegates storing and retrieving
+// of the Data field to the BlobStore. By default chunk data is stored
+// in the retrieval data index value.
+type BlobStore interface {
+	// Get returns the data stored under the chunk address.
+	Get(addr []byte) (data []byte, err error)
+	// Put stores the data under the chunk address.
+	Put(addr []byte, data []byte) error
+	// Delete removes the data stored under the chunk address.
+	Delete(addr []byte) error
+}
+
+// deleteBlobs removes chunk data from the BlobStore after the chunks
+// are removed from the retrieval data index. It is a no-op if no
+// BlobStore is configured. Errors are only logged as the chunks are
+// already removed from the database and orphaned blobs are harmless.
+func (db *DB) deleteBlobs(addrs []chunk.Address) {
+	if db.blobStore == nil {
+		return
+	}
+	for _, addr := range addrs {
+		if err := db.blobStore.Delete(addr); err != nil {
+			metrics.GetOrRegisterCounter("localstore/blob/delete/error", nil).Inc(1)
+			log.Error("localstore delete blob", "addr", addr, "err", err)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package localstore
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/holisticode/swarm/chunk"
+)
+
+// mapBlobStore is a BlobStore that keeps chunk data in a map.
+type mapBlobStore struct {
+	blobs map[string][]byte
+	mu    sync.Mutex
+}
+
+func newMapBlobStore() *mapBlobStore {
+	return &mapBlobStore{
+		blobs: make(map[string][]byte),
+	}
+}
+
+func (s *mapBlobStore) Get(addr []byte) (data []byte, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, ok := s.blobs[string(addr)]
+	if !ok {
+		return nil, chunk.ErrChunkNotFound
+	}
+	return data, nil
+}
+
+func (s *mapBlobStore) Put(addr []byte, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.blobs[string(addr)] = append([]byte(nil), data...)
+	return nil
+}
+
+func (s *mapBlobStore) Delete(addr []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.blobs, string(addr))
+	return nil
+}
+
+func (s *mapBlobStore) len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.blobs)
+}
+
+// TestBlobStore validates that chunk data is stored in and
+// retrieved from the configured BlobStore and that the data is
+// deleted from the BlobStore when the chunk is removed.
+func TestBlobStore(t *testing.T) {
+	blobStore := newMapBlobStore()
+	db, cleanupFunc := newTestDB(t, &Options{
+		BlobStore: blobStore,
+	})
+	defer cleanupFunc()
+
+	chunks := generateTestRandomChunks(10)
+
+	_, err := db.Put(context.Background(), chunk.ModePutUpload, chunks...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := blobStore.len(); got != len(chunks) {
+		t.Fatalf("got %v blobs, want %v", got, len(chunks))
+	}
+
+	for _, ch := range chunks {
+		data, err := blobStore.Get(ch.Address())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data, ch.Data()) {
+			t.Fatalf("got blob data %x, want %x", data, ch.Data())
+		}
+
+		got, err := db.Get(context.Background(), chunk.ModeGetRequest, ch.Address())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got.Data(), ch.Data()) {
+			t.Fatalf("got chunk data %x, want %x", got.Data(), ch.Data())
+		}
+	}
+
+	// chunk data must not be available from
+	// leveldb if it is missing in the BlobStore
+	err = blobStore.Delete(chunks[1].Address())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Get(context.Background(), chunk.ModeGetLookup, chunks[1].Address())
+	if err != chunk.ErrChunkNotFound {
+		t.Errorf("got error %v, want %v", err, chunk.ErrChunkNotFound)
+	}
+
+	err = db.Set(context.Background(), chunk.ModeSetRemove, chunks[0].Address())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := blobStore.len(); got != len(chunks)-2 {
+		t.Fatalf("got %v blobs, want %v", got, len(chunks)-2)
+	}
+	_, err = db.Get(context.Background(), chunk.ModeGetRequest, chunks[0].Address())
+	if err != chunk.ErrChunkNotFound {
+		t.Errorf("got error %v, want %v", err, chunk.ErrChunkNotFound)
+	}
+}
@@ -0,0 +1,122 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package localstore
+
+import (
+	"time"
+
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/holisticode/swarm/chunk"
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+// ChunkInfo holds metadata of a stored chunk.
+type ChunkInfo struct {
+	Address         chunk.Address
+	StoreTimestamp  int64  // time of the first store in nanoseconds
+	AccessTimestamp int64  // time of the last access in nanoseconds, 0 if never accessed
+	AccessCount     uint64 // number of requests for the chunk
+	BinID           uint64 // id in the pull index bin
+	PO              uint8  // proximity order of the address to the base key
+	Pinned          bool
+	PinCounter      uint64
+}
+
+// ChunkInfo returns metadata of the chunk with the provided address
+// from retrieval and pin indexes. It does not update any index.
+// If the chunk is not stored, chunk.ErrChunkNotFound is returned.
+func (db *DB) ChunkInfo(addr chunk.Address) (info *ChunkInfo, err error) {
+	metricName := "localstore/ChunkInfo"
+
+	metrics.GetOrRegisterCounter(metricName, nil).Inc(1)
+	defer totalTimeMetric(metricName, time.Now())
+
+	defer func() {
+		if err != nil && err != chunk.ErrChunkNotFound {
+			metrics.GetOrRegisterCounter(metricName+"/error", nil).Inc(1)
+		}
+	}()
+
+	item := addressToItem(addr)
+
+	out, err := db.retrievalDataIndex.Get(item)
+	if err != nil {
+		if err == leveldb.ErrNotFound {
+			return nil, chunk.ErrChunkNotFound
+		}
+		return nil, err
+	}
+	info = &ChunkInfo{
+		Address:        addr,
+		StoreTimestamp: out.StoreTimestamp,
+		BinID:          out.BinID,
+		PO:             db.po(addr),
+	}
+
+	i, err := db.retrievalAccessIndex.Get(item)
+	switch err {
+	case nil:
+		info.AccessTimestamp = i.AccessTimestamp
+		info.AccessCount = i.AccessCount
+	case leveldb.ErrNotFound:
+		// no chunk accesses
+	default:
+		return nil, err
+	}
+
+	i, err = db.pinIndex.Get(item)
+	switch err {
+	case nil:
+		info.Pinned = true
+		info.PinCounter = i.PinCounter
+	case leveldb.ErrNotFound:
+		// chunk is not pinned
+	default:
+		return nil, err
+	}
+	return info, nil
+}
+
+// AccessCount returns the number of times the chunk was requested with
+// chunk.ModeGetRequest. The counter is updated together with the access
+// timestamp, so requests for chunks that are not yet synced are not counted.
+// If the chunk is not stored, chunk.ErrChunkNotFound is returned.
+func (db *DB) AccessCount(addr chunk.Address) (count uint64, err error) {
+	metricName := "localstore/AccessCount"
+
+	metrics.GetOrRegisterCounter(metricName, nil).Inc(1)
+
+	item := addressToItem(addr)
+
+	i, err := db.retrievalAccessIndex.Get(item)
+	switch err {
+	case nil:
+		return i.AccessCount, nil
+	case leveldb.ErrNotFound:
+		// no chunk accesses
+	default:
+		return 0, err
+	}
+	has, err := db.retrievalDataIndex.Has(item)
+	if err != nil {
+		return 0, err
+	}
+	if !has {
+		return 0, chunk.ErrChunkNotFound
+	}
+	return 0, nil
+}
@@ -0,0 +1,166 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package localstore
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/holisticode/swarm/chunk"
+)
+
+// TestChunkInfo validates that ChunkInfo returns metadata
+// of a stored chunk and chunk.ErrChunkNotFound for a missing one.
+func TestChunkInfo(t *testing.T) {
+	db, cleanupFunc := newTestDB(t, nil)
+	defer cleanupFunc()
+
+	ch := generateTestRandomChunk()
+
+	storeTimestamp := int64(1000)
+	defer setNow(func() int64 {
+		return storeTimestamp
+	})()
+
+	_, err := db.Put(context.Background(), chunk.ModePutUpload, ch)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := db.ChunkInfo(ch.Address())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := ChunkInfo{
+		Address:        ch.Address(),
+		StoreTimestamp: storeTimestamp,
+		BinID:          1,
+		PO:             db.po(ch.Address()),
+	}
+	if !bytes.Equal(info.Address, want.Address) || info.StoreTimestamp != want.StoreTimestamp || info.AccessTimestamp != 0 ||
+		info.BinID != want.BinID || info.PO != want.PO || info.Pinned || info.PinCounter != 0 {
+		t.Fatalf("got chunk info %+v, want %+v", *info, want)
+	}
+
+	accessTimestamp := int64(2000)
+	defer setNow(func() int64 {
+		return accessTimestamp
+	})()
+
+	err = db.Set(context.Background(), chunk.ModeSetSyncPush, ch.Address())
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Set(context.Background(), chunk.ModeSetPin, ch.Address())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, err = db.ChunkInfo(ch.Address())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.StoreTimestamp != storeTimestamp {
+		t.Errorf("got store timestamp %v, want %v", info.StoreTimestamp, storeTimestamp)
+	}
+	if info.AccessTimestamp != accessTimestamp {
+		t.Errorf("got access timestamp %v, want %v", info.AccessTimestamp, accessTimestamp)
+	}
+	if !info.Pinned || info.PinCounter != 1 {
+		t.Errorf("got pinned %v with counter %v, want pinned with counter 1", info.Pinned, info.PinCounter)
+	}
+
+	_, err = db.ChunkInfo(generateTestRandomChunk().Address())
+	if err != chunk.ErrChunkNotFound {
+		t.Errorf("got error %v, want %v", err, chunk.ErrChunkNotFound)
+	}
+}
+
+// TestAccessCount validates that AccessCount returns the number of
+// requests for a synced chunk and chunk.ErrChunkNotFound for a missing one.
+func TestAccessCount(t *testing.T) {
+	db, cleanupFunc := newTestDB(t, nil)
+	defer cleanupFunc()
+
+	testHookUpdateGCChan := make(chan struct{})
+	defer setTestHookUpdateGC(func() {
+		testHookUpdateGCChan <- struct{}{}
+	})()
+
+	ch := generateTestRandomChunk()
+
+	_, err := db.Put(context.Background(), chunk.ModePutUpload, ch)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// requests for a chunk that is not synced are not counted
+	_, err = db.Get(context.Background(), chunk.ModeGetRequest, ch.Address())
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-testHookUpdateGCChan
+
+	count, err := db.AccessCount(ch.Address())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 0 {
+		t.Fatalf("got access count %v, want 0", count)
+	}
+
+	err = db.Set(context.Background(), chunk.ModeSetSyncPush, ch.Address())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	requests := 3
+	for i := 0; i < requests; i++ {
+		_, err = db.Get(context.Background(), chunk.ModeGetRequest, ch.Address())
+		if err != nil {
+			t.Fatal(err)
+		}
+		<-testHookUpdateGCChan
+	}
+	// other get modes do not change the counter
+	_, err = db.Get(context.Background(), chunk.ModeGetLookup, ch.Address())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	count, err = db.AccessCount(ch.Address())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != uint64(requests) {
+		t.Fatalf("got access count %v, want %v", count, requests)
+	}
+
+	info, err := db.ChunkInfo(ch.Address())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.AccessCount != uint64(requests) {
+		t.Fatalf("got chunk info access count %v, want %v", info.AccessCount, requests)
+	}
+
+	_, err = db.AccessCount(generateTestRandomChunk().Address())
+	if err != chunk.ErrChunkNotFound {
+		t.Fatalf("got error %v, want %v", err, chunk.ErrChunkNotFound)
+	}
+}
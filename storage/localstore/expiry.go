@@ -0,0 +1,208 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package localstore
+
+import (
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/holisticode/swarm/chunk"
+	"github.com/holisticode/swarm/shed"
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+// sweepExpiredBatchSize limits the number of chunks in a single
+// leveldb batch on expired chunks removal.
+var sweepExpiredBatchSize uint64 = 200
+
+// sweepExpiredWorker is a long running function that periodically
+// removes the chunks stored with PutWithTTL whose TTL has passed.
+func (db *DB) sweepExpiredWorker() {
+	defer close(db.expirySweepWorkerDone)
+
+	ticker := time.NewTicker(db.expirySweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			for {
+				// if done is false, sweepExpiredBatchSize is reached
+				// and another sweep run is needed
+				removedCount, done, err := db.sweepExpired()
+				if err != nil {
+					log.Error("localstore sweep expired chunks", "err", err)
+				}
+				if testHookSweepExpired != nil {
+					testHookSweepExpired(removedCount)
+				}
+				if done || err != nil {
+					break
+				}
+			}
+		case <-db.close:
+			return
+		}
+	}
+}
+
+// sweepExpired removes chunks with expiry timestamps in the past from
+// retrieval and other indexes. Pinned chunks are not removed, only
+// their expiry is cleared. This function returns the number of removed
+// chunks. If done is false, another call to this function is needed to
+// remove the rest of the expired chunks as the batch size limit is reached.
+func (db *DB) sweepExpired() (removedCount uint64, done bool, err error) {
+	metricName := "localstore/expiry"
+	metrics.GetOrRegisterCounter(metricName, nil).Inc(1)
+	defer totalTimeMetric(metricName, time.Now())
+	defer func() {
+		if err != nil {
+			metrics.GetOrRegisterCounter(metricName+"/error", nil).Inc(1)
+		}
+	}()
+
+	batch := new(leveldb.Batch)
+
+	// protect database from changing idexes and gcSize
+	db.batchMu.Lock()
+	defer db.batchMu.Unlock()
+
+	var gcSizeChange int64
+	var sweptCount uint64
+	var removed []chunk.Address
+	ts := now()
+	done = true
+	err = db.expirySweepIndex.Iterate(func(item shed.Item) (stop bool, err error) {
+		if item.ExpiryTimestamp > ts {
+			return true, nil
+		}
+		if sweptCount >= sweepExpiredBatchSize {
+			// batch size limit reached,
+			// another sweep run is needed
+			done = false
+			return true, nil
+		}
+		sweptCount++
+
+		db.expiryIndex.DeleteInBatch(batch, item)
+		db.expirySweepIndex.DeleteInBatch(batch, item)
+
+		pinned, err := db.pinIndex.Has(item)
+		if err != nil {
+			return true, err
+		}
+		if pinned {
+			return false, nil
+		}
+
+		i, err := db.retrievalDataIndex.Get(item)
+		switch err {
+		case nil:
+		case leveldb.ErrNotFound:
+			// already removed by the garbage collection
+			return false, nil
+		default:
+			return true, err
+		}
+		item.StoreTimestamp = i.StoreTimestamp
+		item.BinID = i.BinID
+
+		i, err = db.retrievalAccessIndex.Get(item)
+		switch err {
+		case nil:
+			item.AccessTimestamp = i.AccessTimestamp
+			db.retrievalAccessIndex.DeleteInBatch(batch, item)
+			db.gcIndex.DeleteInBatch(batch, item)
+			gcSizeChange--
+		case leveldb.ErrNotFound:
+			// chunk is not in the gc index
+		default:
+			return true, err
+		}
+
+		// delete from retrieve, push, pull
+		db.retrievalDataIndex.DeleteInBatch(batch, item)
+		db.pushIndex.DeleteInBatch(batch, item)
+		db.pullIndex.DeleteInBatch(batch, item)
+		if db.blobStore != nil {
+			removed = append(removed, append(chunk.Address(nil), item.Address...))
+		}
+		removedCount++
+		return false, nil
+	}, nil)
+	if err != nil {
+		return 0, false, err
+	}
+	metrics.GetOrRegisterCounter(metricName+"/removed-count", nil).Inc(int64(removedCount))
+
+	err = db.incGCSizeInBatch(batch, gcSizeChange)
+	if err != nil {
+		return 0, false, err
+	}
+
+	err = db.shed.WriteBatch(batch)
+	if err != nil {
+		metrics.GetOrRegisterCounter(metricName+"/writebatch/err", nil).Inc(1)
+		return 0, false, err
+	}
+	db.deleteBlobs(removed)
+	return removedCount, done, nil
+}
+
+// setExpiryInBatch adds the chunk address with its expiry
+// timestamp to the expiry indexes.
+func (db *DB) setExpiryInBatch(batch *leveldb.Batch, addr chunk.Address, expiry int64) {
+	item := addressToItem(addr)
+	item.ExpiryTimestamp = expiry
+	db.expiryIndex.PutInBatch(batch, item)
+	db.expirySweepIndex.PutInBatch(batch, item)
+}
+
+// deleteExpiryInBatch removes the chunk address from the expiry
+// indexes, if it was stored with a TTL.
+func (db *DB) deleteExpiryInBatch(batch *leveldb.Batch, addr chunk.Address) error {
+	item, err := db.expiryIndex.Get(addressToItem(addr))
+	switch err {
+	case nil:
+		db.expiryIndex.DeleteInBatch(batch, item)
+		db.expirySweepIndex.DeleteInBatch(batch, item)
+		return nil
+	case leveldb.ErrNotFound:
+		return nil
+	default:
+		return err
+	}
+}
+
+// isExpired returns true if the item was stored with a TTL that has passed.
+func (db *DB) isExpired(item shed.Item) (bool, error) {
+	i, err := db.expiryIndex.Get(addressToItem(item.Address))
+	switch err {
+	case nil:
+		return i.ExpiryTimestamp <= now(), nil
+	case leveldb.ErrNotFound:
+		return false, nil
+	default:
+		return false, err
+	}
+}
+
+// testHookSweepExpired is a hook that can provide
+// information when an expired chunks sweep run is done
+// and how many chunks it removed.
+var testHookSweepExpired func(removedCount uint64)
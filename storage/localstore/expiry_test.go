@@ -0,0 +1,192 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package localstore
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/holisticode/swarm/chunk"
+)
+
+// TestDB_PutWithTTL validates that chunks stored with a TTL are not
+// returned after it passes and that they are removed by sweepExpired,
+// while chunks stored without a TTL are kept.
+func TestDB_PutWithTTL(t *testing.T) {
+	db, cleanupFunc := newTestDB(t, &Options{
+		// do not let the sweep worker interfere with the test
+		ExpirySweepInterval: time.Hour,
+	})
+	defer cleanupFunc()
+
+	expiring := generateTestRandomChunk()
+	persistent := generateTestRandomChunk()
+
+	if _, err := db.PutWithTTL(context.Background(), chunk.ModePutUpload, time.Minute, expiring); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Put(context.Background(), chunk.ModePutUpload, persistent); err != nil {
+		t.Fatal(err)
+	}
+	// add both chunks to the gc index
+	if err := db.Set(context.Background(), chunk.ModeSetSyncPull, expiring.Address(), persistent.Address()); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := db.Get(context.Background(), chunk.ModeGetLookup, expiring.Address()); err != nil {
+		t.Fatalf("got error %v before ttl passed", err)
+	}
+
+	t.Run("expiry index count", newItemsCountTest(db.expiryIndex, 1))
+	t.Run("expiry sweep index count", newItemsCountTest(db.expirySweepIndex, 1))
+
+	defer setNow(func() int64 {
+		return time.Now().Add(2 * time.Minute).UTC().UnixNano()
+	})()
+
+	// the chunk must not be returned even before it is removed
+	if _, err := db.Get(context.Background(), chunk.ModeGetLookup, expiring.Address()); err != chunk.ErrChunkNotFound {
+		t.Fatalf("got error %v, want %v", err, chunk.ErrChunkNotFound)
+	}
+	if _, err := db.GetMulti(context.Background(), chunk.ModeGetLookup, expiring.Address(), persistent.Address()); err != chunk.ErrChunkNotFound {
+		t.Fatalf("got error %v, want %v", err, chunk.ErrChunkNotFound)
+	}
+	if _, err := db.Get(context.Background(), chunk.ModeGetLookup, persistent.Address()); err != nil {
+		t.Fatal(err)
+	}
+	has, err := db.Has(context.Background(), expiring.Address())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if has {
+		t.Error("expired chunk reported as stored")
+	}
+	have, err := db.HasMulti(context.Background(), expiring.Address(), persistent.Address())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have[0] || !have[1] {
+		t.Errorf("got has multi %v, want [false true]", have)
+	}
+
+	removedCount, done, err := db.sweepExpired()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !done {
+		t.Error("sweep not done")
+	}
+	if removedCount != 1 {
+		t.Errorf("got removed count %v, want %v", removedCount, 1)
+	}
+
+	t.Run("retrieve indexes count", newItemsCountTest(db.retrievalDataIndex, 1))
+	t.Run("pull index count", newItemsCountTest(db.pullIndex, 1))
+	t.Run("gc index count", newItemsCountTest(db.gcIndex, 1))
+	t.Run("gc size", newIndexGCSizeTest(db))
+	t.Run("expiry index count", newItemsCountTest(db.expiryIndex, 0))
+	t.Run("expiry sweep index count", newItemsCountTest(db.expirySweepIndex, 0))
+
+	if _, err := db.PutWithTTL(context.Background(), chunk.ModePutUpload, 0, expiring); err != ErrInvalidTTL {
+		t.Errorf("got error %v, want %v", err, ErrInvalidTTL)
+	}
+}
+
+// TestDB_sweepExpiredWorker validates that the background sweeper
+// removes a chunk after its TTL passes.
+func TestDB_sweepExpiredWorker(t *testing.T) {
+	db, cleanupFunc := newTestDB(t, &Options{
+		ExpirySweepInterval: 10 * time.Millisecond,
+	})
+	testHookSweepExpiredChan := make(chan uint64)
+	defer setTestHookSweepExpired(func(removedCount uint64) {
+		select {
+		case testHookSweepExpiredChan <- removedCount:
+		case <-db.close:
+		}
+	})()
+	defer cleanupFunc()
+
+	ch := generateTestRandomChunk()
+	if _, err := db.PutWithTTL(context.Background(), chunk.ModePutUpload, 50*time.Millisecond, ch); err != nil {
+		t.Fatal(err)
+	}
+
+	timeout := time.After(10 * time.Second)
+	for removed := uint64(0); removed == 0; {
+		select {
+		case removed = <-testHookSweepExpiredChan:
+		case <-timeout:
+			t.Fatal("sweep expired timeout")
+		}
+	}
+
+	if _, err := db.Get(context.Background(), chunk.ModeGetLookup, ch.Address()); err != chunk.ErrChunkNotFound {
+		t.Fatalf("got error %v, want %v", err, chunk.ErrChunkNotFound)
+	}
+	t.Run("retrieve indexes count", newItemsCountTest(db.retrievalDataIndex, 0))
+	t.Run("push index count", newItemsCountTest(db.pushIndex, 0))
+	t.Run("pull index count", newItemsCountTest(db.pullIndex, 0))
+}
+
+// TestDB_expiryIndexesRemoved validates that chunks stored with a TTL
+// are removed from the expiry indexes when they are removed by
+// ModeSetRemove or by the garbage collection before their TTL passes.
+func TestDB_expiryIndexesRemoved(t *testing.T) {
+	db, cleanupFunc := newTestDB(t, &Options{
+		// do not let the sweep worker interfere with the test
+		ExpirySweepInterval: time.Hour,
+	})
+	defer cleanupFunc()
+
+	removed := generateTestRandomChunk()
+	collected := generateTestRandomChunk()
+	for _, ch := range []chunk.Chunk{removed, collected} {
+		if _, err := db.PutWithTTL(context.Background(), chunk.ModePutUpload, time.Minute, ch); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Set(context.Background(), chunk.ModeSetSyncPull, ch.Address()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Run("expiry index count", newItemsCountTest(db.expiryIndex, 2))
+	t.Run("expiry sweep index count", newItemsCountTest(db.expirySweepIndex, 2))
+
+	if err := db.Set(context.Background(), chunk.ModeSetRemove, removed.Address()); err != nil {
+		t.Fatal(err)
+	}
+	t.Run("expiry index count after remove", newItemsCountTest(db.expiryIndex, 1))
+	t.Run("expiry sweep index count after remove", newItemsCountTest(db.expirySweepIndex, 1))
+
+	if _, err := db.CollectGarbage(0); err != nil {
+		t.Fatal(err)
+	}
+	t.Run("retrieve indexes count", newItemsCountTest(db.retrievalDataIndex, 0))
+	t.Run("expiry index count after gc", newItemsCountTest(db.expiryIndex, 0))
+	t.Run("expiry sweep index count after gc", newItemsCountTest(db.expirySweepIndex, 0))
+}
+
+// setTestHookSweepExpired sets testHookSweepExpired and
+// returns a function that will reset it to the
+// value before the change.
+func setTestHookSweepExpired(h func(removedCount uint64)) (reset func()) {
+	current := testHookSweepExpired
+	reset = func() { testHookSweepExpired = current }
+	testHookSweepExpired = h
+	return reset
+}
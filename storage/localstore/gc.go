@@ -21,6 +21,7 @@ import (
 
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/holisticode/swarm/chunk"
 	"github.com/holisticode/swarm/shed"
 	"github.com/syndtr/goleveldb/leveldb"
 )
@@ -53,7 +54,7 @@ func (db *DB) collectGarbageWorker() {
 			// run a single collect garbage run and
 			// if done is false, gcBatchSize is reached and
 			// another collect garbage run is needed
-			collectedCount, done, err := db.collectGarbage()
+			collectedCount, done, err := db.collectGarbage(db.gcTarget())
 			if err != nil {
 				log.Error("localstore collect garbage", "err", err)
 			}
@@ -71,13 +72,45 @@ func (db *DB) collectGarbageWorker() {
 	}
 }
 
+// CollectGarbage runs garbage collection until the number of chunks
+// in the gc index is not larger than the target, regardless of
+// the configured capacity. It returns the number of removed chunks.
+// It can be called while the database is in use, as it runs in
+// batches that are synchronized with other index updates in the
+// same way as the garbage collection triggered by capacity.
+func (db *DB) CollectGarbage(target uint64) (collectedCount uint64, err error) {
+	if db.updateGCSem != nil {
+		// take a spot in updateGCSem buffer, not to
+		// compete with more than maxParallelUpdateGC gc updates
+		select {
+		case db.updateGCSem <- struct{}{}:
+		case <-db.close:
+			return 0, ErrDBClosed
+		}
+		defer func() { <-db.updateGCSem }()
+	}
+	for {
+		c, done, err := db.collectGarbage(target)
+		collectedCount += c
+		if err != nil || done {
+			return collectedCount, err
+		}
+		select {
+		case <-db.close:
+			return collectedCount, ErrDBClosed
+		default:
+		}
+	}
+}
+
 // collectGarbage removes chunks from retrieval and other
-// indexes if maximal number of chunks in database is reached.
-// This function returns the number of removed chunks. If done
-// is false, another call to this function is needed to collect
-// the rest of the garbage as the batch size limit is reached.
-// This function is called in collectGarbageWorker.
-func (db *DB) collectGarbage() (collectedCount uint64, done bool, err error) {
+// indexes until the number of chunks in gc index is reduced to
+// the target value. This function returns the number of removed
+// chunks. If done is false, another call to this function is
+// needed to collect the rest of the garbage as the batch size limit
+// is reached. This function is called in collectGarbageWorker and
+// CollectGarbage.
+func (db *DB) collectGarbage(target uint64) (collectedCount uint64, done bool, err error) {
 	metricName := "localstore/gc"
 	metrics.GetOrRegisterCounter(metricName, nil).Inc(1)
 	defer totalTimeMetric(metricName, time.Now())
@@ -88,7 +121,6 @@ func (db *DB) collectGarbage() (collectedCount uint64, done bool, err error) {
 	}()
 
 	batch := new(leveldb.Batch)
-	target := db.gcTarget()
 
 	// protect database from changing idexes and gcSize
 	db.batchMu.Lock()
@@ -108,6 +140,7 @@ func (db *DB) collectGarbage() (collectedCount uint64, done bool, err error) {
 	}
 	metrics.GetOrRegisterGauge(metricName+"/gcsize", nil).Update(int64(gcSize))
 
+	var collected []chunk.Address
 	done = true
 	err = db.gcIndex.Iterate(func(item shed.Item) (stop bool, err error) {
 		if gcSize-collectedCount <= target {
@@ -117,11 +150,17 @@ func (db *DB) collectGarbage() (collectedCount uint64, done bool, err error) {
 		metrics.GetOrRegisterGauge(metricName+"/storets", nil).Update(item.StoreTimestamp)
 		metrics.GetOrRegisterGauge(metricName+"/accessts", nil).Update(item.AccessTimestamp)
 
-		// delete from retrieve, pull, gc
+		// delete from retrieve, pull, gc, expiry
 		db.retrievalDataIndex.DeleteInBatch(batch, item)
 		db.retrievalAccessIndex.DeleteInBatch(batch, item)
 		db.pullIndex.DeleteInBatch(batch, item)
 		db.gcIndex.DeleteInBatch(batch, item)
+		if err := db.deleteExpiryInBatch(batch, item.Address); err != nil {
+			return true, err
+		}
+		if db.blobStore != nil {
+			collected = append(collected, append(chunk.Address(nil), item.Address...))
+		}
 		collectedCount++
 		if collectedCount >= gcBatchSize {
 			// bach size limit reached,
@@ -143,6 +182,7 @@ func (db *DB) collectGarbage() (collectedCount uint64, done bool, err error) {
 		metrics.GetOrRegisterCounter(metricName+"/writebatch/err", nil).Inc(1)
 		return 0, false, err
 	}
+	db.deleteBlobs(collected)
 	return collectedCount, done, nil
 }
 
@@ -161,6 +201,16 @@ func (db *DB) removeChunksInExcludeIndexFromGC() (err error) {
 	excludedCount := 0
 	var gcSizeChange int64
 	err = db.gcExcludeIndex.Iterate(func(item shed.Item) (stop bool, err error) {
+		if item.ExpiryTimestamp != 0 {
+			// the chunk is reserved
+			c, err := db.updateReservedGCInBatch(batch, item)
+			if err != nil {
+				return true, err
+			}
+			gcSizeChange += c
+			return false, nil
+		}
+
 		// Get access timestamp
 		retrievalAccessIndexItem, err := db.retrievalAccessIndex.Get(item)
 		if err != nil {
@@ -134,6 +134,76 @@ func testDBCollectGarbageWorker(t *testing.T) {
 	})
 }
 
+// TestDB_DisableGC validates that no chunks are garbage collected
+// when gc is disabled, even if their number exceeds the capacity.
+func TestDB_DisableGC(t *testing.T) {
+	chunkCount := 150
+
+	db, cleanupFunc := newTestDB(t, &Options{
+		Capacity:  100,
+		DisableGC: true,
+	})
+	defer setTestHookCollectGarbage(func(collectedCount uint64) {
+		t.Errorf("garbage collected %v chunks with gc disabled", collectedCount)
+	})()
+	defer cleanupFunc()
+
+	addrs := make([]chunk.Address, 0)
+
+	// upload, sync and request random chunks
+	for i := 0; i < chunkCount; i++ {
+		ch := generateTestRandomChunk()
+
+		_, err := db.Put(context.Background(), chunk.ModePutUpload, ch)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = db.Set(context.Background(), chunk.ModeSetSyncPull, ch.Address())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = db.Get(context.Background(), chunk.ModeGetRequest, ch.Address())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		addrs = append(addrs, ch.Address())
+	}
+
+	// give the gc a chance to run if it was triggered
+	time.Sleep(100 * time.Millisecond)
+
+	t.Run("pull index count", newItemsCountTest(db.pullIndex, chunkCount))
+
+	t.Run("gc index count", newItemsCountTest(db.gcIndex, 0))
+
+	t.Run("gc size", newIndexGCSizeTest(db))
+
+	t.Run("debug indices", func(t *testing.T) {
+		indices, err := db.DebugIndices()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if indices["retrievalDataIndex"] != chunkCount {
+			t.Errorf("got %v chunks in retrieval data index, want %v", indices["retrievalDataIndex"], chunkCount)
+		}
+		if indices["gcSize"] != 0 {
+			t.Errorf("got gc size %v, want 0", indices["gcSize"])
+		}
+	})
+
+	t.Run("get chunks", func(t *testing.T) {
+		for _, a := range addrs {
+			_, err := db.Get(context.Background(), chunk.ModeGetRequest, a)
+			if err != nil {
+				t.Errorf("got error %v for chunk %s", err, a)
+			}
+		}
+	})
+}
+
 // Pin a file, upload chunks to go past the gc limit to trigger GC,
 // check if the pinned files are still around and removed from gcIndex
 func TestPinGC(t *testing.T) {
@@ -529,3 +599,69 @@ func TestSetTestHookCollectGarbage(t *testing.T) {
 		t.Errorf("got hook value %v, want %v", got, original)
 	}
 }
+
+// TestDB_CollectGarbage validates that garbage collection can be
+// run on demand down to a target that is lower than the capacity.
+func TestDB_CollectGarbage(t *testing.T) {
+	chunkCount := 50
+
+	db, cleanupFunc := newTestDB(t, &Options{
+		Capacity: 100,
+	})
+	defer cleanupFunc()
+
+	// lower the maximal number of chunks in a single
+	// gc batch to ensure multiple batches.
+	defer func(s uint64) { gcBatchSize = s }(gcBatchSize)
+	gcBatchSize = 7
+
+	addrs := make([]chunk.Address, 0)
+	for i := 0; i < chunkCount; i++ {
+		ch := generateTestRandomChunk()
+
+		_, err := db.Put(context.Background(), chunk.ModePutUpload, ch)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = db.Set(context.Background(), chunk.ModeSetSyncPull, ch.Address())
+		if err != nil {
+			t.Fatal(err)
+		}
+		addrs = append(addrs, ch.Address())
+	}
+
+	target := 20
+	collected, err := db.CollectGarbage(uint64(target))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if collected != uint64(chunkCount-target) {
+		t.Errorf("got %v collected chunks, want %v", collected, chunkCount-target)
+	}
+
+	t.Run("gc index count", newItemsCountTest(db.gcIndex, target))
+
+	t.Run("gc size", newIndexGCSizeTest(db))
+
+	t.Run("only first inserted chunks should be removed", func(t *testing.T) {
+		for i, addr := range addrs {
+			_, err := db.Get(context.Background(), chunk.ModeGetLookup, addr)
+			if i < chunkCount-target {
+				if err != chunk.ErrChunkNotFound {
+					t.Errorf("chunk %v: got error %v, want %v", i, err, chunk.ErrChunkNotFound)
+				}
+			} else if err != nil {
+				t.Errorf("chunk %v: %v", i, err)
+			}
+		}
+	})
+
+	// a target above the gc size does not remove any chunks
+	collected, err = db.CollectGarbage(uint64(chunkCount))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if collected != 0 {
+		t.Errorf("got %v collected chunks, want 0", collected)
+	}
+}
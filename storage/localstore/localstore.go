@@ -19,6 +19,7 @@ package localstore
 import (
 	"encoding/binary"
 	"errors"
+	"fmt"
 	"os"
 	"runtime/pprof"
 	"sync"
@@ -29,6 +30,7 @@ import (
 	"github.com/holisticode/swarm/chunk"
 	"github.com/holisticode/swarm/shed"
 	"github.com/holisticode/swarm/storage/mock"
+	"github.com/syndtr/goleveldb/leveldb"
 )
 
 // DB implements chunk.Store.
@@ -42,6 +44,21 @@ var (
 	// is updated in parallel and one of the updates
 	// takes longer then the configured timeout duration.
 	ErrAddressLockTimeout = errors.New("address lock timeout")
+	// ErrInvalidTTL is returned when a chunk is put
+	// with a TTL that is not a positive duration.
+	ErrInvalidTTL = errors.New("invalid ttl")
+	// ErrInvalidGracePeriod is returned when chunks are reserved
+	// with a grace period that is not a positive duration.
+	ErrInvalidGracePeriod = errors.New("invalid grace period")
+	// ErrInvalidBin is returned when a proximity order bin
+	// is larger than chunk.MaxPO.
+	ErrInvalidBin = errors.New("invalid bin")
+	// ErrInvalidRange is returned when the until bin id
+	// is smaller than the since bin id.
+	ErrInvalidRange = errors.New("invalid range")
+	// ErrDBClosed is returned when a long running operation
+	// is interrupted because the database is closed.
+	ErrDBClosed = errors.New("database closed")
 )
 
 var (
@@ -50,6 +67,8 @@ var (
 	// Limit the number of goroutines created by Getters
 	// that call updateGC function. Value 0 sets no limit.
 	maxParallelUpdateGC = 1000
+	// Default value for ExpirySweepInterval DB option.
+	defaultExpirySweepInterval = time.Minute
 )
 
 // DB is the local store implementation and holds
@@ -89,6 +108,13 @@ type DB struct {
 	// pin files Index
 	pinIndex shed.Index
 
+	// expiry timestamps of chunks stored with a TTL
+	expiryIndex shed.Index
+	// chunks stored with a TTL ordered by ascending expiry timestamp
+	expirySweepIndex shed.Index
+	// interval between removals of expired chunks
+	expirySweepInterval time.Duration
+
 	// field that stores number of intems in gc index
 	gcSize shed.Uint64Field
 
@@ -96,6 +122,10 @@ type DB struct {
 	// the capacity value
 	capacity uint64
 
+	// if true, chunks are never added to the gc index
+	// and garbage collection is never run
+	gcDisabled bool
+
 	// triggers garbage collection event loop
 	collectGarbageTrigger chan struct{}
 
@@ -120,8 +150,22 @@ type DB struct {
 	// are done
 	collectGarbageWorkerDone chan struct{}
 
+	// protect Close method from exiting before
+	// the expired chunks sweep worker is done
+	expirySweepWorkerDone chan struct{}
+
 	putToGCCheck func([]byte) bool
 
+	// optional store for chunk data outside of leveldb,
+	// chunk data is deleted from it when chunks are removed
+	blobStore BlobStore
+
+	// chunk data shards opened by New from Options.DataPaths,
+	// nil if chunk data is not sharded
+	dataShards *shardedBlobStore
+	// number of shards the stored chunk data is spread over
+	dataShardsCount shed.Uint64Field
+
 	// wait for all subscriptions to finish before closing
 	// underlaying LevelDB to prevent possible panics from
 	// iterators
@@ -146,6 +190,25 @@ type Options struct {
 	// to verify whether that chunk needs to be Set and added to
 	// garbage collection index too
 	PutToGCCheck func([]byte) bool
+	// ExpirySweepInterval is the interval between removals
+	// of chunks stored with PutWithTTL whose TTL has passed.
+	ExpirySweepInterval time.Duration
+	// DisableGC disables garbage collection, so that chunks are never
+	// removed regardless of Capacity, as required by archival nodes.
+	DisableGC bool
+	// MemDB keeps all data in memory instead of on disk at the path
+	// given to New. Data is lost when the DB is closed.
+	MemDB bool
+	// BlobStore stores chunk data outside of leveldb, while chunk
+	// metadata is still kept in leveldb indexes. It is ignored if
+	// MockStore is set.
+	BlobStore BlobStore
+	// DataPaths are the paths of the databases chunk data is sharded
+	// across by address prefix, while all indexes are kept in the
+	// database at the path given to New. It is ignored if MockStore
+	// or BlobStore is set. The number of paths must not change once
+	// the database holds chunks.
+	DataPaths []string
 }
 
 // New returns a new DB.  All fields and indexes are initialized
@@ -164,9 +227,10 @@ func New(path string, baseKey []byte, o *Options) (db *DB, err error) {
 	}
 
 	db = &DB{
-		capacity: o.Capacity,
-		baseKey:  baseKey,
-		tags:     o.Tags,
+		capacity:   o.Capacity,
+		gcDisabled: o.DisableGC,
+		baseKey:    baseKey,
+		tags:       o.Tags,
 		// channel collectGarbageTrigger
 		// needs to be buffered with the size of 1
 		// to signal another event if it
@@ -174,19 +238,37 @@ func New(path string, baseKey []byte, o *Options) (db *DB, err error) {
 		collectGarbageTrigger:    make(chan struct{}, 1),
 		close:                    make(chan struct{}),
 		collectGarbageWorkerDone: make(chan struct{}),
+		expirySweepWorkerDone:    make(chan struct{}),
 		putToGCCheck:             o.PutToGCCheck,
+		expirySweepInterval:      o.ExpirySweepInterval,
 	}
 	if db.capacity <= 0 {
 		db.capacity = defaultCapacity
 	}
+	if db.expirySweepInterval <= 0 {
+		db.expirySweepInterval = defaultExpirySweepInterval
+	}
 	if maxParallelUpdateGC > 0 {
 		db.updateGCSem = make(chan struct{}, maxParallelUpdateGC)
 	}
 
-	db.shed, err = shed.NewDB(path, o.MetricsPrefix)
+	if o.MemDB {
+		db.shed, err = shed.NewInmemoryDB(o.MetricsPrefix)
+	} else {
+		db.shed, err = shed.NewDB(path, o.MetricsPrefix)
+	}
 	if err != nil {
 		return nil, err
 	}
+	defer func(db *DB) {
+		// close the databases if New fails, as db is not returned
+		if err != nil {
+			db.shed.Close()
+			if db.dataShards != nil {
+				db.dataShards.Close()
+			}
+		}
+	}(db)
 
 	// Identify current storage schema by arbitrary name.
 	db.schemaName, err = db.shed.NewStringField("schema-name")
@@ -220,13 +302,29 @@ func New(path string, baseKey []byte, o *Options) (db *DB, err error) {
 	var (
 		encodeValueFunc func(fields shed.Item) (value []byte, err error)
 		decodeValueFunc func(keyItem shed.Item, value []byte) (e shed.Item, err error)
+		blobStore       BlobStore
 	)
 	if o.MockStore != nil {
+		// chunk data is never deleted from the mock store
+		// as it may be shared between multiple nodes
+		blobStore = o.MockStore
+	} else if o.BlobStore != nil {
+		blobStore = o.BlobStore
+		db.blobStore = o.BlobStore
+	} else if len(o.DataPaths) > 0 {
+		db.dataShards, err = newShardedBlobStore(o.DataPaths, o.MemDB, o.MetricsPrefix)
+		if err != nil {
+			return nil, err
+		}
+		blobStore = db.dataShards
+		db.blobStore = db.dataShards
+	}
+	if blobStore != nil {
 		encodeValueFunc = func(fields shed.Item) (value []byte, err error) {
 			b := make([]byte, 16)
 			binary.BigEndian.PutUint64(b[:8], fields.BinID)
 			binary.BigEndian.PutUint64(b[8:16], uint64(fields.StoreTimestamp))
-			err = o.MockStore.Put(fields.Address, fields.Data)
+			err = blobStore.Put(fields.Address, fields.Data)
 			if err != nil {
 				return nil, err
 			}
@@ -235,7 +333,7 @@ func New(path string, baseKey []byte, o *Options) (db *DB, err error) {
 		decodeValueFunc = func(keyItem shed.Item, value []byte) (e shed.Item, err error) {
 			e.StoreTimestamp = int64(binary.BigEndian.Uint64(value[8:16]))
 			e.BinID = binary.BigEndian.Uint64(value[:8])
-			e.Data, err = o.MockStore.Get(keyItem.Address)
+			e.Data, err = blobStore.Get(keyItem.Address)
 			return e, err
 		}
 	} else {
@@ -270,6 +368,8 @@ func New(path string, baseKey []byte, o *Options) (db *DB, err error) {
 	}
 	// Index storing access timestamp for a particular address.
 	// It is needed in order to update gc index keys for iteration order.
+	// It also stores the number of requests for the chunk, values written
+	// before the counter was added hold only the timestamp.
 	db.retrievalAccessIndex, err = db.shed.NewIndex("Address->AccessTimestamp", shed.IndexFuncs{
 		EncodeKey: func(fields shed.Item) (key []byte, err error) {
 			return fields.Address, nil
@@ -279,12 +379,16 @@ func New(path string, baseKey []byte, o *Options) (db *DB, err error) {
 			return e, nil
 		},
 		EncodeValue: func(fields shed.Item) (value []byte, err error) {
-			b := make([]byte, 8)
-			binary.BigEndian.PutUint64(b, uint64(fields.AccessTimestamp))
+			b := make([]byte, 16)
+			binary.BigEndian.PutUint64(b[:8], uint64(fields.AccessTimestamp))
+			binary.BigEndian.PutUint64(b[8:16], fields.AccessCount)
 			return b, nil
 		},
 		DecodeValue: func(keyItem shed.Item, value []byte) (e shed.Item, err error) {
-			e.AccessTimestamp = int64(binary.BigEndian.Uint64(value))
+			e.AccessTimestamp = int64(binary.BigEndian.Uint64(value[:8]))
+			if len(value) >= 16 {
+				e.AccessCount = binary.BigEndian.Uint64(value[8:16])
+			}
 			return e, nil
 		},
 	})
@@ -410,7 +514,9 @@ func New(path string, baseKey []byte, o *Options) (db *DB, err error) {
 		return nil, err
 	}
 
-	// Create a index structure for excluding pinned chunks from gcIndex
+	// Create a index structure for excluding pinned and reserved chunks from gcIndex.
+	// Reserved chunks have the expiry timestamp of the reservation as the value,
+	// while pinned chunks have no value.
 	db.gcExcludeIndex, err = db.shed.NewIndex("Hash->nil", shed.IndexFuncs{
 		EncodeKey: func(fields shed.Item) (key []byte, err error) {
 			return fields.Address, nil
@@ -419,6 +525,61 @@ func New(path string, baseKey []byte, o *Options) (db *DB, err error) {
 			e.Address = key
 			return e, nil
 		},
+		EncodeValue: func(fields shed.Item) (value []byte, err error) {
+			if fields.ExpiryTimestamp == 0 {
+				return nil, nil
+			}
+			b := make([]byte, 8)
+			binary.BigEndian.PutUint64(b, uint64(fields.ExpiryTimestamp))
+			return b, nil
+		},
+		DecodeValue: func(keyItem shed.Item, value []byte) (e shed.Item, err error) {
+			if len(value) == 8 {
+				e.ExpiryTimestamp = int64(binary.BigEndian.Uint64(value))
+			}
+			return e, nil
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Create an index structure for looking up expiry timestamps of chunks stored with a TTL
+	db.expiryIndex, err = db.shed.NewIndex("Hash->ExpiryTimestamp", shed.IndexFuncs{
+		EncodeKey: func(fields shed.Item) (key []byte, err error) {
+			return fields.Address, nil
+		},
+		DecodeKey: func(key []byte) (e shed.Item, err error) {
+			e.Address = key
+			return e, nil
+		},
+		EncodeValue: func(fields shed.Item) (value []byte, err error) {
+			b := make([]byte, 8)
+			binary.BigEndian.PutUint64(b, uint64(fields.ExpiryTimestamp))
+			return b, nil
+		},
+		DecodeValue: func(keyItem shed.Item, value []byte) (e shed.Item, err error) {
+			e.ExpiryTimestamp = int64(binary.BigEndian.Uint64(value))
+			return e, nil
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Create an index structure for iterating chunks stored with a TTL in the order of their expiry
+	db.expirySweepIndex, err = db.shed.NewIndex("ExpiryTimestamp|Hash->nil", shed.IndexFuncs{
+		EncodeKey: func(fields shed.Item) (key []byte, err error) {
+			b := make([]byte, 8, 8+len(fields.Address))
+			binary.BigEndian.PutUint64(b, uint64(fields.ExpiryTimestamp))
+			key = append(b, fields.Address...)
+			return key, nil
+		},
+		DecodeKey: func(key []byte) (e shed.Item, err error) {
+			e.ExpiryTimestamp = int64(binary.BigEndian.Uint64(key[:8]))
+			e.Address = key[8:]
+			return e, nil
+		},
 		EncodeValue: func(fields shed.Item) (value []byte, err error) {
 			return nil, nil
 		},
@@ -430,8 +591,25 @@ func New(path string, baseKey []byte, o *Options) (db *DB, err error) {
 		return nil, err
 	}
 
-	// start garbage collection worker
-	go db.collectGarbageWorker()
+	// Chunks are assigned to data shards by their address,
+	// so the number of shards can not change while chunks are stored.
+	db.dataShardsCount, err = db.shed.NewUint64Field("data-shards")
+	if err != nil {
+		return nil, err
+	}
+	if err = db.checkDataShards(uint64(len(o.DataPaths))); err != nil {
+		return nil, err
+	}
+
+	if db.gcDisabled {
+		// there is no garbage collection worker to wait for on Close
+		close(db.collectGarbageWorkerDone)
+	} else {
+		// start garbage collection worker
+		go db.collectGarbageWorker()
+	}
+	// start expired chunks sweep worker
+	go db.sweepExpiredWorker()
 	return db, nil
 }
 
@@ -447,6 +625,7 @@ func (db *DB) Close() (err error) {
 		// wait for gc worker to
 		// return before closing the shed
 		<-db.collectGarbageWorkerDone
+		<-db.expirySweepWorkerDone
 		close(done)
 	}()
 	select {
@@ -457,7 +636,39 @@ func (db *DB) Close() (err error) {
 		// TODO: use a logger to write a goroutine profile
 		pprof.Lookup("goroutine").WriteTo(os.Stdout, 2)
 	}
-	return db.shed.Close()
+	err = db.shed.Close()
+	if db.dataShards != nil {
+		if e := db.dataShards.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// checkDataShards validates that the chunks in the database are sharded
+// over the same number of data shards as configured and persists it.
+// Chunk data is not sharded if the count is 0.
+func (db *DB) checkDataShards(count uint64) (err error) {
+	if db.dataShards == nil {
+		count = 0
+	}
+	stored, err := db.dataShardsCount.Get()
+	if err != nil {
+		return err
+	}
+	if stored == count {
+		return nil
+	}
+	_, err = db.pullIndex.First(nil)
+	switch err {
+	case leveldb.ErrNotFound:
+		// no chunks are stored
+		return db.dataShardsCount.Put(count)
+	case nil:
+		return fmt.Errorf("%w: stored chunks in %d shards, configured %d", ErrDataShardsMismatch, stored, count)
+	default:
+		return err
+	}
 }
 
 // po computes the proximity order between the address
@@ -478,6 +689,8 @@ func (db *DB) DebugIndices() (indexInfo map[string]int, err error) {
 		"gcIndex":              db.gcIndex,
 		"gcExcludeIndex":       db.gcExcludeIndex,
 		"pinIndex":             db.pinIndex,
+		"expiryIndex":          db.expiryIndex,
+		"expirySweepIndex":     db.expirySweepIndex,
 	} {
 		indexSize, err := v.Count()
 		if err != nil {
@@ -490,6 +703,15 @@ func (db *DB) DebugIndices() (indexInfo map[string]int, err error) {
 		return indexInfo, err
 	}
 	indexInfo["gcSize"] = int(val)
+	if db.dataShards != nil {
+		counts, err := db.dataShards.Counts()
+		if err != nil {
+			return indexInfo, err
+		}
+		for i, c := range counts {
+			indexInfo[fmt.Sprintf("dataShard%d", i)] = c
+		}
+	}
 
 	return indexInfo, err
 }
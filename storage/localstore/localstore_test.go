@@ -58,7 +58,20 @@ func init() {
 // TestDB validates if the chunk can be uploaded and
 // correctly retrieved.
 func TestDB(t *testing.T) {
-	db, cleanupFunc := newTestDB(t, nil)
+	testDB(t, nil)
+}
+
+// TestDB_MemDB validates if the chunk can be uploaded and
+// correctly retrieved with the in-memory database.
+func TestDB_MemDB(t *testing.T) {
+	testDB(t, &Options{MemDB: true})
+}
+
+// testDB is a helper test function to validate if the chunk
+// can be uploaded and correctly retrieved from the DB
+// constructed with the provided options.
+func testDB(t *testing.T, o *Options) {
+	db, cleanupFunc := newTestDB(t, o)
 	defer cleanupFunc()
 
 	ch := generateTestRandomChunk()
@@ -142,16 +155,20 @@ func TestDB_updateGCSem(t *testing.T) {
 func newTestDB(t testing.TB, o *Options) (db *DB, cleanupFunc func()) {
 	t.Helper()
 
-	dir, err := ioutil.TempDir("", "localstore-test")
-	if err != nil {
-		t.Fatal(err)
+	var dir string
+	if o == nil || !o.MemDB {
+		var err error
+		dir, err = ioutil.TempDir("", "localstore-test")
+		if err != nil {
+			t.Fatal(err)
+		}
 	}
 	cleanupFunc = func() { os.RemoveAll(dir) }
 	baseKey := make([]byte, 32)
 	if _, err := rand.Read(baseKey); err != nil {
 		t.Fatal(err)
 	}
-	db, err = New(dir, baseKey, o)
+	db, err := New(dir, baseKey, o)
 	if err != nil {
 		cleanupFunc()
 		t.Fatal(err)
@@ -565,7 +582,19 @@ func testIndexCounts(t *testing.T, pushIndex, pullIndex, gcIndex, gcExcludeIndex
 // TestDBDebugIndexes tests that the index counts are correct for the
 // index debug function
 func TestDBDebugIndexes(t *testing.T) {
-	db, cleanupFunc := newTestDB(t, nil)
+	testDBDebugIndexes(t, nil)
+}
+
+// TestDBDebugIndexes_MemDB tests that the index counts are correct for the
+// index keys with the in-memory database.
+func TestDBDebugIndexes_MemDB(t *testing.T) {
+	testDBDebugIndexes(t, &Options{MemDB: true})
+}
+
+// testDBDebugIndexes is a helper test function to test that the index counts
+// are correct for the DB constructed with the provided options.
+func testDBDebugIndexes(t *testing.T, o *Options) {
+	db, cleanupFunc := newTestDB(t, o)
 	defer cleanupFunc()
 
 	uploadTimestamp := time.Now().UTC().UnixNano()
@@ -64,6 +64,14 @@ func (db *DB) get(mode chunk.ModeGet, addr chunk.Address) (out shed.Item, err er
 	if err != nil {
 		return out, err
 	}
+	expired, err := db.isExpired(out)
+	if err != nil {
+		return out, err
+	}
+	if expired {
+		// expired chunks are not returned, even if they are not yet removed
+		return out, leveldb.ErrNotFound
+	}
 	switch mode {
 	// update the access timestamp and gc index
 	case chunk.ModeGetRequest:
@@ -131,12 +139,13 @@ func (db *DB) updateGC(item shed.Item) (err error) {
 
 	batch := new(leveldb.Batch)
 
-	// update accessTimeStamp in retrieve, gc
+	// update accessTimeStamp and access count in retrieve, gc
 
 	i, err := db.retrievalAccessIndex.Get(item)
 	switch err {
 	case nil:
 		item.AccessTimestamp = i.AccessTimestamp
+		item.AccessCount = i.AccessCount
 	case leveldb.ErrNotFound:
 		// no chunk accesses
 	default:
@@ -149,12 +158,13 @@ func (db *DB) updateGC(item shed.Item) (err error) {
 	}
 	// delete current entry from the gc index
 	db.gcIndex.DeleteInBatch(batch, item)
-	// update access timestamp
+	// update access timestamp and count
 	item.AccessTimestamp = now()
+	item.AccessCount++
 	// update retrieve access index
 	db.retrievalAccessIndex.PutInBatch(batch, item)
 	// add new entry to gc index
-	ok, err := db.pinIndex.Has(item)
+	ok, err := db.excludedFromGC(item)
 	if err != nil {
 		return err
 	}
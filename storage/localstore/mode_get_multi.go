@@ -69,6 +69,16 @@ func (db *DB) getMulti(mode chunk.ModeGet, addrs ...chunk.Address) (out []shed.I
 	if err != nil {
 		return nil, err
 	}
+	for _, item := range out {
+		expired, err := db.isExpired(item)
+		if err != nil {
+			return nil, err
+		}
+		if expired {
+			// expired chunks are not returned, even if they are not yet removed
+			return nil, leveldb.ErrNotFound
+		}
+	}
 
 	switch mode {
 	// update the access timestamp and gc index
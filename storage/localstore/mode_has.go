@@ -25,13 +25,20 @@ import (
 )
 
 // Has returns true if the chunk is stored in database.
+// Chunks whose TTL has passed are reported as not stored, even if they are not yet removed.
 func (db *DB) Has(ctx context.Context, addr chunk.Address) (bool, error) {
 	metricName := "localstore/Has"
 
 	metrics.GetOrRegisterCounter(metricName, nil).Inc(1)
 	defer totalTimeMetric(metricName, time.Now())
 
-	has, err := db.retrievalDataIndex.Has(addressToItem(addr))
+	item := addressToItem(addr)
+	has, err := db.retrievalDataIndex.Has(item)
+	if err == nil && has {
+		var expired bool
+		expired, err = db.isExpired(item)
+		has = !expired
+	}
 	if err != nil {
 		metrics.GetOrRegisterCounter(metricName+"/error", nil).Inc(1)
 	}
@@ -39,16 +46,29 @@ func (db *DB) Has(ctx context.Context, addr chunk.Address) (bool, error) {
 }
 
 // HasMulti returns a slice of booleans which represent if the provided chunks
-// are stored in database.
+// are stored in database. Chunks whose TTL has passed are reported as not stored.
 func (db *DB) HasMulti(ctx context.Context, addrs ...chunk.Address) ([]bool, error) {
 	metricName := "localstore/HasMulti"
 
 	metrics.GetOrRegisterCounter(metricName, nil).Inc(1)
 	defer totalTimeMetric(metricName, time.Now())
 
-	have, err := db.retrievalDataIndex.HasMulti(addressesToItems(addrs...)...)
+	items := addressesToItems(addrs...)
+	have, err := db.retrievalDataIndex.HasMulti(items...)
 	if err != nil {
 		metrics.GetOrRegisterCounter(metricName+"/error", nil).Inc(1)
+		return nil, err
+	}
+	for i, item := range items {
+		if !have[i] {
+			continue
+		}
+		expired, err := db.isExpired(item)
+		if err != nil {
+			metrics.GetOrRegisterCounter(metricName+"/error", nil).Inc(1)
+			return nil, err
+		}
+		have[i] = !expired
 	}
-	return have, err
+	return have, nil
 }
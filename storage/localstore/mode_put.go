@@ -38,7 +38,31 @@ func (db *DB) Put(ctx context.Context, mode chunk.ModePut, chs ...chunk.Chunk) (
 	metrics.GetOrRegisterCounter(metricName, nil).Inc(1)
 	defer totalTimeMetric(metricName, time.Now())
 
-	exist, err = db.put(mode, chs...)
+	exist, err = db.put(mode, 0, chs...)
+	if err != nil {
+		metrics.GetOrRegisterCounter(metricName+"/error", nil).Inc(1)
+	}
+
+	return exist, err
+}
+
+// PutWithTTL stores Chunks to database in the same way as Put,
+// and marks the newly stored ones to expire after the ttl passes.
+// Expired chunks are not returned by Get and GetMulti and are
+// removed from the database by a background sweeper, regardless
+// of the garbage collection. Chunks that already exist in the
+// database keep their current expiry.
+func (db *DB) PutWithTTL(ctx context.Context, mode chunk.ModePut, ttl time.Duration, chs ...chunk.Chunk) (exist []bool, err error) {
+	metricName := fmt.Sprintf("localstore/PutWithTTL/%s", mode)
+
+	metrics.GetOrRegisterCounter(metricName, nil).Inc(1)
+	defer totalTimeMetric(metricName, time.Now())
+
+	if ttl <= 0 {
+		return nil, ErrInvalidTTL
+	}
+
+	exist, err = db.put(mode, ttl, chs...)
 	if err != nil {
 		metrics.GetOrRegisterCounter(metricName+"/error", nil).Inc(1)
 	}
@@ -52,8 +76,9 @@ func (db *DB) Put(ctx context.Context, mode chunk.ModePut, chs ...chunk.Chunk) (
 // same address are passed in arguments, only the first chunk will be stored,
 // and following ones will have exist set to true for their index in exist
 // slice. This is the same behaviour as if the same chunks are passed one by one
-// in multiple put method calls.
-func (db *DB) put(mode chunk.ModePut, chs ...chunk.Chunk) (exist []bool, err error) {
+// in multiple put method calls. If ttl is greater than zero, new chunks are set
+// to expire after it passes.
+func (db *DB) put(mode chunk.ModePut, ttl time.Duration, chs ...chunk.Chunk) (exist []bool, err error) {
 	// protect parallel updates
 	db.batchMu.Lock()
 	defer db.batchMu.Unlock()
@@ -132,6 +157,16 @@ func (db *DB) put(mode chunk.ModePut, chs ...chunk.Chunk) (exist []bool, err err
 		return nil, ErrInvalidMode
 	}
 
+	if ttl > 0 {
+		expiry := now() + int64(ttl)
+		for i, ch := range chs {
+			if exist[i] {
+				continue
+			}
+			db.setExpiryInBatch(batch, ch.Address(), expiry)
+		}
+	}
+
 	for po, id := range binIDs {
 		db.binIDs.PutInBatch(batch, uint64(po), id)
 	}
@@ -307,8 +342,13 @@ func (db *DB) setGC(batch *leveldb.Batch, item shed.Item) (gcSizeChange int64, e
 	switch err {
 	case nil:
 		item.AccessTimestamp = i.AccessTimestamp
-		db.gcIndex.DeleteInBatch(batch, item)
-		gcSizeChange--
+		item.AccessCount = i.AccessCount
+		// the chunk is not in the gc index if it is excluded from gc
+		c, err := db.deleteFromGCInBatch(batch, item)
+		if err != nil {
+			return 0, err
+		}
+		gcSizeChange += c
 	case leveldb.ErrNotFound:
 		// the chunk is not accessed before
 	default:
@@ -317,7 +357,7 @@ func (db *DB) setGC(batch *leveldb.Batch, item shed.Item) (gcSizeChange int64, e
 	item.AccessTimestamp = now()
 	db.retrievalAccessIndex.PutInBatch(batch, item)
 
-	ok, err := db.pinIndex.Has(item)
+	ok, err := db.excludedFromGC(item)
 	if err != nil {
 		return 0, err
 	}
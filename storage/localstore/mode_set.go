@@ -59,6 +59,7 @@ func (db *DB) set(mode chunk.ModeSet, addrs ...chunk.Address) (err error) {
 	// to be done after write batch function successfully executes
 	var gcSizeChange int64                      // number to add or subtract from gcSize
 	triggerPullFeed := make(map[uint8]struct{}) // signal pull feed subscriptions to iterate
+	tagIncs := make(map[tagState]int)           // tag counters to increment
 
 	switch mode {
 	case chunk.ModeSetAccess:
@@ -80,8 +81,16 @@ func (db *DB) set(mode chunk.ModeSet, addrs ...chunk.Address) (err error) {
 		}
 
 	case chunk.ModeSetSyncPush, chunk.ModeSetSyncPull:
+		// indexes are read from the database and not from the batch,
+		// so the same chunk must not be set more than once in the batch
+		// not to increment its tag or change gc size twice
+		seen := make(map[string]struct{})
 		for _, addr := range addrs {
-			c, err := db.setSync(batch, addr, mode)
+			if _, ok := seen[string(addr)]; ok {
+				continue
+			}
+			seen[string(addr)] = struct{}{}
+			c, err := db.setSync(batch, tagIncs, addr, mode)
 			if err != nil {
 				return err
 			}
@@ -125,12 +134,24 @@ func (db *DB) set(mode chunk.ModeSet, addrs ...chunk.Address) (err error) {
 	if err != nil {
 		return err
 	}
+	if mode == chunk.ModeSetRemove {
+		db.deleteBlobs(addrs)
+	}
 	for po := range triggerPullFeed {
 		db.triggerPullSubscriptions(po)
 	}
+	for ts, n := range tagIncs {
+		ts.tag.IncN(ts.state, n)
+	}
 	return nil
 }
 
+// tagState is a tag counter to be incremented once the batch is written
+type tagState struct {
+	tag   *chunk.Tag
+	state chunk.State
+}
+
 // setAccess sets the chunk access time by updating required indexes:
 //  - add to pull, insert to gc
 // Provided batch and binID map are updated.
@@ -161,8 +182,13 @@ func (db *DB) setAccess(batch *leveldb.Batch, binIDs map[uint8]uint64, addr chun
 	switch err {
 	case nil:
 		item.AccessTimestamp = i.AccessTimestamp
-		db.gcIndex.DeleteInBatch(batch, item)
-		gcSizeChange--
+		item.AccessCount = i.AccessCount
+		// the chunk is not in the gc index if it is excluded from gc
+		c, err := db.deleteFromGCInBatch(batch, item)
+		if err != nil {
+			return 0, err
+		}
+		gcSizeChange += c
 	case leveldb.ErrNotFound:
 		// the chunk is not accessed before
 	default:
@@ -172,7 +198,7 @@ func (db *DB) setAccess(batch *leveldb.Batch, binIDs map[uint8]uint64, addr chun
 	db.retrievalAccessIndex.PutInBatch(batch, item)
 	db.pullIndex.PutInBatch(batch, item)
 
-	ok, err := db.pinIndex.Has(item)
+	ok, err := db.excludedFromGC(item)
 	if err != nil {
 		return 0, err
 	}
@@ -192,9 +218,12 @@ func (db *DB) setAccess(batch *leveldb.Batch, binIDs map[uint8]uint64, addr chun
 //	 is then set to 0 to prevent duplicate increments for the same chunk synced multiple times
 // - ModeSetSyncPush - the corresponding tag is incremented, then item is removed
 //   from push sync index
-// - update to gc index happens given item does not exist in pin index
-// Provided batch is updated.
-func (db *DB) setSync(batch *leveldb.Batch, addr chunk.Address, mode chunk.ModeSet) (gcSizeChange int64, err error) {
+// - update to gc index happens given item does not exist in pin index and is not reserved
+// - ModeSetSyncPull also releases the reservation of the chunk
+// Only anonymous tags are incremented on ModeSetSyncPull and only
+// non-anonymous tags on ModeSetSyncPush.
+// Provided batch and tag increments map are updated.
+func (db *DB) setSync(batch *leveldb.Batch, tagIncs map[tagState]int, addr chunk.Address, mode chunk.ModeSet) (gcSizeChange int64, err error) {
 	item := addressToItem(addr)
 
 	// need to get access timestamp here as it is not
@@ -216,6 +245,9 @@ func (db *DB) setSync(batch *leveldb.Batch, addr chunk.Address, mode chunk.ModeS
 	item.StoreTimestamp = i.StoreTimestamp
 	item.BinID = i.BinID
 
+	// set if the reservation of the chunk is deleted in this batch
+	var released bool
+
 	switch mode {
 	case chunk.ModeSetSyncPull:
 		// if we are setting a chunk for pullsync we expect it to be in the index
@@ -242,7 +274,7 @@ func (db *DB) setSync(batch *leveldb.Batch, addr chunk.Address, mode chunk.ModeS
 				// since pull sync does not guarantee that
 				// a chunk has reached its NN, we can only mark
 				// it as Sent
-				t.Inc(chunk.StateSent)
+				tagIncs[tagState{tag: t, state: chunk.StateSent}]++
 
 				// setting the tag to zero makes sure that
 				// we don't increment the same tag twice when syncing
@@ -255,6 +287,13 @@ func (db *DB) setSync(batch *leveldb.Batch, addr chunk.Address, mode chunk.ModeS
 				}
 			}
 		}
+
+		// the chunk is synced to the neighbourhood,
+		// it does not need to be reserved anymore
+		released, err = db.deleteReservationInBatch(batch, item)
+		if err != nil {
+			return 0, err
+		}
 	case chunk.ModeSetSyncPush:
 		i, err := db.pushIndex.Get(item)
 		if err != nil {
@@ -279,7 +318,7 @@ func (db *DB) setSync(batch *leveldb.Batch, addr chunk.Address, mode chunk.ModeS
 					return 0, errors.New("got an anonymous chunk in push sync index")
 				}
 
-				t.Inc(chunk.StateSynced)
+				tagIncs[tagState{tag: t, state: chunk.StateSynced}]++
 			}
 		}
 
@@ -290,8 +329,13 @@ func (db *DB) setSync(batch *leveldb.Batch, addr chunk.Address, mode chunk.ModeS
 	switch err {
 	case nil:
 		item.AccessTimestamp = i.AccessTimestamp
-		db.gcIndex.DeleteInBatch(batch, item)
-		gcSizeChange--
+		item.AccessCount = i.AccessCount
+		// the chunk is not in the gc index if it is excluded from gc
+		c, err := db.deleteFromGCInBatch(batch, item)
+		if err != nil {
+			return 0, err
+		}
+		gcSizeChange += c
 	case leveldb.ErrNotFound:
 		// the chunk is not accessed before
 	default:
@@ -300,8 +344,13 @@ func (db *DB) setSync(batch *leveldb.Batch, addr chunk.Address, mode chunk.ModeS
 	item.AccessTimestamp = now()
 	db.retrievalAccessIndex.PutInBatch(batch, item)
 
-	// Add in gcIndex only if this chunk is not pinned
-	ok, err := db.pinIndex.Has(item)
+	// Add in gcIndex only if this chunk is not pinned or reserved
+	var ok bool
+	if released && !db.gcDisabled {
+		ok, err = db.pinIndex.Has(item)
+	} else {
+		ok, err = db.excludedFromGC(item)
+	}
 	if err != nil {
 		return 0, err
 	}
@@ -344,6 +393,9 @@ func (db *DB) setRemove(batch *leveldb.Batch, addr chunk.Address) (gcSizeChange
 	db.retrievalAccessIndex.DeleteInBatch(batch, item)
 	db.pullIndex.DeleteInBatch(batch, item)
 	db.gcIndex.DeleteInBatch(batch, item)
+	if err := db.deleteExpiryInBatch(batch, addr); err != nil {
+		return 0, err
+	}
 	// a check is needed for decrementing gcSize
 	// as delete is not reporting if the key/value pair
 	// is deleted or not
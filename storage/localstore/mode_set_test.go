@@ -312,6 +312,53 @@ func TestModeSetSyncPushNormalTag(t *testing.T) {
 	}
 }
 
+// TestModeSetSyncNormalTagSyncedCount is a regression test that the synced count of
+// a normal tag advances only on push sync, not on pull sync, and only once per chunk,
+// even if the same chunk is set more than once in a single call
+func TestModeSetSyncNormalTagSyncedCount(t *testing.T) {
+	db, cleanupFunc := newTestDB(t, &Options{Tags: chunk.NewTags()})
+	defer cleanupFunc()
+
+	tag, err := db.tags.Create("test", 2, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	chunks := []chunk.Chunk{
+		generateTestRandomChunk().WithTagID(tag.Uid),
+		generateTestRandomChunk().WithTagID(tag.Uid),
+	}
+	for _, ch := range chunks {
+		_, err = db.Put(context.Background(), chunk.ModePutUpload, ch)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tag.Inc(chunk.StateStored) // so we don't get an error on tag.Status later on
+	}
+	addrs := []chunk.Address{chunks[0].Address(), chunks[1].Address(), chunks[0].Address()}
+
+	err = db.Set(context.Background(), chunk.ModeSetSyncPull, addrs...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tagSyncedCounterTest(t, 0, chunk.ModeSetSyncPush, tag)
+
+	err = db.Set(context.Background(), chunk.ModeSetSyncPush, addrs...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tagSyncedCounterTest(t, 2, chunk.ModeSetSyncPush, tag)
+
+	err = db.Set(context.Background(), chunk.ModeSetSyncPull, addrs...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tagSyncedCounterTest(t, 2, chunk.ModeSetSyncPush, tag)
+
+	// 2 stored, 2 synced, 2 total
+	tagtesting.CheckTag(t, tag, 0, 2, 0, 0, 2, 2)
+}
+
 // TestModeSetRemove validates ModeSetRemove index values on the provided DB.
 func TestModeSetRemove(t *testing.T) {
 	for _, tc := range multiChunkTestCases {
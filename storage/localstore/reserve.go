@@ -0,0 +1,253 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package localstore
+
+import (
+	"context"
+	"time"
+
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/holisticode/swarm/chunk"
+	"github.com/holisticode/swarm/shed"
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+// Reserve protects chunks from garbage collection for the grace period,
+// or until they are set with chunk.ModeSetSyncPull, whichever comes first.
+// It is meant for recently uploaded chunks that should not be garbage
+// collected before they are synced to their neighbourhood. Unlike pinning,
+// the protection is released automatically. Reserving a reserved chunk
+// extends its reservation to the new grace period, while reserving a pinned
+// chunk has no effect.
+func (db *DB) Reserve(ctx context.Context, grace time.Duration, addrs ...chunk.Address) (err error) {
+	metricName := "localstore/Reserve"
+
+	metrics.GetOrRegisterCounter(metricName, nil).Inc(1)
+	defer totalTimeMetric(metricName, time.Now())
+	defer func() {
+		if err != nil {
+			metrics.GetOrRegisterCounter(metricName+"/error", nil).Inc(1)
+		}
+	}()
+
+	if grace <= 0 {
+		return ErrInvalidGracePeriod
+	}
+
+	// protect parallel updates
+	db.batchMu.Lock()
+	defer db.batchMu.Unlock()
+
+	batch := new(leveldb.Batch)
+	var gcSizeChange int64
+	expiry := now() + int64(grace)
+	seen := make(map[string]struct{})
+	for _, addr := range addrs {
+		if _, ok := seen[string(addr)]; ok {
+			continue
+		}
+		seen[string(addr)] = struct{}{}
+		item := addressToItem(addr)
+
+		has, err := db.retrievalDataIndex.Has(item)
+		if err != nil {
+			return err
+		}
+		if !has {
+			return chunk.ErrChunkNotFound
+		}
+
+		pinned, err := db.pinIndex.Has(item)
+		if err != nil {
+			return err
+		}
+		if pinned {
+			continue
+		}
+
+		item.ExpiryTimestamp = expiry
+		db.gcExcludeIndex.PutInBatch(batch, item)
+
+		c, err := db.updateReservedGCInBatch(batch, item)
+		if err != nil {
+			return err
+		}
+		gcSizeChange += c
+	}
+
+	err = db.incGCSizeInBatch(batch, gcSizeChange)
+	if err != nil {
+		return err
+	}
+	return db.shed.WriteBatch(batch)
+}
+
+// updateReservedGCInBatch keeps the reserved chunk out of the gc index
+// until its reservation expires. When it expires, the reservation is
+// released and the chunk is added back to the gc index. The item must
+// have the Address and the ExpiryTimestamp of the reservation set.
+// This function must be called under batchMu lock.
+func (db *DB) updateReservedGCInBatch(batch *leveldb.Batch, item shed.Item) (gcSizeChange int64, err error) {
+	if item.ExpiryTimestamp > now() {
+		return db.removeFromGCInBatch(batch, item)
+	}
+	return db.releaseReservationInBatch(batch, item)
+}
+
+// releaseReservationInBatch removes the reservation of the chunk, if it has one,
+// and adds the chunk back to the gc index if it was accessed and it is not pinned.
+// The returned gcSizeChange accounts for the chunk added to the gc index.
+// This function must be called under batchMu lock.
+func (db *DB) releaseReservationInBatch(batch *leveldb.Batch, item shed.Item) (gcSizeChange int64, err error) {
+	item = addressToItem(item.Address)
+
+	released, err := db.deleteReservationInBatch(batch, item)
+	if err != nil {
+		return 0, err
+	}
+	if !released || db.gcDisabled {
+		return 0, nil
+	}
+
+	pinned, err := db.pinIndex.Has(item)
+	if err != nil {
+		return 0, err
+	}
+	if pinned {
+		return 0, nil
+	}
+
+	i, err := db.retrievalAccessIndex.Get(item)
+	switch err {
+	case nil:
+		item.AccessTimestamp = i.AccessTimestamp
+	case leveldb.ErrNotFound:
+		// the chunk is not accessed or synced yet,
+		// it will be added to the gc index when it is
+		return 0, nil
+	default:
+		return 0, err
+	}
+	i, err = db.retrievalDataIndex.Get(item)
+	switch err {
+	case nil:
+		item.BinID = i.BinID
+	case leveldb.ErrNotFound:
+		// the chunk is already removed
+		return 0, nil
+	default:
+		return 0, err
+	}
+
+	has, err := db.gcIndex.Has(item)
+	if err != nil {
+		return 0, err
+	}
+	if has {
+		return 0, nil
+	}
+	err = db.gcIndex.PutInBatch(batch, item)
+	if err != nil {
+		return 0, err
+	}
+	return 1, nil
+}
+
+// deleteReservationInBatch deletes the reservation of the chunk, returning
+// false if the chunk is not reserved. Entries of pinned chunks in the gc exclude
+// index are not deleted. This function must be called under batchMu lock.
+func (db *DB) deleteReservationInBatch(batch *leveldb.Batch, item shed.Item) (released bool, err error) {
+	item = addressToItem(item.Address)
+
+	i, err := db.gcExcludeIndex.Get(item)
+	switch err {
+	case nil:
+	case leveldb.ErrNotFound:
+		return false, nil
+	default:
+		return false, err
+	}
+	if i.ExpiryTimestamp == 0 {
+		// the chunk is pinned, not reserved
+		return false, nil
+	}
+	db.gcExcludeIndex.DeleteInBatch(batch, item)
+	return true, nil
+}
+
+// removeFromGCInBatch removes the chunk from the gc index if it is there.
+// This function must be called under batchMu lock.
+func (db *DB) removeFromGCInBatch(batch *leveldb.Batch, item shed.Item) (gcSizeChange int64, err error) {
+	i, err := db.retrievalAccessIndex.Get(item)
+	switch err {
+	case nil:
+		item.AccessTimestamp = i.AccessTimestamp
+	case leveldb.ErrNotFound:
+		// the chunk is not accessed, so it is not in the gc index
+		return 0, nil
+	default:
+		return 0, err
+	}
+	i, err = db.retrievalDataIndex.Get(item)
+	if err != nil {
+		return 0, err
+	}
+	item.BinID = i.BinID
+
+	return db.deleteFromGCInBatch(batch, item)
+}
+
+// deleteFromGCInBatch deletes the item from the gc index if it is there. The item
+// must have the Address, AccessTimestamp and BinID set. Chunks excluded from gc
+// may have an access timestamp without being in the gc index, so the returned
+// gcSizeChange is based on whether the item is in the gc index.
+func (db *DB) deleteFromGCInBatch(batch *leveldb.Batch, item shed.Item) (gcSizeChange int64, err error) {
+	has, err := db.gcIndex.Has(item)
+	if err != nil {
+		return 0, err
+	}
+	if !has {
+		return 0, nil
+	}
+	db.gcIndex.DeleteInBatch(batch, item)
+	return -1, nil
+}
+
+// excludedFromGC returns true if the chunk is pinned or it has
+// a reservation that has not expired, in which case it must not
+// be added to the gc index. All chunks are excluded if gc is disabled.
+func (db *DB) excludedFromGC(item shed.Item) (bool, error) {
+	if db.gcDisabled {
+		return true, nil
+	}
+	pinned, err := db.pinIndex.Has(item)
+	if err != nil {
+		return false, err
+	}
+	if pinned {
+		return true, nil
+	}
+	i, err := db.gcExcludeIndex.Get(addressToItem(item.Address))
+	switch err {
+	case nil:
+		return i.ExpiryTimestamp > now(), nil
+	case leveldb.ErrNotFound:
+		return false, nil
+	default:
+		return false, err
+	}
+}
@@ -0,0 +1,143 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package localstore
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/holisticode/swarm/chunk"
+)
+
+// TestDB_Reserve validates that reserved chunks are kept out of the gc index
+// until they are set with ModeSetSyncPull or their grace period passes.
+func TestDB_Reserve(t *testing.T) {
+	db, cleanupFunc := newTestDB(t, nil)
+	defer cleanupFunc()
+
+	chunks := []chunk.Chunk{generateTestRandomChunk(), generateTestRandomChunk()}
+	var addrs []chunk.Address
+	for _, ch := range chunks {
+		if _, err := db.Put(context.Background(), chunk.ModePutUpload, ch); err != nil {
+			t.Fatal(err)
+		}
+		addrs = append(addrs, ch.Address())
+	}
+
+	if err := db.Reserve(context.Background(), time.Minute, addrs...); err != nil {
+		t.Fatal(err)
+	}
+	// push syncing adds chunks to the gc index, unless they are reserved
+	if err := db.Set(context.Background(), chunk.ModeSetSyncPush, addrs...); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("gc exclude index count", newItemsCountTest(db.gcExcludeIndex, 2))
+	t.Run("gc index count", newItemsCountTest(db.gcIndex, 0))
+	t.Run("gc size", newIndexGCSizeTest(db))
+
+	// pull syncing releases the reservation
+	if err := db.Set(context.Background(), chunk.ModeSetSyncPull, addrs[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("released gc exclude index count", newItemsCountTest(db.gcExcludeIndex, 1))
+	t.Run("released gc index count", newItemsCountTest(db.gcIndex, 1))
+	t.Run("released gc size", newIndexGCSizeTest(db))
+
+	// the grace period passes for the other chunk
+	defer setNow(func() int64 {
+		return time.Now().Add(2 * time.Minute).UTC().UnixNano()
+	})()
+
+	if err := db.removeChunksInExcludeIndexFromGC(); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("expired gc exclude index count", newItemsCountTest(db.gcExcludeIndex, 0))
+	t.Run("expired gc index count", newItemsCountTest(db.gcIndex, 2))
+	t.Run("expired gc size", newIndexGCSizeTest(db))
+
+	if err := db.Reserve(context.Background(), 0, addrs...); err != ErrInvalidGracePeriod {
+		t.Errorf("got error %v, want %v", err, ErrInvalidGracePeriod)
+	}
+	if err := db.Reserve(context.Background(), time.Minute, generateTestRandomChunk().Address()); err != chunk.ErrChunkNotFound {
+		t.Errorf("got error %v, want %v", err, chunk.ErrChunkNotFound)
+	}
+}
+
+// TestDB_Reserve_collectGarbage validates that garbage collection
+// does not remove reserved chunks.
+func TestDB_Reserve_collectGarbage(t *testing.T) {
+	chunkCount := 150
+
+	db, cleanupFunc := newTestDB(t, &Options{
+		Capacity: 100,
+	})
+	testHookCollectGarbageChan := make(chan uint64)
+	defer setTestHookCollectGarbage(func(collectedCount uint64) {
+		select {
+		case testHookCollectGarbageChan <- collectedCount:
+		case <-db.close:
+		}
+	})()
+	defer cleanupFunc()
+
+	reserved := generateTestRandomChunk()
+	if _, err := db.Put(context.Background(), chunk.ModePutUpload, reserved); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Set(context.Background(), chunk.ModeSetSyncPush, reserved.Address()); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Reserve(context.Background(), time.Minute, reserved.Address()); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < chunkCount; i++ {
+		ch := generateTestRandomChunk()
+		if _, err := db.Put(context.Background(), chunk.ModePutUpload, ch); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Set(context.Background(), chunk.ModeSetSyncPull, ch.Address()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	gcTarget := db.gcTarget()
+	for {
+		select {
+		case <-testHookCollectGarbageChan:
+		case <-time.After(10 * time.Second):
+			t.Fatal("collect garbage timeout")
+		}
+		gcSize, err := db.gcSize.Get()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if gcSize == gcTarget {
+			break
+		}
+	}
+
+	t.Run("gc size", newIndexGCSizeTest(db))
+
+	if _, err := db.Get(context.Background(), chunk.ModeGetLookup, reserved.Address()); err != nil {
+		t.Errorf("got error %v for reserved chunk", err)
+	}
+}
@@ -0,0 +1,153 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package localstore
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/holisticode/swarm/chunk"
+	"github.com/holisticode/swarm/shed"
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+// ErrDataShardsMismatch is returned by New when the database holds chunks
+// whose data is sharded over a different number of paths than configured.
+var ErrDataShardsMismatch = errors.New("chunk data shards mismatch")
+
+// shardedBlobStore is a BlobStore that spreads chunk data over
+// multiple leveldb databases, typically on different disks.
+// Chunks are assigned to shards by the first byte of their address,
+// so that every shard holds a contiguous range of address prefixes.
+type shardedBlobStore struct {
+	shards []blobShard
+}
+
+// blobShard is a database holding the chunk data of one shard.
+type blobShard struct {
+	db   *shed.DB
+	data shed.Index
+}
+
+// newShardedBlobStore opens a shard database at every path, or
+// in memory if inmem is true, and returns a BlobStore over them.
+func newShardedBlobStore(paths []string, inmem bool, metricsPrefix string) (s *shardedBlobStore, err error) {
+	s = new(shardedBlobStore)
+	defer func() {
+		if err != nil {
+			s.Close()
+		}
+	}()
+	for i, path := range paths {
+		prefix := fmt.Sprintf("%sshard%d", metricsPrefix, i)
+		var db *shed.DB
+		if inmem {
+			db, err = shed.NewInmemoryDB(prefix)
+		} else {
+			db, err = shed.NewDB(path, prefix)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("open chunk data shard %s: %w", path, err)
+		}
+		s.shards = append(s.shards, blobShard{db: db})
+		data, err := db.NewIndex("Address->Data", shed.IndexFuncs{
+			EncodeKey: func(fields shed.Item) (key []byte, err error) {
+				return fields.Address, nil
+			},
+			DecodeKey: func(key []byte) (e shed.Item, err error) {
+				e.Address = key
+				return e, nil
+			},
+			EncodeValue: func(fields shed.Item) (value []byte, err error) {
+				return fields.Data, nil
+			},
+			DecodeValue: func(keyItem shed.Item, value []byte) (e shed.Item, err error) {
+				e.Data = value
+				return e, nil
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+		s.shards[i].data = data
+	}
+	return s, nil
+}
+
+// shard returns the index of the shard which holds the chunk data
+// for the address.
+func (s *shardedBlobStore) shard(addr []byte) int {
+	if len(addr) == 0 {
+		return 0
+	}
+	return int(addr[0]) * len(s.shards) / 256
+}
+
+// Get returns the data stored under the chunk address.
+func (s *shardedBlobStore) Get(addr []byte) (data []byte, err error) {
+	item, err := s.shards[s.shard(addr)].data.Get(addressToItem(addr))
+	if err != nil {
+		if err == leveldb.ErrNotFound {
+			return nil, chunk.ErrChunkNotFound
+		}
+		return nil, err
+	}
+	return item.Data, nil
+}
+
+// Put stores the data under the chunk address.
+func (s *shardedBlobStore) Put(addr []byte, data []byte) error {
+	i := s.shard(addr)
+	if err := s.shards[i].data.Put(shed.Item{Address: addr, Data: data}); err != nil {
+		return err
+	}
+	metrics.GetOrRegisterCounter(fmt.Sprintf("localstore/blob/shard/%d/put", i), nil).Inc(1)
+	return nil
+}
+
+// Delete removes the data stored under the chunk address.
+func (s *shardedBlobStore) Delete(addr []byte) error {
+	i := s.shard(addr)
+	if err := s.shards[i].data.Delete(addressToItem(addr)); err != nil {
+		return err
+	}
+	metrics.GetOrRegisterCounter(fmt.Sprintf("localstore/blob/shard/%d/delete", i), nil).Inc(1)
+	return nil
+}
+
+// Counts returns the number of chunks stored in every shard.
+func (s *shardedBlobStore) Counts() (counts []int, err error) {
+	counts = make([]int, len(s.shards))
+	for i, shard := range s.shards {
+		counts[i], err = shard.data.Count()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return counts, nil
+}
+
+// Close closes all shard databases.
+func (s *shardedBlobStore) Close() (err error) {
+	for _, shard := range s.shards {
+		if e := shard.db.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
@@ -0,0 +1,119 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package localstore
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/holisticode/swarm/chunk"
+)
+
+// TestDataShards validates that chunk data is spread over the data shards,
+// that garbage collection removes it from all of them and that the database
+// can not be opened with a different number of data shards.
+func TestDataShards(t *testing.T) {
+	dir, err := ioutil.TempDir("", "localstore-data-shards")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "index")
+	var dataPaths []string
+	for i := 0; i < 3; i++ {
+		dataPaths = append(dataPaths, filepath.Join(dir, fmt.Sprintf("data%d", i)))
+	}
+	baseKey := make([]byte, 32)
+
+	db, err := New(path, baseKey, &Options{DataPaths: dataPaths})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	chunks := generateTestRandomChunks(100)
+	for _, ch := range chunks {
+		if _, err := db.Put(context.Background(), chunk.ModePutUpload, ch); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Set(context.Background(), chunk.ModeSetSyncPull, ch.Address()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	checkShards := func(t *testing.T, db *DB, total int) {
+		t.Helper()
+		info, err := db.DebugIndices()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var sum int
+		for i := range dataPaths {
+			count, ok := info[fmt.Sprintf("dataShard%d", i)]
+			if !ok {
+				t.Fatalf("missing count of data shard %d", i)
+			}
+			if total > 0 && count == 0 {
+				t.Errorf("got no chunks in data shard %d", i)
+			}
+			sum += count
+		}
+		if sum != total {
+			t.Errorf("got %d chunks in data shards, want %d", sum, total)
+		}
+	}
+	checkShards(t, db, len(chunks))
+
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the number of data shards can not change
+	if _, err := New(path, baseKey, &Options{DataPaths: dataPaths[:2]}); !errors.Is(err, ErrDataShardsMismatch) {
+		t.Fatalf("got error %v, want %v", err, ErrDataShardsMismatch)
+	}
+	if _, err := New(path, baseKey, nil); !errors.Is(err, ErrDataShardsMismatch) {
+		t.Fatalf("got error %v, want %v", err, ErrDataShardsMismatch)
+	}
+
+	db, err = New(path, baseKey, &Options{DataPaths: dataPaths})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	for _, ch := range chunks {
+		got, err := db.Get(context.Background(), chunk.ModeGetLookup, ch.Address())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got.Data(), ch.Data()) {
+			t.Fatalf("got chunk data %x, want %x", got.Data(), ch.Data())
+		}
+	}
+
+	if _, err := db.CollectGarbage(0); err != nil {
+		t.Fatal(err)
+	}
+	checkShards(t, db, 0)
+}
@@ -197,6 +197,47 @@ func (db *DB) LastPullSubscriptionBinID(bin uint8) (id uint64, err error) {
 	return item.BinID, nil
 }
 
+// BinChunks returns chunk descriptors from pull syncing index for a provided
+// bin that are stored in the closed bin id interval [since,until]. If since is 0,
+// descriptors are returned from the first chunk in the bin, and if until is 0,
+// up to the last chunk currently stored in the bin. Unlike SubscribePull, it
+// returns a snapshot of the current bin contents and does not wait for new chunks.
+func (db *DB) BinChunks(bin uint8, since, until uint64) (descriptors []chunk.Descriptor, err error) {
+	metrics.GetOrRegisterCounter("localstore/BinChunks", nil).Inc(1)
+
+	if int(bin) > chunk.MaxPO {
+		return nil, ErrInvalidBin
+	}
+	if until > 0 && until < since {
+		return nil, ErrInvalidRange
+	}
+
+	var startFrom *shed.Item
+	if since > 0 {
+		startFrom = &shed.Item{
+			Address: db.addressInBin(bin),
+			BinID:   since,
+		}
+	}
+	err = db.pullIndex.Iterate(func(item shed.Item) (stop bool, err error) {
+		if until > 0 && item.BinID > until {
+			return true, nil
+		}
+		descriptors = append(descriptors, chunk.Descriptor{
+			Address: item.Address,
+			BinID:   item.BinID,
+		})
+		return false, nil
+	}, &shed.IterateOptions{
+		StartFrom: startFrom,
+		Prefix:    []byte{bin},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return descriptors, nil
+}
+
 // triggerPullSubscriptions is used internally for starting iterations
 // on Pull subscriptions for a particular bin. When new item with address
 // that is in particular bin for DB's baseKey is added to pull index
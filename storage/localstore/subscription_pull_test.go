@@ -685,3 +685,71 @@ func TestAddressInBin(t *testing.T) {
 		}
 	}
 }
+
+// TestDB_BinChunks validates that BinChunks returns
+// descriptors from the pull index for the requested range.
+func TestDB_BinChunks(t *testing.T) {
+	db, cleanupFunc := newTestDB(t, nil)
+	defer cleanupFunc()
+
+	addrs := make(map[uint8][]chunk.Address)
+	for i := 0; i < 100; i++ {
+		ch := generateTestRandomChunk()
+
+		_, err := db.Put(context.Background(), chunk.ModePutUpload, ch)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		bin := db.po(ch.Address())
+		addrs[bin] = append(addrs[bin], ch.Address())
+	}
+
+	for bin, binAddrs := range addrs {
+		count := uint64(len(binAddrs))
+		for _, tc := range []struct {
+			since, until uint64
+			from, to     uint64 // expected bin ids
+		}{
+			{0, 0, 1, count},
+			{1, count, 1, count},
+			{count, 0, count, count},
+			{(count + 1) / 2, count, (count + 1) / 2, count},
+			{1, (count + 1) / 2, 1, (count + 1) / 2},
+			{0, count + 10, 1, count},
+		} {
+			got, err := db.BinChunks(bin, tc.since, tc.until)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if uint64(len(got)) != tc.to-tc.from+1 {
+				t.Fatalf("bin %v [%v,%v]: got %v descriptors, want %v", bin, tc.since, tc.until, len(got), tc.to-tc.from+1)
+			}
+			for i, d := range got {
+				wantBinID := tc.from + uint64(i)
+				if d.BinID != wantBinID {
+					t.Fatalf("bin %v [%v,%v]: got bin id %v, want %v", bin, tc.since, tc.until, d.BinID, wantBinID)
+				}
+				if !bytes.Equal(d.Address, binAddrs[wantBinID-1]) {
+					t.Fatalf("bin %v [%v,%v]: got address %s, want %s", bin, tc.since, tc.until, d.Address, binAddrs[wantBinID-1])
+				}
+			}
+		}
+	}
+
+	// a bin that has no chunks
+	got, err := db.BinChunks(uint8(chunk.MaxPO), 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 0 {
+		t.Errorf("got %v descriptors in empty bin, want none", len(got))
+	}
+
+	if _, err := db.BinChunks(uint8(chunk.MaxPO)+1, 0, 0); err != ErrInvalidBin {
+		t.Errorf("got error %v, want %v", err, ErrInvalidBin)
+	}
+	if _, err := db.BinChunks(0, 10, 5); err != ErrInvalidRange {
+		t.Errorf("got error %v, want %v", err, ErrInvalidRange)
+	}
+}
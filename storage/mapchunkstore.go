@@ -0,0 +1,358 @@
+// Copyright 2019 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/holisticode/swarm/chunk"
+	"github.com/holisticode/swarm/log"
+)
+
+// MapChunkStore is a very simple ChunkStore implementation to store chunks in a map in memory.
+// It keeps a pull index like localstore does, so it can be used in place of localstore
+// for tests of the pull syncing streams. It also keeps the state of the chunks changed
+// by Set, which can be inspected with State.
+type MapChunkStore struct {
+	// Tags, if set, are incremented on Set like in localstore:
+	// the Sent counter of anonymous tags on ModeSetSyncPull and
+	// the Synced counter of other tags on ModeSetSyncPush.
+	// It must be set before the store is used.
+	Tags *chunk.Tags
+
+	chunks  map[string]Chunk
+	states  map[string]*mapChunkState
+	baseKey []byte
+	pull    map[uint8][]chunk.Descriptor // pull index descriptors per bin, in bin id order
+	// triggers of the pull subscriptions per bin
+	// signalled when a descriptor is added to the bin
+	pullTriggers map[uint8][]chan struct{}
+	close        chan struct{}
+	closeOnce    sync.Once
+	mu           sync.RWMutex
+}
+
+// NewMapChunkStore creates a MapChunkStore with pull index bins relative to the zero address.
+func NewMapChunkStore() *MapChunkStore {
+	return NewMapChunkStoreWithBaseKey(make([]byte, AddressLength))
+}
+
+// NewMapChunkStoreWithBaseKey creates a MapChunkStore with pull index bins relative to the base key.
+func NewMapChunkStoreWithBaseKey(baseKey []byte) *MapChunkStore {
+	return &MapChunkStore{
+		chunks:       make(map[string]Chunk),
+		states:       make(map[string]*mapChunkState),
+		baseKey:      baseKey,
+		pull:         make(map[uint8][]chunk.Descriptor),
+		pullTriggers: make(map[uint8][]chan struct{}),
+		close:        make(chan struct{}),
+	}
+}
+
+// Put stores the chunks. As in localstore, chunks stored with ModePutUpload
+// or ModePutSync are added to the pull index.
+func (m *MapChunkStore) Put(_ context.Context, mode chunk.ModePut, chs ...Chunk) ([]bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	exist := make([]bool, len(chs))
+	for i, ch := range chs {
+		addr := ch.Address().Hex()
+		_, exist[i] = m.chunks[addr]
+		m.chunks[addr] = ch
+		if exist[i] {
+			continue
+		}
+		m.states[addr] = &mapChunkState{
+			inPush:  mode == chunk.ModePutUpload,
+			pushTag: ch.TagID(),
+			pullTag: ch.TagID(),
+		}
+		if mode != chunk.ModePutUpload && mode != chunk.ModePutSync {
+			continue
+		}
+		m.states[addr].inPull = true
+		bin := uint8(chunk.Proximity(m.baseKey, ch.Address()))
+		m.pull[bin] = append(m.pull[bin], chunk.Descriptor{
+			Address: ch.Address(),
+			BinID:   uint64(len(m.pull[bin]) + 1),
+		})
+		for _, t := range m.pullTriggers[bin] {
+			select {
+			case t <- struct{}{}:
+			default:
+			}
+		}
+	}
+	return exist, nil
+}
+
+func (m *MapChunkStore) Get(_ context.Context, _ chunk.ModeGet, ref Address) (Chunk, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	chunk := m.chunks[ref.Hex()]
+	if chunk == nil {
+		return nil, ErrChunkNotFound
+	}
+	return chunk, nil
+}
+
+func (m *MapChunkStore) GetMulti(_ context.Context, _ chunk.ModeGet, refs ...Address) (chunks []Chunk, err error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, ref := range refs {
+		chunk := m.chunks[ref.Hex()]
+		if chunk == nil {
+			return nil, ErrChunkNotFound
+		}
+		chunks = append(chunks, chunk)
+	}
+	return chunks, nil
+}
+
+// Need to implement Has from SyncChunkStore
+func (m *MapChunkStore) Has(ctx context.Context, ref Address) (has bool, err error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	_, has = m.chunks[ref.Hex()]
+	return has, nil
+}
+
+func (m *MapChunkStore) HasMulti(ctx context.Context, refs ...Address) (have []bool, err error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	have = make([]bool, len(refs))
+	for i, ref := range refs {
+		_, have[i] = m.chunks[ref.Hex()]
+	}
+	return have, nil
+}
+
+// MapChunkState is the state of a chunk in the MapChunkStore changed by Set.
+type MapChunkState struct {
+	AccessCount uint64 // number of ModeSetAccess calls
+	SyncedPull  bool   // set by ModeSetSyncPull
+	SyncedPush  bool   // set by ModeSetSyncPush
+	PinCounter  uint64 // incremented by ModeSetPin and decremented by ModeSetUnpin
+}
+
+// mapChunkState is the state of a stored chunk with the indexes it is in.
+type mapChunkState struct {
+	MapChunkState
+	inPull  bool   // in the pull index, put with ModePutUpload or ModePutSync
+	inPush  bool   // in the push index, put with ModePutUpload and not yet push synced
+	pullTag uint32 // tag of the chunk in the pull index, cleared once the tag is incremented
+	pushTag uint32 // tag of the chunk in the push index
+}
+
+// Set updates the state of the chunks. Like in localstore, the addresses of the
+// chunks that are not stored are ignored, except for ModeSetRemove, ModeSetPin
+// and ModeSetUnpin, which return an error.
+func (m *MapChunkStore) Set(ctx context.Context, mode chunk.ModeSet, addrs ...chunk.Address) (err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, addr := range addrs {
+		key := addr.Hex()
+		s, ok := m.states[key]
+		if !ok {
+			switch mode {
+			case chunk.ModeSetRemove, chunk.ModeSetPin, chunk.ModeSetUnpin:
+				return ErrChunkNotFound
+			}
+			continue
+		}
+		switch mode {
+		case chunk.ModeSetAccess:
+			s.AccessCount++
+		case chunk.ModeSetSyncPull:
+			s.SyncedPull = true
+			if !s.inPull || s.pullTag == 0 || m.Tags == nil {
+				continue
+			}
+			if t, err := m.Tags.Get(s.pullTag); err == nil && t.Anonymous {
+				t.Inc(chunk.StateSent)
+				s.pullTag = 0
+			}
+		case chunk.ModeSetSyncPush:
+			s.SyncedPush = true
+			if !s.inPush {
+				continue
+			}
+			s.inPush = false
+			if s.pushTag == 0 || m.Tags == nil {
+				continue
+			}
+			t, err := m.Tags.Get(s.pushTag)
+			if err != nil {
+				continue
+			}
+			if t.Anonymous {
+				return errors.New("got an anonymous chunk in push sync index")
+			}
+			t.Inc(chunk.StateSynced)
+		case chunk.ModeSetRemove:
+			delete(m.chunks, key)
+			delete(m.states, key)
+		case chunk.ModeSetPin:
+			s.PinCounter++
+		case chunk.ModeSetUnpin:
+			if s.PinCounter == 0 {
+				return fmt.Errorf("unpin chunk %s: not pinned", key)
+			}
+			s.PinCounter--
+		default:
+			return fmt.Errorf("invalid mode %v", mode)
+		}
+	}
+	return nil
+}
+
+// State returns the state of the stored chunk with the address,
+// and false if the chunk is not stored.
+func (m *MapChunkStore) State(addr Address) (state MapChunkState, ok bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	s, ok := m.states[addr.Hex()]
+	if !ok {
+		return state, false
+	}
+	return s.MapChunkState, true
+}
+
+// LastPullSubscriptionBinID returns the bin id of the latest chunk
+// in the pull index bin, or 0 if the bin is empty.
+func (m *MapChunkStore) LastPullSubscriptionBinID(bin uint8) (id uint64, err error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return uint64(len(m.pull[bin])), nil
+}
+
+// SubscribePull returns a channel that provides chunk addresses and bin ids from the pull index
+// bin, with the same semantics as localstore: the [since, until] interval is closed on both sides,
+// since 0 starts from the first chunk and until 0 keeps sending newly stored chunks until the
+// returned stop function is called, the context is done or the store is closed.
+// The channel is closed immediately for a bin larger than chunk.MaxPO or an until smaller than since.
+func (m *MapChunkStore) SubscribePull(ctx context.Context, bin uint8, since, until uint64) (c <-chan chunk.Descriptor, stop func()) {
+	chunkDescriptors := make(chan chunk.Descriptor)
+	stopChan := make(chan struct{})
+	var stopChanOnce sync.Once
+	stop = func() {
+		stopChanOnce.Do(func() {
+			close(stopChan)
+		})
+	}
+
+	if int(bin) > chunk.MaxPO || (until > 0 && until < since) {
+		log.Error("map chunk store pull subscription: invalid range", "bin", bin, "since", since, "until", until)
+		close(chunkDescriptors)
+		return chunkDescriptors, stop
+	}
+
+	trigger := make(chan struct{}, 1)
+	m.mu.Lock()
+	m.pullTriggers[bin] = append(m.pullTriggers[bin], trigger)
+	m.mu.Unlock()
+
+	// send signal for the initial iteration
+	trigger <- struct{}{}
+
+	// bin ids are consecutive starting from 1,
+	// so the next bin id is the index of the next descriptor
+	next := since
+	if next == 0 {
+		next = 1
+	}
+
+	go func() {
+		defer close(chunkDescriptors)
+		defer func() {
+			m.mu.Lock()
+			defer m.mu.Unlock()
+			for i, t := range m.pullTriggers[bin] {
+				if t == trigger {
+					m.pullTriggers[bin] = append(m.pullTriggers[bin][:i], m.pullTriggers[bin][i+1:]...)
+					break
+				}
+			}
+		}()
+		for {
+			select {
+			case <-trigger:
+				for {
+					m.mu.RLock()
+					var d chunk.Descriptor
+					var removed bool
+					ok := next <= uint64(len(m.pull[bin]))
+					if ok {
+						d = m.pull[bin][next-1]
+						_, stored := m.chunks[d.Address.Hex()]
+						removed = !stored
+					}
+					m.mu.RUnlock()
+					if !ok {
+						break
+					}
+					if removed {
+						// removed chunks are not in the pull index
+						if until > 0 && d.BinID >= until {
+							return
+						}
+						next++
+						continue
+					}
+					select {
+					case chunkDescriptors <- d:
+					case <-stopChan:
+						return
+					case <-m.close:
+						return
+					case <-ctx.Done():
+						return
+					}
+					if until > 0 && d.BinID >= until {
+						return
+					}
+					next++
+				}
+			case <-stopChan:
+				return
+			case <-m.close:
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return chunkDescriptors, stop
+}
+
+// Close terminates all pull subscriptions.
+func (m *MapChunkStore) Close() error {
+	m.closeOnce.Do(func() {
+		close(m.close)
+	})
+	return nil
+}
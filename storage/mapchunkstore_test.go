@@ -0,0 +1,252 @@
+// Copyright 2019 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package storage
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/holisticode/swarm/chunk"
+)
+
+// TestMapChunkStoreSubscribePull validates that the pull subscription
+// sends existing chunks from the requested range, streams new ones
+// and closes the channel when the until bin id is reached.
+func TestMapChunkStoreSubscribePull(t *testing.T) {
+	m := NewMapChunkStore()
+	defer m.Close()
+
+	// all chunks are put in bin 0 with the zero base key
+	// if their address starts with a set bit
+	var addrs []Address
+	putChunk := func() {
+		t.Helper()
+		for {
+			ch := GenerateRandomChunk(chunk.DefaultSize)
+			if ch.Address()[0]&0x80 == 0 {
+				continue
+			}
+			if _, err := m.Put(context.Background(), chunk.ModePutUpload, ch); err != nil {
+				t.Fatal(err)
+			}
+			addrs = append(addrs, ch.Address())
+			return
+		}
+	}
+	for i := 0; i < 5; i++ {
+		putChunk()
+	}
+
+	id, err := m.LastPullSubscriptionBinID(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != 5 {
+		t.Fatalf("got last bin id %v, want 5", id)
+	}
+
+	receive := func(c <-chan chunk.Descriptor, wantBinID uint64) {
+		t.Helper()
+		select {
+		case d, ok := <-c:
+			if !ok {
+				t.Fatal("subscription closed")
+			}
+			if d.BinID != wantBinID {
+				t.Fatalf("got bin id %v, want %v", d.BinID, wantBinID)
+			}
+			if !bytes.Equal(d.Address, addrs[wantBinID-1]) {
+				t.Fatalf("got address %s, want %s", d.Address, addrs[wantBinID-1])
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timeout waiting for bin id %v", wantBinID)
+		}
+	}
+	closed := func(c <-chan chunk.Descriptor) {
+		t.Helper()
+		select {
+		case d, ok := <-c:
+			if ok {
+				t.Fatalf("got unexpected descriptor with bin id %v", d.BinID)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout waiting for subscription to close")
+		}
+	}
+
+	t.Run("backfill and live", func(t *testing.T) {
+		c, stop := m.SubscribePull(context.Background(), 0, 2, 0)
+		defer stop()
+
+		for i := uint64(2); i <= 5; i++ {
+			receive(c, i)
+		}
+		putChunk()
+		receive(c, 6)
+
+		stop()
+		closed(c)
+	})
+
+	t.Run("until", func(t *testing.T) {
+		c, stop := m.SubscribePull(context.Background(), 0, 0, 3)
+		defer stop()
+
+		for i := uint64(1); i <= 3; i++ {
+			receive(c, i)
+		}
+		closed(c)
+	})
+
+	t.Run("until in the future", func(t *testing.T) {
+		last, err := m.LastPullSubscriptionBinID(0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c, stop := m.SubscribePull(context.Background(), 0, last, last+1)
+		defer stop()
+
+		receive(c, last)
+		putChunk()
+		receive(c, last+1)
+		closed(c)
+	})
+
+	t.Run("invalid range", func(t *testing.T) {
+		c, stop := m.SubscribePull(context.Background(), 0, 4, 2)
+		defer stop()
+		closed(c)
+
+		c, stop = m.SubscribePull(context.Background(), chunk.MaxPO+1, 0, 0)
+		defer stop()
+		closed(c)
+	})
+
+	t.Run("close", func(t *testing.T) {
+		c, stop := m.SubscribePull(context.Background(), 1, 0, 0)
+		defer stop()
+
+		m.Close()
+		closed(c)
+	})
+}
+
+// TestMapChunkStoreSet validates that Set updates the chunk states and
+// increments the tags like localstore, so that syncing tests can observe them.
+func TestMapChunkStoreSet(t *testing.T) {
+	m := NewMapChunkStore()
+	defer m.Close()
+	m.Tags = chunk.NewTags()
+
+	ctx := context.Background()
+	tag, err := m.Tags.Create("test", 2, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chunks := []Chunk{
+		GenerateRandomChunk(chunk.DefaultSize).WithTagID(tag.Uid),
+		GenerateRandomChunk(chunk.DefaultSize).WithTagID(tag.Uid),
+	}
+	if _, err := m.Put(ctx, chunk.ModePutUpload, chunks...); err != nil {
+		t.Fatal(err)
+	}
+	addrs := []Address{chunks[0].Address(), chunks[1].Address(), chunks[0].Address()}
+
+	checkSynced := func(want int64) {
+		t.Helper()
+		if got := tag.Get(chunk.StateSynced); got != want {
+			t.Fatalf("got %d synced chunks, want %d", got, want)
+		}
+	}
+	if err := m.Set(ctx, chunk.ModeSetSyncPull, addrs...); err != nil {
+		t.Fatal(err)
+	}
+	checkSynced(0)
+	if err := m.Set(ctx, chunk.ModeSetSyncPush, addrs...); err != nil {
+		t.Fatal(err)
+	}
+	checkSynced(2)
+	if err := m.Set(ctx, chunk.ModeSetSyncPush, addrs...); err != nil {
+		t.Fatal(err)
+	}
+	checkSynced(2)
+
+	if err := m.Set(ctx, chunk.ModeSetAccess, addrs...); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Set(ctx, chunk.ModeSetPin, chunks[1].Address(), chunks[1].Address()); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Set(ctx, chunk.ModeSetUnpin, chunks[1].Address()); err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []MapChunkState{
+		{AccessCount: 2, SyncedPull: true, SyncedPush: true},
+		{AccessCount: 1, SyncedPull: true, SyncedPush: true, PinCounter: 1},
+	} {
+		got, ok := m.State(chunks[i].Address())
+		if !ok {
+			t.Fatalf("chunk %d: no state", i)
+		}
+		if got != want {
+			t.Errorf("chunk %d: got state %+v, want %+v", i, got, want)
+		}
+	}
+	if err := m.Set(ctx, chunk.ModeSetUnpin, chunks[0].Address()); err == nil {
+		t.Error("expected an error unpinning a chunk that is not pinned")
+	}
+
+	// removed chunks are not sent by pull subscriptions
+	if err := m.Set(ctx, chunk.ModeSetRemove, chunks[0].Address()); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := m.State(chunks[0].Address()); ok {
+		t.Error("got state of a removed chunk")
+	}
+	if has, _ := m.Has(ctx, chunks[0].Address()); has {
+		t.Error("removed chunk is stored")
+	}
+	if err := m.Set(ctx, chunk.ModeSetRemove, chunks[0].Address()); err != ErrChunkNotFound {
+		t.Errorf("got error %v removing a missing chunk, want %v", err, ErrChunkNotFound)
+	}
+	bin := uint8(chunk.Proximity(m.baseKey, chunks[0].Address()))
+	c, stop := m.SubscribePull(ctx, bin, 0, m.pull[bin][len(m.pull[bin])-1].BinID)
+	defer stop()
+	for d := range c {
+		if bytes.Equal(d.Address, chunks[0].Address()) {
+			t.Fatal("got removed chunk from the pull subscription")
+		}
+	}
+}
+
+func BenchmarkMapChunkStoreGet_1(b *testing.B) {
+	benchmarkStoreGetConcurrency(NewMapChunkStore(), 1000, 1, b)
+}
+
+func BenchmarkMapChunkStoreGet_8(b *testing.B) {
+	benchmarkStoreGetConcurrency(NewMapChunkStore(), 1000, 8, b)
+}
+
+func BenchmarkMapChunkStoreGet_64(b *testing.B) {
+	benchmarkStoreGetConcurrency(NewMapChunkStore(), 1000, 64, b)
+}
+
+func BenchmarkMapChunkStoreGet_Unbounded(b *testing.B) {
+	benchmarkStoreGetConcurrency(NewMapChunkStore(), 1000, 0, b)
+}
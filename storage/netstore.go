@@ -21,6 +21,9 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
@@ -39,12 +42,28 @@ import (
 )
 
 const (
-	// capacity for the fetchers LRU cache
-	fetchersCapacity = 500000
+	// DefaultFetchersCapacity is the default maximum number of fetchers kept in the fetchers cache
+	DefaultFetchersCapacity = 500000
+	// maximum time to wait for in-flight fetches to return on Close
+	closeTimeout = 5 * time.Second
+	// DefaultFetchCoalesceWindow is the default period during which the result
+	// of a completed fetch is reused by requests for the same chunk
+	DefaultFetchCoalesceWindow = 50 * time.Millisecond
+	// DefaultSearchTimeoutJitter is the default fraction of the search timeout
+	// by which the retry interval of a remote fetch is randomly varied
+	DefaultSearchTimeoutJitter = 0.1
+	// maximum number of concurrent remote fetches issued by GetMultiRequests
+	getMultiWorkers = 16
 )
 
+// Errors returned by the NetStore are wrapped with their cause,
+// they should be checked with errors.Is.
 var (
 	ErrNoSuitablePeer = errors.New("no suitable peer")
+	ErrFetchTimeout   = errors.New("fetch timeout")
+	ErrNetStoreClosed = errors.New("netstore closed")
+
+	ErrInvalidFetchersCapacity = errors.New("invalid fetchers capacity")
 )
 
 // Fetcher is a struct which maintains state of remote requests.
@@ -63,6 +82,8 @@ type Fetcher struct {
 	CreatedBy string    // who created the fetcher - "request" or "syncing", used for metrics measuring lifecycle of fetchers
 
 	RequestedBySyncer bool // whether we have issued at least once a request through Offered/Wanted hashes flow
+
+	waiters int // number of remote fetches waiting on the fetcher, guarded by the NetStore put lock
 }
 
 // NewFetcher is a constructor for a Fetcher
@@ -86,8 +107,32 @@ func (fi *Fetcher) SafeClose(ch chunk.Chunk) {
 	})
 }
 
+// NetStoreOption sets an optional NetStore setting in the NetStore constructors
+type NetStoreOption func(*NetStore)
+
+// WithBloomFilter enables a bloom filter of the addresses of stored chunks, sized for the
+// expected number of chunks. The filter is seeded in the background with the chunks in the
+// pull index of the chunk store, and chunks put through the NetStore are added to it.
+// Once it is seeded, Has, HasMulti and Get consult the filter and do not look up the chunks
+// that are definitely not in the filter in the chunk store. The filter must be used with a
+// chunk store that is not written to other than through the NetStore. A zero size disables the filter.
+func WithBloomFilter(size uint64) NetStoreOption {
+	return func(n *NetStore) {
+		if size == 0 {
+			n.filter = nil
+			return
+		}
+		n.filter = newAddressFilter(size)
+	}
+}
+
 type RemoteGetFunc func(ctx context.Context, req *Request, localID enode.ID) (*enode.ID, func(), error)
 
+// RemoteGetMultiFunc requests a chunk from up to n eligible peers at once.
+// It returns the requested peers and a single cleanup function to expire all
+// the requests that were never delivered.
+type RemoteGetMultiFunc func(ctx context.Context, req *Request, localID enode.ID, n int) ([]*enode.ID, func(), error)
+
 // NetStore is an extension of LocalStore
 // it implements the ChunkStore interface
 // on request it initiates remote cloud retrieval
@@ -99,25 +144,234 @@ type NetStore struct {
 	requestGroup singleflight.Group
 	RemoteGet    RemoteGetFunc
 	logger       log.Logger
+	filter       *addressFilter // bloom filter of the stored chunks, nil if disabled
+	filterSeeded chan struct{}  // closed when the filter holds all chunks in the store
+
+	// SelectPeer selects the peer to request a chunk from among the eligible peers.
+	// If nil, the first eligible peer is selected.
+	SelectPeer SelectPeerFunc
+
+	// RemoteGetMulti, if set, is used instead of RemoteGet to request a chunk
+	// from FetchPeers peers at once on each RemoteFetch retry.
+	RemoteGetMulti RemoteGetMultiFunc
+	// FetchPeers is the number of peers a chunk is requested from on each
+	// RemoteFetch retry. Values lower than 1 are treated as 1.
+	FetchPeers int
+
+	// GetMultiFetchMissing makes GetMulti fetch the chunks missing in the LocalStore
+	// from the network like GetMultiRequests, instead of failing on the first missing chunk.
+	GetMultiFetchMissing bool
+
+	// SlowChunkDeliveryThreshold is the time since the creation of a fetcher above which
+	// the delivery of its chunk is counted as slow.
+	SlowChunkDeliveryThreshold time.Duration
+
+	// OnFetchFailed, if set, is called when a remote fetch of a chunk is abandoned,
+	// either because no suitable peer is left to request it from or because of the
+	// global fetch timeout. The reason is the error returned by the fetch, which
+	// matches ErrNoSuitablePeer, ErrFetchTimeout or the context error.
+	OnFetchFailed func(ref Address, reason error)
+
+	// FetchCoalesceWindow is the period after a fetch completes during which
+	// requests for the same chunk reuse its result instead of issuing a new fetch.
+	// Zero disables coalescing beyond the requests that join an in-flight fetch.
+	FetchCoalesceWindow time.Duration
+	coalesceMu          sync.Mutex
+	coalesced           map[string]*coalescedFetch
+
+	// SearchTimeoutJitter is the fraction of timeouts.SearchTimeout by which the interval
+	// before a remote fetch is retried is randomly varied in both directions, so that the
+	// retries of chunks that failed at the same time do not fire in lockstep.
+	// Zero disables the jitter.
+	SearchTimeoutJitter float64
+
+	// VerifyChunks enables validation of chunks on Put, before they are stored and
+	// delivered to waiting fetchers. Invalid chunks are dropped.
+	VerifyChunks bool
+	// NonContentAddressedValidators validate chunks that are not content-addressed,
+	// like feed updates, which are exempted from the content address check if any of
+	// the validators accepts them. Used only when VerifyChunks is set.
+	NonContentAddressedValidators []chunk.Validator
+
+	quit     chan struct{}  // closed when the NetStore is closed, cancels in-flight fetches
+	closeMu  sync.Mutex     // protects closed and the fetches wait group against Close
+	closed   bool           // whether Close has been called
+	fetchesW sync.WaitGroup // in-flight RemoteFetch calls
 }
 
 // NewNetStore creates a new NetStore using the provided chunk.Store and localID of the node.
-func NewNetStore(store chunk.Store, baseAddr *network.BzzAddr) *NetStore {
-	fetchers, _ := lru.New(fetchersCapacity)
+// The fetchers cache holds up to DefaultFetchersCapacity fetchers.
+func NewNetStore(store chunk.Store, baseAddr *network.BzzAddr, opts ...NetStoreOption) *NetStore {
+	n, _ := NewNetStoreWithCapacity(store, baseAddr, DefaultFetchersCapacity, opts...)
+	return n
+}
+
+// NewNetStoreWithCapacity creates a new NetStore like NewNetStore, with a fetchers cache
+// holding up to capacity fetchers. As each delivered fetcher holds the chunk data,
+// capacity bounds the memory used by the fetchers cache.
+func NewNetStoreWithCapacity(store chunk.Store, baseAddr *network.BzzAddr, capacity int, opts ...NetStoreOption) (*NetStore, error) {
+	if capacity <= 0 {
+		return nil, ErrInvalidFetchersCapacity
+	}
+	fetchers, err := lru.New(capacity)
+	if err != nil {
+		return nil, err
+	}
 
-	return &NetStore{
+	n := &NetStore{
 		fetchers: fetchers,
 		Store:    store,
 		LocalID:  baseAddr.ID(),
 		logger:   log.NewBaseAddressLogger(baseAddr.ShortString()),
+		quit:     make(chan struct{}),
+
+		FetchCoalesceWindow: DefaultFetchCoalesceWindow,
+		coalesced:           make(map[string]*coalescedFetch),
+		SearchTimeoutJitter: DefaultSearchTimeoutJitter,
+
+		SlowChunkDeliveryThreshold: timeouts.FetcherSlowChunkDeliveryThreshold,
+	}
+	for _, o := range opts {
+		o(n)
+	}
+	if n.filter != nil {
+		n.filterSeeded = make(chan struct{})
+		go n.seedFilter()
+	}
+	return n, nil
+}
+
+// seedFilter adds the addresses of the chunks in the pull index of the chunk store
+// to the bloom filter and closes filterSeeded once all of them are added.
+// Until then the filter is not trusted to report missing chunks.
+func (n *NetStore) seedFilter() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-n.quit:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	for bin := 0; bin <= chunk.MaxPO; bin++ {
+		until, err := n.Store.LastPullSubscriptionBinID(uint8(bin))
+		if err != nil {
+			n.logger.Error("netstore.seed-filter", "bin", bin, "err", err)
+			return
+		}
+		if until == 0 {
+			continue
+		}
+		if !n.seedFilterBin(ctx, uint8(bin), until) {
+			return
+		}
+	}
+	close(n.filterSeeded)
+	n.logger.Debug("netstore.seed-filter done")
+}
+
+// seedFilterBin adds the addresses of the chunks in the bin up to the until bin id
+// to the bloom filter. It returns false if the subscription ended before reaching until.
+func (n *NetStore) seedFilterBin(ctx context.Context, bin uint8, until uint64) bool {
+	descriptors, stop := n.Store.SubscribePull(ctx, bin, 0, until)
+	defer stop()
+
+	for d := range descriptors {
+		n.filter.Add(d.Address)
+		if d.BinID >= until {
+			return true
+		}
+	}
+	return false
+}
+
+// filterMiss returns true if the bloom filter is seeded and
+// the chunk with the address is definitely not stored
+func (n *NetStore) filterMiss(ref Address) bool {
+	if !n.filterReady() || n.filter.Contains(ref) {
+		return false
+	}
+	metrics.GetOrRegisterCounter("netstore/filter/miss", nil).Inc(1)
+	return true
+}
+
+// filterReady returns true if the bloom filter is enabled and seeded
+func (n *NetStore) filterReady() bool {
+	if n.filter == nil {
+		return false
+	}
+	select {
+	case <-n.filterSeeded:
+		return true
+	default:
+		return false
 	}
 }
 
 // Put stores a chunk in localstore, and delivers to all requestor peers using the fetcher stored in
-// the fetchers cache
+// the fetchers cache. If VerifyChunks is set, invalid chunks are dropped before they are stored
+// or delivered, and reported as not existing.
 func (n *NetStore) Put(ctx context.Context, mode chunk.ModePut, chs ...Chunk) ([]bool, error) {
+	if n.VerifyChunks {
+		valid, indexes := n.validChunks(chs)
+		if len(valid) < len(chs) {
+			// put only valid chunks, reporting dropped ones as not existing
+			exist := make([]bool, len(chs))
+			if len(valid) == 0 {
+				return exist, nil
+			}
+			e, err := n.put(ctx, mode, valid...)
+			if err != nil {
+				return nil, err
+			}
+			for i, idx := range indexes {
+				exist[idx] = e[i]
+			}
+			return exist, nil
+		}
+	}
+	return n.put(ctx, mode, chs...)
+}
+
+// validChunks returns the chunks that are valid content-addressed chunks or are accepted
+// by one of the NonContentAddressedValidators, with their indexes in chs
+func (n *NetStore) validChunks(chs []Chunk) (valid []Chunk, indexes []int) {
+	for i, ch := range chs {
+		if err := ValidateChunk(ch); err != nil && !n.validNonContentAddressed(ch) {
+			metrics.GetOrRegisterCounter("netstore/put/invalid", nil).Inc(1)
+			n.logger.Warn("netstore.put dropping invalid chunk", "ref", ch.Address().String(), "err", err)
+			continue
+		}
+		valid = append(valid, ch)
+		indexes = append(indexes, i)
+	}
+	return valid, indexes
+}
+
+// validNonContentAddressed returns true if one of the NonContentAddressedValidators accepts the chunk
+func (n *NetStore) validNonContentAddressed(ch Chunk) bool {
+	for _, v := range n.NonContentAddressedValidators {
+		if v.Validate(ch) {
+			return true
+		}
+	}
+	return false
+}
+
+// put stores the chunks in localstore, and delivers to all requestor peers using the fetcher stored in
+// the fetchers cache
+func (n *NetStore) put(ctx context.Context, mode chunk.ModePut, chs ...Chunk) ([]bool, error) {
+	ctx, sp := spancontext.StartSpan(
+		ctx,
+		"netstore.put")
+	defer sp.Finish()
+	sp.LogFields(olog.Int("chunks", len(chs)))
+
 	// first notify all goroutines waiting on the fetcher that the chunk has been received
 
+	var delivered int
 	n.putMu.Lock()
 	for i, ch := range chs {
 		n.logger.Trace("netstore.put", "index", i, "ref", ch.Address().String(), "mode", mode)
@@ -127,13 +381,24 @@ func (n *NetStore) Put(ctx context.Context, mode chunk.ModePut, chs ...Chunk) ([
 			// delivered through syncing and through a retrieve request
 			fii := fi.(*Fetcher)
 			fii.SafeClose(ch)
+			delivered++
 		}
 	}
 	n.putMu.Unlock()
+	sp.LogFields(olog.Int("fetchers", delivered))
+
+	// add the chunks to the filter before storing them, so that
+	// a stored chunk is never reported as missing by the filter
+	if n.filter != nil {
+		for _, ch := range chs {
+			n.filter.Add(ch.Address())
+		}
+	}
 
 	// put the chunk to the localstore, there should be no error
 	exist, err := n.Store.Put(ctx, mode, chs...)
 	if err != nil {
+		sp.LogFields(olog.String("err", err.Error()))
 		return nil, err
 	}
 
@@ -149,40 +414,72 @@ func (n *NetStore) Put(ctx context.Context, mode chunk.ModePut, chs ...Chunk) ([
 			metrics.GetOrRegisterResettingTimer(fmt.Sprintf("netstore/fetcher/lifetime/%s", fii.CreatedBy), nil).UpdateSince(fii.CreatedAt)
 
 			// helper snippet to log if a chunk took way to long to be delivered
-			if time.Since(fii.CreatedAt) > timeouts.FetcherSlowChunkDeliveryThreshold {
+			if n.isSlowDelivery(fii) {
 				metrics.GetOrRegisterCounter("netstore/slow_chunk_delivery", nil).Inc(1)
 				n.logger.Trace("netstore.put slow chunk delivery", "ref", ch.Address().String())
 			}
 			n.fetchers.Remove(ch.Address().String())
+			n.updateFetchersMetric()
 		}
 	}
 
 	return exist, nil
 }
 
-// Close chunk store
+// Close cancels all in-flight fetches, waits for them to return
+// for at most closeTimeout and closes the chunk store
 func (n *NetStore) Close() error {
+	n.closeMu.Lock()
+	if !n.closed {
+		n.closed = true
+		close(n.quit)
+	}
+	n.closeMu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		n.fetchesW.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(closeTimeout):
+		n.logger.Warn("netstore.close timeout waiting for in-flight fetches")
+	}
+
 	return n.Store.Close()
 }
 
+// startFetch registers an in-flight fetch, returning false if the NetStore is closed
+func (n *NetStore) startFetch() bool {
+	n.closeMu.Lock()
+	defer n.closeMu.Unlock()
+	if n.closed {
+		return false
+	}
+	n.fetchesW.Add(1)
+	return true
+}
+
 // Get retrieves a chunk
 // If it is not found in the LocalStore then it uses RemoteGet to fetch from the network.
+// Concurrent fetches of the same chunk are coalesced only if they are made with the same mode,
+// as modes have different side effects in the LocalStore.
 func (n *NetStore) Get(ctx context.Context, mode chunk.ModeGet, req *Request) (ch Chunk, err error) {
 	metrics.GetOrRegisterCounter("netstore/get", nil).Inc(1)
 	start := time.Now()
 
 	ref := req.Addr
 
-	ch, err = n.Store.Get(ctx, mode, ref)
+	ch, err = n.getLocal(ctx, mode, ref)
 	if err != nil {
-		// TODO: fix comparison - we should be comparing against leveldb.ErrNotFound, this error should be wrapped.
-		if err != ErrChunkNotFound && err != leveldb.ErrNotFound {
+		if !errors.Is(err, ErrChunkNotFound) {
 			n.logger.Error("localstore get error", "err", err)
 		}
 
 		n.logger.Trace("netstore.chunk-not-in-localstore", "ref", ref.String())
 
-		v, err, _ := n.requestGroup.Do(ref.String(), func() (interface{}, error) {
+		v, err := n.coalesceFetch(ctx, ref.String()+"/"+mode.String(), func() (interface{}, error) {
 			// currently we issue a retrieve request if a fetcher
 			// has already been created by a syncer for that particular chunk.
 			// so it is possible to
@@ -224,17 +521,173 @@ func (n *NetStore) Get(ctx context.Context, mode chunk.ModeGet, req *Request) (c
 	return ch, nil
 }
 
+// GetMultiError is returned by GetMultiRequests when some of the chunks could not be retrieved.
+// It maps the index of every failed request to its error.
+type GetMultiError map[int]error
+
+func (e GetMultiError) Error() string {
+	indexes := make([]int, 0, len(e))
+	for i := range e {
+		indexes = append(indexes, i)
+	}
+	sort.Ints(indexes)
+
+	errs := make([]string, 0, len(indexes))
+	for _, i := range indexes {
+		errs = append(errs, fmt.Sprintf("%d: %v", i, e[i]))
+	}
+	return fmt.Sprintf("failed to get %d chunks: %s", len(e), strings.Join(errs, "; "))
+}
+
+// GetMultiRequests retrieves the chunks for all requests, preserving their order in the returned slice.
+// Chunks present in the LocalStore are retrieved first, the rest are fetched from the network
+// concurrently, with at most getMultiWorkers fetches in flight.
+// If some chunks could not be retrieved, their slots in the returned slice are nil and
+// a GetMultiError holding the error for each of them is returned.
+// Unlike GetMulti of the embedded chunk.Store, which NetStore must keep implementing,
+// it falls back to the network for the chunks missing in the LocalStore.
+func (n *NetStore) GetMultiRequests(ctx context.Context, mode chunk.ModeGet, reqs []*Request) ([]Chunk, error) {
+	metrics.GetOrRegisterCounter("netstore/getmultirequests", nil).Inc(1)
+
+	chunks := make([]Chunk, len(reqs))
+	var missing []int
+	for i, req := range reqs {
+		ch, err := n.getLocal(ctx, mode, req.Addr)
+		if err != nil {
+			missing = append(missing, i)
+			continue
+		}
+		chunks[i] = ch
+	}
+	if len(missing) == 0 {
+		return chunks, nil
+	}
+
+	var (
+		mu   sync.Mutex
+		errs = make(GetMultiError)
+		wg   sync.WaitGroup
+		sem  = make(chan struct{}, getMultiWorkers)
+	)
+	for _, i := range missing {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			mu.Lock()
+			errs[i] = ctx.Err()
+			mu.Unlock()
+			continue
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			ch, err := n.Get(ctx, mode, reqs[i])
+			if err != nil {
+				mu.Lock()
+				errs[i] = err
+				mu.Unlock()
+				return
+			}
+			chunks[i] = ch
+		}(i)
+	}
+	wg.Wait()
+
+	if len(errs) > 0 {
+		return chunks, errs
+	}
+	return chunks, nil
+}
+
+// GetMulti retrieves the chunks from the LocalStore, failing on the first missing one.
+// If GetMultiFetchMissing is set, the missing chunks are fetched from the network with
+// GetMultiRequests instead, and the error is a GetMultiError indexed by the position of
+// the refs that could not be retrieved before the context is done.
+func (n *NetStore) GetMulti(ctx context.Context, mode chunk.ModeGet, refs ...Address) ([]Chunk, error) {
+	if !n.GetMultiFetchMissing {
+		return n.Store.GetMulti(ctx, mode, refs...)
+	}
+	reqs := make([]*Request, len(refs))
+	for i, ref := range refs {
+		reqs[i] = NewRequest(ref)
+	}
+	return n.GetMultiRequests(ctx, mode, reqs)
+}
+
+// coalescedFetch holds the result of a fetch shared by requests for the same chunk
+type coalescedFetch struct {
+	done chan struct{} // closed when the fetch completes
+	val  interface{}
+	err  error
+}
+
+// coalesceFetch runs fn for the given key through the request singleflight group.
+// Calls for a key with a fetch in flight, or with a fetch that completed successfully
+// within FetchCoalesceWindow, reuse that fetch's result instead of calling fn.
+// Calls waiting for a fetch in flight return early if their ctx is done.
+func (n *NetStore) coalesceFetch(ctx context.Context, key string, fn func() (interface{}, error)) (interface{}, error) {
+	if n.FetchCoalesceWindow <= 0 {
+		v, err, _ := n.requestGroup.Do(key, fn)
+		return v, err
+	}
+
+	n.coalesceMu.Lock()
+	if c, ok := n.coalesced[key]; ok {
+		n.coalesceMu.Unlock()
+		metrics.GetOrRegisterCounter("netstore/fetch/coalesced", nil).Inc(1)
+		select {
+		case <-c.done:
+			return c.val, c.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	c := &coalescedFetch{
+		done: make(chan struct{}),
+	}
+	n.coalesced[key] = c
+	n.coalesceMu.Unlock()
+
+	c.val, c.err, _ = n.requestGroup.Do(key, fn)
+	close(c.done)
+
+	remove := func() {
+		n.coalesceMu.Lock()
+		delete(n.coalesced, key)
+		n.coalesceMu.Unlock()
+	}
+	// failed fetches are not reused, so that subsequent requests can retry
+	if c.err != nil {
+		remove()
+	} else {
+		time.AfterFunc(n.FetchCoalesceWindow, remove)
+	}
+
+	return c.val, c.err
+}
+
 // RemoteFetch is handling the retry mechanism when making a chunk request to our peers.
 // For a given chunk Request, we call RemoteGet, which selects the next eligible peer and
-// issues a RetrieveRequest and we wait for a delivery. If a delivery doesn't arrive within the SearchTimeout
-// we retry.
+// issues a RetrieveRequest and we wait for a delivery. If a delivery doesn't arrive within the SearchTimeout,
+// varied by SearchTimeoutJitter, we retry.
 func (n *NetStore) RemoteFetch(ctx context.Context, req *Request, fi *Fetcher) (chunk.Chunk, error) {
 	// while we haven't timed-out, and while we don't have a chunk,
 	// iterate over peers and try to find a chunk
 	metrics.GetOrRegisterCounter("remote/fetch", nil).Inc(1)
 
+	if !n.startFetch() {
+		return nil, ErrNetStoreClosed
+	}
+	defer n.fetchesW.Done()
+
 	ref := req.Addr
 
+	n.addFetcherWaiter(fi)
+	defer n.removeFetcherWaiter(ref, fi)
+
 	for {
 		metrics.GetOrRegisterCounter("remote/fetch/inner", nil).Inc(1)
 
@@ -247,18 +700,36 @@ func (n *NetStore) RemoteFetch(ctx context.Context, req *Request, fi *Fetcher) (
 
 		log.Trace("remote.fetch", "ref", ref)
 
-		currentPeer, cleanup, err := n.RemoteGet(ctx, req, n.LocalID)
+		peers, cleanup, err := n.remoteGetMulti(ctx, req)
 		if err != nil {
 			n.logger.Trace(err.Error(), "ref", ref)
 			osp.LogFields(olog.String("err", err.Error()))
 			osp.Finish()
-			return nil, ErrNoSuitablePeer
+
+			// the fetcher is shared, so the chunk may still be delivered by an earlier
+			// request or by the syncer; wait for it once more before giving up
+			select {
+			case <-fi.Delivered:
+				n.logger.Trace("remote.fetch, chunk delivered after no suitable peer", "ref", ref)
+				metrics.GetOrRegisterCounter("remote/fetch/nopeer/delivered", nil).Inc(1)
+				return fi.Chunk, nil
+			case <-time.After(n.searchTimeout()):
+			case <-ctx.Done():
+			case <-n.quit:
+				return nil, ErrNetStoreClosed
+			}
+
+			err = fmt.Errorf("%w: %v", ErrNoSuitablePeer, err)
+			n.fetchFailed(ref, fi, err)
+			return nil, err
 		}
 		defer cleanup()
 
-		// add peer to the set of peers to skip from now
-		n.logger.Trace("remote.fetch, adding peer to skip", "ref", ref, "peer", currentPeer.String())
-		req.PeersToSkip.Store(currentPeer.String(), time.Now())
+		// add peers to the set of peers to skip from now
+		for _, p := range peers {
+			n.logger.Trace("remote.fetch, adding peer to skip", "ref", ref, "peer", p.String())
+			req.PeersToSkip.Store(p.String(), time.Now())
+		}
 
 		select {
 		case <-fi.Delivered:
@@ -267,7 +738,7 @@ func (n *NetStore) RemoteFetch(ctx context.Context, req *Request, fi *Fetcher) (
 			osp.LogFields(olog.Bool("delivered", true))
 			osp.Finish()
 			return fi.Chunk, nil
-		case <-time.After(timeouts.SearchTimeout):
+		case <-time.After(n.searchTimeout()):
 			metrics.GetOrRegisterCounter("remote/fetch/timeout/search", nil).Inc(1)
 
 			osp.LogFields(olog.Bool("timeout", true))
@@ -279,17 +750,230 @@ func (n *NetStore) RemoteFetch(ctx context.Context, req *Request, fi *Fetcher) (
 
 			osp.LogFields(olog.Bool("fail", true))
 			osp.Finish()
-			return nil, ctx.Err()
+			err := ctx.Err()
+			if err == context.DeadlineExceeded {
+				err = &fetchTimeoutError{err: err}
+			}
+			n.fetchFailed(ref, fi, err)
+			return nil, err
+		case <-n.quit:
+			n.logger.Trace("remote.fetch, netstore closed", "ref", ref)
+
+			osp.LogFields(olog.Bool("closed", true))
+			osp.Finish()
+			return nil, ErrNetStoreClosed
 		}
 	}
 }
 
+// remoteGetMulti requests the chunk from FetchPeers peers using RemoteGetMulti or,
+// if it is not set, by calling RemoteGet for each peer.
+func (n *NetStore) remoteGetMulti(ctx context.Context, req *Request) ([]*enode.ID, func(), error) {
+	count := n.FetchPeers
+	if count < 1 {
+		count = 1
+	}
+	if n.RemoteGetMulti != nil {
+		return n.RemoteGetMulti(ctx, req, n.LocalID, count)
+	}
+	return remoteGetMultiFromSingle(n.RemoteGet)(ctx, req, n.LocalID, count)
+}
+
+// remoteGetMultiFromSingle adapts a RemoteGetFunc to a RemoteGetMultiFunc by calling it
+// up to n times, adding each requested peer to the peers to skip so that the next call
+// selects another one. It returns an error only if no peer could be requested.
+func remoteGetMultiFromSingle(remoteGet RemoteGetFunc) RemoteGetMultiFunc {
+	return func(ctx context.Context, req *Request, localID enode.ID, n int) ([]*enode.ID, func(), error) {
+		var peers []*enode.ID
+		var cleanups []func()
+		cleanup := func() {
+			for _, c := range cleanups {
+				c()
+			}
+		}
+		for i := 0; i < n; i++ {
+			peer, c, err := remoteGet(ctx, req, localID)
+			if err != nil {
+				if len(peers) == 0 {
+					return nil, func() {}, err
+				}
+				break
+			}
+			peers = append(peers, peer)
+			cleanups = append(cleanups, c)
+			if i < n-1 {
+				req.PeersToSkip.Store(peer.String(), time.Now())
+			}
+		}
+		return peers, cleanup, nil
+	}
+}
+
+// isSlowDelivery returns true if the chunk of the fetcher is delivered
+// later than SlowChunkDeliveryThreshold after the fetcher was created
+func (n *NetStore) isSlowDelivery(fi *Fetcher) bool {
+	return time.Since(fi.CreatedAt) > n.SlowChunkDeliveryThreshold
+}
+
+// searchTimeout returns the interval to wait for a delivery before a remote fetch
+// is retried, which is timeouts.SearchTimeout randomly varied by SearchTimeoutJitter.
+func (n *NetStore) searchTimeout() time.Duration {
+	if n.SearchTimeoutJitter <= 0 {
+		return timeouts.SearchTimeout
+	}
+	jitter := n.SearchTimeoutJitter * (2*rand.Float64() - 1)
+	return timeouts.SearchTimeout + time.Duration(jitter*float64(timeouts.SearchTimeout))
+}
+
+// fetchFailed calls OnFetchFailed for the chunk that could not be fetched.
+func (n *NetStore) fetchFailed(ref Address, fi *Fetcher, reason error) {
+	metrics.GetOrRegisterCounter("netstore/fetch/failed", nil).Inc(1)
+
+	if n.OnFetchFailed != nil {
+		n.OnFetchFailed(ref, reason)
+	}
+}
+
+// addFetcherWaiter registers a remote fetch waiting on the fetcher.
+func (n *NetStore) addFetcherWaiter(fi *Fetcher) {
+	n.putMu.Lock()
+	fi.waiters++
+	n.putMu.Unlock()
+}
+
+// removeFetcherWaiter unregisters a remote fetch waiting on the fetcher. If it was the last
+// one and the chunk was not delivered, the fetcher is removed from the fetchers cache, so that
+// it is not reused by later requests. Fetches of different modes share the fetcher, so it is
+// kept as long as any of them may still receive the chunk through it.
+func (n *NetStore) removeFetcherWaiter(ref Address, fi *Fetcher) {
+	n.putMu.Lock()
+	defer n.putMu.Unlock()
+
+	fi.waiters--
+	if fi.waiters > 0 {
+		return
+	}
+	select {
+	case <-fi.Delivered:
+		return
+	default:
+	}
+	// the fetcher may have been replaced after it was evicted from the cache
+	if v, ok := n.fetchers.Peek(ref.String()); ok && v.(*Fetcher) == fi {
+		n.fetchers.Remove(ref.String())
+		n.updateFetchersMetric()
+	}
+}
+
 // Has is the storage layer entry point to query the underlying
 // database to return if it has a chunk or not.
+// If the bloom filter is enabled and seeded, chunks that are definitely not in it are
+// reported as missing without querying the database.
 func (n *NetStore) Has(ctx context.Context, ref Address) (bool, error) {
+	if n.filterMiss(ref) {
+		return false, nil
+	}
 	return n.Store.Has(ctx, ref)
 }
 
+// GetLocal retrieves a chunk from the LocalStore only, without ever fetching it
+// from the network. It returns an error matching ErrChunkNotFound if the chunk is not stored locally.
+func (n *NetStore) GetLocal(ctx context.Context, mode chunk.ModeGet, ref Address) (Chunk, error) {
+	metrics.GetOrRegisterCounter("netstore/getlocal", nil).Inc(1)
+
+	return n.getLocal(ctx, mode, ref)
+}
+
+// getLocal retrieves a chunk from the LocalStore, returning ErrChunkNotFound
+// without looking it up if the seeded bloom filter does not contain it
+func (n *NetStore) getLocal(ctx context.Context, mode chunk.ModeGet, ref Address) (Chunk, error) {
+	if n.filterMiss(ref) {
+		return nil, ErrChunkNotFound
+	}
+	ch, err := n.Store.Get(ctx, mode, ref)
+	if err == leveldb.ErrNotFound {
+		return nil, fmt.Errorf("%w: %v", ErrChunkNotFound, err)
+	}
+	return ch, err
+}
+
+// fetchTimeoutError is returned by a fetch when its context deadline is exceeded.
+// It matches both ErrFetchTimeout and context.DeadlineExceeded with errors.Is.
+type fetchTimeoutError struct {
+	err error
+}
+
+func (e *fetchTimeoutError) Error() string {
+	return fmt.Sprintf("%v: %v", ErrFetchTimeout, e.err)
+}
+
+func (e *fetchTimeoutError) Is(target error) bool {
+	return target == ErrFetchTimeout
+}
+
+func (e *fetchTimeoutError) Unwrap() error {
+	return e.err
+}
+
+// HasMulti queries the underlying database in a single call to return
+// which of the chunks with the given references it has.
+// If the bloom filter is enabled and seeded, only the chunks that may be in it are queried.
+func (n *NetStore) HasMulti(ctx context.Context, refs ...Address) ([]bool, error) {
+	if !n.filterReady() {
+		return n.Store.HasMulti(ctx, refs...)
+	}
+
+	have := make([]bool, len(refs))
+	var (
+		candidates []Address
+		indexes    []int
+	)
+	for i, ref := range refs {
+		if !n.filter.Contains(ref) {
+			continue
+		}
+		candidates = append(candidates, ref)
+		indexes = append(indexes, i)
+	}
+	metrics.GetOrRegisterCounter("netstore/filter/miss", nil).Inc(int64(len(refs) - len(candidates)))
+	if len(candidates) == 0 {
+		return have, nil
+	}
+
+	yes, err := n.Store.HasMulti(ctx, candidates...)
+	if err != nil {
+		return nil, err
+	}
+	for i, idx := range indexes {
+		have[idx] = yes[i]
+	}
+	return have, nil
+}
+
+// EachFetcher iterates over the fetchers of chunks currently being fetched, calling f with the
+// reference of the chunk and its Fetcher. The iteration stops when f returns false.
+// f is called while holding the NetStore put lock, so it must not call back into the NetStore.
+func (n *NetStore) EachFetcher(f func(ref string, fi *Fetcher) bool) {
+	n.putMu.Lock()
+	defer n.putMu.Unlock()
+
+	for _, k := range n.fetchers.Keys() {
+		v, ok := n.fetchers.Peek(k)
+		if !ok {
+			continue
+		}
+		if !f(k.(string), v.(*Fetcher)) {
+			return
+		}
+	}
+}
+
+// updateFetchersMetric reports the current number of fetchers in the fetchers cache.
+// Must be called with putMu held.
+func (n *NetStore) updateFetchersMetric() {
+	metrics.GetOrRegisterGauge("netstore/fetchers", nil).Update(int64(n.fetchers.Len()))
+}
+
 // GetOrCreateFetcher returns the Fetcher for a given chunk, if this chunk is not in the LocalStore.
 // If the chunk is in the LocalStore, it returns nil for the Fetcher and ok == false
 func (n *NetStore) GetOrCreateFetcher(ctx context.Context, ref Address, interestedParty string) (f *Fetcher, loaded bool, ok bool) {
@@ -304,11 +988,14 @@ func (n *NetStore) GetOrCreateFetcher(ctx context.Context, ref Address, interest
 	} else {
 		f.CreatedBy = interestedParty
 		n.fetchers.Add(ref.String(), f)
+		n.updateFetchersMetric()
+		metrics.GetOrRegisterCounter(fmt.Sprintf("netstore/fetcher/created/%s", interestedParty), nil).Inc(1)
 	}
 
 	// if fetcher created by request, but we get a call from syncer, make sure we issue a second request
 	if f.CreatedBy != interestedParty && !f.RequestedBySyncer {
 		f.RequestedBySyncer = true
+		metrics.GetOrRegisterCounter("netstore/fetcher/dual-origin", nil).Inc(1)
 		return f, false, true
 	}
 
@@ -0,0 +1,970 @@
+// Copyright 2019 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/holisticode/swarm/chunk"
+	"github.com/holisticode/swarm/network"
+	"github.com/holisticode/swarm/network/timeouts"
+)
+
+// TestNetStoreCloseCancelsFetches checks that closing the NetStore
+// cancels an in-flight fetch and that the fetch returns promptly with an error.
+func TestNetStoreCloseCancelsFetches(t *testing.T) {
+	netStore := NewNetStore(NewMapChunkStore(), network.RandomBzzAddr())
+
+	requested := make(chan struct{})
+	netStore.RemoteGet = func(ctx context.Context, req *Request, localID enode.ID) (*enode.ID, func(), error) {
+		close(requested)
+		var id enode.ID
+		return &id, func() {}, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	errc := make(chan error, 1)
+	go func() {
+		_, err := netStore.Get(ctx, chunk.ModeGetRequest, NewRequest(GenerateRandomChunk(chunk.DefaultSize).Address()))
+		errc <- err
+	}()
+
+	select {
+	case <-requested:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for remote get")
+	}
+
+	if err := netStore.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case err := <-errc:
+		if err != ErrNetStoreClosed {
+			t.Fatalf("got error %v, want %v", err, ErrNetStoreClosed)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("fetch did not return after close")
+	}
+}
+
+// TestNetStoreFetchCoalescing checks that concurrent Gets for the same missing chunk,
+// including ones arriving shortly after the chunk is delivered, result in a single RemoteGet call.
+func TestNetStoreFetchCoalescing(t *testing.T) {
+	netStore := NewNetStore(NewMapChunkStore(), network.RandomBzzAddr())
+	defer netStore.Close()
+
+	ch := GenerateRandomChunk(chunk.DefaultSize)
+
+	var remoteGets int32
+	netStore.RemoteGet = func(ctx context.Context, req *Request, localID enode.ID) (*enode.ID, func(), error) {
+		atomic.AddInt32(&remoteGets, 1)
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			netStore.Put(context.Background(), chunk.ModePutRequest, ch)
+		}()
+		var id enode.ID
+		return &id, func() {}, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	const n = 50
+	var wg sync.WaitGroup
+	errc := make(chan error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			got, err := netStore.Get(ctx, chunk.ModeGetRequest, NewRequest(ch.Address()))
+			if err != nil {
+				errc <- err
+				return
+			}
+			if !bytes.Equal(got.Data(), ch.Data()) {
+				errc <- errors.New("got wrong chunk data")
+			}
+		}()
+	}
+	wg.Wait()
+	close(errc)
+
+	for err := range errc {
+		t.Fatal(err)
+	}
+	if got := atomic.LoadInt32(&remoteGets); got != 1 {
+		t.Fatalf("got %v remote get calls, want 1", got)
+	}
+}
+
+// TestNetStoreFetchCoalescingModes checks that concurrent Gets for the same missing chunk
+// are coalesced only with Gets of the same mode, so that each mode issues its own fetch.
+func TestNetStoreFetchCoalescingModes(t *testing.T) {
+	netStore := NewNetStore(NewMapChunkStore(), network.RandomBzzAddr())
+	defer netStore.Close()
+
+	ch := GenerateRandomChunk(chunk.DefaultSize)
+	modes := []chunk.ModeGet{chunk.ModeGetRequest, chunk.ModeGetLookup}
+
+	// the chunk is delivered only when every mode has issued its own request,
+	// before the first request is retried after the search timeout
+	var remoteGets int32
+	netStore.RemoteGet = func(ctx context.Context, req *Request, localID enode.ID) (*enode.ID, func(), error) {
+		if atomic.AddInt32(&remoteGets, 1) == int32(len(modes)) {
+			go netStore.Put(context.Background(), chunk.ModePutRequest, ch)
+		}
+		var id enode.ID
+		return &id, func() {}, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeouts.SearchTimeout/2)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	errc := make(chan error, 10*len(modes))
+	for i := 0; i < 10; i++ {
+		for _, mode := range modes {
+			wg.Add(1)
+			go func(mode chunk.ModeGet) {
+				defer wg.Done()
+				got, err := netStore.Get(ctx, mode, NewRequest(ch.Address()))
+				if err != nil {
+					errc <- err
+					return
+				}
+				if !bytes.Equal(got.Data(), ch.Data()) {
+					errc <- errors.New("got wrong chunk data")
+				}
+			}(mode)
+		}
+	}
+	wg.Wait()
+	close(errc)
+
+	for err := range errc {
+		t.Fatal(err)
+	}
+	if got := atomic.LoadInt32(&remoteGets); got != int32(len(modes)) {
+		t.Fatalf("got %v remote get calls, want %v", got, len(modes))
+	}
+}
+
+// TestNetStoreFetchModesSharedFetcher checks that when a fetch of one mode fails, the fetcher it
+// shares with a concurrent fetch of another mode is kept, so that the other fetch still gets the chunk.
+func TestNetStoreFetchModesSharedFetcher(t *testing.T) {
+	netStore := NewNetStore(NewMapChunkStore(), network.RandomBzzAddr())
+	defer netStore.Close()
+
+	ch := GenerateRandomChunk(chunk.DefaultSize)
+	requested := make(chan struct{}, 10)
+	netStore.RemoteGet = func(ctx context.Context, req *Request, localID enode.ID) (*enode.ID, func(), error) {
+		requested <- struct{}{}
+		var id enode.ID
+		return &id, func() {}, nil
+	}
+
+	errc := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		got, err := netStore.Get(ctx, chunk.ModeGetLookup, NewRequest(ch.Address()))
+		if err == nil && !bytes.Equal(got.Data(), ch.Data()) {
+			err = errors.New("got wrong chunk data")
+		}
+		errc <- err
+	}()
+	<-requested
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, err := netStore.Get(ctx, chunk.ModeGetRequest, NewRequest(ch.Address())); !errors.Is(err, ErrFetchTimeout) {
+		t.Fatalf("got error %v, want %v", err, ErrFetchTimeout)
+	}
+
+	if _, err := netStore.Put(context.Background(), chunk.ModePutRequest, ch); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-errc:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(timeouts.SearchTimeout / 2):
+		t.Fatal("fetch did not return the delivered chunk")
+	}
+}
+
+// TestNetStoreGetMultiRequests checks that GetMultiRequests returns local and remotely fetched chunks
+// in the order of the requests and reports failed requests by their index.
+func TestNetStoreGetMultiRequests(t *testing.T) {
+	netStore := NewNetStore(NewMapChunkStore(), network.RandomBzzAddr())
+	defer netStore.Close()
+
+	local := GenerateRandomChunk(chunk.DefaultSize)
+	if _, err := netStore.Put(context.Background(), chunk.ModePutUpload, local); err != nil {
+		t.Fatal(err)
+	}
+	remote := GenerateRandomChunk(chunk.DefaultSize)
+	unavailable := GenerateRandomChunk(chunk.DefaultSize)
+
+	netStore.RemoteGet = func(ctx context.Context, req *Request, localID enode.ID) (*enode.ID, func(), error) {
+		if !bytes.Equal(req.Addr, remote.Address()) {
+			return nil, nil, errors.New("not found")
+		}
+		go netStore.Put(context.Background(), chunk.ModePutRequest, remote)
+		var id enode.ID
+		return &id, func() {}, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	reqs := []*Request{
+		NewRequest(remote.Address()),
+		NewRequest(unavailable.Address()),
+		NewRequest(local.Address()),
+	}
+	chunks, err := netStore.GetMultiRequests(ctx, chunk.ModeGetRequest, reqs)
+	merr, ok := err.(GetMultiError)
+	if !ok {
+		t.Fatalf("got error %v, want GetMultiError", err)
+	}
+	if len(merr) != 1 || merr[1] == nil {
+		t.Fatalf("got errors %v, want an error only for index 1", merr)
+	}
+	if len(chunks) != len(reqs) {
+		t.Fatalf("got %v chunks, want %v", len(chunks), len(reqs))
+	}
+	if chunks[0] == nil || !bytes.Equal(chunks[0].Data(), remote.Data()) {
+		t.Fatal("got wrong remote chunk at index 0")
+	}
+	if chunks[1] != nil {
+		t.Fatal("got chunk for unavailable request at index 1")
+	}
+	if chunks[2] == nil || !bytes.Equal(chunks[2].Data(), local.Data()) {
+		t.Fatal("got wrong local chunk at index 2")
+	}
+}
+
+// TestNetStoreGetMultiFetchMissing checks that GetMulti fails on missing chunks
+// unless GetMultiFetchMissing is set, in which case they are fetched from the network.
+func TestNetStoreGetMultiFetchMissing(t *testing.T) {
+	netStore := NewNetStore(NewMapChunkStore(), network.RandomBzzAddr())
+	defer netStore.Close()
+
+	local := GenerateRandomChunk(chunk.DefaultSize)
+	if _, err := netStore.Put(context.Background(), chunk.ModePutUpload, local); err != nil {
+		t.Fatal(err)
+	}
+	remote := GenerateRandomChunk(chunk.DefaultSize)
+
+	netStore.RemoteGet = func(ctx context.Context, req *Request, localID enode.ID) (*enode.ID, func(), error) {
+		go netStore.Put(context.Background(), chunk.ModePutRequest, remote)
+		var id enode.ID
+		return &id, func() {}, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := netStore.GetMulti(ctx, chunk.ModeGetRequest, local.Address(), remote.Address()); err != ErrChunkNotFound {
+		t.Fatalf("got error %v, want %v", err, ErrChunkNotFound)
+	}
+
+	netStore.GetMultiFetchMissing = true
+	chunks, err := netStore.GetMulti(ctx, chunk.ModeGetRequest, local.Address(), remote.Address())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(chunks[0].Data(), local.Data()) {
+		t.Fatal("got wrong local chunk at index 0")
+	}
+	if !bytes.Equal(chunks[1].Data(), remote.Data()) {
+		t.Fatal("got wrong remote chunk at index 1")
+	}
+}
+
+// TestNetStoreGetLocal checks that GetLocal returns locally stored chunks
+// and ErrChunkNotFound for missing ones, without requesting them from the network.
+func TestNetStoreGetLocal(t *testing.T) {
+	netStore := NewNetStore(NewMapChunkStore(), network.RandomBzzAddr())
+	defer netStore.Close()
+
+	netStore.RemoteGet = func(ctx context.Context, req *Request, localID enode.ID) (*enode.ID, func(), error) {
+		t.Error("unexpected remote get")
+		return nil, func() {}, errors.New("not found")
+	}
+
+	ch := GenerateRandomChunk(chunk.DefaultSize)
+	if _, err := netStore.GetLocal(context.Background(), chunk.ModeGetRequest, ch.Address()); err != ErrChunkNotFound {
+		t.Fatalf("got error %v, want %v", err, ErrChunkNotFound)
+	}
+
+	if _, err := netStore.Put(context.Background(), chunk.ModePutUpload, ch); err != nil {
+		t.Fatal(err)
+	}
+	got, err := netStore.GetLocal(context.Background(), chunk.ModeGetRequest, ch.Address())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got.Data(), ch.Data()) {
+		t.Fatal("got wrong chunk data")
+	}
+}
+
+// TestNetStoreVerifyChunks checks that with VerifyChunks set, chunks with invalid
+// content addresses are neither stored nor delivered to waiting fetchers, unless
+// they are accepted by one of the NonContentAddressedValidators.
+func TestNetStoreVerifyChunks(t *testing.T) {
+	netStore := NewNetStore(NewMapChunkStore(), network.RandomBzzAddr())
+	defer netStore.Close()
+	netStore.VerifyChunks = true
+
+	valid := GenerateRandomChunk(chunk.DefaultSize)
+	data := make([]byte, len(valid.Data()))
+	copy(data, valid.Data())
+	data[len(data)-1] ^= 0xff
+	invalid := NewChunk(valid.Address(), data)
+
+	fi, _, ok := netStore.GetOrCreateFetcher(context.Background(), invalid.Address(), "request")
+	if !ok {
+		t.Fatal("expected a fetcher")
+	}
+
+	exist, err := netStore.Put(context.Background(), chunk.ModePutRequest, invalid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(exist) != 1 || exist[0] {
+		t.Fatalf("got exist %v, want [false]", exist)
+	}
+	select {
+	case <-fi.Delivered:
+		t.Fatal("invalid chunk delivered to fetcher")
+	default:
+	}
+	if has, _ := netStore.Has(context.Background(), invalid.Address()); has {
+		t.Fatal("invalid chunk stored")
+	}
+
+	if _, err := netStore.Put(context.Background(), chunk.ModePutRequest, valid); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-fi.Delivered:
+	default:
+		t.Fatal("valid chunk not delivered to fetcher")
+	}
+
+	// chunks accepted by a non content addressed validator are exempted
+	exempt := NewChunk(GenerateRandomChunk(chunk.DefaultSize).Address(), data)
+	netStore.NonContentAddressedValidators = []chunk.Validator{validatorFunc(func(ch Chunk) bool {
+		return bytes.Equal(ch.Address(), exempt.Address())
+	})}
+	if _, err := netStore.Put(context.Background(), chunk.ModePutRequest, exempt); err != nil {
+		t.Fatal(err)
+	}
+	if has, _ := netStore.Has(context.Background(), exempt.Address()); !has {
+		t.Fatal("exempted chunk not stored")
+	}
+}
+
+// validatorFunc is a chunk.Validator that calls the function
+type validatorFunc func(ch Chunk) bool
+
+func (f validatorFunc) Validate(ch Chunk) bool {
+	return f(ch)
+}
+
+// TestNewNetStoreWithCapacity checks that the fetchers capacity is validated
+// and that the fetchers cache does not grow beyond it.
+func TestNewNetStoreWithCapacity(t *testing.T) {
+	for _, capacity := range []int{0, -1} {
+		if _, err := NewNetStoreWithCapacity(NewMapChunkStore(), network.RandomBzzAddr(), capacity); err != ErrInvalidFetchersCapacity {
+			t.Fatalf("capacity %v: got error %v, want %v", capacity, err, ErrInvalidFetchersCapacity)
+		}
+	}
+
+	netStore, err := NewNetStoreWithCapacity(NewMapChunkStore(), network.RandomBzzAddr(), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer netStore.Close()
+
+	for i := 0; i < 3; i++ {
+		if _, _, ok := netStore.GetOrCreateFetcher(context.Background(), GenerateRandomChunk(chunk.DefaultSize).Address(), "request"); !ok {
+			t.Fatal("expected a fetcher")
+		}
+	}
+	if got := netStore.fetchers.Len(); got != 2 {
+		t.Fatalf("got %v fetchers, want 2", got)
+	}
+}
+
+// TestNetStoreOnFetchFailed checks that OnFetchFailed is called with the reason when
+// a fetch is abandoned and that the fetcher of the chunk is removed from the cache.
+func TestNetStoreOnFetchFailed(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		remoteGet RemoteGetFunc
+		reason    error
+	}{
+		{
+			name: "no suitable peer",
+			remoteGet: func(ctx context.Context, req *Request, localID enode.ID) (*enode.ID, func(), error) {
+				return nil, nil, errors.New("no peer found")
+			},
+			reason: ErrNoSuitablePeer,
+		},
+		{
+			name: "global timeout",
+			remoteGet: func(ctx context.Context, req *Request, localID enode.ID) (*enode.ID, func(), error) {
+				var id enode.ID
+				return &id, func() {}, nil
+			},
+			reason: ErrFetchTimeout,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			netStore := NewNetStore(NewMapChunkStore(), network.RandomBzzAddr())
+			defer netStore.Close()
+			netStore.RemoteGet = tc.remoteGet
+
+			type failure struct {
+				ref    Address
+				reason error
+			}
+			failures := make(chan failure, 1)
+			netStore.OnFetchFailed = func(ref Address, reason error) {
+				failures <- failure{ref: ref, reason: reason}
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+
+			ref := GenerateRandomChunk(chunk.DefaultSize).Address()
+			_, err := netStore.Get(ctx, chunk.ModeGetRequest, NewRequest(ref))
+			if !errors.Is(err, tc.reason) {
+				t.Fatalf("got error %v, want %v", err, tc.reason)
+			}
+			if tc.reason == ErrFetchTimeout && !errors.Is(err, context.DeadlineExceeded) {
+				t.Fatalf("got error %v, want %v", err, context.DeadlineExceeded)
+			}
+
+			select {
+			case f := <-failures:
+				if !bytes.Equal(f.ref, ref) {
+					t.Fatalf("got failed fetch of %v, want %v", f.ref, ref)
+				}
+				if f.reason != err {
+					t.Fatalf("got reason %v, want %v", f.reason, tc.reason)
+				}
+			default:
+				t.Fatal("OnFetchFailed not called")
+			}
+
+			if _, ok := netStore.fetchers.Peek(ref.String()); ok {
+				t.Fatal("fetcher of the failed fetch not removed")
+			}
+		})
+	}
+}
+
+// countingStore counts the lookups in the wrapped chunk.Store
+type countingStore struct {
+	chunk.Store
+	lookups int32
+}
+
+func (s *countingStore) Get(ctx context.Context, mode chunk.ModeGet, addr Address) (Chunk, error) {
+	atomic.AddInt32(&s.lookups, 1)
+	return s.Store.Get(ctx, mode, addr)
+}
+
+func (s *countingStore) Has(ctx context.Context, addr Address) (bool, error) {
+	atomic.AddInt32(&s.lookups, 1)
+	return s.Store.Has(ctx, addr)
+}
+
+func (s *countingStore) HasMulti(ctx context.Context, addrs ...Address) ([]bool, error) {
+	atomic.AddInt32(&s.lookups, int32(len(addrs)))
+	return s.Store.HasMulti(ctx, addrs...)
+}
+
+// TestNetStoreBloomFilter checks that with the bloom filter enabled, chunks put through
+// the NetStore are found and chunks that were never put are not looked up in the store
+func TestNetStoreBloomFilter(t *testing.T) {
+	store := &countingStore{Store: NewMapChunkStore()}
+	netStore := NewNetStore(store, network.RandomBzzAddr(), WithBloomFilter(1000))
+	defer netStore.Close()
+	waitFilterSeeded(t, netStore)
+
+	ctx := context.Background()
+	stored := GenerateRandomChunks(chunk.DefaultSize, 10)
+	if _, err := netStore.Put(ctx, chunk.ModePutUpload, stored...); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, ch := range stored {
+		yes, err := netStore.Has(ctx, ch.Address())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !yes {
+			t.Fatalf("expected chunk %v to be stored", ch.Address())
+		}
+		got, err := netStore.Get(ctx, chunk.ModeGetRequest, NewRequest(ch.Address()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got.Data(), ch.Data()) {
+			t.Fatalf("got chunk data %x, want %x", got.Data(), ch.Data())
+		}
+	}
+
+	// a false positive is possible, so only most of the missing chunks
+	// are required to be answered by the filter alone
+	missing := GenerateRandomChunks(chunk.DefaultSize, 100)
+	atomic.StoreInt32(&store.lookups, 0)
+	for _, ch := range missing {
+		yes, err := netStore.Has(ctx, ch.Address())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if yes {
+			t.Fatalf("expected chunk %v not to be stored", ch.Address())
+		}
+	}
+	if lookups := atomic.LoadInt32(&store.lookups); lookups > 10 {
+		t.Fatalf("got %v store lookups for missing chunks, want at most 10", lookups)
+	}
+
+	refs := append(chunkAddresses(stored), chunkAddresses(missing)...)
+	atomic.StoreInt32(&store.lookups, 0)
+	have, err := netStore.HasMulti(ctx, refs...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, yes := range have {
+		if want := i < len(stored); yes != want {
+			t.Fatalf("chunk %v: got has %v, want %v", i, yes, want)
+		}
+	}
+	if lookups := atomic.LoadInt32(&store.lookups); lookups > int32(len(stored))+10 {
+		t.Fatalf("got %v store lookups, want at most %v", lookups, len(stored)+10)
+	}
+}
+
+// TestNetStoreBloomFilterSeed checks that chunks which were in the chunk store before
+// the NetStore was constructed are found, before and after the bloom filter is seeded
+func TestNetStoreBloomFilterSeed(t *testing.T) {
+	ctx := context.Background()
+	store := &blockingPullStore{Store: NewMapChunkStore(), release: make(chan struct{})}
+	stored := GenerateRandomChunks(chunk.DefaultSize, 10)
+	if _, err := store.Put(ctx, chunk.ModePutUpload, stored...); err != nil {
+		t.Fatal(err)
+	}
+
+	netStore := NewNetStore(store, network.RandomBzzAddr(), WithBloomFilter(1000))
+	defer netStore.Close()
+
+	checkStored := func(t *testing.T) {
+		t.Helper()
+		for _, ch := range stored {
+			yes, err := netStore.Has(ctx, ch.Address())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !yes {
+				t.Fatalf("expected chunk %v to be stored", ch.Address())
+			}
+		}
+		have, err := netStore.HasMulti(ctx, chunkAddresses(stored)...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, yes := range have {
+			if !yes {
+				t.Fatalf("expected chunk %v to be stored", stored[i].Address())
+			}
+		}
+	}
+
+	// the filter is not trusted while it is being seeded
+	checkStored(t)
+
+	close(store.release)
+	waitFilterSeeded(t, netStore)
+	checkStored(t)
+}
+
+// blockingPullStore blocks the pull subscriptions of the wrapped chunk.Store until release is closed
+type blockingPullStore struct {
+	chunk.Store
+	release chan struct{}
+}
+
+func (s *blockingPullStore) SubscribePull(ctx context.Context, bin uint8, since, until uint64) (<-chan chunk.Descriptor, func()) {
+	<-s.release
+	return s.Store.SubscribePull(ctx, bin, since, until)
+}
+
+// waitFilterSeeded waits until the bloom filter of the NetStore is seeded
+func waitFilterSeeded(t *testing.T, n *NetStore) {
+	t.Helper()
+	select {
+	case <-n.filterSeeded:
+	case <-time.After(5 * time.Second):
+		t.Fatal("bloom filter not seeded")
+	}
+}
+
+// TestNetStoreSearchTimeoutJitter checks that the retry interval of remote fetches
+// stays within the configured jitter and that concurrent fetches do not retry in lockstep.
+func TestNetStoreSearchTimeoutJitter(t *testing.T) {
+	defer func(d time.Duration) { timeouts.SearchTimeout = d }(timeouts.SearchTimeout)
+	timeouts.SearchTimeout = 100 * time.Millisecond
+
+	netStore := NewNetStore(NewMapChunkStore(), network.RandomBzzAddr())
+	defer netStore.Close()
+
+	netStore.SearchTimeoutJitter = 0
+	if got := netStore.searchTimeout(); got != timeouts.SearchTimeout {
+		t.Fatalf("got search timeout %v without jitter, want %v", got, timeouts.SearchTimeout)
+	}
+
+	netStore.SearchTimeoutJitter = 0.5
+	min, max := 50*time.Millisecond, 150*time.Millisecond
+	seen := make(map[time.Duration]struct{})
+	for i := 0; i < 100; i++ {
+		got := netStore.searchTimeout()
+		if got < min || got > max {
+			t.Fatalf("got search timeout %v, want between %v and %v", got, min, max)
+		}
+		seen[got] = struct{}{}
+	}
+	if len(seen) < 2 {
+		t.Fatal("got the same search timeout on every call")
+	}
+
+	// record the instants of the first two remote gets of every chunk
+	var mu sync.Mutex
+	calls := make(map[string][]time.Time)
+	retried := make(chan struct{}, 2)
+	netStore.RemoteGet = func(ctx context.Context, req *Request, localID enode.ID) (*enode.ID, func(), error) {
+		mu.Lock()
+		defer mu.Unlock()
+		ref := req.Addr.Hex()
+		calls[ref] = append(calls[ref], time.Now())
+		if len(calls[ref]) == 2 {
+			retried <- struct{}{}
+		}
+		if len(calls[ref]) > 2 {
+			return nil, nil, ErrNoSuitablePeer
+		}
+		id := enode.ID{byte(len(calls[ref]))}
+		return &id, func() {}, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	for i := 0; i < 2; i++ {
+		go netStore.Get(ctx, chunk.ModeGetRequest, NewRequest(GenerateRandomChunk(chunk.DefaultSize).Address()))
+	}
+	for i := 0; i < 2; i++ {
+		select {
+		case <-retried:
+		case <-ctx.Done():
+			t.Fatal("timeout waiting for fetches to be retried")
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	var intervals []time.Duration
+	for _, c := range calls {
+		interval := c[1].Sub(c[0])
+		if interval < min {
+			t.Fatalf("got retry interval %v, want at least %v", interval, min)
+		}
+		intervals = append(intervals, interval)
+	}
+	if intervals[0] == intervals[1] {
+		t.Fatalf("got identical retry intervals %v", intervals[0])
+	}
+}
+
+// TestNetStoreRemoteGetMulti checks that RemoteFetch requests a chunk from FetchPeers
+// peers using RemoteGetMulti and adds all the requested peers to the peers to skip.
+func TestNetStoreRemoteGetMulti(t *testing.T) {
+	netStore := NewNetStore(NewMapChunkStore(), network.RandomBzzAddr())
+	defer netStore.Close()
+	netStore.FetchPeers = 3
+
+	ch := GenerateRandomChunk(chunk.DefaultSize)
+	var got int
+	netStore.RemoteGetMulti = func(ctx context.Context, req *Request, localID enode.ID, n int) ([]*enode.ID, func(), error) {
+		got = n
+		peers := make([]*enode.ID, n)
+		for i := range peers {
+			peers[i] = &enode.ID{byte(i + 1)}
+		}
+		go netStore.Put(context.Background(), chunk.ModePutRequest, ch)
+		return peers, func() {}, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	req := NewRequest(ch.Address())
+	if _, err := netStore.Get(ctx, chunk.ModeGetRequest, req); err != nil {
+		t.Fatal(err)
+	}
+	if got != 3 {
+		t.Fatalf("got %v peers requested, want 3", got)
+	}
+	for i := 1; i <= 3; i++ {
+		if _, ok := req.PeersToSkip.Load(enode.ID{byte(i)}.String()); !ok {
+			t.Errorf("peer %v not skipped", i)
+		}
+	}
+}
+
+// TestRemoteGetMultiFromSingle checks that a RemoteGetFunc adapted to a RemoteGetMultiFunc
+// requests distinct peers, returns the peers requested before the first error
+// and expires all the requests with a single cleanup.
+func TestRemoteGetMultiFromSingle(t *testing.T) {
+	ids := []enode.ID{{1}, {2}, {3}}
+	var cleanups int
+	remoteGet := func(ctx context.Context, req *Request, localID enode.ID) (*enode.ID, func(), error) {
+		for i := range ids {
+			if _, ok := req.PeersToSkip.Load(ids[i].String()); !ok {
+				return &ids[i], func() { cleanups++ }, nil
+			}
+		}
+		return nil, func() {}, errors.New("no peer found")
+	}
+	remoteGetMulti := remoteGetMultiFromSingle(remoteGet)
+
+	for _, tc := range []struct {
+		n    int
+		want int
+	}{
+		{n: 1, want: 1},
+		{n: 2, want: 2},
+		{n: 5, want: 3},
+	} {
+		cleanups = 0
+		peers, cleanup, err := remoteGetMulti(context.Background(), NewRequest(ids[0][:]), enode.ID{}, tc.n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(peers) != tc.want {
+			t.Fatalf("n %v: got %v peers, want %v", tc.n, len(peers), tc.want)
+		}
+		for i, p := range peers {
+			if *p != ids[i] {
+				t.Errorf("n %v: got peer %v at index %v, want %v", tc.n, p, i, ids[i])
+			}
+		}
+		cleanup()
+		if cleanups != tc.want {
+			t.Errorf("n %v: got %v cleanups, want %v", tc.n, cleanups, tc.want)
+		}
+	}
+
+	req := NewRequest(ids[0][:])
+	for i := range ids {
+		req.PeersToSkip.Store(ids[i].String(), time.Now())
+	}
+	if _, _, err := remoteGetMulti(context.Background(), req, enode.ID{}, 2); err == nil {
+		t.Fatal("expected error when no peer can be requested")
+	}
+}
+
+// TestNetStoreSlowChunkDeliveryThreshold checks that a chunk delivery is considered slow
+// only if the fetcher is older than the configured threshold and that
+// the default threshold is timeouts.FetcherSlowChunkDeliveryThreshold.
+func TestNetStoreSlowChunkDeliveryThreshold(t *testing.T) {
+	netStore := NewNetStore(NewMapChunkStore(), network.RandomBzzAddr())
+	defer netStore.Close()
+
+	if netStore.SlowChunkDeliveryThreshold != timeouts.FetcherSlowChunkDeliveryThreshold {
+		t.Fatalf("got default threshold %v, want %v", netStore.SlowChunkDeliveryThreshold, timeouts.FetcherSlowChunkDeliveryThreshold)
+	}
+	netStore.SlowChunkDeliveryThreshold = time.Minute
+
+	for _, tc := range []struct {
+		age  time.Duration
+		slow bool
+	}{
+		{age: 0, slow: false},
+		{age: 30 * time.Second, slow: false},
+		{age: 2 * time.Minute, slow: true},
+	} {
+		ch := GenerateRandomChunk(chunk.DefaultSize)
+		fi, _, ok := netStore.GetOrCreateFetcher(context.Background(), ch.Address(), "test")
+		if !ok {
+			t.Fatal("expected a fetcher")
+		}
+		// age the fetcher artificially
+		fi.CreatedAt = time.Now().Add(-tc.age)
+
+		if got := netStore.isSlowDelivery(fi); got != tc.slow {
+			t.Errorf("age %v: got slow delivery %v, want %v", tc.age, got, tc.slow)
+		}
+
+		if _, err := netStore.Put(context.Background(), chunk.ModePutRequest, ch); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case <-fi.Delivered:
+		case <-time.After(time.Second):
+			t.Fatalf("age %v: chunk not delivered", tc.age)
+		}
+	}
+}
+
+// TestNetStoreFetcherCreationMetrics checks that fetcher creations are counted
+// by the creating party and that a fetcher requested by both parties is counted once as dual-origin.
+func TestNetStoreFetcherCreationMetrics(t *testing.T) {
+	defer func(enabled bool) { metrics.Enabled = enabled }(metrics.Enabled)
+	metrics.Enabled = true
+
+	netStore := NewNetStore(NewMapChunkStore(), network.RandomBzzAddr())
+	defer netStore.Close()
+
+	// drop counters registered by other tests while metrics were disabled
+	names := []string{"netstore/fetcher/created/request", "netstore/fetcher/created/syncer", "netstore/fetcher/dual-origin"}
+	for _, name := range names {
+		metrics.DefaultRegistry.Unregister(name)
+	}
+	byRequest := metrics.GetOrRegisterCounter(names[0], nil)
+	bySyncer := metrics.GetOrRegisterCounter(names[1], nil)
+	dualOrigin := metrics.GetOrRegisterCounter(names[2], nil)
+
+	ctx := context.Background()
+	requested := GenerateRandomChunk(chunk.DefaultSize).Address()
+	synced := GenerateRandomChunk(chunk.DefaultSize).Address()
+	for _, c := range []struct {
+		ref   Address
+		party string
+	}{
+		{ref: requested, party: "request"},
+		{ref: requested, party: "request"},
+		{ref: requested, party: "syncer"},
+		{ref: requested, party: "syncer"},
+		{ref: synced, party: "syncer"},
+	} {
+		if _, _, ok := netStore.GetOrCreateFetcher(ctx, c.ref, c.party); !ok {
+			t.Fatal("expected a fetcher")
+		}
+	}
+
+	if got := byRequest.Count(); got != 1 {
+		t.Errorf("got %d fetchers created by request, want 1", got)
+	}
+	if got := bySyncer.Count(); got != 1 {
+		t.Errorf("got %d fetchers created by syncer, want 1", got)
+	}
+	if got := dualOrigin.Count(); got != 1 {
+		t.Errorf("got %d dual-origin fetchers, want 1", got)
+	}
+}
+
+// TestNetStoreRemoteFetchDeliveredAfterNoSuitablePeer checks that a remote fetch which runs
+// out of peers still returns the chunk if it is delivered concurrently, e.g. by the syncer.
+func TestNetStoreRemoteFetchDeliveredAfterNoSuitablePeer(t *testing.T) {
+	netStore := NewNetStore(NewMapChunkStore(), network.RandomBzzAddr())
+	defer netStore.Close()
+
+	exhausted := make(chan struct{})
+	var once sync.Once
+	netStore.RemoteGet = func(ctx context.Context, req *Request, localID enode.ID) (*enode.ID, func(), error) {
+		once.Do(func() { close(exhausted) })
+		return nil, nil, errors.New("no peer found")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	ch := GenerateRandomChunk(chunk.DefaultSize)
+	go func() {
+		<-exhausted
+		if _, err := netStore.Put(ctx, chunk.ModePutSync, ch); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	got, err := netStore.Get(ctx, chunk.ModeGetRequest, NewRequest(ch.Address()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got.Data(), ch.Data()) {
+		t.Fatal("got different chunk data")
+	}
+}
+
+// TestNetStoreFetchCoalescingContext checks that a Get waiting for a coalesced
+// fetch returns when its own context is done, while the fetch is still in flight.
+func TestNetStoreFetchCoalescingContext(t *testing.T) {
+	netStore := NewNetStore(NewMapChunkStore(), network.RandomBzzAddr())
+	defer netStore.Close()
+
+	release := make(chan struct{})
+	defer close(release)
+	started := make(chan struct{})
+	go netStore.coalesceFetch(context.Background(), "key", func() (interface{}, error) {
+		close(started)
+		<-release
+		return nil, nil
+	})
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	errc := make(chan error, 1)
+	go func() {
+		_, err := netStore.coalesceFetch(ctx, "key", func() (interface{}, error) {
+			return nil, errors.New("fetch was not coalesced")
+		})
+		errc <- err
+	}()
+
+	select {
+	case err := <-errc:
+		if err != context.DeadlineExceeded {
+			t.Fatalf("got error %v, want %v", err, context.DeadlineExceeded)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("coalesced fetch did not return after its context was done")
+	}
+}
@@ -69,6 +69,9 @@ var (
 const (
 	ChunkProcessors = 8
 	splitTimeout    = time.Minute * 5
+	// minimum number of tree levels kept by the chunker, enough for any
+	// content size with small chunk sizes that have only a few branches
+	minTreeLevels = 64
 )
 
 type PyramidSplitterParams struct {
@@ -170,7 +173,11 @@ func NewPyramidSplitter(params *PyramidSplitterParams, tag *chunk.Tag) (pc *Pyra
 	pc.errC = make(chan error)
 	pc.quitC = make(chan bool)
 	pc.rootAddress = make([]byte, pc.hashSize)
-	pc.chunkLevel = make([][]*TreeEntry, pc.branches)
+	levels := pc.branches
+	if levels < minTreeLevels {
+		levels = minTreeLevels
+	}
+	pc.chunkLevel = make([][]*TreeEntry, levels)
 	return
 }
 
@@ -533,19 +540,21 @@ func (pc *PyramidChunker) buildTree(isAppend bool, ent *TreeEntry, chunkWG *sync
 	pc.enqueueTreeChunk(ent, chunkWG, last)
 
 	compress := false
-	endLvl := pc.branches
-	for lvl := int64(0); lvl < pc.branches; lvl++ {
+	levels := int64(len(pc.chunkLevel))
+	endLvl := levels
+	for lvl := int64(0); lvl < levels; lvl++ {
 		lvlCount := int64(len(pc.chunkLevel[lvl]))
 		if lvlCount >= pc.branches {
 			endLvl = lvl + 1
 			compress = true
 
 			// Move up the chunk level to see if there is any boundary wrapping
-			for uprLvl := endLvl; uprLvl < pc.branches; uprLvl++ {
+			for uprLvl := endLvl; uprLvl < levels; uprLvl++ {
 				uprLvlCount := int64(len(pc.chunkLevel[uprLvl]))
-				if uprLvlCount >= pc.branches-1 {
-					endLvl = endLvl + 1
+				if uprLvlCount < pc.branches-1 {
+					break
 				}
+				endLvl = endLvl + 1
 			}
 
 			break
@@ -555,6 +564,10 @@ func (pc *PyramidChunker) buildTree(isAppend bool, ent *TreeEntry, chunkWG *sync
 	if !compress && !last {
 		return
 	}
+	// the last chunk completes the tree up to the root
+	if last {
+		endLvl = levels
+	}
 
 	// Wait for all the keys to be processed before compressing the tree
 	chunkWG.Wait()
@@ -562,7 +575,7 @@ func (pc *PyramidChunker) buildTree(isAppend bool, ent *TreeEntry, chunkWG *sync
 	for lvl := int64(ent.level); lvl < endLvl; lvl++ {
 
 		lvlCount := int64(len(pc.chunkLevel[lvl]))
-		if lvlCount == 1 && last {
+		if lvlCount == 1 && last && pc.emptyAbove(lvl) {
 			copy(pc.rootAddress, pc.chunkLevel[lvl][0].key)
 			return
 		}
@@ -620,7 +633,7 @@ func (pc *PyramidChunker) buildTree(isAppend bool, ent *TreeEntry, chunkWG *sync
 				}
 				// Lonely chunk key is the key of the last chunk that is only one on the last branch.
 				// In this case, ignore the its tree chunk key and replace it with the lonely chunk key.
-				if lonelyChunkKey != nil {
+				if lonelyChunkKey != nil && lvl == int64(ent.level) {
 					// Overwrite the last tree chunk key with the lonely data chunk key.
 					copy(newEntry.chunk[int64(len(newEntry.chunk))-pc.hashSize:], lonelyChunkKey[:pc.hashSize])
 				}
@@ -641,6 +654,16 @@ func (pc *PyramidChunker) buildTree(isAppend bool, ent *TreeEntry, chunkWG *sync
 
 }
 
+// emptyAbove returns true if there are no tree entries on the levels above lvl
+func (pc *PyramidChunker) emptyAbove(lvl int64) bool {
+	for _, entries := range pc.chunkLevel[lvl+1:] {
+		if len(entries) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
 func (pc *PyramidChunker) enqueueTreeChunk(ent *TreeEntry, chunkWG *sync.WaitGroup, last bool) {
 	if ent != nil && ent.branchCount > 0 {
 
@@ -698,11 +721,13 @@ func (pc *PyramidChunker) depth() (d int) {
 // cleanChunkLevels removes gaps (nil levels) between chunk levels
 // that are not nil.
 func (pc *PyramidChunker) cleanChunkLevels() {
-	for i, l := range pc.chunkLevel {
-		if l == nil {
-			pc.chunkLevel = append(pc.chunkLevel[:i], append(pc.chunkLevel[i+1:], nil)...)
+	levels := make([][]*TreeEntry, 0, len(pc.chunkLevel))
+	for _, l := range pc.chunkLevel {
+		if l != nil {
+			levels = append(levels, l)
 		}
 	}
+	pc.chunkLevel = levels[:len(pc.chunkLevel)]
 }
 
 func (pc *PyramidChunker) quit() {
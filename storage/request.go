@@ -56,3 +56,31 @@ func (r *Request) SkipPeer(nodeID string) bool {
 	}
 	return true
 }
+
+// PeerCandidate is a peer eligible to be requested to deliver a chunk.
+type PeerCandidate struct {
+	ID      enode.ID      // peer node ID
+	Latency time.Duration // average past delivery latency of the peer, zero if not known
+}
+
+// SelectPeerFunc selects the peer to request a chunk from, returning its index in candidates.
+// Candidates are never empty and are ordered by the default preference, closest to the chunk first.
+type SelectPeerFunc func(req *Request, candidates []PeerCandidate) int
+
+// SelectLowestLatencyPeer is a SelectPeerFunc that selects the candidate with the lowest
+// known delivery latency. If the latency of none of the candidates is known, it selects
+// the first candidate, as is done when no SelectPeerFunc is set.
+func SelectLowestLatencyPeer(_ *Request, candidates []PeerCandidate) int {
+	selected := 0
+	var lowest time.Duration
+	for i, c := range candidates {
+		if c.Latency == 0 {
+			continue
+		}
+		if lowest == 0 || c.Latency < lowest {
+			selected = i
+			lowest = c.Latency
+		}
+	}
+	return selected
+}
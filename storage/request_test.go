@@ -0,0 +1,58 @@
+// Copyright 2019 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package storage
+
+import (
+	"testing"
+	"time"
+)
+
+// TestSelectLowestLatencyPeer checks that the candidate with the lowest known latency
+// is selected, and the first candidate if no latencies are known.
+func TestSelectLowestLatencyPeer(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		latencies []time.Duration
+		want      int
+	}{
+		{
+			name:      "no latencies",
+			latencies: []time.Duration{0, 0, 0},
+			want:      0,
+		},
+		{
+			name:      "lowest latency",
+			latencies: []time.Duration{30 * time.Millisecond, 10 * time.Millisecond, 20 * time.Millisecond},
+			want:      1,
+		},
+		{
+			name:      "unknown latencies",
+			latencies: []time.Duration{0, 20 * time.Millisecond, 0, 10 * time.Millisecond},
+			want:      3,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			candidates := make([]PeerCandidate, len(tc.latencies))
+			for i, l := range tc.latencies {
+				candidates[i].Latency = l
+			}
+			if got := SelectLowestLatencyPeer(NewRequest(nil), candidates); got != tc.want {
+				t.Fatalf("got candidate %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
@@ -24,11 +24,22 @@ const (
 	BMTHash     = "BMT"
 	SHA3Hash    = "SHA3" // http://golang.org/pkg/hash/#Hash
 	DefaultHash = BMTHash
+	// RefBMTHash gives the same hashes as BMTHash using the slow reference
+	// implementation of the BMT, meant only for verifying the BMT hasher
+	RefBMTHash = "BMTREF"
 )
 
 type SwarmHash interface {
 	hash.Hash
 	SetSpanBytes([]byte)
+	SumWithSpan(b, span []byte) []byte
+}
+
+// hashErrer is implemented by the SwarmHash hashers that can fail to compute a hash,
+// like the BMT hasher once its tree pool is closed. The result of SumWithSpan is only
+// valid if Err returns nil.
+type hashErrer interface {
+	Err() error
 }
 
 type HashWithLength struct {
@@ -39,3 +50,9 @@ func (h *HashWithLength) SetSpanBytes(length []byte) {
 	h.Reset()
 	h.Write(length)
 }
+
+func (h *HashWithLength) SumWithSpan(b, span []byte) []byte {
+	h.SetSpanBytes(span)
+	h.Write(b)
+	return h.Sum(nil)
+}
@@ -22,6 +22,8 @@ import (
 	"crypto"
 	"crypto/rand"
 	"encoding/binary"
+	"errors"
+	"fmt"
 	"io"
 
 	"github.com/holisticode/swarm/bmt"
@@ -47,6 +49,12 @@ var Proximity = chunk.Proximity
 var ZeroAddr = chunk.ZeroAddr
 
 func MakeHashFunc(hash string) SwarmHasher {
+	return MakeHashFuncForChunkSize(hash, chunk.DefaultSize)
+}
+
+// MakeHashFuncForChunkSize returns the hash function of the given name for chunks
+// with data of at most chunkSize bytes. Only the BMT hash depends on the chunk size.
+func MakeHashFuncForChunkSize(hash string, chunkSize int64) SwarmHasher {
 	switch hash {
 	case "SHA256":
 		return func() SwarmHash { return &HashWithLength{crypto.SHA256.New()} }
@@ -56,10 +64,15 @@ func MakeHashFunc(hash string) SwarmHasher {
 		return func() SwarmHash {
 			hasher := sha3.NewLegacyKeccak256
 			hasherSize := hasher().Size()
-			segmentCount := chunk.DefaultSize / hasherSize
+			segmentCount := int(chunkSize) / hasherSize
 			pool := bmt.NewTreePool(hasher, segmentCount, bmt.PoolSize)
 			return bmt.New(pool)
 		}
+	case RefBMTHash:
+		return func() SwarmHash {
+			hasher := sha3.NewLegacyKeccak256
+			return bmt.NewRef(hasher, int(chunkSize)/hasher().Size())
+		}
 	}
 	return nil
 }
@@ -196,19 +209,40 @@ func NewContentAddressValidator(hasher SwarmHasher) *ContentAddressValidator {
 
 // Validate that the given key is a valid content address for the given data
 func (v *ContentAddressValidator) Validate(ch Chunk) bool {
+	return validateContentAddress(v.Hasher, ch) == nil
+}
+
+var (
+	// ErrInvalidChunkSize is returned by ValidateChunk for chunks
+	// with data shorter than the span or longer than the maximal chunk size.
+	ErrInvalidChunkSize = errors.New("invalid chunk size")
+	// ErrInvalidChunkAddress is returned by ValidateChunk for chunks
+	// with an address that is not the BMT hash of their span and data.
+	ErrInvalidChunkAddress = errors.New("invalid chunk address")
+)
+
+// ValidateChunk recomputes the BMT address of the chunk from its span and data
+// and returns an error if it does not match the chunk address.
+func ValidateChunk(ch Chunk) error {
+	return validateContentAddress(MakeHashFunc(DefaultHash), ch)
+}
+
+// validateContentAddress checks that the chunk address is the hash of its span and data
+// computed with the provided hasher.
+func validateContentAddress(hasher SwarmHasher, ch Chunk) error {
 	data := ch.Data()
 	if l := len(data); l < 9 || l > chunk.DefaultSize+8 {
-		// log.Error("invalid chunk size", "chunk", addr.Hex(), "size", l)
-		return false
+		return fmt.Errorf("%w: chunk %s, size %d", ErrInvalidChunkSize, ch.Address().Hex(), l)
 	}
 
-	hasher := v.Hasher()
-	hasher.Reset()
-	hasher.SetSpanBytes(data[:8])
-	hasher.Write(data[8:])
-	hash := hasher.Sum(nil)
-
-	return bytes.Equal(hash, ch.Address())
+	h := hasher()
+	h.Reset()
+	h.SetSpanBytes(data[:8])
+	h.Write(data[8:])
+	if !bytes.Equal(h.Sum(nil), ch.Address()) {
+		return fmt.Errorf("%w: %s", ErrInvalidChunkAddress, ch.Address().Hex())
+	}
+	return nil
 }
 
 type ChunkStore = chunk.Store
@@ -0,0 +1,46 @@
+// Copyright 2019 The Swarm Authors
+// This file is part of the Swarm library.
+//
+// The Swarm library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The Swarm library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the Swarm library. If not, see <http://www.gnu.org/licenses/>.
+
+package storage
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/holisticode/swarm/chunk"
+)
+
+// TestValidateChunk checks that ValidateChunk accepts a valid chunk
+// and rejects chunks with tampered data or invalid size.
+func TestValidateChunk(t *testing.T) {
+	ch := GenerateRandomChunk(chunk.DefaultSize)
+	if err := ValidateChunk(ch); err != nil {
+		t.Fatalf("valid chunk: %v", err)
+	}
+
+	data := make([]byte, len(ch.Data()))
+	copy(data, ch.Data())
+	data[len(data)-1] ^= 0xff
+	tampered := NewChunk(ch.Address(), data)
+	if err := ValidateChunk(tampered); !errors.Is(err, ErrInvalidChunkAddress) {
+		t.Fatalf("tampered chunk: got error %v, want %v", err, ErrInvalidChunkAddress)
+	}
+
+	short := NewChunk(ch.Address(), ch.Data()[:8])
+	if err := ValidateChunk(short); !errors.Is(err, ErrInvalidChunkSize) {
+		t.Fatalf("short chunk: got error %v, want %v", err, ErrInvalidChunkSize)
+	}
+}
@@ -27,6 +27,7 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 	"unicode"
 
@@ -184,14 +185,26 @@ func NewSwarm(config *api.Config, mockStore *mock.NodeStore) (self *Swarm, err e
 		resolver = api.NewMultiResolver(opts...)
 		self.dns = resolver
 	}
-	if config.RnsAPI != "" {
-		var contractAddress string
-		_, endpoint, addr := parseResolverAPIAddress(config.RnsAPI)
-		if !bytes.Equal(addr.Bytes(), common.Address{}.Bytes()) {
-			contractAddress = addr.String()
+	if len(config.RnsAPIs) > 0 {
+		resolvers := []api.Resolver{}
+		for _, c := range config.RnsAPIs {
+			resolvers = append(resolvers, newRnsResolver(c))
+		}
+		self.rns = api.NewFallbackResolver(resolvers...)
+	}
+	if config.ResolverCacheTTL > 0 {
+		if self.dns != nil {
+			self.dns, err = api.NewCachingResolver(self.dns, config.ResolverCacheSize, config.ResolverCacheTTL)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if self.rns != nil {
+			self.rns, err = api.NewCachingResolver(self.rns, config.ResolverCacheSize, config.ResolverCacheTTL)
+			if err != nil {
+				return nil, err
+			}
 		}
-		rnsconfig.SetConfiguration(endpoint, contractAddress)
-		self.rns = api.ResolverFunc(rnsresolver.ResolveDomainContent)
 	}
 
 	// check that we are not in the old database schema
@@ -228,6 +241,7 @@ func NewSwarm(config *api.Config, mockStore *mock.NodeStore) (self *Swarm, err e
 		Capacity:     config.DbCapacity,
 		Tags:         self.tags,
 		PutToGCCheck: to.IsWithinDepth,
+		DataPaths:    config.ChunkDataPaths,
 	})
 	if err != nil {
 		return nil, err
@@ -238,7 +252,12 @@ func NewSwarm(config *api.Config, mockStore *mock.NodeStore) (self *Swarm, err e
 		feedsHandler,
 	)
 
-	self.netStore = storage.NewNetStore(lstore, bzzconfig.Address)
+	self.netStore, err = storage.NewNetStoreWithCapacity(lstore, bzzconfig.Address, config.FetchersCapacity)
+	if err != nil {
+		return nil, err
+	}
+	// feed updates are exempted from the content address check if chunk verification is enabled
+	self.netStore.NonContentAddressedValidators = []chunk.Validator{feedsHandler}
 	self.retrieval = retrieval.New(to, self.netStore, bzzconfig.Address, self.swap)
 	self.netStore.RemoteGet = self.retrieval.RequestFromPeers
 
@@ -251,13 +270,24 @@ func NewSwarm(config *api.Config, mockStore *mock.NodeStore) (self *Swarm, err e
 
 	syncProvider := stream.NewSyncProvider(self.netStore, to, bzzconfig.Address, syncing, false)
 	self.streamer = stream.New(self.stateStore, bzzconfig.Address, syncProvider)
+	self.streamer.SetDisabledProviders(config.DisabledStreamProviders)
+	self.streamer.SetDeliveryAckTimeout(config.DeliveryAckTimeout)
+	if err := self.streamer.EnableDeliveryAcks(to.Capabilities); err != nil {
+		return nil, err
+	}
+	if err := self.streamer.EnableStreamStates(to.Capabilities); err != nil {
+		return nil, err
+	}
+	if err := self.streamer.EnableChunkProofs(to.Capabilities, localStore); err != nil {
+		return nil, err
+	}
 
 	// Swarm Hash Merklised Chunking for Arbitrary-length Document/File storage
 	lnetStore := storage.NewLNetStore(self.netStore)
 	self.fileStore = storage.NewFileStore(lnetStore, localStore, self.config.FileStoreParams, self.tags)
 
 	log.Debug("Setup local storage")
-	self.bzz = network.NewBzz(bzzconfig, to, self.stateStore, stream.Spec, self.retrieval.Spec(), self.streamer.Run, self.retrieval.Run)
+	self.bzz = network.NewBzz(bzzconfig, to, self.stateStore, self.streamer.Spec(), self.retrieval.Spec(), self.streamer.Run, self.retrieval.Run)
 	self.bzzEth = bzzeth.New(self.netStore, to)
 
 	// Pss = postal service over swarm (devp2p over bzz)
@@ -315,6 +345,27 @@ func parseResolverAPIAddress(s string) (tld, endpoint string, addr common.Addres
 	return
 }
 
+// rnsMu serializes RNS resolutions, as the RNS library
+// keeps the endpoint and contract address in a global configuration
+var rnsMu sync.Mutex
+
+// newRnsResolver creates a resolver for a RNS API in the format
+// [contract-addr@]url, which sets the RNS configuration
+// to its endpoint before each resolution
+func newRnsResolver(rnsAPI string) api.Resolver {
+	var contractAddress string
+	_, endpoint, addr := parseResolverAPIAddress(rnsAPI)
+	if !bytes.Equal(addr.Bytes(), common.Address{}.Bytes()) {
+		contractAddress = addr.String()
+	}
+	return api.ResolverFunc(func(domain string) (common.Hash, error) {
+		rnsMu.Lock()
+		defer rnsMu.Unlock()
+		rnsconfig.SetConfiguration(endpoint, contractAddress)
+		return rnsresolver.ResolveDomainContent(domain)
+	})
+}
+
 // ensClient provides functionality for api.ResolveValidator
 type ensClient struct {
 	*ens.ENS